@@ -3,6 +3,8 @@ package app
 import (
 	"fmt"
 	"net/http"
+
+	"nathejk.dk/pkg/correlation"
 )
 
 // The logError() method is a generic helper for logging an error message.
@@ -10,6 +12,8 @@ func (app *JsonApi) logError(r *http.Request, err error) {
 	app.Logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
+		"request_id":     correlation.CausationID(r.Context()),
+		"correlation_id": correlation.CorrelationID(r.Context()),
 	})
 }
 
@@ -49,10 +53,31 @@ func (app *JsonApi) EditConflictResponse(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// ConflictResponse is sent when a request conflicts with the current state
+// of the resource, e.g. a change to a team that is no longer allowed.
+func (app *JsonApi) ConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+func (app *JsonApi) PreconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request must have an If-Match header with the ETag of the resource"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
+func (app *JsonApi) PreconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been changed since it was read, please reload and try again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
 func (app *JsonApi) BadRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+func (app *JsonApi) RateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *JsonApi) InvalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -1,18 +0,0 @@
-package app
-
-import (
-	"net/http"
-)
-
-func (app *JsonApi) HealthcheckHandler(w http.ResponseWriter, r *http.Request) {
-	env := Envelope{
-		"status": "available",
-		"system_info": map[string]string{
-			"version": version,
-		},
-	}
-	err := app.WriteJSON(w, http.StatusOK, env, nil)
-	if err != nil {
-		app.ServerErrorResponse(w, r, err)
-	}
-}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"nathejk.dk/internal/validator"
+	"nathejk.dk/pkg/correlation"
 )
 
 // Retrieve the "id" URL parameter from the current request context, then convert it to
@@ -28,6 +30,30 @@ func (app *JsonApi) ReadNamedParam(r *http.Request, param string) string {
 	return httprouter.ParamsFromContext(r.Context()).ByName(param)
 }
 
+// ETag returns the entity tag of a resource at the given version.
+func ETag(version uint64) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(version, 10))
+}
+
+// IfMatchVersion returns the version in the If-Match header of the request,
+// see ETag. ok is false when the request has no If-Match header, and err is
+// set when the header is not the entity tag of a version.
+func (app *JsonApi) IfMatchVersion(r *http.Request) (version uint64, ok bool, err error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, false, nil
+	}
+	tag, err := strconv.Unquote(strings.TrimPrefix(strings.TrimSpace(header), "W/"))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid If-Match header %q", header)
+	}
+	version, err = strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid If-Match header %q", header)
+	}
+	return version, true, nil
+}
+
 // Define an envelope type.
 type Envelope map[string]any
 
@@ -187,8 +213,11 @@ func (app *JsonApi) ReadInt(qs url.Values, key string, defaultValue int, v valid
 	return i
 }
 
-// The background() helper accepts an arbitrary function as a parameter.
-func (app *JsonApi) Background(fn func()) {
+// The background() helper accepts an arbitrary function as a parameter. The
+// function is passed a context detached from ctx, carrying its correlation IDs
+// but not its cancellation, as the request is usually done before fn is.
+func (app *JsonApi) Background(ctx context.Context, fn func(context.Context)) {
+	ctx = correlation.Detach(ctx)
 	app.wg.Add(1)
 
 	go func() {
@@ -197,10 +226,12 @@ func (app *JsonApi) Background(fn func()) {
 		// Recover any panic.
 		defer func() {
 			if err := recover(); err != nil {
-				app.Logger.PrintError(fmt.Errorf("%s", err), nil)
+				app.Logger.PrintError(fmt.Errorf("%s", err), map[string]string{
+					"correlation_id": correlation.CorrelationID(ctx),
+				})
 			}
 		}()
 
-		fn()
+		fn(ctx)
 	}()
 }
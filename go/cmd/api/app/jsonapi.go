@@ -30,7 +30,8 @@ type UserRepository interface {
 }
 
 type JsonApi struct {
-	Logger *jsonlog.Logger
-	wg     sync.WaitGroup
-	User   UserRepository
+	Logger    *jsonlog.Logger
+	wg        sync.WaitGroup
+	User      UserRepository
+	readiness readiness
 }
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts the attempts made per key, e.g. per team, allowing at most
+// max attempts in a window starting at the first of them.
+type Limiter struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*attempts
+	nextSweep time.Time
+}
+
+type attempts struct {
+	count int
+	until time.Time
+}
+
+func NewLimiter(max int, window time.Duration) *Limiter {
+	return &Limiter{max: max, window: window, attempts: map[string]*attempts{}}
+}
+
+// Allow counts an attempt for key and reports whether it is within the
+// limit.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	// The windows that have passed are forgotten now and then, so the map
+	// does not grow with every key ever tried.
+	if now.After(l.nextSweep) {
+		for k, a := range l.attempts {
+			if now.After(a.until) {
+				delete(l.attempts, k)
+			}
+		}
+		l.nextSweep = now.Add(l.window)
+	}
+	a, ok := l.attempts[key]
+	if !ok || now.After(a.until) {
+		a = &attempts{until: now.Add(l.window)}
+		l.attempts[key] = a
+	}
+	a.count++
+	return a.count <= l.max
+}
+
+// Reset forgets the attempts for key, e.g. once a pincode is entered
+// correctly.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
@@ -1,10 +1,17 @@
 package app
 
 import (
+	"crypto/subtle"
 	"expvar"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"nathejk.dk/pkg/correlation"
+	"nathejk.dk/pkg/metrics"
 )
 
 type metricsResponseWriter struct {
@@ -36,13 +43,18 @@ func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.wrapped
 }
+
+// The request metrics are shared by every handler wrapped by Metrics, as
+// expvar and metrics names can only be registered once.
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+	requestDuration                 = metrics.Must(metrics.NewHistogramVec("http_request_duration_seconds", "HTTP request latency by route.", nil, "method", "route", "status"))
+)
+
 func (app *JsonApi) Metrics(next http.Handler) http.Handler {
-	var (
-		totalRequestsReceived           = expvar.NewInt("total_requests_received")
-		totalResponsesSent              = expvar.NewInt("total_responses_sent")
-		totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
-		totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
-	)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		totalRequestsReceived.Add(1)
@@ -63,7 +75,93 @@ func (app *JsonApi) Metrics(next http.Handler) http.Handler {
 		// our new totalResponsesSentByStatus map to increment the count for the
 		// given status code by 1.
 		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
-		duration := time.Since(start).Microseconds()
-		totalProcessingTimeMicroseconds.Add(duration)
+		duration := time.Since(start)
+		totalProcessingTimeMicroseconds.Add(duration.Microseconds())
+		requestDuration.With(r.Method, routeLabel(next, r), strconv.Itoa(mw.statusCode)).Observe(duration.Seconds())
+	})
+}
+
+// routeLabel returns the route pattern matching r, e.g. "/api/klan/:id", so
+// requests are not labelled by their IDs. Requests not handled by a
+// httprouter, or not matching any route, are labelled "other".
+func routeLabel(next http.Handler, r *http.Request) string {
+	router, ok := next.(*httprouter.Router)
+	if !ok {
+		return "other"
+	}
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return "other"
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	i := 0
+	for j, segment := range segments {
+		if i < len(params) && segment == params[i].Value {
+			segments[j] = ":" + params[i].Key
+			i++
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// RequestID seeds the request context with a correlation ID. The ID is taken
+// from the X-Correlation-ID header when present, so calls across services
+// share it, otherwise the request ID is used. The request ID itself becomes
+// the causation ID of every message published while handling the request.
+// IDs from the client that are not correlation.ValidID are replaced by new
+// ones.
+func (app *JsonApi) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !correlation.ValidID(requestID) {
+			requestID = correlation.NewID("request")
+		}
+		correlationID := r.Header.Get("X-Correlation-ID")
+		if !correlation.ValidID(correlationID) {
+			correlationID = requestID
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		w.Header().Set("X-Correlation-ID", correlationID)
+
+		ctx := correlation.NewContext(r.Context(), correlationID, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// LogRequests logs each request with its status, duration and IDs. It must
+// be wrapped by RequestID. Probes and metrics scrapes are not logged.
+func (app *JsonApi) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/livez", "/readyz", "/metrics":
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		mw := newMetricsResponseWriter(w)
+		next.ServeHTTP(mw, r)
+		app.Logger.PrintInfo("request", map[string]string{
+			"request_method": r.Method,
+			"request_url":    r.URL.String(),
+			"status":         strconv.Itoa(mw.statusCode),
+			"duration":       time.Since(start).String(),
+			"request_id":     correlation.CausationID(r.Context()),
+			"correlation_id": correlation.CorrelationID(r.Context()),
+		})
+	})
+}
+
+// RequireBearerToken only passes requests with an "Authorization: Bearer
+// <token>" header on to next. When token is empty all requests are refused.
+func (app *JsonApi) RequireBearerToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			app.InvalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
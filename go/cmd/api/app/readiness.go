@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A ReadinessCheck reports whether a dependency of the service is ready. It
+// should return promptly once ctx is done.
+type ReadinessCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// dependencyCheck is a check of an external service, run in the background
+// with its last result kept.
+type dependencyCheck struct {
+	name string
+
+	mu  sync.Mutex
+	err error
+	ran bool
+}
+
+func (c *dependencyCheck) result() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case !c.ran:
+		return "pending"
+	case c.err != nil:
+		return c.err.Error()
+	}
+	return "ok"
+}
+
+type readiness struct {
+	mu           sync.Mutex
+	checks       []namedCheck
+	dependencies []*dependencyCheck
+}
+
+// checkTimeout bounds the time spent on each readiness check.
+const checkTimeout = 2 * time.Second
+
+// AddReadinessCheck registers a check reported by the ReadyzHandler.
+func (app *JsonApi) AddReadinessCheck(name string, check ReadinessCheck) {
+	app.readiness.mu.Lock()
+	defer app.readiness.mu.Unlock()
+
+	app.readiness.checks = append(app.readiness.checks, namedCheck{name, check})
+}
+
+// AddDependencyCheck registers a check of an external service, such as the
+// mail or SMS provider. It runs every interval in the background, and the
+// ReadyzHandler reports its last result without running it. The service
+// stays ready when it fails: an outage of a provider should not take every
+// instance out of the load balancer.
+func (app *JsonApi) AddDependencyCheck(name string, interval time.Duration, check ReadinessCheck) {
+	c := &dependencyCheck{name: name}
+	app.readiness.mu.Lock()
+	app.readiness.dependencies = append(app.readiness.dependencies, c)
+	app.readiness.mu.Unlock()
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			err := check(ctx)
+			cancel()
+
+			c.mu.Lock()
+			c.err, c.ran = err, true
+			c.mu.Unlock()
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// dependencyResults returns the last result of each dependency check.
+func (app *JsonApi) dependencyResults() map[string]string {
+	app.readiness.mu.Lock()
+	dependencies := append([]*dependencyCheck(nil), app.readiness.dependencies...)
+	app.readiness.mu.Unlock()
+
+	results := make(map[string]string, len(dependencies))
+	for _, c := range dependencies {
+		results[c.name] = c.result()
+	}
+	return results
+}
+
+// runReadinessChecks runs all checks concurrently and returns the result of
+// each check, "ok" or the error message, and whether all checks passed.
+func (app *JsonApi) runReadinessChecks(ctx context.Context) (map[string]string, bool) {
+	app.readiness.mu.Lock()
+	checks := append([]namedCheck(nil), app.readiness.checks...)
+	app.readiness.mu.Unlock()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			results[i] = c.check(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := make(map[string]string, len(checks))
+	ready := true
+	for i, c := range checks {
+		if results[i] != nil {
+			status[c.name] = results[i].Error()
+			ready = false
+			continue
+		}
+		status[c.name] = "ok"
+	}
+	return status, ready
+}
+
+// LivezHandler answers as long as the process is able to serve requests. It
+// does not depend on anything else, so orchestrators only restart the
+// service when it is truly stuck.
+func (app *JsonApi) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	env := Envelope{
+		"status": "alive",
+		"system_info": map[string]string{
+			"version": version,
+		},
+	}
+	err := app.WriteJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ReadyzHandler runs the registered readiness checks and answers 503 Service
+// Unavailable unless all of them pass. The last results of the dependency
+// checks are reported alongside.
+func (app *JsonApi) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks, ready := app.runReadinessChecks(r.Context())
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	env := Envelope{
+		"status":       status,
+		"checks":       checks,
+		"dependencies": app.dependencyResults(),
+		"system_info": map[string]string{
+			"version": version,
+		},
+	}
+	err := app.WriteJSON(w, code, env, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ServiceUnavailableResponse tells the client to retry after the given
+// number of seconds.
+func (app *JsonApi) ServiceUnavailableResponse(w http.ResponseWriter, r *http.Request, retryAfter int) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	message := "the service is starting up, please try again shortly"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+// RequireCaughtUp answers 503 Service Unavailable until caughtUp reports
+// true, so clients don't read stale projections while the service starts.
+func (app *JsonApi) RequireCaughtUp(caughtUp func() bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !caughtUp() {
+			app.ServiceUnavailableResponse(w, r, 5)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
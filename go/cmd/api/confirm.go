@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nathejk/shared-go/types"
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	nathejktypes "nathejk.dk/nathejk/types"
+)
+
+// confirmationMailTemplate is the slug of the template of the confirmation
+// mail.
+const confirmationMailTemplate = "verify_email"
+
+// A team may have the confirmation mail resent confirmationResends times
+// within confirmationResendWindow.
+const (
+	confirmationResends      = 3
+	confirmationResendWindow = time.Hour
+)
+
+// confirmationMailData is the data the confirmation mail with secret is sent
+// with.
+func confirmationMailData(secret string) map[string]any {
+	return map[string]any{"secret": secret, "days": confirmationDays()}
+}
+
+// sendConfirmationMail asks the outbox to send a mail with a new
+// confirmation link to the pending e-mail address of a team. The secret of
+// the link is kept by the confirm table once the outbox has sent the mail,
+// as the table only knows the secret of the last mail sent.
+func (app *application) sendConfirmationMail(ctx context.Context, teamID types.TeamID, email types.EmailAddress) error {
+	secret := uuid.New().String()
+	return app.requestMail(ctx, &nathejk.NathejkMailRequested{
+		PingType:  nathejktypes.PingType(types.PingTypeSignup),
+		TeamID:    nathejktypes.TeamID(teamID),
+		Recipient: nathejktypes.Email(email),
+		Subject:   "Bekræft e-mailadresse",
+		Template:  confirmationMailTemplate + ".tmpl",
+		Data:      confirmationMailData(secret),
+		Secret:    secret,
+	})
+}
+
+// confirmSignupHandler confirms the e-mail address of a team when the
+// contact follows the link of the confirmation mail, and sends the pincode
+// to the pending phone number. A link that is unknown, used or expired
+// shows a page telling so.
+func (app *application) confirmSignupHandler(w http.ResponseWriter, r *http.Request) {
+	secret := app.ReadNamedParam(r, "id")
+	confirm, err := app.models.Signup.GetConfirmation(secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.confirmPageResponse(w, r, http.StatusNotFound, confirmPage{Page: "unknown"})
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if confirm.ConfirmedAt != nil {
+		app.confirmPageResponse(w, r, http.StatusConflict, confirmPage{Page: "used", TeamID: confirm.TeamID})
+		return
+	}
+	if confirm.Expired(time.Now()) {
+		app.confirmPageResponse(w, r, http.StatusGone, confirmPage{Page: "expired", Secret: secret, Email: confirm.EmailPending})
+		return
+	}
+	if _, err := app.commands.Team.ConfirmEmail(r.Context(), confirm.TeamID, confirm.EmailPending); err != nil {
+		switch {
+		case errors.Is(err, aggregate.ErrEmailConfirmed):
+			app.confirmPageResponse(w, r, http.StatusConflict, confirmPage{Page: "used", TeamID: confirm.TeamID})
+		case errors.Is(err, aggregate.ErrTeamNotFound), errors.Is(err, aggregate.ErrTeamOut):
+			app.confirmPageResponse(w, r, http.StatusNotFound, confirmPage{Page: "unknown"})
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	team, err := app.models.Signup.GetByID(confirm.TeamID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.requestSms(r.Context(), &nathejk.NathejkSmsRequested{
+		PingType: nathejktypes.PingType(types.PingTypeValidate),
+		TeamID:   nathejktypes.TeamID(confirm.TeamID),
+		Phone:    nathejktypes.PhoneNumber(team.PhonePending),
+		Text:     "Din aktiveringskode til Nathejktilmeldingen er: " + team.Pincode,
+	})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/indskrivning/%s", confirm.TeamID), http.StatusSeeOther)
+}
+
+// resendExpiredConfirmationHandler sends a new confirmation mail from the
+// page shown for an expired link.
+func (app *application) resendExpiredConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	confirm, err := app.models.Signup.GetConfirmation(app.ReadNamedParam(r, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.confirmPageResponse(w, r, http.StatusNotFound, confirmPage{Page: "unknown"})
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if confirm.ConfirmedAt != nil {
+		app.confirmPageResponse(w, r, http.StatusConflict, confirmPage{Page: "used", TeamID: confirm.TeamID})
+		return
+	}
+	team, err := app.models.Signup.GetByID(confirm.TeamID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	if !app.resends.Allow(string(team.TeamID)) {
+		app.confirmPageResponse(w, r, http.StatusTooManyRequests, confirmPage{Page: "limited", Email: team.EmailPending})
+		return
+	}
+	if err := app.sendConfirmationMail(r.Context(), team.TeamID, team.EmailPending); err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	app.confirmPageResponse(w, r, http.StatusOK, confirmPage{Page: "resent", Email: team.EmailPending})
+}
+
+// resendConfirmationHandler sends a new confirmation mail to the pending
+// e-mail address of a team that has not confirmed it.
+func (app *application) resendConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TeamID types.TeamID `json:"teamId"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	team, err := app.models.Signup.GetByID(input.TeamID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if team.Email != nil && *team.Email == team.EmailPending {
+		app.ConflictResponse(w, r, aggregate.ErrEmailConfirmed)
+		return
+	}
+	if !app.resends.Allow(string(team.TeamID)) {
+		app.RateLimitExceededResponse(w, r)
+		return
+	}
+	if err := app.sendConfirmationMail(r.Context(), team.TeamID, team.EmailPending); err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"teamId": team.TeamID}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// confirmPage is the page shown when a confirmation link cannot be used, or
+// a new confirmation mail has been sent.
+type confirmPage struct {
+	// Page is one of unknown, used, expired, resent and limited.
+	Page   string
+	TeamID types.TeamID
+	Secret string
+	Email  types.EmailAddress
+	Days   int
+}
+
+var confirmPageTemplate = template.Must(template.New("confirm").Parse(`<!doctype html>
+<html lang="da">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width">
+    <title>Nathejk tilmelding</title>
+</head>
+<body>
+{{if eq .Page "expired"}}
+    <h1>Linket er udløbet</h1>
+    <p>Linket i mailen kan kun bruges i {{.Days}} dage. Tryk på knappen, så sender vi en ny mail til {{.Email}}.</p>
+    <form method="post" action="/confirm/{{.Secret}}/resend"><button type="submit">Send ny mail</button></form>
+{{else if eq .Page "resent"}}
+    <h1>Ny mail sendt</h1>
+    <p>Vi har sendt en ny mail til {{.Email}}. Linket i den kan bruges i {{.Days}} dage.</p>
+{{else if eq .Page "limited"}}
+    <h1>For mange nye mails</h1>
+    <p>Vi har sendt flere mails til {{.Email}} for nylig. Se efter i din indbakke og spamfilter, eller prøv igen senere.</p>
+{{else if eq .Page "used"}}
+    <h1>Linket er allerede brugt</h1>
+    <p>Din e-mailadresse er bekræftet. <a href="/indskrivning/{{.TeamID}}">Fortsæt tilmeldingen</a>.</p>
+{{else}}
+    <h1>Linket virker ikke</h1>
+    <p>Linket er ikke gyldigt. Er der sendt flere mails, så brug linket i den seneste.</p>
+{{end}}
+    <p>Vi ses i mørket...<br>Nathejk</p>
+</body>
+</html>
+`))
+
+// confirmationDays is the number of days a confirmation link can be used.
+func confirmationDays() int {
+	return int(data.ConfirmationTTL / (24 * time.Hour))
+}
+
+func (app *application) confirmPageResponse(w http.ResponseWriter, r *http.Request, status int, page confirmPage) {
+	page.Days = confirmationDays()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := confirmPageTemplate.Execute(w, page); err != nil {
+		log.Printf("confirm page %q", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+)
+
+// confirmModel is a signupModel also knowing the confirmation mails sent.
+type confirmModel struct {
+	signupModel
+	confirmations map[string]*data.Confirmation
+}
+
+func (m confirmModel) GetConfirmation(secret string) (*data.Confirmation, error) {
+	if c, ok := m.confirmations[secret]; ok {
+		return c, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func TestConfirmSignupHandler(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		confirmation *data.Confirmation
+		status       int
+		page         string
+	}{
+		"unknown link": {
+			status: http.StatusNotFound,
+			page:   "Linket virker ikke",
+		},
+		"used link": {
+			confirmation: &data.Confirmation{TeamID: "team-1", EmailPending: "anna@example.com", SentAt: now.Add(-time.Hour), ConfirmedAt: &now},
+			status:       http.StatusConflict,
+			page:         `href="/indskrivning/team-1"`,
+		},
+		"expired link": {
+			confirmation: &data.Confirmation{TeamID: "team-1", EmailPending: "anna@example.com", SentAt: now.Add(-data.ConfirmationTTL - time.Hour)},
+			status:       http.StatusGone,
+			page:         `action="/confirm/secret-1/resend"`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			m := confirmModel{confirmations: map[string]*data.Confirmation{}}
+			if tt.confirmation != nil {
+				m.confirmations["secret-1"] = tt.confirmation
+			}
+			a.models.Signup = m
+
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/confirm/secret-1", nil))
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), tt.page)
+		})
+	}
+}
+
+func TestConfirmSignupHandlerConfirms(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTeamTestApp(t)
+	a.models.Signup = confirmModel{
+		signupModel: signupModel{"team-1": {TeamID: "team-1", PhonePending: "12345678", Pincode: "1234"}},
+		confirmations: map[string]*data.Confirmation{
+			"secret-1": {TeamID: "team-1", EmailPending: "anna@example.com", SentAt: time.Now()},
+		},
+	}
+	h := a.routes()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/confirm/secret-1", nil))
+	assert.Equal(http.StatusSeeOther, w.Code, w.Body.String())
+	assert.Equal("/indskrivning/team-1", w.Header().Get("Location"))
+	assert.Equal(map[string]string{"12345678": "Din aktiveringskode til Nathejktilmeldingen er: 1234"}, smsRequested(t, a))
+
+	team, err := a.teams.LoadTeam("team-1")
+	assert.NoError(err)
+	assert.Equal(types.EmailAddress("anna@example.com"), team.Email)
+
+	// The link is used, also before the read model has seen it.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/confirm/secret-1", nil))
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Contains(w.Body.String(), "Linket er allerede brugt")
+}
+
+func TestResendConfirmationHandler(t *testing.T) {
+	confirmed := types.EmailAddress("anna@example.com")
+	tests := map[string]struct {
+		signup     *data.Signup
+		status     int
+		recipients []string
+	}{
+		"unknown team": {
+			status: http.StatusNotFound,
+		},
+		"confirmed": {
+			signup: &data.Signup{TeamID: "team-1", TeamType: types.TeamTypePatrulje, EmailPending: "anna@example.com", Email: &confirmed},
+			status: http.StatusConflict,
+		},
+		"not confirmed": {
+			signup:     &data.Signup{TeamID: "team-1", TeamType: types.TeamTypePatrulje, EmailPending: "anna@example.org", Email: &confirmed},
+			status:     http.StatusAccepted,
+			recipients: []string{"anna@example.org"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			signups := signupModel{}
+			if tt.signup != nil {
+				signups[tt.signup.TeamID] = tt.signup
+			}
+			a.models.Signup = signups
+
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/signup/resend", strings.NewReader(`{"teamId":"team-1"}`)))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.recipients, mailRequested(t, a))
+		})
+	}
+}
+
+func TestResendExpiredConfirmationHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTeamTestApp(t)
+	a.models.Signup = confirmModel{
+		signupModel: signupModel{"team-1": {TeamID: "team-1", TeamType: types.TeamTypePatrulje, EmailPending: "anna@example.com"}},
+		confirmations: map[string]*data.Confirmation{
+			"secret-1": {TeamID: "team-1", EmailPending: "anna@example.com", SentAt: time.Now().Add(-data.ConfirmationTTL - time.Hour)},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	a.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/confirm/secret-1/resend", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "Vi har sendt en ny mail til anna@example.com")
+	assert.Equal([]string{"anna@example.com"}, mailRequested(t, a))
+}
+
+func TestResendConfirmationHandlerLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTeamTestApp(t)
+	a.models.Signup = confirmModel{
+		signupModel: signupModel{"team-1": {TeamID: "team-1", TeamType: types.TeamTypePatrulje, EmailPending: "anna@example.com"}},
+		confirmations: map[string]*data.Confirmation{
+			"secret-1": {TeamID: "team-1", EmailPending: "anna@example.com", SentAt: time.Now().Add(-data.ConfirmationTTL - time.Hour)},
+		},
+	}
+	h := a.routes()
+
+	// Both ways of resending the mail count against the limit of the team.
+	for i := 0; i < confirmationResends; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/signup/resend", strings.NewReader(`{"teamId":"team-1"}`)))
+		assert.Equal(http.StatusAccepted, w.Code, w.Body.String())
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/signup/resend", strings.NewReader(`{"teamId":"team-1"}`)))
+	assert.Equal(http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/confirm/secret-1/resend", nil))
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Contains(w.Body.String(), "For mange nye mails")
+	assert.Len(mailRequested(t, a), confirmationResends)
+}
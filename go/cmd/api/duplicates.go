@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nathejk/shared-go/types"
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/nathejk/commands"
+)
+
+// teamDuplicates returns the suspected duplicates of the members of a team,
+// shown on the team page. They are left out if they cannot be found.
+func (app *application) teamDuplicates(teamID types.TeamID) []*data.Duplicate {
+	duplicates, err := app.models.Members.GetDuplicates(data.Filters{Year: app.config.year, TeamID: teamID})
+	if err != nil {
+		log.Printf("GetDuplicates %q", err)
+		return []*data.Duplicate{}
+	}
+	return duplicates
+}
+
+// listDuplicatesHandler is the report of the suspected duplicates of the
+// year.
+func (app *application) listDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	duplicates, err := app.models.Members.GetDuplicates(data.Filters{Year: app.config.year})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"duplicates": duplicates}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// resolveDuplicateHandler deletes a duplicate member or merges it into the
+// member kept. Once the read model has seen the change it answers with the
+// remaining duplicates, otherwise 202.
+func (app *application) resolveDuplicateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MemberID     types.MemberID      `json:"memberId"`
+		KeepMemberID types.MemberID      `json:"keepMemberId"`
+		Resolution   commands.Resolution `json:"resolution"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	seq, err := app.commands.Team.ResolveDuplicate(r.Context(), input.MemberID, input.KeepMemberID, input.Resolution)
+	if err != nil {
+		log.Printf("ResolveDuplicate %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	if !app.applied(r.Context(), seq) {
+		if err := app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"memberId": input.MemberID}, nil); err != nil {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.listDuplicatesHandler(w, r)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	"nathejk.dk/superfluids/jetstream"
+)
+
+// commandErrorResponse maps the domain errors returned by the commands to
+// HTTP responses.
+func (app *application) commandErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *commands.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		app.FailedValidationResponse(w, r, verr.Errors)
+	case errors.Is(err, aggregate.ErrTeamNotFound):
+		app.NotFoundResponse(w, r)
+	case errors.Is(err, aggregate.ErrMemberNotFound):
+		app.FailedValidationResponse(w, r, map[string]string{"members": err.Error()})
+	case errors.Is(err, aggregate.ErrNumberOutOfRange):
+		app.FailedValidationResponse(w, r, map[string]string{"number": err.Error()})
+	case errors.Is(err, aggregate.ErrTeamOut), errors.Is(err, aggregate.ErrTeamExists), errors.Is(err, aggregate.ErrInvalidTransition), errors.Is(err, aggregate.ErrMemberExists), errors.Is(err, aggregate.ErrNumberTaken), errors.Is(err, aggregate.ErrEmailConfirmed), errors.Is(err, aggregate.ErrEmailUnconfirmed), errors.Is(err, aggregate.ErrPhoneUnconfirmed):
+		app.ConflictResponse(w, r, err)
+	case errors.Is(err, aggregate.ErrVersionMismatch), errors.Is(err, jetstream.ErrWrongLastSequence):
+		app.PreconditionFailedResponse(w, r)
+	default:
+		app.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/validator"
+	"nathejk.dk/pkg/correlation"
+	"nathejk.dk/pkg/nats"
+)
+
+// skipLister is implemented by streams that can skip invalid events.
+type skipLister interface {
+	SetInvalidMessagesIds(map[string]map[uint64]bool)
+}
+
+// applySkipList sets the invalid events stored in the database, and those
+// in the -invalid-events-file, as the skip list of the event stream. It
+// takes effect for subscriptions made afterwards.
+func (app *application) applySkipList() error {
+	sl, ok := app.stan.(skipLister)
+	if !ok {
+		return nil
+	}
+	events, err := app.models.InvalidEvents.GetAll()
+	if err != nil {
+		return err
+	}
+	skip := data.SkipList(events)
+	if app.config.stan.invalidEventsFile != "" {
+		file, err := nats.LoadInvalidEventsFromFile(app.config.stan.invalidEventsFile)
+		if err != nil {
+			return err
+		}
+		for channel, seqs := range file {
+			if skip[channel] == nil {
+				skip[channel] = make(map[uint64]bool)
+			}
+			for seq := range seqs {
+				skip[channel][seq] = true
+			}
+		}
+	}
+	sl.SetInvalidMessagesIds(skip)
+	return nil
+}
+
+// rebuildProjections applies the skip list and replays the event stream
+// into the projections.
+func (app *application) rebuildProjections() error {
+	if err := app.applySkipList(); err != nil {
+		return err
+	}
+	return app.projections.Rebuild()
+}
+
+// rebuildInBackground rebuilds the projections of this instance without
+// holding up the request. Other instances of the API keep their projections
+// until they are restarted or rebuilt themselves.
+func (app *application) rebuildInBackground(r *http.Request) {
+	app.Background(r.Context(), func(ctx context.Context) {
+		if err := app.rebuildProjections(); err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"correlation_id": correlation.CorrelationID(ctx),
+			})
+		}
+	})
+}
+
+// invalidEventAuthor is recorded as the author of the invalid events. The
+// admin API is guarded by a single shared token, so there is no user to
+// name; the request ID in the request log tells who made the change.
+const invalidEventAuthor = "admin"
+
+func (app *application) listInvalidEventsHandler(w http.ResponseWriter, r *http.Request) {
+	events, err := app.models.InvalidEvents.GetAll()
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"invalidEvents": events}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// rebuildMessage tells the client that the change is not applied yet, and only
+// to the instance that answered.
+const rebuildMessage = "projections of this instance are being rebuilt"
+
+// createInvalidEventHandler adds an event to the skip list and rebuilds the
+// projections of this instance in the background. It answers 202 Accepted,
+// as the API answers 503 Service Unavailable until the rebuild has caught up.
+func (app *application) createInvalidEventHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Channel  string `json:"channel"`
+		Sequence uint64 `json:"sequence"`
+		Reason   string `json:"reason"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	event := &data.InvalidEvent{
+		Channel:  input.Channel,
+		Sequence: input.Sequence,
+		Reason:   input.Reason,
+		Author:   invalidEventAuthor,
+	}
+	v := validator.New()
+	if event.Validate(v); !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err := app.models.InvalidEvents.Insert(event); err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	app.rebuildInBackground(r)
+	err := app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"invalidEvent": event, "message": rebuildMessage}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteInvalidEventHandler removes an event from the skip list and rebuilds
+// the projections of this instance in the background, like
+// createInvalidEventHandler.
+func (app *application) deleteInvalidEventHandler(w http.ResponseWriter, r *http.Request) {
+	channel := app.ReadNamedParam(r, "channel")
+	sequence, err := strconv.ParseUint(app.ReadNamedParam(r, "sequence"), 10, 64)
+	if channel == "" || err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	err = app.models.InvalidEvents.Delete(channel, sequence)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.rebuildInBackground(r)
+	err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"message": "invalid event successfully deleted; " + rebuildMessage}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
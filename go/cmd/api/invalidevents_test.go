@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/jsonlog"
+	"nathejk.dk/pkg/memorystream"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// invalidEvents is an in-memory data.Models.InvalidEvents.
+type invalidEvents struct {
+	mu     sync.Mutex
+	events map[string]*data.InvalidEvent
+}
+
+func key(channel string, sequence uint64) string {
+	return channel + ":" + strconv.FormatUint(sequence, 10)
+}
+
+func (m *invalidEvents) CreateTable() error { return nil }
+
+func (m *invalidEvents) GetAll() ([]*data.InvalidEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*data.InvalidEvent{}
+	for _, e := range m.events {
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (m *invalidEvents) Insert(e *data.InvalidEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events[key(e.Channel, e.Sequence)] = e
+	return nil
+}
+
+func (m *invalidEvents) Delete(channel string, sequence uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.events[key(channel, sequence)]; !ok {
+		return data.ErrRecordNotFound
+	}
+	delete(m.events, key(channel, sequence))
+	return nil
+}
+
+// resetConsumer signals each reset of the projections.
+type resetConsumer struct {
+	resets chan struct{}
+}
+
+func (c *resetConsumer) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{streaminterface.SubjectFromStr("NATHEJK")}
+}
+func (c *resetConsumer) HandleMessage(streaminterface.Message) error { return nil }
+func (c *resetConsumer) Reset() error {
+	c.resets <- struct{}{}
+	return nil
+}
+
+func newAdminTestApp(t *testing.T) (*application, *invalidEvents, *resetConsumer) {
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	events := &invalidEvents{events: make(map[string]*data.InvalidEvent)}
+	consumer := &resetConsumer{resets: make(chan struct{}, 10)}
+	eventstream := memorystream.New()
+	a := &application{
+		JsonApi: app.JsonApi{Logger: logger},
+		models:  data.Models{InvalidEvents: events},
+		stan:    eventstream,
+		projections: newProjections(eventstream, logger, func(streaminterface.Publisher) []streaminterface.Consumer {
+			return []streaminterface.Consumer{consumer}
+		}),
+		logger: logger,
+	}
+	a.config.admin.token = "secret"
+	if err := a.projections.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return a, events, consumer
+}
+
+func adminRequest(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func waitReset(t *testing.T, c *resetConsumer) {
+	select {
+	case <-c.resets:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for projections to rebuild")
+	}
+}
+
+func TestCreateInvalidEventHandler(t *testing.T) {
+	assert := assert.New(t)
+	a, events, consumer := newAdminTestApp(t)
+	h := a.routes()
+
+	w := adminRequest(t, h, http.MethodPost, "/admin/invalid-events", `{"channel":"NATHEJK","sequence":12,"reason":"broken member list"}`)
+	assert.Equal(http.StatusAccepted, w.Code, w.Body.String())
+	waitReset(t, consumer)
+	if assert.Contains(events.events, "NATHEJK:12") {
+		assert.Equal("admin", events.events["NATHEJK:12"].Author)
+	}
+
+	// the author is not taken from the client
+	w = adminRequest(t, h, http.MethodPost, "/admin/invalid-events", `{"channel":"NATHEJK","sequence":13,"reason":"x","author":"someone else"}`)
+	assert.Equal(http.StatusAccepted, w.Code)
+	waitReset(t, consumer)
+	if assert.Contains(events.events, "NATHEJK:13") {
+		assert.Equal("admin", events.events["NATHEJK:13"].Author)
+	}
+
+	w = adminRequest(t, h, http.MethodPost, "/admin/invalid-events", `{"channel":"NATHEJK"}`)
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/invalid-events", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestDeleteInvalidEventHandler(t *testing.T) {
+	assert := assert.New(t)
+	a, events, consumer := newAdminTestApp(t)
+	h := a.routes()
+	events.Insert(&data.InvalidEvent{Channel: "NATHEJK", Sequence: 12, Reason: "broken", Author: "admin"})
+
+	w := adminRequest(t, h, http.MethodGet, "/admin/invalid-events", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"sequence": 12`)
+
+	w = adminRequest(t, h, http.MethodDelete, "/admin/invalid-events/NATHEJK/12", "")
+	assert.Equal(http.StatusAccepted, w.Code, w.Body.String())
+	waitReset(t, consumer)
+	assert.Empty(events.events)
+
+	w = adminRequest(t, h, http.MethodDelete, "/admin/invalid-events/NATHEJK/12", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+	w = adminRequest(t, h, http.MethodDelete, "/admin/invalid-events/NATHEJK/twelve", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+// notResetter is a consumer without Reset.
+type notResetter struct{}
+
+func (notResetter) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{streaminterface.SubjectFromStr("NATHEJK")}
+}
+func (notResetter) HandleMessage(streaminterface.Message) error { return nil }
+
+func TestProjectionsRequireReset(t *testing.T) {
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	p := newProjections(memorystream.New(), logger, func(streaminterface.Publisher) []streaminterface.Consumer {
+		return []streaminterface.Consumer{notResetter{}}
+	})
+	assert.Error(t, p.Start())
+}
@@ -29,6 +29,15 @@ func (app *application) showKlanHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The version of the team is the one the commands check If-Match
+	// against.
+	state, err := app.teams.LoadTeam(teamId)
+	if err != nil {
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	version := state.Sequence
+
 	members, _, err := app.models.Members.GetSeniore(data.Filters{TeamID: teamId})
 	if err != nil {
 		log.Printf("GetSenior %q", err)
@@ -42,9 +51,11 @@ func (app *application) showKlanHandler(w http.ResponseWriter, r *http.Request)
 		Korps:          Korps(),
 		TShirtSizes:    TShirtSizes(),
 	}
+	year := app.teams.LoadYear(app.config.year)
+	config.AgeRules, config.StartTime = year.AgeRules, year.StartTime
 	//contact, _ := app.models.Teams.GetContact(teamId)
 
-	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"config": config, "team": team, "members": members, "payments": []any{}}, nil)
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"config": config, "team": team, "members": members, "duplicates": app.teamDuplicates(teamId), "payments": []any{}}, http.Header{"Etag": {jsonapi.ETag(version)}})
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
@@ -60,16 +71,18 @@ func (app *application) updateKlanHandler(w http.ResponseWriter, r *http.Request
 		app.BadRequestResponse(w, r, err)
 		return
 	}
-	team, err := app.models.Teams.GetKlan(teamID)
-	if err != nil {
-		log.Printf("Signup.GetByID  %q", err)
-		app.BadRequestResponse(w, r, err)
+	version, ok, err := app.IfMatchVersion(r)
+	if !ok {
+		app.PreconditionRequiredResponse(w, r)
+		return
+	} else if err != nil {
+		app.PreconditionFailedResponse(w, r)
 		return
 	}
-	err = app.commands.Team.UpdateKlan(teamID, input.Team, input.Members)
+	seq, err := app.commands.Team.UpdateKlan(r.Context(), teamID, version, input.Team, input.Members)
 	if err != nil {
 		log.Printf("UpdateKlan  %q", err)
-		app.BadRequestResponse(w, r, err)
+		app.commandErrorResponse(w, r, err)
 		return
 	}
 	/*
@@ -78,7 +91,25 @@ func (app *application) updateKlanHandler(w http.ResponseWriter, r *http.Request
 		if err != nil {
 			app.ServerErrorResponse(w, r, err)
 		}*/
-	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"team": team}, nil)
+	headers := http.Header{}
+	if seq != 0 {
+		headers.Set("Etag", jsonapi.ETag(seq))
+	}
+	if !app.applied(r.Context(), seq) {
+		// The read model has not seen the update yet, so the client must
+		// fetch the team later.
+		err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"teamId": teamID}, headers)
+		if err != nil {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	team, err := app.models.Teams.GetKlan(teamID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"team": team}, headers)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nathejk/shared-go/messages"
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/mailer"
+	"nathejk.dk/internal/validator"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// mailTemplateSlugRX matches the slugs of the mail templates, which are
+// part of their subjects.
+var mailTemplateSlugRX = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// sampleMailTemplateData is the team the templates are previewed with,
+// unless the mails of the template are sent with other data, see
+// previewMailTemplateData.
+var sampleMailTemplateData = types.MailTemplateData{
+	Name:         "Ræverne",
+	Group:        "1. Nordhavn",
+	Corps:        "dds",
+	SignupStatus: types.SignupStatusPay,
+	Contact: types.MailTemplateData_Contact{
+		Name:  "Anna Andersen",
+		Phone: "12345678",
+		Email: "anna@example.com",
+		Role:  "Leder",
+	},
+	Members: []types.MailTemplateData_Member{
+		{Name: "Bo Bech", Address: "Nørregade 1", PostalCode: "1165", City: "København K", Phone: "23456789", PhoneParent: "34567890", Birthday: "2010-05-01"},
+		{Name: "Cy Clausen", Address: "Vestergade 2", PostalCode: "1456", City: "København K", Phone: "45678901", PhoneParent: "56789012", Birthday: "2011-02-03", Returning: true},
+	},
+	Nathejk: "Nathejk 2024",
+	Weekend: "13.-15. september",
+}
+
+// previewMailTemplateData returns data like that the mails of the template
+// slug are sent with, so a template is previewed as it will be sent.
+func previewMailTemplateData(slug string) any {
+	switch slug {
+	case confirmationMailTemplate:
+		return confirmationMailData("00000000-0000-0000-0000-000000000000")
+	}
+	return sampleMailTemplateData
+}
+
+// mailTemplateSource returns the mail templates defined on the stream to
+// the mailer.
+func mailTemplateSource(models data.Models) mailer.TemplateSource {
+	return func(slug string) (*mailer.Template, error) {
+		t, err := models.MailTemplates.Get(slug)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return &mailer.Template{Subject: t.Subject, Body: t.Template}, nil
+	}
+}
+
+// mailTemplateEnvelope is a mail template and whether it is defined on the
+// stream or embedded in the mailer.
+type mailTemplateEnvelope struct {
+	*data.MailTemplate
+	Source string `json:"source"`
+}
+
+// listMailTemplatesHandler lists the mail templates defined on the stream
+// and the embedded templates they have not replaced.
+func (app *application) listMailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	defined, err := app.models.MailTemplates.GetAll()
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	embedded, err := mailer.Embedded()
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	templates := []mailTemplateEnvelope{}
+	for _, t := range defined {
+		templates = append(templates, mailTemplateEnvelope{MailTemplate: t, Source: "stream"})
+		delete(embedded, t.Slug)
+	}
+	for slug, t := range embedded {
+		templates = append(templates, mailTemplateEnvelope{MailTemplate: &data.MailTemplate{Slug: slug, Template: t.Body}, Source: "embedded"})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Slug < templates[j].Slug })
+
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"templates": templates}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readMailTemplate reads a mail template from the request and checks that
+// it parses, answering 422 if it does not.
+func (app *application) readMailTemplate(w http.ResponseWriter, r *http.Request) (*mailer.Template, bool) {
+	var input struct {
+		Subject  string `json:"subject"`
+		Template string `json:"template"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return nil, false
+	}
+	t := &mailer.Template{Subject: strings.TrimSpace(input.Subject), Body: input.Template}
+	if _, err := mailer.Parse(*t); err != nil {
+		var terr *mailer.TemplateError
+		if errors.As(err, &terr) {
+			app.FailedValidationResponse(w, r, map[string]string{terr.Field: terr.Err.Error()})
+			return nil, false
+		}
+		app.ServerErrorResponse(w, r, err)
+		return nil, false
+	}
+	return t, true
+}
+
+// updateMailTemplateHandler defines the mail template slug on the stream,
+// replacing the embedded template of the same slug.
+func (app *application) updateMailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	slug := app.ReadNamedParam(r, "slug")
+	v := validator.New()
+	v.Check(mailTemplateSlugRX.MatchString(slug), "slug", "must be lowercase letters, digits, - and _")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+	t, ok := app.readMailTemplate(w, r)
+	if !ok {
+		return
+	}
+	msg := app.message(r.Context(), streaminterface.SubjectFromStr(subject.MailTemplateChanged(app.config.year, slug, subject.VerbUpdated).String()))
+	msg.SetBody(&nathejk.NathejkMailTemplateUpdated{Slug: slug, Subject: t.Subject, Template: t.Body})
+	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
+	// A message buffered while the stream reconnects is published once
+	// connected, so it is answered as accepted.
+	seq, err := streaminterface.PublishSequence(app.stan, msg)
+	if err != nil && !errors.Is(err, nats.ErrBuffered) {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	if app.applied(r.Context(), seq) {
+		if t, err := app.models.MailTemplates.Get(slug); err == nil {
+			err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"template": t}, nil)
+			if err != nil {
+				app.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+	err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"slug": slug}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteMailTemplateHandler deletes the mail template slug from the stream,
+// so the embedded template of the same slug, if any, is used again.
+func (app *application) deleteMailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	slug := app.ReadNamedParam(r, "slug")
+	if _, err := app.models.MailTemplates.Get(slug); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	msg := app.message(r.Context(), streaminterface.SubjectFromStr(subject.MailTemplateChanged(app.config.year, slug, subject.VerbDeleted).String()))
+	msg.SetBody(&nathejk.NathejkMailTemplateDeleted{Slug: slug})
+	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
+	// A message buffered while the stream reconnects is published once
+	// connected, so it is answered as accepted.
+	seq, err := streaminterface.PublishSequence(app.stan, msg)
+	if err != nil && !errors.Is(err, nats.ErrBuffered) {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	if !app.applied(r.Context(), seq) {
+		if err := app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"slug": slug}, nil); err != nil {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.listMailTemplatesHandler(w, r)
+}
+
+// previewMailTemplateHandler renders a mail template, saved or not, with
+// sample data like that of the slug given in the query, e.g.
+// ?slug=verify_email, or with a sample team.
+func (app *application) previewMailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	data := previewMailTemplateData(app.ReadString(r.URL.Query(), "slug", ""))
+	t, ok := app.readMailTemplate(w, r)
+	if !ok {
+		return
+	}
+	tmpl, err := mailer.Parse(*t)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	preview, err := mailer.Render(tmpl, data)
+	if err != nil {
+		app.FailedValidationResponse(w, r, map[string]string{"template": err.Error()})
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"preview": preview, "data": data}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
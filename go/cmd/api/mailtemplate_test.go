@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// mailTemplates is a data.Models.MailTemplates knowing the templates in it.
+type mailTemplates map[string]*data.MailTemplate
+
+func (m mailTemplates) GetAll() ([]*data.MailTemplate, error) {
+	templates := []*data.MailTemplate{}
+	for _, t := range m {
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func (m mailTemplates) Get(slug string) (*data.MailTemplate, error) {
+	if t, ok := m[slug]; ok {
+		return t, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func TestListMailTemplatesHandler(t *testing.T) {
+	tests := map[string]struct {
+		templates mailTemplates
+		want      map[string]string
+	}{
+		"embedded": {
+			templates: mailTemplates{},
+			want:      map[string]string{"verify_email": "embedded"},
+		},
+		"defined on the stream": {
+			templates: mailTemplates{
+				"verify_email": {Slug: "verify_email", Subject: "Bekræft", Template: `{{define "plainBody"}}Hej{{end}}`},
+				"paid":         {Slug: "paid", Subject: "Betalt", Template: `{{define "plainBody"}}Tak{{end}}`},
+			},
+			want: map[string]string{"paid": "stream", "verify_email": "stream"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.config.admin.token = "secret"
+			a.models.MailTemplates = tt.templates
+
+			w := adminRequest(t, a.routes(), http.MethodGet, "/admin/mailtemplates", "")
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var body struct {
+				Templates []struct {
+					Slug     string `json:"slug"`
+					Template string `json:"template"`
+					Source   string `json:"source"`
+				} `json:"templates"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			got := map[string]string{}
+			for _, t := range body.Templates {
+				got[t.Slug] = t.Source
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUpdateMailTemplateHandler(t *testing.T) {
+	tests := map[string]struct {
+		slug   string
+		body   string
+		status int
+		errs   map[string]string
+	}{
+		"saved": {
+			slug:   "paid",
+			body:   `{"subject":"Betalt {{.Name}}","template":"{{define \"plainBody\"}}Tak{{end}}"}`,
+			status: http.StatusOK,
+		},
+		"bad slug": {
+			slug:   "Paid.Mail",
+			body:   `{"subject":"Betalt","template":"{{define \"plainBody\"}}Tak{{end}}"}`,
+			status: http.StatusUnprocessableEntity,
+			errs:   map[string]string{"slug": "must be lowercase letters, digits, - and _"},
+		},
+		"template fails to parse": {
+			slug:   "paid",
+			body:   `{"subject":"Betalt","template":"{{define \"plainBody\"}}Tak {{.Name}{{end}}"}`,
+			status: http.StatusUnprocessableEntity,
+			errs:   map[string]string{"template": "template: email:1: bad character U+007D '}'"},
+		},
+		"no plain body": {
+			slug:   "paid",
+			body:   `{"subject":"Betalt","template":"Tak"}`,
+			status: http.StatusUnprocessableEntity,
+			errs:   map[string]string{"template": `must define "plainBody"`},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.config.admin.token = "secret"
+			a.models.MailTemplates = mailTemplates{"paid": {Slug: "paid"}}
+
+			w := adminRequest(t, a.routes(), http.MethodPut, "/admin/mailtemplates/"+tt.slug, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.errs != nil {
+				var body struct {
+					Error map[string]string `json:"error"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, tt.errs, body.Error)
+			}
+		})
+	}
+}
+
+// bufferingStream is a stream buffering the messages published, as NATS
+// does while it reconnects.
+type bufferingStream struct {
+	streaminterface.Stream
+}
+
+func (bufferingStream) Publish(streaminterface.Message) error { return nats.ErrBuffered }
+func (bufferingStream) PublishSequence(streaminterface.Message) (uint64, error) {
+	return 0, nats.ErrBuffered
+}
+
+func TestMailTemplateHandlersBuffered(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.config.admin.token = "secret"
+	a.models.MailTemplates = mailTemplates{"paid": {Slug: "paid"}}
+	a.stan = bufferingStream{a.stan}
+	h := a.routes()
+
+	w := adminRequest(t, h, http.MethodPut, "/admin/mailtemplates/paid", `{"subject":"Betalt","template":"{{define \"plainBody\"}}Tak{{end}}"}`)
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	w = adminRequest(t, h, http.MethodDelete, "/admin/mailtemplates/paid", "")
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+}
+
+func TestDeleteMailTemplateHandler(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.config.admin.token = "secret"
+	a.models.MailTemplates = mailTemplates{"paid": {Slug: "paid"}}
+	h := a.routes()
+
+	w := adminRequest(t, h, http.MethodDelete, "/admin/mailtemplates/welcome", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = adminRequest(t, h, http.MethodDelete, "/admin/mailtemplates/paid", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestPreviewMailTemplateHandler(t *testing.T) {
+	tests := map[string]struct {
+		slug    string
+		body    string
+		status  int
+		subject string
+		plain   string
+	}{
+		"preview": {
+			body:    `{"subject":"Velkommen {{.Name}}","template":"{{define \"plainBody\"}}Hej {{.Contact.Name}}{{end}}"}`,
+			status:  http.StatusOK,
+			subject: "Velkommen Ræverne",
+		},
+		"fails with the sample": {
+			body:   `{"subject":"Velkommen","template":"{{define \"plainBody\"}}{{.Secret}}{{end}}"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		"data of the slug": {
+			slug:    "verify_email",
+			body:    `{"subject":"Bekræft","template":"{{define \"plainBody\"}}/confirm/{{.secret}} i {{.days}} dage{{end}}"}`,
+			status:  http.StatusOK,
+			subject: "Bekræft",
+			plain:   "/confirm/00000000-0000-0000-0000-000000000000 i 3 dage",
+		},
+		"fails with the data of the slug": {
+			slug:   "verify_email",
+			body:   `{"subject":"Velkommen {{.days.Name}}","template":"{{define \"plainBody\"}}Hej{{end}}"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.config.admin.token = "secret"
+
+			w := adminRequest(t, a.routes(), http.MethodPost, "/admin/mailtemplates/preview?slug="+tt.slug, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+
+			var body struct {
+				Preview struct {
+					Subject   string `json:"subject"`
+					PlainBody string `json:"plainBody"`
+				} `json:"preview"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.subject, body.Preview.Subject)
+			if tt.plain != "" {
+				assert.Equal(t, tt.plain, body.Preview.PlainBody)
+			}
+		})
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"expvar"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"nathejk.dk/cmd/api/app"
@@ -16,12 +16,12 @@ import (
 	"nathejk.dk/internal/mailer"
 	"nathejk.dk/internal/sms"
 	"nathejk.dk/internal/vcs"
+	"nathejk.dk/nathejk/aggregate"
 	"nathejk.dk/nathejk/commands"
+	"nathejk.dk/nathejk/outbox"
 	"nathejk.dk/nathejk/table"
-	"nathejk.dk/pkg/memorystream"
-	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/correlation"
 	"nathejk.dk/pkg/sqlpersister"
-	"nathejk.dk/pkg/stream"
 	"nathejk.dk/pkg/streaminterface"
 )
 
@@ -33,6 +33,8 @@ var (
 type config struct {
 	port      int
 	webroot   string
+	year      string
+	yearStart string
 	countdown struct {
 		time   string
 		videos []string
@@ -44,7 +46,11 @@ type config struct {
 		maxIdleTime  string
 	}
 	stan struct {
-		dsn string
+		dsn               string
+		invalidEventsFile string
+	}
+	admin struct {
+		token string
 	}
 	sms struct {
 		dsn string
@@ -55,14 +61,32 @@ type config struct {
 type application struct {
 	app.JsonApi
 
-	config config
-	models data.Models
-	stan   streaminterface.Stream
+	config      config
+	models      data.Models
+	stan        streaminterface.Stream
+	projections *projections
 	//publisher streaminterface.Publisher
 	commands commands.Commands
-	mailer   mailer.Mailer
-	sms      sms.Sender
-	logger   *jsonlog.Logger
+	// teams holds the team aggregates the commands check, and is the
+	// source of the versions of the teams.
+	teams *aggregate.Store
+	// pincodes limits the attempts to enter the pincode of a team.
+	pincodes *app.Limiter
+	// resends limits the confirmation mails resent to a team.
+	resends *app.Limiter
+	// resending holds the IDs of the outbox messages being resent.
+	resending sync.Map
+	mailer    mailer.Mailer
+	sms       sms.Sender
+	logger    *jsonlog.Logger
+}
+
+// message returns a new message for subj on the stan stream, carrying the
+// correlation IDs of ctx.
+func (app *application) message(ctx context.Context, subj streaminterface.Subject) streaminterface.MutableMessage {
+	msg := app.stan.MessageFunc()(subj)
+	correlation.Apply(ctx, msg)
+	return msg
 }
 
 func main() {
@@ -70,9 +94,13 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 80, "API server port")
 	flag.StringVar(&cfg.webroot, "webroot", getEnv("WEBROOT", "/www"), "Static web root")
+	flag.StringVar(&cfg.year, "year", getEnv("YEAR", "2024"), "Year of the event, used in the subjects of published events")
+	flag.StringVar(&cfg.yearStart, "year-start", os.Getenv("YEAR_START"), "Start of the event, e.g. 2024-09-13T18:00:00+02:00, used for the age rules until a nathejk:year.created event tells it")
 
-	flag.StringVar(&cfg.sms.dsn, "sms-dsn", os.Getenv("SMS_DSN"), "SMS DSN")
-	flag.StringVar(&cfg.stan.dsn, "stan-dsn", os.Getenv("STAN_DSN"), "NATS Streaming DSN")
+	flag.StringVar(&cfg.sms.dsn, "sms-dsn", os.Getenv("SMS_DSN"), "SMS DSN: cpsms://, log://, file:///path, http(s):// or multi://")
+	flag.StringVar(&cfg.stan.dsn, "stan-dsn", os.Getenv("STAN_DSN"), "NATS Streaming DSN, or file:///path/to/events.jsonl to run offline")
+	flag.StringVar(&cfg.stan.invalidEventsFile, "invalid-events-file", os.Getenv("INVALID_EVENTS_FILE"), "File with events to skip, one 'channel:?:sequence' per line")
+	flag.StringVar(&cfg.admin.token, "admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token for the admin API")
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DB_DSN"), "Database DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Database max open connections")
@@ -100,8 +128,11 @@ func main() {
 		}
 		log.Printf("Last message (%d) %v", msg.Sequence(), msg)
 	*/
-	natsstream := nats.NewNATSStreamUnique(cfg.stan.dsn, "hq-api")
-	defer natsstream.Close()
+	eventstream, err := openStream(cfg.stan.dsn)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer eventstream.Close()
 
 	db := NewDatabase(cfg.db)
 	if err := db.Open(); err != nil {
@@ -111,62 +142,89 @@ func main() {
 
 	sqlw := sqlpersister.New(db.DB())
 
-	memstream := memorystream.New()
-	//bufferedPublisher := memstream
-	dstmux := stream.NewStreamMux(memstream)
-	dstmux.Handles(natsstream, "nathejk") //d.stream.Channels()...)
-	dstswtch, err := stream.NewSwitch(dstmux, []streaminterface.Consumer{
-		table.NewPersonnel(sqlw, memstream),
-	})
 	//mux := xstream.NewMux(js)
 	//mux.AddConsumer(table.NewSignup(sqlw), table.NewConfirm(sqlw), table.NewKlan(sqlw), table.NewSenior(sqlw), table.NewPatrulje(sqlw), table.NewPatruljeStatus(sqlw) /*table.NewPatruljeMerged(sqlw),*/, table.NewSpejder(sqlw), table.NewSpejderStatus(sqlw))
 	//mux.AddConsumer(table.NewSpejder(sqlw), table.NewSpejderStatus(sqlw))
 	//if err := mux.Run(context.Background()); err != nil {
 	//	logger.PrintFatal(err, nil)
 	//}
-	ctx := context.Background()
-	live := make(chan struct{})
-	go func() {
-		err = dstswtch.Run(ctx, func() {
-			//dstswtch.Close()
-			//log.Printf("Closing")
-			live <- struct{}{}
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-	// Waiting for live
-	select {
-	case <-ctx.Done():
-		log.Fatal(ctx.Err())
-	case <-live:
-	}
-
 	models := data.NewModels(db.DB())
+	if err := models.InvalidEvents.CreateTable(); err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	expvar.NewString("version").Set(version)
 	expvar.NewInt("timestamp").Set(time.Now().Unix())
 	expvar.NewInt("goroutines").Set(int64(runtime.NumGoroutine()))
 
-	smsclient, err := sms.NewClient(cfg.sms.dsn)
+	smsclient, err := sms.NewClient(cfg.sms.dsn, logger)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 
+	// The mailer prefers the mail templates defined on the stream.
+	mail := mailer.NewFromConfig(cfg.smtp)
+	mail.UseTemplates(mailTemplateSource(models))
+
+	// teams keeps the events of each team for the commands to check
+	// invariants against. It is reset when the projections are rebuilt.
+	teams := aggregate.NewStore(100)
+	if cfg.yearStart != "" {
+		start, err := time.Parse(time.RFC3339, cfg.yearStart)
+		if err != nil {
+			logger.PrintFatal(fmt.Errorf("year-start: %w", err), nil)
+		}
+		teams.SetStartTime(cfg.year, start)
+	}
+	// The outbox worker sends the SMS and mail requested on the stream, and
+	// keeps the messages it is sending across rebuilds.
+	worker := outbox.NewWorker(eventstream, smsclient, mail, logger)
+	cmds := commands.New(eventstream, cfg.year, models, teams)
+	projections := newProjections(eventstream, logger, func(p streaminterface.Publisher) []streaminterface.Consumer {
+		return []streaminterface.Consumer{
+			table.NewPersonnel(sqlw, p),
+			table.NewSignup(sqlw),
+			table.NewSignupStatusHistory(sqlw),
+			table.NewConfirm(sqlw),
+			table.NewMailTemplate(sqlw),
+			table.NewOutbox(sqlw),
+			teams,
+			worker,
+			cmds.Numberer,
+		}
+	})
+
 	app := &application{
+		projections: projections,
 		JsonApi: app.JsonApi{
 			Logger: logger,
 		},
 		config: cfg,
 		models: models,
 		//jetstream: js,
-		stan:     natsstream,
-		commands: commands.New(natsstream, models),
-		mailer:   mailer.NewFromConfig(cfg.smtp),
+		stan:     eventstream,
+		commands: cmds,
+		teams:    teams,
+		pincodes: app.NewLimiter(pincodeAttempts, pincodeWindow),
+		resends:  app.NewLimiter(confirmationResends, confirmationResendWindow),
+		mailer:   mail,
 		sms:      smsclient,
 		logger:   logger,
 	}
 
+	// The skip list must be set before subscribing. The projections catch
+	// up in the background; until they have, /readyz reports not ready and
+	// the API answers 503 Service Unavailable.
+	if err := app.applySkipList(); err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if err := projections.Start(); err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if err := registerStreamMetrics(projections, eventstream); err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	app.registerReadinessChecks(db, eventstream)
+
 	logger.PrintFatal(app.Serve(fmt.Sprintf(":%d", cfg.port), app.routes()), nil)
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nathejk/shared-go/types"
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/nathejk/commands"
+)
+
+// readVersion returns the version of the If-Match header, and writes the
+// error response if there is none.
+func (app *application) readVersion(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	version, ok, err := app.IfMatchVersion(r)
+	if !ok {
+		app.PreconditionRequiredResponse(w, r)
+		return 0, false
+	} else if err != nil {
+		app.PreconditionFailedResponse(w, r)
+		return 0, false
+	}
+	return version, true
+}
+
+// changedResponse writes the response of a command on a team that wrote
+// events up to seq. Once the read model has seen them, it writes status and
+// the envelope of read, otherwise 202 so the client fetches the team later.
+func (app *application) changedResponse(w http.ResponseWriter, r *http.Request, teamID types.TeamID, seq uint64, status int, read func() (jsonapi.Envelope, error)) {
+	headers := http.Header{}
+	if seq != 0 {
+		headers.Set("Etag", jsonapi.ETag(seq))
+	}
+	if !app.applied(r.Context(), seq) {
+		err := app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"teamId": teamID}, headers)
+		if err != nil {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	env, err := read()
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	if err := app.WriteJSON(w, status, env, headers); err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// hqApproved marks the requests to next as approved by HQ, so the age
+// rules of the year allow exceptions.
+func (app *application) hqApproved(next http.HandlerFunc) http.HandlerFunc {
+	return app.RequireBearerToken(app.config.admin.token, func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(commands.WithHQApproval(r.Context())))
+	})
+}
+
+func (app *application) spejdereEnvelope(teamID types.TeamID) func() (jsonapi.Envelope, error) {
+	return func() (jsonapi.Envelope, error) {
+		members, _, err := app.models.Members.GetSpejdere(data.Filters{TeamID: teamID})
+		return jsonapi.Envelope{"members": members}, err
+	}
+}
+
+func (app *application) seniorerEnvelope(teamID types.TeamID) func() (jsonapi.Envelope, error) {
+	return func() (jsonapi.Envelope, error) {
+		members, _, err := app.models.Members.GetSeniore(data.Filters{TeamID: teamID})
+		return jsonapi.Envelope{"members": members}, err
+	}
+}
+
+func (app *application) createSpejderHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	var input commands.Spejder
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	input.MemberID = types.MemberID(app.ReadNamedParam(r, "memberId"))
+	version, ok := app.readVersion(w, r)
+	if !ok {
+		return
+	}
+	seq, err := app.commands.Team.AddSpejder(r.Context(), teamID, version, input)
+	if err != nil {
+		log.Printf("AddSpejder %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	app.changedResponse(w, r, teamID, seq, http.StatusCreated, app.spejdereEnvelope(teamID))
+}
+
+func (app *application) updateSpejderHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	var input commands.SpejderPatch
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	version, ok := app.readVersion(w, r)
+	if !ok {
+		return
+	}
+	memberID := types.MemberID(app.ReadNamedParam(r, "memberId"))
+	seq, err := app.commands.Team.UpdateSpejder(r.Context(), teamID, version, memberID, input)
+	if err != nil {
+		log.Printf("UpdateSpejder %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	app.changedResponse(w, r, teamID, seq, http.StatusOK, app.spejdereEnvelope(teamID))
+}
+
+func (app *application) createSeniorHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	var input commands.Senior
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	input.MemberID = types.MemberID(app.ReadNamedParam(r, "memberId"))
+	version, ok := app.readVersion(w, r)
+	if !ok {
+		return
+	}
+	seq, err := app.commands.Team.AddSenior(r.Context(), teamID, version, input)
+	if err != nil {
+		log.Printf("AddSenior %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	app.changedResponse(w, r, teamID, seq, http.StatusCreated, app.seniorerEnvelope(teamID))
+}
+
+func (app *application) updateSeniorHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	var input commands.SeniorPatch
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	version, ok := app.readVersion(w, r)
+	if !ok {
+		return
+	}
+	memberID := types.MemberID(app.ReadNamedParam(r, "memberId"))
+	seq, err := app.commands.Team.UpdateSenior(r.Context(), teamID, version, memberID, input)
+	if err != nil {
+		log.Printf("UpdateSenior %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	app.changedResponse(w, r, teamID, seq, http.StatusOK, app.seniorerEnvelope(teamID))
+}
+
+// deleteMemberHandler returns the handler deleting a member of a team of
+// teamType.
+func (app *application) deleteMemberHandler(teamType types.TeamType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+		version, ok := app.readVersion(w, r)
+		if !ok {
+			return
+		}
+		memberID := types.MemberID(app.ReadNamedParam(r, "memberId"))
+		seq, err := app.commands.Team.DeleteMember(r.Context(), teamID, teamType, version, memberID)
+		if err != nil {
+			log.Printf("DeleteMember %q", err)
+			app.commandErrorResponse(w, r, err)
+			return
+		}
+		read := app.spejdereEnvelope(teamID)
+		if teamType == types.TeamTypeKlan {
+			read = app.seniorerEnvelope(teamID)
+		}
+		app.changedResponse(w, r, teamID, seq, http.StatusOK, read)
+	}
+}
+
+func (app *application) updateContactHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	var input commands.ContactPatch
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+	version, ok := app.readVersion(w, r)
+	if !ok {
+		return
+	}
+	seq, err := app.commands.Team.UpdateContact(r.Context(), teamID, version, input)
+	if err != nil {
+		log.Printf("UpdateContact %q", err)
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	app.changedResponse(w, r, teamID, seq, http.StatusOK, func() (jsonapi.Envelope, error) {
+		contact, err := app.models.Teams.GetContact(teamID)
+		return jsonapi.Envelope{"contact": contact}, err
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberHandlers(t *testing.T) {
+	h := newConfirmedTeamTestApp(t).routes()
+
+	tests := []struct {
+		method, path, ifMatch, body string
+		status                      int
+		contains                    string
+	}{
+		{http.MethodPost, "/api/patrulje/team-1/members/member-1", `"3"`, `{"name":"Bo","tshirtsize":"m"}`, http.StatusCreated, ""},
+		{http.MethodPost, "/api/patrulje/team-1/members/member-1", `"4"`, `{"name":"Bo"}`, http.StatusConflict, ""},
+		{http.MethodPatch, "/api/patrulje/team-1/members/member-1", `"4"`, `{"email":"bo"}`, http.StatusUnprocessableEntity, `"email"`},
+		{http.MethodPatch, "/api/patrulje/team-1/members/member-1", `"3"`, `{"tshirtsize":"l"}`, http.StatusPreconditionFailed, ""},
+		{http.MethodPatch, "/api/patrulje/team-1/members/member-1", `"4"`, `{"tshirtsize":"l"}`, http.StatusOK, ""},
+		{http.MethodPatch, "/api/klan/team-1/members/member-1", `"5"`, `{"diet":"vegan"}`, http.StatusNotFound, ""},
+		{http.MethodPatch, "/api/patrulje/team-1/contact", `"5"`, `{"name":"Anna","phone":"12345678"}`, http.StatusOK, ""},
+		{http.MethodDelete, "/api/patrulje/team-1/members/member-2", `"6"`, ``, http.StatusUnprocessableEntity, ""},
+		{http.MethodDelete, "/api/patrulje/team-1/members/member-1", `"6"`, ``, http.StatusOK, ""},
+		{http.MethodDelete, "/api/patrulje/team-1/members/member-1", ``, ``, http.StatusPreconditionRequired, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+		assert.Contains(t, w.Body.String(), tt.contains)
+	}
+}
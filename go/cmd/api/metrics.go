@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+
+	"nathejk.dk/pkg/metrics"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// lastSequencer is implemented by streams that know the last sequence of a
+// channel.
+type lastSequencer interface {
+	LastSequence(channel string) (int64, error)
+}
+
+// registerStreamMetrics exposes the switch and event stream counters, and the
+// lag of each consumer on the subjects read from the event stream.
+func registerStreamMetrics(p *projections, eventstream streaminterface.Stream) error {
+	var errs []error
+	register := func(err error) { errs = append(errs, err) }
+
+	register(metrics.NewCounterFunc("nathejk_subject_in_messages_total", "Messages received by consumers per subject.", []string{"subject"}, func(emit metrics.EmitFunc) {
+		for _, s := range p.Switch().SubjectStats() {
+			emit(float64(s.InMsgs), s.Subject)
+		}
+	}))
+	register(metrics.NewCounterFunc("nathejk_subject_out_messages_total", "Messages handed to consumers per subject after type filtering.", []string{"subject"}, func(emit metrics.EmitFunc) {
+		for _, s := range p.Switch().SubjectStats() {
+			emit(float64(s.OutMsgs), s.Subject)
+		}
+	}))
+	register(metrics.NewGaugeFunc("nathejk_consumer_caught_up", "Whether the consumer has caught up (1) or not (0).", []string{"consumer"}, func(emit metrics.EmitFunc) {
+		for _, c := range p.Switch().ConsumerStats() {
+			caughtup := 0.0
+			if c.CaughtUp {
+				caughtup = 1
+			}
+			emit(caughtup, c.Name)
+		}
+	}))
+	register(metrics.NewGaugeFunc("nathejk_consumer_last_sequence", "Sequence of the last message received by the consumer.", []string{"consumer", "subject"}, func(emit metrics.EmitFunc) {
+		for _, c := range p.Switch().ConsumerStats() {
+			for subj, seq := range c.LastSequence {
+				emit(float64(seq), c.Name, subj)
+			}
+		}
+	}))
+	register(metrics.NewGaugeFunc("nathejk_consumer_lag", "Messages on the event stream channel not yet received by the consumer.", []string{"consumer", "subject"}, func(emit metrics.EmitFunc) {
+		ls, ok := eventstream.(lastSequencer)
+		if !ok {
+			return
+		}
+		// look up each channel once per scrape
+		mux := p.Mux()
+		last := map[string]int64{}
+		for _, c := range p.Switch().ConsumerStats() {
+			for _, subj := range c.Subjects {
+				if mux.Lookup(subj) != eventstream {
+					continue
+				}
+				seq, ok := last[subj]
+				if !ok {
+					var err error
+					if seq, err = ls.LastSequence(subj); err != nil {
+						seq = -1
+					}
+					last[subj] = seq
+				}
+				if seq < 0 {
+					continue
+				}
+				lag := seq - int64(c.LastSequence[subj])
+				if lag < 0 {
+					lag = 0
+				}
+				emit(float64(lag), c.Name, subj)
+			}
+		}
+	}))
+
+	if natsstream, ok := eventstream.(*nats.NATSStream); ok {
+		register(metrics.NewCounterFunc("nathejk_stan_messages_total", "Messages received from NATS Streaming by outcome.", []string{"outcome"}, func(emit metrics.EmitFunc) {
+			stats := natsstream.Stats()
+			emit(float64(stats.Msgs-stats.DecodeErrors-stats.Discarded), "ok")
+			emit(float64(stats.DecodeErrors), "decode_error")
+			emit(float64(stats.Discarded), "discarded")
+		}))
+		register(metrics.NewCounterFunc("nathejk_stan_reconnects_total", "Reconnects to NATS Streaming after the connection was lost.", nil, func(emit metrics.EmitFunc) {
+			emit(float64(natsstream.Stats().Reconnects))
+		}))
+		register(metrics.NewGaugeFunc("nathejk_stan_publish_buffered", "Messages waiting to be published until NATS Streaming is reconnected.", nil, func(emit metrics.EmitFunc) {
+			emit(float64(natsstream.Stats().Buffered))
+		}))
+		register(metrics.NewGaugeFunc("nathejk_stan_connected", "Whether the connection to NATS Streaming is up (1) or not (0).", nil, func(emit metrics.EmitFunc) {
+			connected := 0.0
+			if natsstream.State() == nats.StateConnected {
+				connected = 1
+			}
+			emit(connected)
+		}))
+	}
+	register(metrics.NewGaugeFunc("nathejk_build_info", "Build version.", []string{"version"}, func(emit metrics.EmitFunc) {
+		emit(1, version)
+	}))
+	return errors.Join(errs...)
+}
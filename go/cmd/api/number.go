@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nathejk/shared-go/types"
+	jsonapi "nathejk.dk/cmd/api/app"
+)
+
+// assignNumberHandler returns the handler with which HQ gives a team of
+// teamType a number. Without a number in the body, the team is given the
+// next free number unless it has one.
+func (app *application) assignNumberHandler(teamType types.TeamType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+		var input struct {
+			Number int `json:"number"`
+		}
+		if err := app.ReadJSON(w, r, &input); err != nil {
+			app.BadRequestResponse(w, r, err)
+			return
+		}
+		seq, err := app.commands.Team.AssignNumber(r.Context(), teamID, teamType, input.Number)
+		if err != nil {
+			log.Printf("AssignNumber %q", err)
+			app.commandErrorResponse(w, r, err)
+			return
+		}
+		app.changedResponse(w, r, teamID, seq, http.StatusOK, func() (jsonapi.Envelope, error) {
+			if teamType == types.TeamTypeKlan {
+				team, err := app.models.Teams.GetKlan(teamID)
+				return jsonapi.Envelope{"team": team}, err
+			}
+			team, err := app.models.Teams.GetPatrulje(teamID)
+			return jsonapi.Envelope{"team": team}, err
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nathejk/shared-go/messages"
+	jsonapi "nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/validator"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// requestSms asks the outbox to send an SMS. It is sent in the background
+// by the outbox worker, which retries if the provider fails.
+func (app *application) requestSms(ctx context.Context, body *nathejk.NathejkSmsRequested) error {
+	if body.MessageID == "" {
+		body.MessageID = uuid.New().String()
+	}
+	_, err := app.publishOutboxRequest(ctx, body.MessageID, subject.VerbSms, body)
+	return err
+}
+
+// requestMail asks the outbox to send a mail, like requestSms.
+func (app *application) requestMail(ctx context.Context, body *nathejk.NathejkMailRequested) error {
+	if body.MessageID == "" {
+		body.MessageID = uuid.New().String()
+	}
+	_, err := app.publishOutboxRequest(ctx, body.MessageID, subject.VerbMail, body)
+	return err
+}
+
+// publishOutboxRequest publishes the request and returns its sequence, zero
+// if the request was buffered.
+func (app *application) publishOutboxRequest(ctx context.Context, id, kind string, body any) (uint64, error) {
+	msg := app.message(ctx, streaminterface.SubjectFromStr(subject.OutboxRequested(app.config.year, id, kind).String()))
+	msg.SetBody(body)
+	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
+	seq, err := streaminterface.PublishSequence(app.stan, msg)
+	if err != nil && !errors.Is(err, nats.ErrBuffered) {
+		return 0, err
+	}
+	return seq, nil
+}
+
+var (
+	errResending = errors.New("the message is being resent")
+	errNotFailed = errors.New("only failed messages can be resent")
+)
+
+// listOutboxHandler lists the SMS and mail of the outbox, optionally only
+// those with the status given in the query, e.g. ?status=failed.
+func (app *application) listOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	v := validator.New()
+	v.Check(validator.PermittedValue(status, "", table.OutboxPending, table.OutboxSent, table.OutboxFailed), "status", "must be pending, sent or failed")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+	msgs, err := app.models.Outbox.GetAll(status)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"messages": msgs}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// resendOutboxHandler publishes the request of a failed message again, so
+// the outbox worker tries sending it once more. A message is resent once at
+// a time, and the handler waits for the outbox to mark it pending, so a
+// double-click does not send it twice.
+func (app *application) resendOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	id := app.ReadNamedParam(r, "id")
+	if _, resending := app.resending.LoadOrStore(id, true); resending {
+		app.ConflictResponse(w, r, errResending)
+		return
+	}
+	defer app.resending.Delete(id)
+
+	msg, err := app.models.Outbox.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	if msg.Status != table.OutboxFailed {
+		app.ConflictResponse(w, r, errNotFailed)
+		return
+	}
+	var body any
+	switch msg.Kind {
+	case subject.VerbSms:
+		body = &nathejk.NathejkSmsRequested{}
+	case subject.VerbMail:
+		body = &nathejk.NathejkMailRequested{}
+	default:
+		app.ServerErrorResponse(w, r, fmt.Errorf("outbox message %q of unknown kind %q", msg.MessageID, msg.Kind))
+		return
+	}
+	if err := json.Unmarshal(msg.Request, body); err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	seq, err := app.publishOutboxRequest(r.Context(), msg.MessageID, msg.Kind, body)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	app.applied(r.Context(), seq)
+	err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"messageId": msg.MessageID}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
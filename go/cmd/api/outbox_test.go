@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+)
+
+// outboxRequests returns the outbox requests of the given kind published on
+// the stream of a.
+func outboxRequests(t *testing.T, a *application, kind string) []streaminterface.Message {
+	t.Helper()
+	ch := make(chan streaminterface.Message, 100)
+	sub, err := a.stan.Subscribe(subject.Domain, streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+		ch <- msg
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	var requests []streaminterface.Message
+	for {
+		select {
+		case msg := <-ch:
+			if caughtup.IsCaughtup(msg) {
+				return requests
+			}
+			subj, err := subject.Parse(msg.Subject().Subject())
+			if err == nil && subj.Entity == subject.Outbox && subj.Verb == kind && subj.SubVerbs[0] == subject.VerbRequested {
+				requests = append(requests, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout reading the stream")
+		}
+	}
+}
+
+// smsRequested returns the text of the SMS requested for each phone number.
+func smsRequested(t *testing.T, a *application) map[string]string {
+	t.Helper()
+	texts := map[string]string{}
+	for _, msg := range outboxRequests(t, a, subject.VerbSms) {
+		var body nathejk.NathejkSmsRequested
+		if err := msg.Body(&body); err != nil {
+			t.Fatal(err)
+		}
+		texts[string(body.Phone)] = body.Text
+	}
+	return texts
+}
+
+// mailRequested returns the recipients of the mails requested.
+func mailRequested(t *testing.T, a *application) []string {
+	t.Helper()
+	var recipients []string
+	for _, msg := range outboxRequests(t, a, subject.VerbMail) {
+		var body nathejk.NathejkMailRequested
+		if err := msg.Body(&body); err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, string(body.Recipient))
+	}
+	return recipients
+}
+
+// outboxModel is a data.Models.Outbox knowing the messages in it.
+type outboxModel map[string]*data.OutboxMessage
+
+func (m outboxModel) GetAll(status string) ([]*data.OutboxMessage, error) {
+	msgs := []*data.OutboxMessage{}
+	for _, msg := range m {
+		if status == "" || msg.Status == status {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (m outboxModel) Get(id string) (*data.OutboxMessage, error) {
+	if msg, ok := m[id]; ok {
+		return msg, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func testOutbox() outboxModel {
+	return outboxModel{
+		"msg-1": {MessageID: "msg-1", Kind: "sms", Recipient: "12345678", Status: "failed", Request: json.RawMessage(`{"messageId":"msg-1","pingType":"validate","phone":"12345678","text":"Din pinkode er 1234"}`)},
+		"msg-2": {MessageID: "msg-2", Kind: "mail", Recipient: "anna@example.com", Status: "sent", Request: json.RawMessage(`{"messageId":"msg-2","recipient":"anna@example.com","template":"verify_email.tmpl"}`)},
+	}
+}
+
+func TestListOutboxHandler(t *testing.T) {
+	tests := map[string]struct {
+		query  string
+		status int
+		ids    []string
+	}{
+		"failed":         {query: "?status=failed", status: http.StatusOK, ids: []string{"msg-1"}},
+		"unknown status": {query: "?status=lost", status: http.StatusUnprocessableEntity},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.config.admin.token = "secret"
+			a.models.Outbox = testOutbox()
+
+			w := adminRequest(t, a.routes(), http.MethodGet, "/admin/outbox"+tt.query, "")
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status != http.StatusOK {
+				return
+			}
+			var body struct {
+				Messages []*data.OutboxMessage `json:"messages"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			var ids []string
+			for _, msg := range body.Messages {
+				ids = append(ids, msg.MessageID)
+			}
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+}
+
+func TestResendOutboxHandler(t *testing.T) {
+	tests := map[string]struct {
+		id        string
+		resending bool
+		status    int
+		sms       map[string]string
+	}{
+		"failed":       {id: "msg-1", status: http.StatusAccepted, sms: map[string]string{"12345678": "Din pinkode er 1234"}},
+		"sent":         {id: "msg-2", status: http.StatusConflict, sms: map[string]string{}},
+		"pending":      {id: "msg-4", status: http.StatusConflict, sms: map[string]string{}},
+		"being resent": {id: "msg-1", resending: true, status: http.StatusConflict, sms: map[string]string{}},
+		"unknown":      {id: "msg-3", status: http.StatusNotFound, sms: map[string]string{}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.config.admin.token = "secret"
+			outbox := testOutbox()
+			outbox["msg-4"] = &data.OutboxMessage{MessageID: "msg-4", Kind: "sms", Recipient: "12345678", Status: "pending", Request: json.RawMessage(`{"messageId":"msg-4","phone":"12345678","text":"Betal her"}`)}
+			a.models.Outbox = outbox
+			if tt.resending {
+				a.resending.Store(tt.id, true)
+			}
+
+			w := adminRequest(t, a.routes(), http.MethodPost, "/admin/outbox/"+tt.id+"/resend", "")
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.sms, smsRequested(t, a))
+			if tt.status == http.StatusAccepted {
+				msgs := outboxRequests(t, a, subject.VerbSms)
+				assert.Equal(t, "NATHEJK:2024.outbox.msg-1.sms.requested", msgs[0].Subject().Subject(), "a resent message keeps its ID")
+				_, resending := a.resending.Load(tt.id)
+				assert.False(t, resending, "the message may be resent again once it has failed")
+			}
+		})
+	}
+}
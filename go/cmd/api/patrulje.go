@@ -4,11 +4,13 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/nathejk/shared-go/types"
 	jsonapi "nathejk.dk/cmd/api/app"
 	"nathejk.dk/internal/data"
 	"nathejk.dk/nathejk/commands"
+	nathejktypes "nathejk.dk/nathejk/types"
 )
 
 type SlugLabel struct {
@@ -22,6 +24,9 @@ type TeamConfig struct {
 	TShirtPrice    int         `json:"tshirtPrice"`
 	Korps          []SlugLabel `json:"korps"`
 	TShirtSizes    []SlugLabel `json:"tshirtSizes"`
+	// AgeRules are the age limits of the year, in whole years at StartTime.
+	AgeRules  nathejktypes.AgeRules `json:"ageRules"`
+	StartTime *time.Time            `json:"startTime,omitempty"`
 }
 
 func Korps() []SlugLabel {
@@ -66,6 +71,15 @@ func (app *application) showPatruljeHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// The version of the team is the one the commands check If-Match
+	// against.
+	state, err := app.teams.LoadTeam(teamId)
+	if err != nil {
+		app.commandErrorResponse(w, r, err)
+		return
+	}
+	version := state.Sequence
+
 	members, _, err := app.models.Members.GetSpejdere(data.Filters{TeamID: teamId})
 	if err != nil {
 		log.Printf("GetSpejdere %q", err)
@@ -79,9 +93,11 @@ func (app *application) showPatruljeHandler(w http.ResponseWriter, r *http.Reque
 		Korps:          Korps(),
 		TShirtSizes:    TShirtSizes(),
 	}
+	year := app.teams.LoadYear(app.config.year)
+	config.AgeRules, config.StartTime = year.AgeRules, year.StartTime
 	contact, _ := app.models.Teams.GetContact(teamId)
 
-	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"config": config, "team": team, "contact": contact, "members": members, "payments": []any{}}, nil)
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"config": config, "team": team, "contact": contact, "members": members, "duplicates": app.teamDuplicates(teamId), "payments": []any{}}, http.Header{"Etag": {jsonapi.ETag(version)}})
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
@@ -98,16 +114,18 @@ func (app *application) updatePatruljeHandler(w http.ResponseWriter, r *http.Req
 		app.BadRequestResponse(w, r, err)
 		return
 	}
-	team, err := app.models.Teams.GetPatrulje(teamID)
-	if err != nil {
-		log.Printf("Signup.GetByID  %q", err)
-		app.BadRequestResponse(w, r, err)
+	version, ok, err := app.IfMatchVersion(r)
+	if !ok {
+		app.PreconditionRequiredResponse(w, r)
+		return
+	} else if err != nil {
+		app.PreconditionFailedResponse(w, r)
 		return
 	}
-	err = app.commands.Team.UpdatePatrulje(teamID, input.Team, input.Contact, input.Members)
+	seq, err := app.commands.Team.UpdatePatrulje(r.Context(), teamID, version, input.Team, input.Contact, input.Members)
 	if err != nil {
 		log.Printf("UpdatePatrulje  %q", err)
-		app.BadRequestResponse(w, r, err)
+		app.commandErrorResponse(w, r, err)
 		return
 	}
 	/*
@@ -116,7 +134,25 @@ func (app *application) updatePatruljeHandler(w http.ResponseWriter, r *http.Req
 		if err != nil {
 			app.ServerErrorResponse(w, r, err)
 		}*/
-	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"team": team}, nil)
+	headers := http.Header{}
+	if seq != 0 {
+		headers.Set("Etag", jsonapi.ETag(seq))
+	}
+	if !app.applied(r.Context(), seq) {
+		// The read model has not seen the update yet, so the client must
+		// fetch the team later.
+		err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"teamId": teamID}, headers)
+		if err != nil {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+	team, err := app.models.Teams.GetPatrulje(teamID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	err = app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"team": team}, headers)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
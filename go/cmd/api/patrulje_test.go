@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/cmd/api/app"
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/jsonlog"
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	"nathejk.dk/pkg/filestream"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// teamModel is a data.Models.Teams holding a single patrulje and the
+// status changes in history.
+type teamModel struct {
+	patrulje *data.Patrulje
+	history  map[types.TeamID][]*data.StatusChange
+}
+
+func (m *teamModel) GetStartedTeamIDs(data.Filters) ([]types.TeamID, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+func (m *teamModel) GetDiscontinuedTeamIDs(data.Filters) ([]types.TeamID, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+func (m *teamModel) GetPatruljer(data.Filters) ([]*data.Patrulje, data.Metadata, error) {
+	return []*data.Patrulje{m.patrulje}, data.Metadata{}, nil
+}
+func (m *teamModel) GetPatrulje(teamID types.TeamID) (*data.Patrulje, error) {
+	if teamID != m.patrulje.ID {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.patrulje, nil
+}
+func (m *teamModel) GetKlan(types.TeamID) (*data.Klan, error)       { return nil, data.ErrRecordNotFound }
+func (m *teamModel) GetContact(types.TeamID) (*data.Contact, error) { return &data.Contact{}, nil }
+func (m *teamModel) RequestedSeniorCount() int                      { return 0 }
+func (m *teamModel) GetStatusHistory(teamID types.TeamID) ([]*data.StatusChange, error) {
+	if changes, ok := m.history[teamID]; ok {
+		return changes, nil
+	}
+	return []*data.StatusChange{}, nil
+}
+
+// memberModel is a data.Models.Members without members.
+type memberModel struct{}
+
+func (memberModel) GetSpejdere(data.Filters) ([]*data.Spejder, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+func (memberModel) GetSeniore(data.Filters) ([]*data.Senior, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+func (memberModel) GetInactive(data.Filters) ([]*data.SpejderStatus, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+func (memberModel) GetDuplicates(data.Filters) ([]*data.Duplicate, error) {
+	return []*data.Duplicate{}, nil
+}
+
+// newTeamTestApp returns an application on a file stream, where patrulje
+// "team-1" has signed up as the first event.
+func newTeamTestApp(t *testing.T) *application {
+	eventstream, err := filestream.Open(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eventstream.Close() })
+
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	teams := aggregate.NewStore(0)
+	models := data.Models{
+		Teams:   &teamModel{patrulje: &data.Patrulje{ID: "team-1", Name: "Ræverne"}},
+		Members: memberModel{},
+	}
+	a := &application{
+		JsonApi: app.JsonApi{Logger: logger},
+		models:  models,
+		stan:    eventstream,
+		projections: newProjections(eventstream, logger, func(streaminterface.Publisher) []streaminterface.Consumer {
+			return []streaminterface.Consumer{teams}
+		}),
+		commands: commands.New(eventstream, "2024", models, teams),
+		teams:    teams,
+		pincodes: app.NewLimiter(pincodeAttempts, pincodeWindow),
+		resends:  app.NewLimiter(confirmationResends, confirmationResendWindow),
+		logger:   logger,
+	}
+	a.config.year = "2024"
+	if err := a.projections.Start(); err != nil {
+		t.Fatal(err)
+	}
+	seq, err := a.commands.Team.Signup(context.Background(), types.TeamTypePatrulje, &messages.NathejkTeamSignedUp{TeamID: "team-1"})
+	if err != nil || seq != 1 {
+		t.Fatalf("signup at %d: %v", seq, err)
+	}
+	if !assert.Eventually(t, a.caughtUp, time.Second, time.Millisecond, "projections caught up") {
+		t.FailNow()
+	}
+	return a
+}
+
+// newConfirmedTeamTestApp returns an application like newTeamTestApp, where
+// the contact of "team-1" has confirmed the e-mail address and the phone
+// number, so the team is at version 3 and may be changed.
+func newConfirmedTeamTestApp(t *testing.T) *application {
+	a := newTeamTestApp(t)
+	if _, err := a.commands.Team.ConfirmEmail(context.Background(), "team-1", "anna@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	seq, err := a.commands.Team.ConfirmPhone(context.Background(), "team-1", "12345678")
+	if err != nil || seq != 3 {
+		t.Fatalf("confirm at %d: %v", seq, err)
+	}
+	return a
+}
+
+func TestShowPatruljeHandlerETag(t *testing.T) {
+	h := newTeamTestApp(t).routes()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/patrulje/team-1", nil))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"1"`, w.Header().Get("Etag"))
+}
+
+func TestUpdatePatruljeHandlerIfMatch(t *testing.T) {
+	tests := map[string]struct {
+		ifMatch string
+		status  int
+	}{
+		"missing":    {status: http.StatusPreconditionRequired},
+		"stale":      {ifMatch: `"0"`, status: http.StatusPreconditionFailed},
+		"unparsable": {ifMatch: `"abc"`, status: http.StatusPreconditionFailed},
+		"current":    {ifMatch: `"3"`, status: http.StatusOK},
+		"weak":       {ifMatch: `W/"3"`, status: http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := newConfirmedTeamTestApp(t).routes()
+
+			r := httptest.NewRequest(http.MethodPut, "/api/patrulje/team-1", strings.NewReader(`{"team":{"name":"Ulvene"},"contact":{"name":"Anna"}}`))
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status == http.StatusOK {
+				assert.Equal(t, `"4"`, w.Header().Get("Etag"), "version after the update")
+			}
+		})
+	}
+}
+
+func TestUpdatePatruljeHandlerUnconfirmed(t *testing.T) {
+	h := newTeamTestApp(t).routes()
+
+	// The contact has not confirmed the e-mail address and phone number.
+	r := httptest.NewRequest(http.MethodPut, "/api/patrulje/team-1", strings.NewReader(`{"team":{"name":"Ulvene"},"contact":{"name":"Anna"}}`))
+	r.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"nathejk.dk/internal/jsonlog"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/memorystream"
+	"nathejk.dk/pkg/stream"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// resetter is implemented by consumers whose read model can be emptied
+// before it is rebuilt from the start of the stream.
+type resetter interface {
+	Reset() error
+}
+
+// projections runs the stream switch that feeds the read models. It can be
+// rebuilt, which stops the switch, resets the consumers and replays the
+// event stream into a new switch.
+type projections struct {
+	eventstream streaminterface.Stream
+	consumers   func(streaminterface.Publisher) []streaminterface.Consumer
+	logger      *jsonlog.Logger
+
+	mu     sync.Mutex
+	swtch  *stream.Switch
+	mux    *stream.StreamMux
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newProjections(eventstream streaminterface.Stream, logger *jsonlog.Logger, consumers func(streaminterface.Publisher) []streaminterface.Consumer) *projections {
+	return &projections{
+		eventstream: eventstream,
+		consumers:   consumers,
+		logger:      logger,
+	}
+}
+
+// Switch returns the switch currently running.
+func (p *projections) Switch() *stream.Switch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.swtch
+}
+
+// Mux returns the stream mux of the switch currently running.
+func (p *projections) Mux() *stream.StreamMux {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.mux
+}
+
+// Start creates the switch and runs it in the background.
+func (p *projections) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.start(false)
+}
+
+// Rebuild stops the running switch, resets the consumers and starts a new
+// switch reading the event stream from the beginning. Until it has caught
+// up, the API answers 503 Service Unavailable.
+func (p *projections) Rebuild() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+	}
+	return p.start(true)
+}
+
+func (p *projections) start(reset bool) error {
+	memstream := memorystream.New()
+	mux := stream.NewStreamMux(memstream)
+	mux.Handles(p.eventstream, "nathejk", subject.Domain)
+
+	// Every consumer must be able to reset, or a rebuild would replay the
+	// stream on top of its old read model. This is checked on Start too, so
+	// a consumer that cannot reset fails at startup rather than on rebuild.
+	consumers := p.consumers(memstream)
+	for _, c := range consumers {
+		r, ok := c.(resetter)
+		if !ok {
+			return fmt.Errorf("projections: consumer %T cannot be reset", c)
+		}
+		if reset {
+			if err := r.Reset(); err != nil {
+				return err
+			}
+		}
+	}
+	swtch, err := stream.NewSwitch(mux, consumers)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := swtch.Run(ctx); err != nil {
+			p.logger.PrintFatal(err, nil)
+		}
+	}()
+	p.swtch, p.mux, p.cancel, p.done = swtch, mux, cancel, done
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nathejk.dk/internal/sms"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+var errCatchingUp = errors.New("catching up")
+
+// dependencyCheckInterval is how often the mail and SMS providers are
+// checked.
+const dependencyCheckInterval = time.Minute
+
+// appliedTimeout is how long a command handler waits for the projections to
+// apply the events it wrote before answering.
+const appliedTimeout = 2 * time.Second
+
+// applied waits until the projections have applied the event at seq, so the
+// read models include it, and reports whether they have. An unknown (zero)
+// sequence is never applied.
+func (app *application) applied(ctx context.Context, seq uint64) bool {
+	if seq == 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, appliedTimeout)
+	defer cancel()
+
+	return app.projections.Switch().WaitApplied(ctx, subject.Domain, seq) == nil
+}
+
+// caughtUp reports whether all projections have caught up with the stream.
+func (app *application) caughtUp() bool {
+	for _, c := range app.projections.Switch().ConsumerStats() {
+		if !c.CaughtUp {
+			return false
+		}
+	}
+	return true
+}
+
+func (app *application) registerReadinessChecks(db *database, eventstream streaminterface.Stream) {
+	for _, c := range app.projections.Switch().ConsumerStats() {
+		name := c.Name
+		app.AddReadinessCheck("projection "+name, func(context.Context) error {
+			for _, c := range app.projections.Switch().ConsumerStats() {
+				if c.Name == name && !c.CaughtUp {
+					return errCatchingUp
+				}
+			}
+			return nil
+		})
+	}
+	app.AddReadinessCheck("database", func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	})
+	if p, ok := eventstream.(interface{ Ping() error }); ok {
+		app.AddReadinessCheck("nats", func(context.Context) error {
+			return p.Ping()
+		})
+	}
+	app.AddDependencyCheck("smtp", dependencyCheckInterval, app.mailer.Ping)
+	app.AddDependencyCheck("sms", dependencyCheckInterval, func(ctx context.Context) error {
+		return sms.Ping(ctx, app.sms)
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"os"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/nathejk/shared-go/types"
+
+	"nathejk.dk/pkg/metrics"
 )
 
 func (app *application) routes() http.Handler {
@@ -21,12 +24,21 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPatch, "/api/person/:id", app.updatePersonHandler)
 	router.HandlerFunc(http.MethodPost, "/api/signup", app.signupHandler)
 	router.HandlerFunc(http.MethodPost, "/api/signup/pincode", app.signupPincodeHandler)
+	router.HandlerFunc(http.MethodPost, "/api/signup/resend", app.resendConfirmationHandler)
 	router.HandlerFunc(http.MethodGet, "/api/signup/:id", app.showSignupHandler)
 	router.HandlerFunc(http.MethodGet, "/api/patrulje/:id", app.showPatruljeHandler)
 	router.HandlerFunc(http.MethodPut, "/api/patrulje/:id", app.updatePatruljeHandler)
+	router.HandlerFunc(http.MethodPatch, "/api/patrulje/:id/contact", app.updateContactHandler)
+	router.HandlerFunc(http.MethodPost, "/api/patrulje/:id/members/:memberId", app.createSpejderHandler)
+	router.HandlerFunc(http.MethodPatch, "/api/patrulje/:id/members/:memberId", app.updateSpejderHandler)
+	router.HandlerFunc(http.MethodDelete, "/api/patrulje/:id/members/:memberId", app.deleteMemberHandler(types.TeamTypePatrulje))
 	router.HandlerFunc(http.MethodGet, "/api/klan/:id", app.showKlanHandler)
 	router.HandlerFunc(http.MethodPut, "/api/klan/:id", app.updateKlanHandler)
+	router.HandlerFunc(http.MethodPost, "/api/klan/:id/members/:memberId", app.createSeniorHandler)
+	router.HandlerFunc(http.MethodPatch, "/api/klan/:id/members/:memberId", app.updateSeniorHandler)
+	router.HandlerFunc(http.MethodDelete, "/api/klan/:id/members/:memberId", app.deleteMemberHandler(types.TeamTypeKlan))
 	router.HandlerFunc(http.MethodGet, "/confirm/:id", app.confirmSignupHandler)
+	router.HandlerFunc(http.MethodPost, "/confirm/:id/resend", app.resendExpiredConfirmationHandler)
 	router.HandlerFunc(http.MethodPut, "/api/pay/:id", app.sendMobilepaySmsHandler)
 	/*
 		router.HandlerFunc(http.MethodPut, "/api/*filepath", app.cleo.ProxyHandler)
@@ -35,14 +47,51 @@ func (app *application) routes() http.Handler {
 		router.HandlerFunc(http.MethodDelete, "/api/*filepath", app.cleo.ProxyHandler)
 		router.HandlerFunc(http.MethodPatch, "/api/*filepath", app.cleo.ProxyHandler)
 	*/
+	// Admin routes are not gated on the projections being caught up, as they
+	// are used to find out why they are not.
+	admin := httprouter.New()
+	admin.NotFound = http.HandlerFunc(app.NotFoundResponse)
+	admin.MethodNotAllowed = http.HandlerFunc(app.MethodNotAllowedResponse)
+
+	admin.HandlerFunc(http.MethodGet, "/admin/topology", app.RequireBearerToken(app.config.admin.token, app.showTopologyHandler))
+	admin.HandlerFunc(http.MethodGet, "/admin/invalid-events", app.RequireBearerToken(app.config.admin.token, app.listInvalidEventsHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/invalid-events", app.RequireBearerToken(app.config.admin.token, app.createInvalidEventHandler))
+	admin.HandlerFunc(http.MethodDelete, "/admin/invalid-events/:channel/:sequence", app.RequireBearerToken(app.config.admin.token, app.deleteInvalidEventHandler))
+	admin.HandlerFunc(http.MethodGet, "/admin/duplicates", app.RequireBearerToken(app.config.admin.token, app.listDuplicatesHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/duplicates/resolve", app.RequireBearerToken(app.config.admin.token, app.resolveDuplicateHandler))
+	admin.HandlerFunc(http.MethodGet, "/admin/mailtemplates", app.RequireBearerToken(app.config.admin.token, app.listMailTemplatesHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/mailtemplates/preview", app.RequireBearerToken(app.config.admin.token, app.previewMailTemplateHandler))
+	admin.HandlerFunc(http.MethodPut, "/admin/mailtemplates/:slug", app.RequireBearerToken(app.config.admin.token, app.updateMailTemplateHandler))
+	admin.HandlerFunc(http.MethodDelete, "/admin/mailtemplates/:slug", app.RequireBearerToken(app.config.admin.token, app.deleteMailTemplateHandler))
+	admin.HandlerFunc(http.MethodGet, "/admin/outbox", app.RequireBearerToken(app.config.admin.token, app.listOutboxHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/outbox/:id/resend", app.RequireBearerToken(app.config.admin.token, app.resendOutboxHandler))
+	admin.HandlerFunc(http.MethodPut, "/admin/patrulje/:id/number", app.RequireBearerToken(app.config.admin.token, app.assignNumberHandler(types.TeamTypePatrulje)))
+	admin.HandlerFunc(http.MethodPut, "/admin/klan/:id/number", app.RequireBearerToken(app.config.admin.token, app.assignNumberHandler(types.TeamTypeKlan)))
+	admin.HandlerFunc(http.MethodGet, "/admin/patrulje/:id/status", app.RequireBearerToken(app.config.admin.token, app.showStatusHistoryHandler))
+	admin.HandlerFunc(http.MethodPut, "/admin/patrulje/:id/status", app.RequireBearerToken(app.config.admin.token, app.changeStatusHandler(types.TeamTypePatrulje)))
+	admin.HandlerFunc(http.MethodGet, "/admin/klan/:id/status", app.RequireBearerToken(app.config.admin.token, app.showStatusHistoryHandler))
+	admin.HandlerFunc(http.MethodPut, "/admin/klan/:id/status", app.RequireBearerToken(app.config.admin.token, app.changeStatusHandler(types.TeamTypeKlan)))
+	// HQ may add and edit members outside the age rules of the year.
+	admin.HandlerFunc(http.MethodPut, "/admin/patrulje/:id", app.hqApproved(app.updatePatruljeHandler))
+	admin.HandlerFunc(http.MethodPatch, "/admin/patrulje/:id/contact", app.hqApproved(app.updateContactHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/patrulje/:id/members/:memberId", app.hqApproved(app.createSpejderHandler))
+	admin.HandlerFunc(http.MethodPatch, "/admin/patrulje/:id/members/:memberId", app.hqApproved(app.updateSpejderHandler))
+	admin.HandlerFunc(http.MethodPut, "/admin/klan/:id", app.hqApproved(app.updateKlanHandler))
+	admin.HandlerFunc(http.MethodPost, "/admin/klan/:id/members/:memberId", app.hqApproved(app.createSeniorHandler))
+	admin.HandlerFunc(http.MethodPatch, "/admin/klan/:id/members/:memberId", app.hqApproved(app.updateSeniorHandler))
+
 	mux := http.NewServeMux()
 	mux.Handle("/", http.FileServer(SpaFileSystem(http.Dir(app.config.webroot))))
-	mux.HandleFunc("/api/v1/healthcheck", app.HealthcheckHandler)
-	mux.Handle("/api/", app.Metrics(router))
-	mux.Handle("/confirm/", router)
+	mux.HandleFunc("/api/v1/healthcheck", app.ReadyzHandler)
+	mux.HandleFunc("/livez", app.LivezHandler)
+	mux.HandleFunc("/readyz", app.ReadyzHandler)
+	mux.Handle("/api/", app.RequireCaughtUp(app.caughtUp, app.Metrics(router)))
+	mux.Handle("/confirm/", app.RequireCaughtUp(app.caughtUp, router))
+	mux.Handle("/admin/", app.Metrics(admin))
 	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
 
-	return mux
+	return app.RequestID(app.LogRequests(mux))
 }
 
 type spaFileSystem struct {
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/google/uuid"
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
 	jsonapi "nathejk.dk/cmd/api/app"
 	"nathejk.dk/internal/data"
 	"nathejk.dk/internal/validator"
+	nathejk "nathejk.dk/nathejk/messages"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/correlation"
+	"nathejk.dk/pkg/nats"
 	"nathejk.dk/pkg/streaminterface"
 )
 
@@ -61,6 +66,16 @@ func (app *application) showSignupHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// A team may enter a wrong pincode pincodeAttempts times within
+// pincodeWindow.
+const (
+	pincodeAttempts = 5
+	pincodeWindow   = 15 * time.Minute
+)
+
+// signupPincodeHandler confirms the phone number of a team with the pincode
+// texted to it. The signup continues on the team page once both the e-mail
+// address and the phone number are confirmed.
 func (app *application) signupPincodeHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		TeamID  types.TeamID `json:"teamId"`
@@ -75,8 +90,20 @@ func (app *application) signupPincodeHandler(w http.ResponseWriter, r *http.Requ
 		app.BadRequestResponse(w, r, err)
 		return
 	}
+	// The pincode has only 4 digits, so a team is locked out after a few
+	// wrong guesses.
+	if !app.pincodes.Allow(string(team.TeamID)) {
+		app.RateLimitExceededResponse(w, r)
+		return
+	}
 	if team.Pincode != input.Pincode {
 		app.InvalidCredentialsResponse(w, r)
+		return
+	}
+	app.pincodes.Reset(string(team.TeamID))
+	if _, err := app.commands.Team.ConfirmPhone(r.Context(), team.TeamID, team.PhonePending); err != nil {
+		app.commandErrorResponse(w, r, err)
+		return
 	}
 	page := fmt.Sprintf("/%s/%s", team.TeamType, input.TeamID)
 	err = app.WriteJSON(w, http.StatusCreated, jsonapi.Envelope{"team": map[string]string{"teamPage": page}}, nil)
@@ -110,9 +137,14 @@ func (app *application) sendMobilepaySmsHandler(w http.ResponseWriter, r *http.R
 		mobilepay = 204414
 	}
 	text := fmt.Sprintf("https://www.mobilepay.dk/erhverv/betalingslink/betalingslink-svar?phone=%d&amount=%d&comment=%s&lock=1", mobilepay, input.Amount, teamID)
-	err = app.sms.Send(input.Phone.Normalize(), text)
+	err = app.requestSms(r.Context(), &nathejk.NathejkSmsRequested{
+		PingType: nathejktypes.PingType(types.PingTypeMobilepayLink),
+		TeamID:   nathejktypes.TeamID(teamID),
+		Phone:    nathejktypes.PhoneNumber(input.Phone),
+		Text:     text,
+	})
 	if err != nil {
-		app.BadRequestResponse(w, r, err)
+		app.ServerErrorResponse(w, r, err)
 		return
 	}
 	err = app.WriteJSON(w, http.StatusCreated, jsonapi.Envelope{"ok": true}, nil)
@@ -120,31 +152,7 @@ func (app *application) sendMobilepaySmsHandler(w http.ResponseWriter, r *http.R
 		app.ServerErrorResponse(w, r, err)
 	}
 }
-func (app *application) confirmSignupHandler(w http.ResponseWriter, r *http.Request) {
-	id := app.ReadNamedParam(r, "id")
-	if id == "" {
-		app.NotFoundResponse(w, r)
-		return
-	}
-	teamID, err := app.models.Signup.ConfirmBySecret(id)
-	if err != nil {
-		app.ServerErrorResponse(w, r, err)
-		return
-	}
-	team, err := app.models.Signup.GetByID(teamID)
-	if err != nil {
-		app.BadRequestResponse(w, r, err)
-		return
-	}
-	err = app.sms.Send(team.PhonePending.Normalize(), "Din aktiveringskode til Nathejktilmeldingen er: "+team.Pincode)
-	if err != nil {
-		app.BadRequestResponse(w, r, err)
-		return
-	}
-	http.Redirect(w, r, fmt.Sprintf("/indskrivning/%s", teamID), http.StatusSeeOther)
-}
-
-func (app *application) commandCreatePerson(person *data.Personnel) {
+func (app *application) commandCreatePerson(ctx context.Context, person *data.Personnel) {
 	if person.Pincode == "" {
 		pin := fmt.Sprintf("%v", rand.Float64())
 		pin = pin[len(pin)-4:]
@@ -154,20 +162,24 @@ func (app *application) commandCreatePerson(person *data.Personnel) {
 		person.UserID = types.UserID("user-" + uuid.New().String())
 	}
 
-	err := app.sms.Send(person.Phone.Normalize(), "Din pinkode til Nathejktilmeldingen er: "+person.Pincode)
+	err := app.requestSms(ctx, &nathejk.NathejkSmsRequested{
+		PingType: nathejktypes.PingType(types.PingTypeValidate),
+		Phone:    nathejktypes.PhoneNumber(person.Phone),
+		Text:     "Din pinkode til Nathejktilmeldingen er: " + person.Pincode,
+	})
 	if err != nil {
-		//app.BadRequestResponse(w, r, err)
+		app.logger.PrintError(err, map[string]string{"correlation_id": correlation.CorrelationID(ctx)})
 		return
 	}
-	msg := app.stan.MessageFunc()(streaminterface.SubjectFromStr("nathejk:personnel.updated"))
+	msg := app.message(ctx, streaminterface.SubjectFromStr("nathejk:personnel.updated"))
 	msg.SetBody(&messages.NathejkPersonnelCreated{
 		UserID:  person.UserID,
 		Phone:   types.PhoneNumber(person.Phone.Normalize()),
 		Pincode: person.Pincode,
 	})
 	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
-	if err := app.stan.Publish(msg); err != nil {
-		app.logger.PrintError(err, nil)
+	if err := app.stan.Publish(msg); err != nil && !errors.Is(err, nats.ErrBuffered) {
+		app.logger.PrintError(err, map[string]string{"correlation_id": correlation.CorrelationID(ctx)})
 	}
 }
 func (app *application) startHandler(w http.ResponseWriter, r *http.Request) {
@@ -189,8 +201,8 @@ func (app *application) startHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	app.Background(func() {
-		app.commandCreatePerson(person)
+	app.Background(r.Context(), func(ctx context.Context) {
+		app.commandCreatePerson(ctx, person)
 	})
 	/*
 		msg := &messages.NathejkTeamSignedUp{
@@ -277,52 +289,39 @@ func (app *application) signupHandler(w http.ResponseWriter, r *http.Request) {
 		Phone:  input.PhonePending,
 		Email:  input.EmailPending,
 	}
-	/*
-	   v := validator.New()
-
-	   	if product.Validate(v); !v.Valid() {
-	   		app.FailedValidationResponse(w, r, v.Errors)
-	   		return
-	   	}
-	*/
-	if err := app.commands.Team.Signup(input.TeamType, msg); err != nil {
-		spew.Dump(input)
-		app.ServerErrorResponse(w, r, err)
+	v := validator.New()
+	v.Check(types.TeamTypes.Exists(input.TeamType), "type", "must be patrulje or klan")
+	v.Check(strings.TrimSpace(input.Name) != "", "name", "must be provided")
+	v.Check(input.EmailPending.Valid(), "emailPending", "must be a valid email address")
+	v.Check(input.PhonePending.IsValid(), "phonePending", "must be a phone number of 8 digits")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
-
-	team, _ := app.models.Signup.GetByID(msg.TeamID)
-	if team == nil {
-		team = &data.Signup{TeamID: msg.TeamID, TeamType: input.TeamType}
+	seq, err := app.commands.Team.Signup(r.Context(), input.TeamType, msg)
+	if err != nil {
+		app.commandErrorResponse(w, r, err)
+		return
 	}
-	team.Name = input.Name
-	team.PhonePending = input.PhonePending
-	team.EmailPending = input.EmailPending
 
-	app.Background(func() {
-		data := map[string]any{
-			"team":   team,
-			"secret": uuid.New().String(),
-		}
+	// The team is signed up even if the mail cannot be requested, as the
+	// contact can ask for it to be resent.
+	if err := app.sendConfirmationMail(r.Context(), msg.TeamID, input.EmailPending); err != nil {
+		app.logger.PrintError(err, map[string]string{"correlation_id": correlation.CorrelationID(r.Context())})
+	}
 
-		err := app.mailer.Send(string(input.EmailPending), "verify_email.tmpl", data)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-		msg := app.stan.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.%s.%s.mail.%s.sent", "2024", input.TeamType, team.TeamID, types.PingTypeSignup)))
-		msg.SetBody(&messages.NathejkMailSent{
-			PingType:  types.PingTypeSignup,
-			TeamID:    team.TeamID,
-			Recipient: types.EmailAddress(input.EmailPending),
-			Subject:   "Bekræft e-mailadresse",
-		})
-		msg.SetMeta(&messages.Metadata{Producer: "deltag-api", Phase: data["secret"].(string)})
-		if err := app.stan.Publish(msg); err != nil {
-			app.logger.PrintError(err, nil)
+	if app.applied(r.Context(), seq) {
+		if team, err := app.models.Signup.GetByID(msg.TeamID); err == nil {
+			err = app.WriteJSON(w, http.StatusCreated, jsonapi.Envelope{"team": team}, nil)
+			if err != nil {
+				app.ServerErrorResponse(w, r, err)
+			}
+			return
 		}
-	})
-
-	err := app.WriteJSON(w, http.StatusCreated, jsonapi.Envelope{"team": team}, nil)
+	}
+	// The read model has not seen the signup yet, so the client must fetch
+	// the team later.
+	err = app.WriteJSON(w, http.StatusAccepted, jsonapi.Envelope{"teamId": msg.TeamID}, nil)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
@@ -345,15 +344,6 @@ func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	// If the request contains a X-Expected-Version header, verify that the
-	// version in the database matches the expected version specified in the header.
-	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.FormatInt(int64(person.Version), 32) != r.Header.Get("X-Expected-Version") {
-			app.EditConflictResponse(w, r)
-			return
-		}
-	}
-
 	var input struct {
 		Name       *string             `json:"name"`
 		Email      *types.EmailAddress `json:"email"`
@@ -397,7 +387,7 @@ func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Reque
 		app.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
-	msg := app.stan.MessageFunc()(streaminterface.SubjectFromStr("nathejk:personnel.updated"))
+	msg := app.message(r.Context(), streaminterface.SubjectFromStr("nathejk:personnel.updated"))
 	msg.SetBody(&messages.NathejkPersonnelUpdated{
 		UserID:     person.UserID,
 		Name:       person.Name,
@@ -410,8 +400,8 @@ func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Reque
 		Diet:       person.Diet,
 	})
 	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
-	if err := app.stan.Publish(msg); err != nil {
-		app.logger.PrintError(err, nil)
+	if err := app.stan.Publish(msg); err != nil && !errors.Is(err, nats.ErrBuffered) {
+		app.logger.PrintError(err, map[string]string{"correlation_id": correlation.CorrelationID(r.Context())})
 	}
 
 	/*
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+)
+
+// signupModel is a data.Models.Signup knowing the teams in it.
+type signupModel map[types.TeamID]*data.Signup
+
+func (m signupModel) GetByID(teamID types.TeamID) (*data.Signup, error) {
+	if s, ok := m[teamID]; ok {
+		return s, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+func (m signupModel) GetConfirmation(string) (*data.Confirmation, error) {
+	return nil, data.ErrRecordNotFound
+}
+
+// nopMailer is a mailer sending nothing.
+type nopMailer struct{}
+
+func (nopMailer) Send(string, string, any) error { return nil }
+func (nopMailer) Ping(context.Context) error     { return nil }
+
+func TestSignupHandler(t *testing.T) {
+	tests := map[string]struct {
+		signups signupModel
+		status  int
+	}{
+		"read model has the team": {
+			signups: signupModel{"team-2": {TeamID: "team-2", Name: "Ulvene"}},
+			status:  http.StatusCreated,
+		},
+		"read model lacks the team": {
+			signups: signupModel{},
+			status:  http.StatusAccepted,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.models.Signup = tt.signups
+			a.mailer = nopMailer{}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/signup", strings.NewReader(`{"teamId":"team-2","type":"patrulje","name":"Ulvene","emailPending":"anna@example.com","phonePending":"12345678"}`))
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+
+			var body struct {
+				TeamID types.TeamID `json:"teamId"`
+				Team   *data.Signup `json:"team"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			if tt.status == http.StatusCreated {
+				assert.Equal(t, "Ulvene", body.Team.Name)
+			} else {
+				assert.Equal(t, types.TeamID("team-2"), body.TeamID)
+			}
+		})
+	}
+}
+
+func TestSignupHandlerTeamExists(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.mailer = nopMailer{}
+
+	// team-1 has signed up already, so its signup is not overwritten.
+	r := httptest.NewRequest(http.MethodPost, "/api/signup", strings.NewReader(`{"teamId":"team-1","type":"patrulje","name":"Ulvene","emailPending":"anna@example.com","phonePending":"12345678"}`))
+	w := httptest.NewRecorder()
+	a.routes().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
+
+func TestSignupHandlerValidation(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.mailer = nopMailer{}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/signup", strings.NewReader(`{"type":"spejder","emailPending":"anna","phonePending":"1234"}`))
+	w := httptest.NewRecorder()
+	a.routes().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	var body struct {
+		Error map[string]string `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]string{
+		"type":         "must be patrulje or klan",
+		"name":         "must be provided",
+		"emailPending": "must be a valid email address",
+		"phonePending": "must be a phone number of 8 digits",
+	}, body.Error)
+}
+
+func TestSignupPincodeHandler(t *testing.T) {
+	tests := map[string]struct {
+		pincode        string
+		emailConfirmed bool
+		status         int
+		phone          types.PhoneNumber
+	}{
+		"wrong pincode": {
+			pincode: "4321", emailConfirmed: true,
+			status: http.StatusUnauthorized,
+		},
+		"e-mail not confirmed": {
+			pincode: "1234",
+			status:  http.StatusConflict,
+		},
+		"confirmed": {
+			pincode: "1234", emailConfirmed: true,
+			status: http.StatusCreated,
+			phone:  "12345678",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTeamTestApp(t)
+			a.models.Signup = signupModel{"team-1": {TeamID: "team-1", TeamType: types.TeamTypePatrulje, PhonePending: "12345678", Pincode: "1234"}}
+			if tt.emailConfirmed {
+				_, err := a.commands.Team.ConfirmEmail(context.Background(), "team-1", "anna@example.com")
+				assert.NoError(t, err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/signup/pincode", strings.NewReader(`{"teamId":"team-1","pincode":"`+tt.pincode+`"}`))
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status == http.StatusCreated {
+				assert.JSONEq(t, `{"team":{"teamPage":"/patrulje/team-1"}}`, w.Body.String())
+			}
+
+			team, err := a.teams.LoadTeam("team-1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.phone, team.Phone)
+		})
+	}
+}
+
+func TestSignupPincodeHandlerLockout(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.models.Signup = signupModel{"team-1": {TeamID: "team-1", TeamType: types.TeamTypePatrulje, PhonePending: "12345678", Pincode: "1234"}}
+	_, err := a.commands.Team.ConfirmEmail(context.Background(), "team-1", "anna@example.com")
+	assert.NoError(t, err)
+	h := a.routes()
+
+	enter := func(pincode string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/signup/pincode", strings.NewReader(`{"teamId":"team-1","pincode":"`+pincode+`"}`))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < pincodeAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, enter("4321"))
+	}
+	// The right pincode is not accepted either once the team is locked out.
+	assert.Equal(t, http.StatusTooManyRequests, enter("1234"))
+}
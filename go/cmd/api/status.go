@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/nathejk/shared-go/types"
+	jsonapi "nathejk.dk/cmd/api/app"
+)
+
+func (app *application) statusHistoryEnvelope(teamID types.TeamID) func() (jsonapi.Envelope, error) {
+	return func() (jsonapi.Envelope, error) {
+		history, err := app.models.Teams.GetStatusHistory(teamID)
+		return jsonapi.Envelope{"statusHistory": history}, err
+	}
+}
+
+// showStatusHistoryHandler shows the signup status changes of a team.
+func (app *application) showStatusHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+	env, err := app.statusHistoryEnvelope(teamID)()
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	if err := app.WriteJSON(w, http.StatusOK, env, nil); err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// changeStatusHandler returns the handler with which HQ changes the signup
+// status of a team of teamType, giving a reason.
+func (app *application) changeStatusHandler(teamType types.TeamType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamID := types.TeamID(app.ReadNamedParam(r, "id"))
+		var input struct {
+			Status types.SignupStatus `json:"status"`
+			Reason string             `json:"reason"`
+		}
+		if err := app.ReadJSON(w, r, &input); err != nil {
+			app.BadRequestResponse(w, r, err)
+			return
+		}
+		seq, err := app.commands.Team.ChangeStatus(r.Context(), teamID, teamType, input.Status, input.Reason)
+		if err != nil {
+			app.logger.PrintInfo("change status failed", map[string]string{"teamId": string(teamID), "status": string(input.Status), "error": err.Error()})
+			app.commandErrorResponse(w, r, err)
+			return
+		}
+		app.changedResponse(w, r, teamID, seq, http.StatusOK, app.statusHistoryEnvelope(teamID))
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+)
+
+func TestShowStatusHistoryHandler(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.config.admin.token = "secret"
+	a.models.Teams.(*teamModel).history = map[types.TeamID][]*data.StatusChange{
+		"team-1": {
+			{Status: types.SignupStatusPay, Reason: "signed up", ChangedAt: "2024-05-01T12:00:00Z"},
+			{Status: types.SignupStatusPaid, Reason: "paid by bank transfer", ChangedAt: "2024-05-02T12:00:00Z"},
+		},
+	}
+	h := a.routes()
+
+	w := adminRequest(t, h, http.MethodGet, "/admin/patrulje/team-1/status", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"statusHistory":[
+		{"status":"PAY","reason":"signed up","changedAt":"2024-05-01T12:00:00Z"},
+		{"status":"PAID","reason":"paid by bank transfer","changedAt":"2024-05-02T12:00:00Z"}
+	]}`, w.Body.String())
+
+	w = adminRequest(t, h, http.MethodGet, "/admin/patrulje/team-2/status", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"statusHistory":[]}`, w.Body.String())
+}
+
+func TestChangeStatusHandler(t *testing.T) {
+	a := newTeamTestApp(t)
+	a.config.admin.token = "secret"
+	h := a.routes()
+
+	w := adminRequest(t, h, http.MethodPut, "/admin/patrulje/team-1/status", `{"status":"PAY","reason":"signed up"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("Etag"))
+
+	w = adminRequest(t, h, http.MethodPut, "/admin/patrulje/team-1/status", `{"status":"STARTED","reason":"started early"}`)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = adminRequest(t, h, http.MethodPut, "/admin/klan/team-1/status", `{"status":"PAID","reason":"paid"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
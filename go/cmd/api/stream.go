@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/url"
+
+	"nathejk.dk/pkg/filestream"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// openStream opens the event stream given by dsn: NATS Streaming for stan://
+// DSNs, or a local JSONL file for file:// DSNs, which lets the API run
+// offline on a recorded event log.
+func openStream(dsn string) (streaminterface.Stream, error) {
+	u, err := url.Parse(dsn)
+	if err == nil && u.Scheme == "file" {
+		s, err := filestream.Open(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nats.NewNATSStreamUnique(dsn, "hq-api"), nil
+}
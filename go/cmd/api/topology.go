@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	jsonapi "nathejk.dk/cmd/api/app"
+)
+
+// showTopologyHandler returns the consumer→subject graph of the stream switch
+// with live stats, as JSON or, with ?format=dot, as Graphviz DOT.
+func (app *application) showTopologyHandler(w http.ResponseWriter, r *http.Request) {
+	graph := app.projections.Switch().Graph()
+
+	if app.ReadString(r.URL.Query(), "format", "json") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		io.WriteString(w, graph.DOT())
+		return
+	}
+	err := app.WriteJSON(w, http.StatusOK, jsonapi.Envelope{"topology": graph}, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Command nathejkctl is a command line tool for operating the signup
+// service.
+//
+// Usage:
+//
+//	nathejkctl <command> [flags]
+//
+// Run "nathejkctl <command> -h" for the flags of a command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"topology", "print the consumer→subject graph of a running api as JSON or DOT", runTopology},
+	{"stream", "dump a channel to JSONL, or replay JSONL into a stream", runStream},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: nathejkctl <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "nathejkctl %s: %s\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
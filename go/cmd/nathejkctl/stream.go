@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"nathejk.dk/pkg/filestream"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+	"nathejk.dk/superfluids/jetstream"
+	sfstreaminterface "nathejk.dk/superfluids/streaminterface"
+)
+
+const streamUsage = `Usage:
+  nathejkctl stream dump [flags]    write a channel as JSONL
+  nathejkctl stream replay [flags]  publish JSONL into a stream
+
+Sources and destinations are given as DSNs:
+  stan://host:4222/cluster   NATS Streaming
+  nats://host:4222           JetStream (dump only)
+  file:///path/events.jsonl  JSONL stream file
+`
+
+func runStream(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, streamUsage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "dump":
+		return runStreamDump(args[1:])
+	case "replay":
+		return runStreamReplay(args[1:])
+	}
+	fmt.Fprint(os.Stderr, streamUsage)
+	os.Exit(2)
+	return nil
+}
+
+// filterFlags defines the record filter flags on fs. The returned function
+// builds the filter once fs has been parsed.
+func filterFlags(fs *flag.FlagSet) func() (filestream.Filter, error) {
+	subject := fs.String("subject", "", "only records matching the subject pattern, e.g. NATHEJK.*.klan.*.updated")
+	team := fs.String("team", "", "only records of the team ID")
+	since := fs.String("since", "", "only records at or after the time (RFC3339)")
+	until := fs.String("until", "", "only records at or before the time (RFC3339)")
+
+	return func() (f filestream.Filter, err error) {
+		f.Subject, f.TeamID = *subject, *team
+		if *since != "" {
+			if f.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+				return f, fmt.Errorf("-since: %w", err)
+			}
+		}
+		if *until != "" {
+			if f.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+				return f, fmt.Errorf("-until: %w", err)
+			}
+		}
+		return f, nil
+	}
+}
+
+func runStreamDump(args []string) error {
+	fs := flag.NewFlagSet("stream dump", flag.ExitOnError)
+	from := fs.String("from", getEnv("STAN_DSN", ""), "source DSN")
+	channel := fs.String("channel", "NATHEJK", "channel or JetStream stream to dump")
+	output := fs.String("o", "-", "output file, - for stdout")
+	filter := filterFlags(fs)
+	fs.Parse(args)
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(*from)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	n := 0
+	emit := func(r filestream.Record) error {
+		if !f.Match(r) {
+			return nil
+		}
+		n++
+		return filestream.WriteRecord(w, r)
+	}
+
+	switch u.Scheme {
+	case "file":
+		err = dumpFile(u.Path, *channel, emit)
+	case "stan":
+		err = dumpStan(*from, *channel, emit)
+	case "nats":
+		err = dumpJetStream(*from, *channel, emit)
+	default:
+		return fmt.Errorf("unsupported source %q", *from)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dumped %d records\n", n)
+	return nil
+}
+
+func dumpFile(path, channel string, emit func(filestream.Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return filestream.ReadRecords(file, func(r filestream.Record) error {
+		if r.Channel != channel {
+			return nil
+		}
+		return emit(r)
+	})
+}
+
+// dumpStan reads channel from its first message until it is caught up.
+// Messages arriving after that are ignored.
+func dumpStan(dsn, channel string, emit func(filestream.Record) error) error {
+	s := nats.NewNATSStreamUnique(dsn, "nathejkctl")
+	defer s.Close()
+
+	var (
+		mu   sync.Mutex
+		done bool
+	)
+	result := make(chan error, 1)
+	finish := func(err error) {
+		if !done {
+			done = true
+			result <- err
+		}
+	}
+	sub, err := s.Subscribe(channel, streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return nil
+		}
+		if caughtup.IsCaughtup(msg) {
+			finish(nil)
+			return nil
+		}
+		r, err := filestream.NewRecord(channel, msg.Sequence(), msg)
+		if err == nil {
+			err = emit(r)
+		}
+		if err != nil {
+			finish(err)
+		}
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	return <-result
+}
+
+// jetstreamMessage is implemented by the messages read from JetStream.
+type jetstreamMessage interface {
+	sfstreaminterface.Message
+	EventID() jetstream.EventID
+	CorrelationID() jetstream.EventID
+	CausationID() jetstream.EventID
+}
+
+func dumpJetStream(dsn, stream string, emit func(filestream.Record) error) error {
+	js, err := jetstream.New(dsn)
+	if err != nil {
+		return err
+	}
+	return js.ReadAll(context.Background(), stream, sfstreaminterface.MessageHandlerFunc(func(msg sfstreaminterface.Message) error {
+		m, ok := msg.(jetstreamMessage)
+		if !ok {
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+		body, _ := m.RawBody().(json.RawMessage)
+		meta, _ := m.RawMeta().(json.RawMessage)
+		return emit(filestream.Record{
+			Channel:  m.Subject().Domain(),
+			Sequence: m.Sequence(),
+			Envelope: nats.Envelope{
+				EventID:       string(m.EventID()),
+				CorrelationID: string(m.CorrelationID()),
+				CausationID:   string(m.CausationID()),
+				Datetime:      m.Time(),
+				Type:          m.Subject().Type(),
+				Body:          body,
+				Meta:          meta,
+			},
+		})
+	}))
+}
+
+func runStreamReplay(args []string) error {
+	fs := flag.NewFlagSet("stream replay", flag.ExitOnError)
+	to := fs.String("to", "", "destination DSN")
+	input := fs.String("i", "-", "input file, - for stdin")
+	filter := filterFlags(fs)
+	fs.Parse(args)
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(*to)
+	if err != nil {
+		return err
+	}
+
+	var p interface {
+		streaminterface.Publisher
+		Close() error
+	}
+	switch u.Scheme {
+	case "file":
+		s, err := filestream.Open(u.Path)
+		if err != nil {
+			return err
+		}
+		p = s
+	case "stan":
+		p = nats.NewNATSStreamUnique(*to, "nathejkctl")
+	default:
+		return fmt.Errorf("unsupported destination %q", *to)
+	}
+	defer p.Close()
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	n, err := filestream.Replay(r, p, f)
+	if err != nil {
+		return fmt.Errorf("after %d records: %w", n, err)
+	}
+	fmt.Fprintf(os.Stderr, "replayed %d records\n", n)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+func runTopology(args []string) error {
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	addr := fs.String("addr", getEnv("NATHEJK_API", "http://localhost"), "API base URL")
+	format := fs.String("format", "json", "output format: json or dot")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "bearer token for the admin API")
+	fs.Parse(args)
+
+	if *format != "json" && *format != "dot" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	u, err := url.Parse(*addr)
+	if err != nil {
+		return err
+	}
+	u = u.JoinPath("admin", "topology")
+	u.RawQuery = url.Values{"format": {*format}}.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, res.Status)
+	}
+
+	if *format == "dot" {
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	}
+	var env struct {
+		Topology json.RawMessage `json:"topology"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(env.Topology)
+}
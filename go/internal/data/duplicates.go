@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nathejk/shared-go/types"
+)
+
+// Participant is a spejder or senior as compared by FindDuplicates.
+type Participant struct {
+	MemberID types.MemberID `json:"memberId"`
+	TeamID   types.TeamID   `json:"teamId"`
+	TeamType types.TeamType `json:"teamType"`
+	Name     string         `json:"name"`
+	Email    string         `json:"email"`
+	Phone    string         `json:"phone"`
+	Birthday types.Date     `json:"birthday"`
+}
+
+// Duplicate is a pair of participants suspected to be the same person.
+// Matches tells what they have in common: "phone", "email" or
+// "name+birthday".
+type Duplicate struct {
+	Member  Participant `json:"member"`
+	Other   Participant `json:"other"`
+	Matches []string    `json:"matches"`
+}
+
+// normalizePhone returns the digits of a phone number without the danish
+// country code, so "+45 12 34 56 78" and "12345678" are the same.
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > 8 {
+		digits = strings.TrimPrefix(strings.TrimPrefix(digits, "00"), "45")
+	}
+	return digits
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeName returns the name in lower case with single spaces.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// FindDuplicates returns the pairs of participants sharing a phone number,
+// an email address, or a name and birthday. Empty values are not compared.
+func FindDuplicates(participants []Participant) []*Duplicate {
+	type pair struct{ i, j int }
+	matches := map[pair][]string{}
+
+	match := func(kind string, key func(Participant) string) {
+		seen := map[string][]int{}
+		for j, p := range participants {
+			k := key(p)
+			if k == "" {
+				continue
+			}
+			for _, i := range seen[k] {
+				matches[pair{i, j}] = append(matches[pair{i, j}], kind)
+			}
+			seen[k] = append(seen[k], j)
+		}
+	}
+	match("phone", func(p Participant) string { return normalizePhone(p.Phone) })
+	match("email", func(p Participant) string { return normalizeEmail(p.Email) })
+	match("name+birthday", func(p Participant) string {
+		name := normalizeName(p.Name)
+		if name == "" || p.Birthday == "" {
+			return ""
+		}
+		return name + "|" + string(p.Birthday)
+	})
+
+	pairs := make([]pair, 0, len(matches))
+	for p := range matches {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a].i != pairs[b].i {
+			return pairs[a].i < pairs[b].i
+		}
+		return pairs[a].j < pairs[b].j
+	})
+	duplicates := make([]*Duplicate, 0, len(pairs))
+	for _, p := range pairs {
+		duplicates = append(duplicates, &Duplicate{
+			Member:  participants[p.i],
+			Other:   participants[p.j],
+			Matches: matches[p],
+		})
+	}
+	return duplicates
+}
+
+// GetDuplicates returns the suspected duplicates among the spejdere and
+// seniors of filters.Year. With filters.TeamID, only those where one of the
+// pair is on the team are returned.
+func (m MemberModel) GetDuplicates(filters Filters) ([]*Duplicate, error) {
+	// Create a context with a 3-second timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT memberId, teamId, 'patrulje', name, email, phone, birthday FROM spejder WHERE year = ?
+UNION ALL
+SELECT memberId, teamId, 'klan', name, email, phone, birthday FROM senior WHERE year = ?
+ORDER BY teamId, memberId`
+	rows, err := m.DB.QueryContext(ctx, query, filters.Year, filters.Year)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []Participant{}
+	for rows.Next() {
+		var p Participant
+		if err := rows.Scan(&p.MemberID, &p.TeamID, &p.TeamType, &p.Name, &p.Email, &p.Phone, &p.Birthday); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	duplicates := []*Duplicate{}
+	for _, d := range FindDuplicates(participants) {
+		if filters.TeamID == "" || d.Member.TeamID == filters.TeamID || d.Other.TeamID == filters.TeamID {
+			duplicates = append(duplicates, d)
+		}
+	}
+	return duplicates, nil
+}
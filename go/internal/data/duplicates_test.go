@@ -0,0 +1,33 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	participants := []data.Participant{
+		{MemberID: "member-1", TeamID: "team-1", Name: "Bo Hansen", Phone: "+45 12 34 56 78", Email: "Bo@example.com", Birthday: "2012-01-01"},
+		{MemberID: "member-2", TeamID: "team-2", Name: "bo  hansen", Phone: "12345678", Birthday: "2012-01-01"},
+		{MemberID: "member-3", TeamID: "team-2", Name: "Carl", Email: " bo@example.com"},
+		{MemberID: "member-4", TeamID: "team-3", Name: "Bo Hansen", Birthday: "2011-01-01"},
+		{MemberID: "member-5", TeamID: "team-3", Name: "Dan"},
+		{MemberID: "member-6", TeamID: "team-3", Name: "Dan"},
+	}
+	duplicates := data.FindDuplicates(participants)
+	if !assert.Len(duplicates, 2) {
+		return
+	}
+	assert.Equal(types.MemberID("member-1"), duplicates[0].Member.MemberID)
+	assert.Equal(types.MemberID("member-2"), duplicates[0].Other.MemberID)
+	assert.Equal([]string{"phone", "name+birthday"}, duplicates[0].Matches)
+	assert.Equal(types.MemberID("member-1"), duplicates[1].Member.MemberID)
+	assert.Equal(types.MemberID("member-3"), duplicates[1].Other.MemberID)
+	assert.Equal([]string{"email"}, duplicates[1].Matches)
+}
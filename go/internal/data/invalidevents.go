@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"time"
+
+	"nathejk.dk/internal/validator"
+)
+
+// InvalidEvent marks the event at Sequence on Channel as invalid. Invalid
+// events are skipped when the projections read the stream.
+type InvalidEvent struct {
+	Channel   string `json:"channel"`
+	Sequence  uint64 `json:"sequence"`
+	Reason    string `json:"reason"`
+	Author    string `json:"author"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (e *InvalidEvent) Validate(v validator.Validator) {
+	v.Check(e.Channel != "", "channel", "must be provided")
+	v.Check(e.Sequence > 0, "sequence", "must be greater than zero")
+	v.Check(e.Reason != "", "reason", "must be provided")
+	v.Check(e.Author != "", "author", "must be provided")
+	v.Check(len(e.Author) <= 99, "author", "must not be more than 99 bytes long")
+}
+
+// SkipList returns the events as a skip list, keyed by channel and sequence.
+func SkipList(events []*InvalidEvent) map[string]map[uint64]bool {
+	m := make(map[string]map[uint64]bool)
+	for _, e := range events {
+		if m[e.Channel] == nil {
+			m[e.Channel] = make(map[uint64]bool)
+		}
+		m[e.Channel][e.Sequence] = true
+	}
+	return m
+}
+
+//go:embed invalidevents.sql
+var invalidEventSchema string
+
+type InvalidEventModel struct {
+	DB *sql.DB
+}
+
+// CreateTable creates the invalid_event table unless it exists.
+func (m InvalidEventModel) CreateTable() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, invalidEventSchema)
+	return err
+}
+
+func (m InvalidEventModel) GetAll() ([]*InvalidEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT channel, sequence, reason, author, createdAt FROM invalid_event ORDER BY channel, sequence`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*InvalidEvent{}
+	for rows.Next() {
+		var e InvalidEvent
+		if err := rows.Scan(&e.Channel, &e.Sequence, &e.Reason, &e.Author, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Insert adds e to the list, or updates the reason and author if the event
+// is already in it.
+func (m InvalidEventModel) Insert(e *InvalidEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if e.CreatedAt == "" {
+		e.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	query := `INSERT INTO invalid_event (channel, sequence, reason, author, createdAt) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE reason=VALUES(reason), author=VALUES(author)`
+	_, err := m.DB.ExecContext(ctx, query, e.Channel, e.Sequence, e.Reason, e.Author, e.CreatedAt)
+	return err
+}
+
+func (m InvalidEventModel) Delete(channel string, sequence uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM invalid_event WHERE channel = ? AND sequence = ?`, channel, sequence)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
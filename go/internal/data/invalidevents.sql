@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS invalid_event (
+    channel VARCHAR(99) NOT NULL,
+    sequence BIGINT UNSIGNED NOT NULL,
+    reason TEXT NOT NULL,
+    author VARCHAR(99) NOT NULL,
+    createdAt VARCHAR(99) NOT NULL,
+    PRIMARY KEY (channel, sequence)
+);
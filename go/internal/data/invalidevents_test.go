@@ -0,0 +1,82 @@
+package data_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/validator"
+)
+
+func TestInvalidEventValidate(t *testing.T) {
+	v := validator.New()
+	(&data.InvalidEvent{Channel: "NATHEJK", Sequence: 12, Reason: "broken", Author: "admin"}).Validate(v)
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	(&data.InvalidEvent{}).Validate(v)
+	assert.False(t, v.Valid())
+	assert.Contains(t, v.Errors, "channel")
+	assert.Contains(t, v.Errors, "sequence")
+	assert.Contains(t, v.Errors, "reason")
+	assert.Contains(t, v.Errors, "author")
+}
+
+func TestSkipList(t *testing.T) {
+	skip := data.SkipList([]*data.InvalidEvent{
+		{Channel: "NATHEJK", Sequence: 12},
+		{Channel: "NATHEJK", Sequence: 13},
+		{Channel: "nathejk", Sequence: 4},
+	})
+	assert.Equal(t, map[string]map[uint64]bool{
+		"NATHEJK": {12: true, 13: true},
+		"nathejk": {4: true},
+	}, skip)
+}
+
+// TestInvalidEventModel needs a MySQL database, e.g.
+// TEST_DB_DSN="root:secret@tcp(localhost:3306)/test"; it is skipped without.
+func TestInvalidEventModel(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	assert := assert.New(t)
+	m := data.InvalidEventModel{DB: db}
+	if err := m.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM invalid_event"); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(m.Insert(&data.InvalidEvent{Channel: "NATHEJK", Sequence: 13, Reason: "first", Author: "admin"}))
+	assert.NoError(m.Insert(&data.InvalidEvent{Channel: "NATHEJK", Sequence: 12, Reason: "second", Author: "admin"}))
+	// inserting again updates the reason
+	assert.NoError(m.Insert(&data.InvalidEvent{Channel: "NATHEJK", Sequence: 13, Reason: "updated", Author: "admin"}))
+
+	events, err := m.GetAll()
+	assert.NoError(err)
+	if assert.Len(events, 2) {
+		assert.Equal(uint64(12), events[0].Sequence)
+		assert.Equal(uint64(13), events[1].Sequence)
+		assert.Equal("updated", events[1].Reason)
+		assert.NotEmpty(events[1].CreatedAt)
+	}
+
+	assert.NoError(m.Delete("NATHEJK", 12))
+	assert.ErrorIs(m.Delete("NATHEJK", 12), data.ErrRecordNotFound)
+	events, err = m.GetAll()
+	assert.NoError(err)
+	assert.Len(events, 1)
+}
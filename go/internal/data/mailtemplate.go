@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MailTemplate is a mail template defined on the stream.
+type MailTemplate struct {
+	Slug      string `json:"slug"`
+	Subject   string `json:"subject"`
+	Template  string `json:"template"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type MailTemplateModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns the mail templates defined on the stream, by slug.
+func (m MailTemplateModel) GetAll() ([]*MailTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT slug, subject, template, updatedAt FROM mailtemplate ORDER BY slug`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*MailTemplate{}
+	for rows.Next() {
+		var t MailTemplate
+		if err := rows.Scan(&t.Slug, &t.Subject, &t.Template, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// Get returns the mail template slug, ErrRecordNotFound if it is not
+// defined on the stream.
+func (m MailTemplateModel) Get(slug string) (*MailTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT slug, subject, template, updatedAt FROM mailtemplate WHERE slug = ?`
+	var t MailTemplate
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&t.Slug, &t.Subject, &t.Template, &t.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
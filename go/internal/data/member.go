@@ -8,16 +8,8 @@ import (
 	"time"
 
 	"github.com/nathejk/shared-go/types"
-	"nathejk.dk/internal/validator"
 )
 
-type Member struct {
-}
-
-func (p *Member) Validate(v validator.Validator) {
-	//v.Check(p.Timestamp.IsZero(), "timestamp", "must be provided")
-}
-
 type MemberModel struct {
 	DB *sql.DB
 }
@@ -208,10 +200,9 @@ func (m TeamModel) GetSpejder(teamID types.TeamID) (*Patrulje, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT p.teamId, p.teamNumber, p.name, p.groupName, p.korps, p.memberCount, IF(pm.parentTeamId IS NOT NULL, "JOIN", IF(startedUts > 0, "STARTED",  signupStatus)) 
-		FROM patrulje p 
+	query := `SELECT p.teamId, p.teamNumber, p.name, p.groupName, p.korps, p.memberCount, p.signupStatus
+		FROM patrulje p
 		JOIN patruljestatus ps ON p.teamId = ps.teamID
-		LEFT JOIN patruljemerged pm ON p.teamId = pm.teamId
 		WHERE p.teamId = ?`
 	var p Patrulje
 	err := m.DB.QueryRow(query, teamID).Scan(
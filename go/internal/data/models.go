@@ -21,12 +21,14 @@ type Models struct {
 		GetPatrulje(types.TeamID) (*Patrulje, error)
 		GetKlan(types.TeamID) (*Klan, error)
 		GetContact(types.TeamID) (*Contact, error)
+		GetStatusHistory(types.TeamID) ([]*StatusChange, error)
 		RequestedSeniorCount() int
 	}
 	Members interface {
 		GetSpejdere(Filters) ([]*Spejder, Metadata, error)
 		GetSeniore(Filters) ([]*Senior, Metadata, error)
 		GetInactive(Filters) ([]*SpejderStatus, Metadata, error)
+		GetDuplicates(Filters) ([]*Duplicate, error)
 	}
 	Permissions interface {
 		AddForUser(int64, ...string) error
@@ -51,18 +53,35 @@ type Models struct {
 	}
 	Signup interface {
 		GetByID(types.TeamID) (*Signup, error)
-		ConfirmBySecret(string) (types.TeamID, error)
+		GetConfirmation(secret string) (*Confirmation, error)
+	}
+	MailTemplates interface {
+		GetAll() ([]*MailTemplate, error)
+		Get(slug string) (*MailTemplate, error)
+	}
+	Outbox interface {
+		GetAll(status string) ([]*OutboxMessage, error)
+		Get(id string) (*OutboxMessage, error)
+	}
+	InvalidEvents interface {
+		CreateTable() error
+		GetAll() ([]*InvalidEvent, error)
+		Insert(*InvalidEvent) error
+		Delete(channel string, sequence uint64) error
 	}
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Teams:       TeamModel{DB: db},
-		Members:     MemberModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Personnel:   PersonnelModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
-		Signup:      SignupModel{DB: db},
+		Teams:         TeamModel{DB: db},
+		Members:       MemberModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Personnel:     PersonnelModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Users:         UserModel{DB: db},
+		Signup:        SignupModel{DB: db},
+		MailTemplates: MailTemplateModel{DB: db},
+		Outbox:        OutboxModel{DB: db},
+		InvalidEvents: InvalidEventModel{DB: db},
 	}
 }
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nathejk/shared-go/types"
+)
+
+// OutboxMessage is an SMS or mail requested to be sent by the outbox. Kind
+// is "sms" or "mail", and Content is the text of an SMS or the template of a
+// mail. Request is the requested event as published, and is published again
+// when the message is resent.
+type OutboxMessage struct {
+	MessageID   string          `json:"messageId"`
+	Kind        string          `json:"kind"`
+	PingType    types.PingType  `json:"pingType"`
+	TeamID      types.TeamID    `json:"teamId"`
+	Recipient   string          `json:"recipient"`
+	Content     string          `json:"content"`
+	Request     json.RawMessage `json:"-"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	RequestedAt string          `json:"requestedAt"`
+	SentAt      *string         `json:"sentAt"`
+}
+
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+const outboxColumns = `messageId, kind, pingType, teamId, recipient, content, request, status, error, requestedAt, sentAt`
+
+func scanOutboxMessage(row interface{ Scan(...any) error }) (*OutboxMessage, error) {
+	var m OutboxMessage
+	var request string
+	err := row.Scan(&m.MessageID, &m.Kind, &m.PingType, &m.TeamID, &m.Recipient, &m.Content, &request, &m.Status, &m.Error, &m.RequestedAt, &m.SentAt)
+	if err != nil {
+		return nil, err
+	}
+	m.Request = json.RawMessage(request)
+	return &m, nil
+}
+
+// GetAll returns the messages of the outbox with the given status, or all
+// messages if status is empty, the latest requested first.
+func (m OutboxModel) GetAll(status string) ([]*OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + outboxColumns + ` FROM outbox WHERE (status = ? OR ? = '') ORDER BY requestedAt DESC, messageId`
+	rows, err := m.DB.QueryContext(ctx, query, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*OutboxMessage{}
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Get returns the message id of the outbox, ErrRecordNotFound if there is
+// none.
+func (m OutboxModel) Get(id string) (*OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + outboxColumns + ` FROM outbox WHERE messageId = ?`
+	msg, err := scanOutboxMessage(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return msg, nil
+}
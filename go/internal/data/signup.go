@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/nathejk/shared-go/types"
 )
@@ -98,30 +99,52 @@ func (m SignupModel) GetByID(teamID types.TeamID) (*Signup, error) {
 	}
 	return &p, nil
 }
-func (m SignupModel) ConfirmBySecret(secret string) (types.TeamID, error) {
-	//ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	//defer cancel()
 
-	query := "UPDATE signup s JOIN confirm c ON s.teamId = c.teamId SET s.email = c.emailPending WHERE secret = ?"
-	//result, err := m.DB.Exec(query, secret)
-	_, err := m.DB.Exec(query, secret)
+// ConfirmationTTL is how long the link of a confirmation mail can be used.
+const ConfirmationTTL = 72 * time.Hour
+
+// Confirmation is the last confirmation mail sent to a team.
+type Confirmation struct {
+	TeamID       types.TeamID
+	EmailPending types.EmailAddress
+	SentAt       time.Time
+	// ConfirmedAt is set once the link has been used.
+	ConfirmedAt *time.Time
+}
+
+// Expired reports whether the link of the mail can no longer be used at now.
+func (c *Confirmation) Expired(now time.Time) bool {
+	return now.After(c.SentAt.Add(ConfirmationTTL))
+}
+
+// GetConfirmation returns the confirmation mail sent with secret. Only the
+// secret of the last mail sent to a team is known.
+func (m SignupModel) GetConfirmation(secret string) (*Confirmation, error) {
+	if secret == "" {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT teamId, emailPending, sentAt, confirmedAt FROM confirm WHERE secret = ?`
+	var c Confirmation
+	var sentAt string
+	var confirmedAt sql.NullString
+	err := m.DB.QueryRow(query, secret).Scan(&c.TeamID, &c.EmailPending, &sentAt, &confirmedAt)
 	if err != nil {
-		return "", err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
-	/*
-		rowCount, err := result.RowsAffected()
+	if c.SentAt, err = time.Parse(time.RFC3339, sentAt); err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		t, err := time.Parse(time.RFC3339, confirmedAt.String)
 		if err != nil {
-			return "", err
-		}
-		if rowCount != 1 {
-			return "", fmt.Errorf("e-mail not found")
+			return nil, err
 		}
-	*/
-	var teamID types.TeamID
-	err = m.DB.QueryRow(`SELECT teamId FROM confirm WHERE secret = ?`, secret).Scan(&teamID)
-	if err != nil {
-		return "", err
+		c.ConfirmedAt = &t
 	}
-
-	return teamID, nil
+	return &c, nil
 }
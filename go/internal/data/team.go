@@ -7,16 +7,8 @@ import (
 	"time"
 
 	"github.com/nathejk/shared-go/types"
-	"nathejk.dk/internal/validator"
 )
 
-type Team struct {
-}
-
-func (p *Team) Validate(v validator.Validator) {
-	//v.Check(p.Timestamp.IsZero(), "timestamp", "must be provided")
-}
-
 type TeamModel struct {
 	DB *sql.DB
 }
@@ -76,6 +68,7 @@ type Patrulje struct {
 }
 type Klan struct {
 	ID          types.TeamID       `json:"id"`
+	Number      string             `json:"number"`
 	Status      types.SignupStatus `json:"status"`
 	Name        string             `json:"name"`
 	Group       string             `json:"group"`
@@ -90,6 +83,7 @@ type Contact struct {
 	Email      types.EmailAddress `json:"email"`
 	Phone      types.PhoneNumber  `json:"phone"`
 	Role       string             `json:"role"`
+	Birthday   types.Date         `json:"birthday"`
 }
 
 func (m TeamModel) RequestedSeniorCount() int {
@@ -104,9 +98,12 @@ func (m TeamModel) GetPatruljer(filters Filters) ([]*Patrulje, Metadata, error)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT p.teamId, p.teamNumber, p.name, p.groupName, p.korps, p.liga, p.memberCount, IF(pm.parentTeamId IS NOT NULL, "JOIN", IF(startedUts > 0, "STARTED",  signupStatus)) 
+	// A merged patrulje shows as JOIN and a started one as STARTED, which
+	// are not signup statuses.
+	query := `SELECT p.teamId, p.teamNumber, p.name, p.groupName, p.korps, p.liga, p.memberCount, IF(pm.parentTeamId IS NOT NULL, "JOIN", IF(ps.startedUts > 0, "STARTED", p.signupStatus))
 		FROM patrulje p
-		JOIN patruljestatus ps ON p.teamId = ps.teamID AND (LOWER(p.year) = LOWER(?) OR ? = '')`
+		JOIN patruljestatus ps ON p.teamId = ps.teamID AND (LOWER(p.year) = LOWER(?) OR ? = '')
+		LEFT JOIN patruljemerged pm ON p.teamId = pm.teamId`
 	args := []any{filters.Year, filters.Year}
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -168,13 +165,14 @@ func (m TeamModel) GetKlan(teamID types.TeamID) (*Klan, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT t.teamId, t.name, t.groupName, t.korps, t.memberCount, t.signupStatus
+	query := `SELECT t.teamId, t.teamNumber, t.name, t.groupName, t.korps, t.memberCount, t.signupStatus
 		FROM klan t
 		JOIN patruljestatus ts ON t.teamId = ts.teamID
 		WHERE t.teamId = ?`
 	var t Klan
 	err := m.DB.QueryRow(query, teamID).Scan(
 		&t.ID,
+		&t.Number,
 		&t.Name,
 		&t.Group,
 		&t.Korps,
@@ -197,7 +195,7 @@ func (m TeamModel) GetContact(teamID types.TeamID) (*Contact, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT p.contactName, p.contactPhone, p.contactEmail, p.contactRole
+	query := `SELECT p.contactName, p.contactPhone, p.contactEmail, p.contactRole, p.contactBirthday
 		FROM patrulje p
 		JOIN patruljestatus ps ON p.teamId = ps.teamID
 		WHERE p.teamId = ?`
@@ -207,6 +205,7 @@ func (m TeamModel) GetContact(teamID types.TeamID) (*Contact, error) {
 		&c.Phone,
 		&c.Email,
 		&c.Role,
+		&c.Birthday,
 	)
 	if err != nil {
 		switch {
@@ -218,3 +217,37 @@ func (m TeamModel) GetContact(teamID types.TeamID) (*Contact, error) {
 	}
 	return &c, nil
 }
+
+// StatusChange is a change of the signup status of a team.
+type StatusChange struct {
+	Status    types.SignupStatus `json:"status"`
+	Reason    string             `json:"reason"`
+	ChangedAt string             `json:"changedAt"`
+}
+
+// GetStatusHistory returns the signup status changes of a team, oldest
+// first.
+func (m TeamModel) GetStatusHistory(teamID types.TeamID) ([]*StatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT signupStatus, reason, changedAt FROM signupstatushistory WHERE teamId = ? ORDER BY sequence`
+	rows, err := m.DB.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.Status, &c.Reason, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -1,19 +1,25 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"embed"
-	"html/template"
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/go-mail/mail/v2"
+
+	"nathejk.dk/pkg/metrics"
 )
 
+var sendResults = metrics.Must(metrics.NewCounterVec("nathejk_mail_sent_total", "Mail send results by template.", "template", "result"))
+
 //go:embed "templates"
 var templateFS embed.FS
 
 type Mailer interface {
 	Send(recipient, templateFile string, data any) error
+	Ping(ctx context.Context) error
 }
 type Config struct {
 	Host     string
@@ -24,10 +30,13 @@ type Config struct {
 }
 
 type mailer struct {
+	host       string
+	port       int
 	dialer     *mail.Dialer
 	sender     string
 	retryCount int
 	retrySleep time.Duration
+	templates  TemplateSource
 }
 
 func NewFromConfig(c Config) *mailer {
@@ -39,6 +48,8 @@ func New(host string, port int, username, password, sender string) *mailer {
 	dialer.Timeout = 5 * time.Second
 
 	return &mailer{
+		host:       host,
+		port:       port,
 		dialer:     dialer,
 		sender:     sender,
 		retryCount: 3,
@@ -46,30 +57,40 @@ func New(host string, port int, username, password, sender string) *mailer {
 	}
 }
 
-func (m *mailer) Send(recipient, templateFile string, data any) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+// Ping checks that the SMTP server accepts connections.
+func (m *mailer) Ping(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.host, fmt.Sprint(m.port)))
 	if err != nil {
 		return err
 	}
-	subject := new(bytes.Buffer)
-	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
-		return err
-	}
-	plainBody := new(bytes.Buffer)
-	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+	return conn.Close()
+}
+
+func (m *mailer) Send(recipient, templateFile string, data any) error {
+	err := m.send(recipient, templateFile, data)
+	if err != nil {
+		sendResults.With(templateFile, "error").Inc()
 		return err
 	}
-	htmlBody := new(bytes.Buffer)
-	if err := tmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+	sendResults.With(templateFile, "ok").Inc()
+	return nil
+}
+
+func (m *mailer) send(recipient, templateFile string, data any) error {
+	rendered, err := m.render(templateFile, data)
+	if err != nil {
 		return err
 	}
 
 	msg := mail.NewMessage()
 	msg.SetHeader("To", recipient)
 	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg.SetHeader("Subject", rendered.Subject)
+	msg.SetBody("text/plain", rendered.PlainBody)
+	if rendered.HTMLBody != "" {
+		msg.AddAlternative("text/html", rendered.HTMLBody)
+	}
 
 	// Try sending the email several times before aborting and returning the final error.
 	for i := 1; i <= m.retryCount; i++ {
@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"strings"
+)
+
+// Template is a mail template defined at runtime. Body is written like the
+// embedded templates, defining the plainBody and optionally the htmlBody
+// and subject templates. Subject, if given, is the template of the subject
+// line.
+type Template struct {
+	Subject string
+	Body    string
+}
+
+// TemplateSource returns the template defined at runtime for slug, nil if
+// there is none.
+type TemplateSource func(slug string) (*Template, error)
+
+// UseTemplates makes the mailer prefer the templates of src to the
+// embedded templates.
+func (m *mailer) UseTemplates(src TemplateSource) {
+	m.templates = src
+}
+
+// TemplateError is a template that fails to parse. Field is subject or
+// template.
+type TemplateError struct {
+	Field string
+	Err   error
+}
+
+func (e *TemplateError) Error() string { return e.Field + ": " + e.Err.Error() }
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// Parse parses a template defined at runtime. It must define the subject
+// and the plain body.
+func Parse(t Template) (*template.Template, error) {
+	tmpl, err := template.New("email").Parse(t.Body)
+	if err != nil {
+		return nil, &TemplateError{Field: "template", Err: err}
+	}
+	if t.Subject != "" {
+		if _, err := tmpl.New("subject").Parse(t.Subject); err != nil {
+			return nil, &TemplateError{Field: "subject", Err: err}
+		}
+	}
+	if tmpl.Lookup("subject") == nil {
+		return nil, &TemplateError{Field: "subject", Err: fmt.Errorf("must be given")}
+	}
+	if tmpl.Lookup("plainBody") == nil {
+		return nil, &TemplateError{Field: "template", Err: fmt.Errorf(`must define "plainBody"`)}
+	}
+	return tmpl, nil
+}
+
+// Rendered is a mail rendered from a template. HTMLBody is empty if the
+// template has no HTML body.
+type Rendered struct {
+	Subject   string `json:"subject"`
+	PlainBody string `json:"plainBody"`
+	HTMLBody  string `json:"htmlBody"`
+}
+
+// Render executes tmpl with data.
+func Render(tmpl *template.Template, data any) (*Rendered, error) {
+	var r Rendered
+	for _, part := range []struct {
+		name string
+		dst  *string
+	}{{"subject", &r.Subject}, {"plainBody", &r.PlainBody}, {"htmlBody", &r.HTMLBody}} {
+		if tmpl.Lookup(part.name) == nil && part.name == "htmlBody" {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.ExecuteTemplate(buf, part.name, data); err != nil {
+			return nil, err
+		}
+		*part.dst = buf.String()
+	}
+	return &r, nil
+}
+
+// Embedded returns the embedded templates by slug, the file name without
+// its .tmpl extension.
+func Embedded() (map[string]Template, error) {
+	templates := make(map[string]Template)
+	err := fs.WalkDir(templateFS, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return err
+		}
+		body, err := fs.ReadFile(templateFS, path)
+		if err != nil {
+			return err
+		}
+		templates[strings.TrimSuffix(d.Name(), ".tmpl")] = Template{Body: string(body)}
+		return nil
+	})
+	return templates, err
+}
+
+// render renders templateFile with data, using the template defined at
+// runtime for its slug if any, otherwise the embedded one. A runtime
+// template that cannot be looked up, parsed or executed with data is logged,
+// and the embedded one used, so a broken template does not stop the mails.
+func (m *mailer) render(templateFile string, data any) (*Rendered, error) {
+	var runtimeErr error
+	if m.templates != nil {
+		slug := strings.TrimSuffix(templateFile, ".tmpl")
+		t, err := m.templates(slug)
+		if err == nil && t != nil {
+			var tmpl *template.Template
+			if tmpl, err = Parse(*t); err == nil {
+				var r *Rendered
+				if r, err = Render(tmpl, data); err == nil {
+					return r, nil
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("[mailer] using the embedded template %q: %v", templateFile, err)
+			runtimeErr = err
+		}
+	}
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		if runtimeErr != nil {
+			// There is no embedded template to fall back on.
+			return nil, runtimeErr
+		}
+		return nil, err
+	}
+	return Render(tmpl, data)
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		template Template
+		field    string
+	}{
+		"subject given":   {template: Template{Subject: "Hej {{.Name}}", Body: `{{define "plainBody"}}Hej{{end}}`}},
+		"subject defined": {template: Template{Body: `{{define "subject"}}Hej{{end}}{{define "plainBody"}}Hej{{end}}`}},
+		"no subject":      {template: Template{Body: `{{define "plainBody"}}Hej{{end}}`}, field: "subject"},
+		"bad subject":     {template: Template{Subject: "Hej {{.Name", Body: `{{define "plainBody"}}Hej{{end}}`}, field: "subject"},
+		"bad template":    {template: Template{Subject: "Hej", Body: `{{define "plainBody"}}Hej{{if}}{{end}}`}, field: "template"},
+		"no plain body":   {template: Template{Subject: "Hej", Body: `{{define "htmlBody"}}Hej{{end}}`}, field: "template"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(tt.template)
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var terr *TemplateError
+			if assert.ErrorAs(t, err, &terr) {
+				assert.Equal(t, tt.field, terr.Field)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New("localhost", 25, "", "", "Nathejk <hej@nathejk.dk>")
+	data := map[string]any{"secret": "secret-1", "days": 3}
+
+	r, err := m.render("verify_email.tmpl", data)
+	assert.NoError(err)
+	assert.Equal("Bekræft e-mailadresse", r.Subject)
+	assert.Contains(r.HTMLBody, "/confirm/secret-1")
+
+	m.UseTemplates(func(slug string) (*Template, error) {
+		assert.Equal("verify_email", slug)
+		return &Template{Subject: "Bekræft din e-mail", Body: `{{define "plainBody"}}Link: /confirm/{{.secret}}{{end}}`}, nil
+	})
+	r, err = m.render("verify_email.tmpl", data)
+	assert.NoError(err)
+	assert.Equal(&Rendered{Subject: "Bekræft din e-mail", PlainBody: "Link: /confirm/secret-1"}, r)
+
+	// The embedded template is used when the one defined at runtime fails.
+	for name, src := range map[string]TemplateSource{
+		"parse": func(string) (*Template, error) {
+			return &Template{Subject: "Hej", Body: `{{define "plainBody"}}{{if}}{{end}}`}, nil
+		},
+		"execute": func(string) (*Template, error) {
+			return &Template{Subject: "Hej", Body: `{{define "plainBody"}}{{.days.First}}{{end}}`}, nil
+		},
+		"source": func(string) (*Template, error) { return nil, errors.New("database is down") },
+		"none":   func(string) (*Template, error) { return nil, nil },
+	} {
+		m.UseTemplates(src)
+		r, err = m.render("verify_email.tmpl", data)
+		if assert.NoError(err, name) {
+			assert.Equal("Bekræft e-mailadresse", r.Subject, name)
+		}
+	}
+
+	// A runtime template without an embedded one fails with its own error.
+	m.UseTemplates(func(string) (*Template, error) {
+		return &Template{Subject: "Hej", Body: `{{define "plainBody"}}{{.days.First}}{{end}}`}, nil
+	})
+	_, err = m.render("welcome.tmpl", data)
+	assert.ErrorContains(err, "First")
+
+	embedded, err := Embedded()
+	assert.NoError(err)
+	assert.Contains(embedded, "verify_email")
+}
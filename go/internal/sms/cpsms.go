@@ -2,23 +2,37 @@ package sms
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 )
 
 type cpsms struct {
+	host   string
 	apikey string
 	apiurl string
 }
 
 func NewCpsms(host, apikey string) (*cpsms, error) {
 	return &cpsms{
+		host:   host,
 		apiurl: "https://" + host + "/v2/send",
 		apikey: apikey,
 	}, nil
 }
 
+// Ping checks that the CPSMS API accepts connections.
+func (s *cpsms) Ping(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.host, "443"))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 func (s *cpsms) Send(phone, message string) error {
 	type cpsmsSingleRecipientRequest struct {
 		To      string `json:"to"`
@@ -0,0 +1,50 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileMessage is a line of the file written by the file provider.
+type FileMessage struct {
+	Time    time.Time `json:"time"`
+	Phone   string    `json:"phone"`
+	Message string    `json:"message"`
+}
+
+// fileSender appends the SMS to a file, one JSON object per line, so tests
+// can read what would have been sent.
+type fileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFile(path string) (*fileSender, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file sms provider needs a path, e.g. file:///tmp/sms.jsonl")
+	}
+	return &fileSender{path: path}, nil
+}
+
+func (s *fileSender) Send(phone, message string) error {
+	line, err := json.Marshal(FileMessage{Time: time.Now().UTC(), Phone: phone, Message: message})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,25 @@
+package sms
+
+import (
+	"fmt"
+
+	"nathejk.dk/internal/jsonlog"
+)
+
+// logSender writes the SMS to the log instead of sending them, so the API
+// can run without an SMS provider.
+type logSender struct {
+	logger *jsonlog.Logger
+}
+
+func NewLog(logger *jsonlog.Logger) (*logSender, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("log sms provider needs a logger")
+	}
+	return &logSender{logger: logger}, nil
+}
+
+func (s *logSender) Send(phone, message string) error {
+	s.logger.PrintInfo("sms", map[string]string{"phone": phone, "message": message})
+	return nil
+}
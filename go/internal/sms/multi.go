@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"nathejk.dk/internal/jsonlog"
+)
+
+// multiSender sends with the primary provider, and fails over to the
+// secondary when the primary fails.
+type multiSender struct {
+	primary   Sender
+	secondary Sender
+}
+
+// NewMulti returns a failover provider of the DSNs given, URL encoded, by
+// the query parameters primary and secondary, e.g.
+//
+//	multi://?primary=cpsms%3A%2F%2FTOKEN%40api.cpsms.dk&secondary=log%3A%2F%2F
+func NewMulti(u *url.URL, logger *jsonlog.Logger) (*multiSender, error) {
+	q := u.Query()
+	if q.Get("primary") == "" || q.Get("secondary") == "" {
+		return nil, fmt.Errorf("multi sms provider needs a primary and a secondary DSN")
+	}
+	primary, err := NewClient(q.Get("primary"), logger)
+	if err != nil {
+		return nil, fmt.Errorf("multi sms provider primary: %w", err)
+	}
+	secondary, err := NewClient(q.Get("secondary"), logger)
+	if err != nil {
+		return nil, fmt.Errorf("multi sms provider secondary: %w", err)
+	}
+	return &multiSender{primary: primary, secondary: secondary}, nil
+}
+
+// Ping checks that one of the providers is reachable.
+func (s *multiSender) Ping(ctx context.Context) error {
+	err := Ping(ctx, s.primary)
+	if err == nil {
+		return nil
+	}
+	if err := Ping(ctx, s.secondary); err == nil {
+		return nil
+	}
+	return err
+}
+
+func (s *multiSender) Send(phone, message string) error {
+	err := s.primary.Send(phone, message)
+	if err == nil {
+		return nil
+	}
+	if err2 := s.secondary.Send(phone, message); err2 != nil {
+		return errors.Join(err, err2)
+	}
+	return nil
+}
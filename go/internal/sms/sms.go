@@ -1,22 +1,90 @@
 package sms
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+
+	"nathejk.dk/internal/jsonlog"
+	"nathejk.dk/pkg/metrics"
 )
 
+var sendResults = metrics.Must(metrics.NewCounterVec("nathejk_sms_sent_total", "SMS send results by provider.", "provider", "result"))
+
 type Sender interface {
 	Send(string, string) error
 }
 
-func NewClient(dsn string) (Sender, error) {
+// Pinger is implemented by senders that can check that their provider is
+// reachable.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// Ping checks that the provider of s is reachable. Senders not implementing
+// Pinger are assumed to be.
+func Ping(ctx context.Context, s Sender) error {
+	if p, ok := s.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// NewClient returns the sender of the provider selected by the scheme of
+// dsn:
+//
+//	cpsms://APIKEY@api.cpsms.dk  sends with CPSMS
+//	log://                       writes the SMS to logger
+//	file:///path/to/sms.jsonl    appends the SMS to a file, see FileMessage
+//	http(s)://host/path          posts the SMS to a URL, see NewHTTP
+//	multi://?primary=&secondary= fails over between two DSNs, see NewMulti
+func NewClient(dsn string, logger *jsonlog.Logger) (Sender, error) {
 	u, err := url.Parse(dsn)
 	if err != nil {
 		return nil, err
 	}
+	var s Sender
 	switch u.Scheme {
 	case "cpsms":
-		return NewCpsms(u.Host, u.User.Username())
+		s, err = NewCpsms(u.Host, u.User.Username())
+	case "log":
+		s, err = NewLog(logger)
+	case "file":
+		s, err = NewFile(u.Path)
+	case "http", "https":
+		s, err = NewHTTP(u)
+	case "multi":
+		// The providers of a multi sender count their own results.
+		m, err := NewMulti(u, logger)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &countingSender{sender: s, provider: u.Scheme}, nil
+}
+
+// countingSender counts the send results of the wrapped sender.
+type countingSender struct {
+	sender   Sender
+	provider string
+}
+
+func (s *countingSender) Ping(ctx context.Context) error {
+	return Ping(ctx, s.sender)
+}
+
+func (s *countingSender) Send(phone, message string) error {
+	err := s.sender.Send(phone, message)
+	if err != nil {
+		sendResults.With(s.provider, "error").Inc()
+		return err
 	}
-	return nil, fmt.Errorf("unknown sms provider %q", u.Scheme)
+	sendResults.With(s.provider, "ok").Inc()
+	return nil
 }
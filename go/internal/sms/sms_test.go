@@ -0,0 +1,208 @@
+package sms_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/jsonlog"
+	"nathejk.dk/internal/sms"
+)
+
+func TestNewClient(t *testing.T) {
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	tests := map[string]struct {
+		dsn string
+		err string
+	}{
+		"cpsms":                {dsn: "cpsms://TOKEN@api.cpsms.dk"},
+		"log":                  {dsn: "log://"},
+		"file":                 {dsn: "file:///tmp/sms.jsonl"},
+		"file sans path":       {dsn: "file://", err: "file sms provider needs a path, e.g. file:///tmp/sms.jsonl"},
+		"http":                 {dsn: "https://sms.example.com/send"},
+		"http bad body":        {dsn: "https://sms.example.com/send?body=%7B%7B", err: "http sms provider body: template: body:1: unclosed action"},
+		"multi":                {dsn: "multi://?primary=log%3A%2F%2F&secondary=file%3A%2F%2F%2Ftmp%2Fsms.jsonl"},
+		"multi sans secondary": {dsn: "multi://?primary=log%3A%2F%2F", err: "multi sms provider needs a primary and a secondary DSN"},
+		"multi bad primary":    {dsn: "multi://?primary=sms%3A%2F%2F&secondary=log%3A%2F%2F", err: `multi sms provider primary: unknown sms provider "sms"`},
+		"unknown":              {dsn: "sms://", err: `unknown sms provider "sms"`},
+		"empty":                {dsn: "", err: `unknown sms provider ""`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := sms.NewClient(tt.dsn, logger)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, s)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, s)
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	var out bytes.Buffer
+	s, err := sms.NewClient("log://", jsonlog.New(&out, jsonlog.LevelInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Send("12345678", "Din pinkode er 1234"))
+
+	var line struct {
+		Message    string            `json:"message"`
+		Properties map[string]string `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "sms", line.Message)
+	assert.Equal(t, map[string]string{"phone": "12345678", "message": "Din pinkode er 1234"}, line.Properties)
+}
+
+func readFile(t *testing.T, name string) (msgs []sms.FileMessage) {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg sms.FileMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sms.jsonl")
+	s, err := sms.NewClient("file://"+name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Send("12345678", "Din pinkode er 1234"))
+	assert.NoError(t, s.Send("87654321", "Betal her"))
+
+	msgs := readFile(t, name)
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, "12345678", msgs[0].Phone)
+		assert.Equal(t, "Din pinkode er 1234", msgs[0].Message)
+		assert.Equal(t, "87654321", msgs[1].Phone)
+		assert.False(t, msgs[1].Time.IsZero())
+	}
+}
+
+// provider is an SMS provider recording the requests it gets, answering
+// with status.
+type provider struct {
+	status   int
+	requests []string
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	user, pass, _ := r.BasicAuth()
+	p.requests = append(p.requests, strings.Join([]string{r.Method, r.URL.String(), r.Header.Get("Content-Type"), user + ":" + pass, string(body)}, " "))
+	w.WriteHeader(p.status)
+	io.WriteString(w, "provider says no\n")
+}
+
+func TestHTTP(t *testing.T) {
+	tests := map[string]struct {
+		query    string
+		status   int
+		requests []string
+		err      string
+	}{
+		"default body": {
+			status:   http.StatusOK,
+			requests: []string{`POST /send application/json user:secret {"to":"12345678","message":"Din \"pinkode\" er 1234"}`},
+		},
+		"body template": {
+			query:    "?from=Nathejk&contentType=" + url.QueryEscape("application/x-www-form-urlencoded") + "&body=" + url.QueryEscape("to={{query .Phone}}&text={{query .Message}}"),
+			status:   http.StatusAccepted,
+			requests: []string{`POST /send?from=Nathejk application/x-www-form-urlencoded user:secret to=12345678&text=Din+%22pinkode%22+er+1234`},
+		},
+		"provider fails": {
+			status:   http.StatusBadGateway,
+			requests: []string{`POST /send application/json user:secret {"to":"12345678","message":"Din \"pinkode\" er 1234"}`},
+			err:      `http sms provider: 502 Bad Gateway: "provider says no"`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &provider{status: tt.status}
+			srv := httptest.NewServer(p)
+			defer srv.Close()
+
+			dsn := strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/send" + tt.query
+			s, err := sms.NewClient(dsn, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Send("12345678", `Din "pinkode" er 1234`)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.requests, p.requests)
+		})
+	}
+}
+
+func TestMulti(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		sent   int
+		err    bool
+	}{
+		"primary sends":   {status: http.StatusOK},
+		"fails over":      {status: http.StatusInternalServerError, sent: 1},
+		"secondary fails": {status: http.StatusInternalServerError, err: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &provider{status: tt.status}
+			srv := httptest.NewServer(p)
+			defer srv.Close()
+
+			name := filepath.Join(t.TempDir(), "sms.jsonl")
+			secondary := "file://" + name
+			if tt.err {
+				secondary = "file://" + filepath.Join(t.TempDir(), "missing", "sms.jsonl")
+			}
+			q := url.Values{"primary": {srv.URL}, "secondary": {secondary}}
+			s, err := sms.NewClient("multi://?"+q.Encode(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Send("12345678", "Din pinkode er 1234")
+			if tt.err {
+				assert.ErrorContains(t, err, "http sms provider: 500 Internal Server Error")
+				assert.ErrorContains(t, err, "no such file or directory")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, p.requests, 1)
+			if tt.sent > 0 {
+				assert.Len(t, readFile(t, name), tt.sent)
+			} else {
+				assert.NoFileExists(t, name)
+			}
+		})
+	}
+}
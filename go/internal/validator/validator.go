@@ -15,6 +15,9 @@ type Validator interface {
 // pattern is taken from https://html.spec.whatwg.org/#valid-e-mail-address.
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	// PostalCodeRX matches Danish postal codes, and the German ones used
+	// in Sydslesvig.
+	PostalCodeRX = regexp.MustCompile("^[0-9]{4,5}$")
 )
 
 // Define a new Validator type which contains a map of validation errors.
@@ -66,3 +69,32 @@ func Unique[T comparable](values []T) bool {
 	}
 	return len(values) == len(uniqueValues)
 }
+
+// prefixed is a Validator adding its errors to another Validator with a
+// prefix on the keys.
+type prefixed struct {
+	Validator
+	prefix string
+}
+
+// Prefix returns a Validator adding its errors to v with keys prefixed by
+// prefix, so the fields of a nested object are keyed like "members[2].name".
+func Prefix(v Validator, prefix string) Validator {
+	return &prefixed{Validator: v, prefix: prefix}
+}
+
+func (p *prefixed) AddError(key, message string) {
+	p.Validator.AddError(p.prefix+key, message)
+}
+
+func (p *prefixed) Check(ok bool, key, message string) {
+	if !ok {
+		p.AddError(key, message)
+	}
+}
+
+func (p *prefixed) CheckEmail(email, key, message string) {
+	if !EmailRX.MatchString(email) {
+		p.AddError(key, message)
+	}
+}
@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"errors"
+
+	"github.com/nathejk/shared-go/types"
+)
+
+var (
+	ErrNumberTaken      = errors.New("team number is given to another team")
+	ErrNumberOutOfRange = errors.New("team number is outside the range of the team type")
+)
+
+// NumberRange is the range of the numbers given to the teams of a type.
+type NumberRange struct {
+	First int
+	Last  int
+}
+
+// Contains reports whether number is in the range.
+func (r NumberRange) Contains(number int) bool {
+	return number >= r.First && number <= r.Last
+}
+
+// NumberRanges holds the number range of each team type, so patruljer and
+// klaner can be told apart by their number.
+var NumberRanges = map[types.TeamType]NumberRange{
+	types.TeamTypePatrulje: {First: 1, Last: 499},
+	types.TeamTypeKlan:     {First: 501, Last: 999},
+}
+
+// numberKey identifies the numbers of a team type in a year.
+type numberKey struct {
+	year     string
+	teamType types.TeamType
+}
+
+// NumberTeam returns the team that was given number in year, false if no
+// team was. A number stays with the team it was first given to, also when
+// the team is given another number.
+func (s *Store) NumberTeam(year string, teamType types.TeamType, number int) (types.TeamID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teamID, ok := s.numbers[numberKey{year, teamType}][number]
+	return teamID, ok
+}
+
+// NextNumber returns the number following the highest number given to a
+// team of teamType in year, so numbers are never reused.
+func (s *Store) NextNumber(year string, teamType types.TeamType) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := NumberRanges[teamType].First
+	for number := range s.numbers[numberKey{year, teamType}] {
+		if number >= next {
+			next = number + 1
+		}
+	}
+	return next
+}
@@ -0,0 +1,232 @@
+package aggregate
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// Store is a consumer of the NATHEJK channel that keeps the events of each
+// team. LoadTeam rebuilds a team by applying its events, starting from the
+// latest snapshot of the team if there is one. LoadYear returns the state
+// of a year, which is kept as its nathejk:year.created events arrive.
+type Store struct {
+	snapshotEvery int
+
+	mu        sync.Mutex
+	events    map[types.TeamID][]streaminterface.Message
+	members   map[types.MemberID]types.TeamID
+	snapshots map[types.TeamID]*Team
+	years     map[string]*Year
+	// starts holds the configured start time of the years whose created
+	// event does not tell it, see SetStartTime.
+	starts  map[string]time.Time
+	numbers map[numberKey]map[int]types.TeamID
+
+	// expected holds the events waited for with Expect, keyed by event ID.
+	expected map[string]chan uint64
+}
+
+// identifiable is implemented by messages with an event ID.
+type identifiable interface {
+	EventID() string
+}
+
+// NewStore returns an empty store. When loading a team applies at least
+// snapshotEvery events, the resulting state is kept as a snapshot and the
+// events are dropped. Zero disables snapshots.
+func NewStore(snapshotEvery int) *Store {
+	s := &Store{snapshotEvery: snapshotEvery, expected: make(map[string]chan uint64), starts: make(map[string]time.Time)}
+	s.Reset()
+	return s
+}
+
+func (s *Store) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+		streaminterface.SubjectFromStr("nathejk"),
+	}
+}
+
+func (s *Store) HandleMessage(msg streaminterface.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := msg.(identifiable); ok {
+		if handled, ok := s.expected[id.EventID()]; ok {
+			handled <- msg.Sequence()
+			delete(s.expected, id.EventID())
+		}
+	}
+	if msg.Subject().Subject() == "nathejk:year.created" {
+		var body nathejk.NathejkYearCreated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		year := NewYear(string(body.Slug))
+		year.apply(body)
+		s.years[year.Year] = year
+		return nil
+	}
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil {
+		log.Printf("[aggregate] skipping %q at %d: %v", msg.Subject().Subject(), msg.Sequence(), err)
+		return nil
+	}
+
+	switch subj.Entity {
+	case subject.Patrulje, subject.Klan:
+		teamID := types.TeamID(subj.ID)
+		s.events[teamID] = append(s.events[teamID], msg)
+		if subj.Verb == subject.VerbNumber {
+			var body nathejk.NathejkTeamNumberAssigned
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			key := numberKey{subj.Year, subj.TeamType()}
+			if s.numbers[key] == nil {
+				s.numbers[key] = make(map[int]types.TeamID)
+			}
+			if _, ok := s.numbers[key][body.TeamNumber]; !ok {
+				s.numbers[key][body.TeamNumber] = teamID
+			}
+		}
+		if subj.Verb != subject.VerbRoster {
+			break
+		}
+		var body nathejk.NathejkTeamRosterUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		for _, m := range body.Members {
+			s.members[m.MemberID] = teamID
+		}
+		for _, memberID := range body.Deleted {
+			delete(s.members, memberID)
+		}
+
+	case subject.Spejder, subject.Senior:
+		memberID := types.MemberID(subj.ID)
+		var body struct {
+			TeamID types.TeamID `json:"teamId"`
+		}
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		// A member moving to another team is an event on both teams.
+		if prev, ok := s.members[memberID]; ok && prev != body.TeamID {
+			s.events[prev] = append(s.events[prev], msg)
+		}
+		// A deleted member, or one without a team, is no longer on any
+		// team, also when the event does not name the team it left.
+		if subj.Verb == subject.VerbDeleted || body.TeamID == "" {
+			delete(s.members, memberID)
+		}
+		if body.TeamID == "" {
+			break
+		}
+		s.events[body.TeamID] = append(s.events[body.TeamID], msg)
+		if subj.Verb != subject.VerbDeleted {
+			s.members[memberID] = body.TeamID
+		}
+	}
+	return nil
+}
+
+// Reset forgets all events and snapshots before the stream is replayed.
+func (s *Store) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = make(map[types.TeamID][]streaminterface.Message)
+	s.members = make(map[types.MemberID]types.TeamID)
+	s.snapshots = make(map[types.TeamID]*Team)
+	s.years = make(map[string]*Year)
+	s.numbers = make(map[numberKey]map[int]types.TeamID)
+	return nil
+}
+
+// Expect returns a channel receiving the sequence of the event with eventID
+// once the store has handled it. Call it before publishing the event, and
+// call cancel if the event is not waited for after all.
+func (s *Store) Expect(eventID string) (handled <-chan uint64, cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan uint64, 1)
+	s.expected[eventID] = ch
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.expected[eventID] == ch {
+			delete(s.expected, eventID)
+		}
+	}
+}
+
+// MemberTeam returns the team of a member, false if the member is not on a
+// team.
+func (s *Store) MemberTeam(memberID types.MemberID) (types.TeamID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teamID, ok := s.members[memberID]
+	return teamID, ok
+}
+
+// SetStartTime sets the start time of year used until its created event
+// tells it.
+func (s *Store) SetStartTime(year string, start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.starts[year] = start
+}
+
+// LoadYear returns the current state of year. A year without events has
+// the default age rules and the configured start time, if any.
+func (s *Store) LoadYear(year string) *Year {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	y := NewYear(year)
+	if created, ok := s.years[year]; ok {
+		c := *created
+		y = &c
+	}
+	if start, ok := s.starts[year]; ok && y.StartTime == nil {
+		y.StartTime = &start
+	}
+	return y
+}
+
+// LoadTeam returns the current state of a team. A team without events is
+// returned with Exists() false.
+func (s *Store) LoadTeam(teamID types.TeamID) (*Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team := NewTeam(teamID)
+	if snapshot, ok := s.snapshots[teamID]; ok {
+		team = snapshot.clone()
+	}
+	events := s.events[teamID]
+	for _, msg := range events {
+		if err := team.Apply(msg); err != nil {
+			return nil, err
+		}
+	}
+	if s.snapshotEvery > 0 && len(events) >= s.snapshotEvery {
+		s.snapshots[teamID] = team.clone()
+		delete(s.events, teamID)
+	}
+	return team, nil
+}
+
+var _ streaminterface.Consumer = (*Store)(nil)
@@ -0,0 +1,262 @@
+// Package aggregate rebuilds the state of a team from its own events, so
+// the commands can check invariants before publishing new events.
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// Domain errors returned by the commands. Handlers map them to HTTP status
+// codes.
+var (
+	ErrTeamNotFound      = errors.New("team not found")
+	ErrTeamExists        = errors.New("team already exists")
+	ErrMemberNotFound    = errors.New("member not found")
+	ErrMemberExists      = errors.New("member already exists")
+	ErrTeamOut           = errors.New("team is out and can no longer be changed")
+	ErrInvalidTransition = errors.New("invalid signup status transition")
+	ErrVersionMismatch   = errors.New("team has changed since the given version")
+	ErrEmailConfirmed    = errors.New("e-mail address is already confirmed")
+	ErrEmailUnconfirmed  = errors.New("e-mail address is not confirmed")
+	ErrPhoneUnconfirmed  = errors.New("phone number is not confirmed")
+)
+
+// Team is the state of a team as told by its events.
+type Team struct {
+	ID     types.TeamID
+	Type   types.TeamType
+	Year   string
+	Status types.SignupStatus
+	// Number is the team number, zero until it is assigned.
+	Number int
+	// Email is the e-mail address confirmed by the contact, empty until it
+	// is confirmed.
+	Email types.EmailAddress
+	// Phone is the phone number confirmed with the pincode, empty until it
+	// is confirmed.
+	Phone types.PhoneNumber
+
+	// Details holds the team and contact details as last told.
+	Details          messages.NathejkTeamUpdated
+	ContactBirthDate types.Date
+	// Members holds the members on the team and their details as last told.
+	Members map[types.MemberID]nathejk.NathejkRosterMember
+
+	// Sequence is the stream sequence of the last applied event. It is the
+	// version of the team.
+	Sequence uint64
+
+	// subjects holds the sequence of the last applied event on each subject,
+	// keyed by subject type.
+	subjects map[string]uint64
+}
+
+// NewTeam returns the state of a team that has no events yet.
+func NewTeam(teamID types.TeamID) *Team {
+	return &Team{ID: teamID, Members: make(map[types.MemberID]nathejk.NathejkRosterMember), subjects: make(map[string]uint64)}
+}
+
+func (t *Team) clone() *Team {
+	c := *t
+	c.Members = make(map[types.MemberID]nathejk.NathejkRosterMember, len(t.Members))
+	for id, m := range t.Members {
+		c.Members[id] = m
+	}
+	c.subjects = make(map[string]uint64, len(t.subjects))
+	for s, seq := range t.subjects {
+		c.subjects[s] = seq
+	}
+	return &c
+}
+
+// Exists reports whether the team has signed up.
+func (t *Team) Exists() bool {
+	return t.Type != ""
+}
+
+// CanChange returns an error unless the team exists and is not out.
+func (t *Team) CanChange() error {
+	if !t.Exists() {
+		return fmt.Errorf("%w: %s", ErrTeamNotFound, t.ID)
+	}
+	if t.Status == types.SignupStatusOut {
+		return ErrTeamOut
+	}
+	return nil
+}
+
+// IsConfirmed returns an error unless the contact has confirmed both the
+// e-mail address and the phone number given at signup.
+func (t *Team) IsConfirmed() error {
+	if t.Email == "" {
+		return ErrEmailUnconfirmed
+	}
+	if t.Phone == "" {
+		return ErrPhoneUnconfirmed
+	}
+	return nil
+}
+
+// HasMember returns an error unless memberID is a member of the team.
+func (t *Team) HasMember(memberID types.MemberID) error {
+	if _, ok := t.Members[memberID]; !ok {
+		return fmt.Errorf("%w: %s", ErrMemberNotFound, memberID)
+	}
+	return nil
+}
+
+// Member returns the details of a member of the team.
+func (t *Team) Member(memberID types.MemberID) (nathejk.NathejkRosterMember, error) {
+	m, ok := t.Members[memberID]
+	if !ok {
+		return m, fmt.Errorf("%w: %s", ErrMemberNotFound, memberID)
+	}
+	return m, nil
+}
+
+// SubjectSequence returns the sequence of the last applied event on subj,
+// or zero if there is none.
+func (t *Team) SubjectSequence(subj streaminterface.Subject) uint64 {
+	return t.subjects[subj.Type()]
+}
+
+// Published records that an event on subj was stored at seq, for an event
+// applied before the stream told its sequence.
+func (t *Team) Published(subj streaminterface.Subject, seq uint64) {
+	if seq > t.subjects[subj.Type()] {
+		t.subjects[subj.Type()] = seq
+	}
+	if seq > t.Sequence {
+		t.Sequence = seq
+	}
+}
+
+// IsVersion returns an error unless version is the version of the team.
+func (t *Team) IsVersion(version uint64) error {
+	if t.Sequence != version {
+		return fmt.Errorf("%w: %d, now %d", ErrVersionMismatch, version, t.Sequence)
+	}
+	return nil
+}
+
+// CanTransition returns an error unless the team may change signup status
+// to status, see nathejktypes.SignupStatus.CanTransition.
+func (t *Team) CanTransition(status types.SignupStatus) error {
+	if err := t.CanChange(); err != nil {
+		return err
+	}
+	if !nathejktypes.SignupStatus(t.Status).CanTransition(nathejktypes.SignupStatus(status)) {
+		return fmt.Errorf("%w: %q to %q", ErrInvalidTransition, t.Status, status)
+	}
+	return nil
+}
+
+// Apply applies an event to the team. Events about other teams, and events
+// that do not change the state, are ignored.
+func (t *Team) Apply(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil {
+		log.Printf("[aggregate] team %s skipping %q at %d: %v", t.ID, msg.Subject().Subject(), msg.Sequence(), err)
+		return nil
+	}
+	switch subj.Entity {
+	case subject.Patrulje, subject.Klan:
+		if types.TeamID(subj.ID) != t.ID {
+			return nil
+		}
+		switch {
+		case subj.Verb == subject.VerbSignedup:
+			var body messages.NathejkTeamSignedUp
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			t.Type, t.Year = subj.TeamType(), subj.Year
+			t.Details = messages.NathejkTeamUpdated{
+				TeamID:       t.ID,
+				Type:         t.Type,
+				ContactName:  body.Name,
+				ContactEmail: body.Email,
+				ContactPhone: body.Phone,
+			}
+		case subj.Verb == subject.VerbUpdated && len(subj.SubVerbs) == 0:
+			var body messages.NathejkTeamUpdated
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			body.TeamID, body.Type = t.ID, t.Type
+			t.Details = body
+		case subj.Verb == subject.VerbStatus && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbChanged:
+			var body struct {
+				Status types.SignupStatus `json:"signupStatus"`
+			}
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			t.Status = body.Status
+		case subj.Verb == subject.VerbNumber:
+			var body nathejk.NathejkTeamNumberAssigned
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			t.Number = body.TeamNumber
+		case subj.Verb == subject.VerbEmail && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbConfirmed:
+			var body nathejk.NathejkEmailConfirmed
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			t.Email = types.EmailAddress(body.Email)
+		case subj.Verb == subject.VerbPhone && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbConfirmed:
+			var body nathejk.NathejkPhoneNumberConfirmed
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			t.Phone = types.PhoneNumber(body.Phone)
+		case subj.Verb == subject.VerbRoster:
+			var body nathejk.NathejkTeamRosterUpdated
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			body.Team.TeamID, body.Team.Type = t.ID, t.Type
+			t.Details, t.ContactBirthDate = body.Team, body.ContactBirthDate
+			for _, m := range body.Members {
+				t.Members[m.MemberID] = m
+			}
+			for _, memberID := range body.Deleted {
+				delete(t.Members, memberID)
+			}
+		}
+
+	case subject.Spejder, subject.Senior:
+		memberID := types.MemberID(subj.ID)
+		switch subj.Verb {
+		case subject.VerbUpdated:
+			var body struct {
+				TeamID types.TeamID `json:"teamId"`
+				nathejk.NathejkRosterMember
+			}
+			if err := msg.Body(&body); err != nil {
+				return err
+			}
+			if body.TeamID == t.ID {
+				body.MemberID = memberID
+				t.Members[memberID] = body.NathejkRosterMember
+			} else {
+				// The member has moved to another team.
+				delete(t.Members, memberID)
+			}
+		case subject.VerbDeleted:
+			delete(t.Members, memberID)
+		}
+	}
+	t.Published(msg.Subject(), msg.Sequence())
+	return nil
+}
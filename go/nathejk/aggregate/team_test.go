@@ -0,0 +1,253 @@
+package aggregate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func event(seq uint64, subj subject.Subject, body any) streaminterface.Message {
+	return streamtest.NewMessageP(streaminterface.SubjectFromStr(subj.String()), streamtest.MessageData{Sequence: seq, Body: body})
+}
+
+func TestTeamTransitions(t *testing.T) {
+	assert := assert.New(t)
+
+	team := aggregate.NewTeam("team-1")
+	assert.ErrorIs(team.CanTransition(types.SignupStatusPay), aggregate.ErrTeamNotFound)
+
+	team.Apply(event(1, subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1"}))
+	assert.True(team.Exists())
+	assert.Equal(types.TeamTypeKlan, team.Type)
+	assert.NoError(team.CanTransition(types.SignupStatusPay))
+	assert.ErrorIs(team.CanTransition(types.SignupStatusPaid), aggregate.ErrInvalidTransition)
+
+	team.Apply(event(2, subject.StatusChanged("2024", types.TeamTypeKlan, "team-1"), messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: types.SignupStatusPay}))
+	team.Apply(event(3, subject.StatusChanged("2024", types.TeamTypeKlan, "team-1"), messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: types.SignupStatusPaid}))
+	assert.Equal(types.SignupStatusPaid, team.Status)
+	assert.ErrorIs(team.CanTransition(types.SignupStatusOnHold), aggregate.ErrInvalidTransition)
+	assert.ErrorIs(team.CanTransition(types.SignupStatusOut), aggregate.ErrInvalidTransition)
+
+	team.Apply(event(4, subject.StatusChanged("2024", types.TeamTypeKlan, "team-1"), messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: types.SignupStatusStarted}))
+	team.Apply(event(5, subject.StatusChanged("2024", types.TeamTypeKlan, "team-1"), messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: types.SignupStatusOut}))
+	assert.ErrorIs(team.CanChange(), aggregate.ErrTeamOut)
+	assert.ErrorIs(team.CanTransition(types.SignupStatusStarted), aggregate.ErrTeamOut)
+	assert.Equal(uint64(5), team.Sequence)
+	assert.NoError(team.IsVersion(5))
+	assert.ErrorIs(team.IsVersion(4), aggregate.ErrVersionMismatch)
+	assert.Equal(uint64(1), team.SubjectSequence(streaminterface.SubjectFromStr(subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbSignedup).String())))
+	assert.Equal(uint64(5), team.SubjectSequence(streaminterface.SubjectFromStr(subject.StatusChanged("2024", types.TeamTypeKlan, "team-1").String())))
+	assert.Zero(team.SubjectSequence(streaminterface.SubjectFromStr(subject.RosterUpdated("2024", types.TeamTypeKlan, "team-1").String())))
+}
+
+func TestTeamTransitionTable(t *testing.T) {
+	statuses := []types.SignupStatus{
+		types.SignupStatusNone,
+		types.SignupStatusNew,
+		types.SignupStatusOnHold,
+		types.SignupStatusPay,
+		types.SignupStatusPaid,
+		types.SignupStatusStarted,
+		types.SignupStatusOut,
+	}
+	allowed := map[types.SignupStatus][]types.SignupStatus{
+		types.SignupStatusNone:    {types.SignupStatusNew, types.SignupStatusOnHold, types.SignupStatusPay},
+		types.SignupStatusNew:     {types.SignupStatusOnHold, types.SignupStatusPay},
+		types.SignupStatusOnHold:  {types.SignupStatusPay},
+		types.SignupStatusPay:     {types.SignupStatusPaid},
+		types.SignupStatusPaid:    {types.SignupStatusStarted},
+		types.SignupStatusStarted: {types.SignupStatusOut},
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			team := aggregate.NewTeam("team-1")
+			team.Apply(event(1, subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1"}))
+			team.Apply(event(2, subject.StatusChanged("2024", types.TeamTypeKlan, "team-1"), messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: from}))
+
+			err := team.CanTransition(to)
+			switch {
+			case from == types.SignupStatusOut:
+				assert.ErrorIs(t, err, aggregate.ErrTeamOut, "%q to %q", from, to)
+			case contains(allowed[from], to):
+				assert.NoError(t, err, "%q to %q", from, to)
+			default:
+				assert.ErrorIs(t, err, aggregate.ErrInvalidTransition, "%q to %q", from, to)
+			}
+		}
+	}
+}
+
+func contains(statuses []types.SignupStatus, status types.SignupStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s := aggregate.NewStore(3)
+	s.HandleMessage(event(1, subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1"}))
+	s.HandleMessage(event(2, subject.Team("2024", types.TeamTypePatrulje, "team-2", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-2"}))
+	s.HandleMessage(event(3, subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1"}))
+	s.HandleMessage(event(4, subject.Member("2024", subject.Spejder, "member-2", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1"}))
+
+	team, err := s.LoadTeam("team-1")
+	assert.NoError(err)
+	assert.NoError(team.HasMember("member-1"))
+	assert.NoError(team.HasMember("member-2"))
+	assert.Equal(uint64(4), team.Sequence)
+
+	// member-1 moves to team-2; team-1 loads from its snapshot.
+	s.HandleMessage(event(5, subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-2"}))
+	s.HandleMessage(event(6, subject.Member("2024", subject.Spejder, "member-2", subject.VerbDeleted), messages.NathejkMemberDeleted{MemberID: "member-2", TeamID: "team-1"}))
+
+	team, err = s.LoadTeam("team-1")
+	assert.NoError(err)
+	assert.True(team.Exists())
+	assert.ErrorIs(team.HasMember("member-1"), aggregate.ErrMemberNotFound)
+	assert.ErrorIs(team.HasMember("member-2"), aggregate.ErrMemberNotFound)
+	assert.Equal(uint64(6), team.Sequence)
+
+	team, err = s.LoadTeam("team-2")
+	assert.NoError(err)
+	assert.NoError(team.HasMember("member-1"))
+	teamID, ok := s.MemberTeam("member-1")
+	assert.True(ok)
+	assert.Equal(types.TeamID("team-2"), teamID)
+	_, ok = s.MemberTeam("member-2")
+	assert.False(ok)
+
+	// A delete event without teamId still removes the member from its team.
+	s.HandleMessage(event(7, subject.Member("2024", subject.Spejder, "member-1", subject.VerbDeleted), messages.NathejkMemberDeleted{MemberID: "member-1"}))
+	_, ok = s.MemberTeam("member-1")
+	assert.False(ok)
+	team, err = s.LoadTeam("team-2")
+	assert.NoError(err)
+	assert.ErrorIs(team.HasMember("member-1"), aggregate.ErrMemberNotFound)
+
+	assert.NoError(s.Reset())
+	team, err = s.LoadTeam("team-1")
+	assert.NoError(err)
+	assert.False(team.Exists())
+}
+
+// identified is a message with an event ID.
+type identified struct {
+	streaminterface.Message
+	id string
+}
+
+func (m identified) EventID() string { return m.id }
+
+func TestStoreExpect(t *testing.T) {
+	assert := assert.New(t)
+
+	s := aggregate.NewStore(0)
+	handled, cancel := s.Expect("event-1")
+	defer cancel()
+	canceled, cancel2 := s.Expect("event-2")
+	cancel2()
+
+	s.HandleMessage(identified{event(7, subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1"}), "event-1"})
+	s.HandleMessage(identified{event(8, subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbUpdated), messages.NathejkTeamUpdated{TeamID: "team-1"}), "event-2"})
+
+	select {
+	case seq := <-handled:
+		assert.Equal(uint64(7), seq)
+	default:
+		t.Fatal("event-1 not handled")
+	}
+	assert.Len(canceled, 0)
+}
+
+func TestStoreRoster(t *testing.T) {
+	assert := assert.New(t)
+
+	s := aggregate.NewStore(0)
+	s.HandleMessage(event(1, subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1"}))
+	s.HandleMessage(event(2, subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1"), nathejk.NathejkTeamRosterUpdated{
+		Members: []nathejk.NathejkRosterMember{{MemberID: "member-1"}, {MemberID: "member-2"}},
+	}))
+	s.HandleMessage(event(3, subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1"), nathejk.NathejkTeamRosterUpdated{
+		Team:    messages.NathejkTeamUpdated{Name: "Ræverne", ContactName: "Anna"},
+		Members: []nathejk.NathejkRosterMember{{MemberID: "member-1", Name: "Bo"}},
+		Deleted: []types.MemberID{"member-2"},
+	}))
+
+	team, err := s.LoadTeam("team-1")
+	assert.NoError(err)
+	assert.NoError(team.HasMember("member-1"))
+	assert.ErrorIs(team.HasMember("member-2"), aggregate.ErrMemberNotFound)
+	assert.Equal(uint64(3), team.Sequence)
+	assert.Equal("Anna", team.Details.ContactName)
+	member, err := team.Member("member-1")
+	assert.NoError(err)
+	assert.Equal("Bo", member.Name)
+	teamID, ok := s.MemberTeam("member-1")
+	assert.True(ok)
+	assert.Equal(types.TeamID("team-1"), teamID)
+	_, ok = s.MemberTeam("member-2")
+	assert.False(ok)
+}
+
+func TestStoreYear(t *testing.T) {
+	assert := assert.New(t)
+
+	s := aggregate.NewStore(0)
+	year := s.LoadYear("2024")
+	assert.Equal(nathejktypes.DefaultAgeRules, year.AgeRules)
+	assert.Nil(year.StartTime)
+	_, err := year.Age(time.Date(2012, time.September, 14, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(err, aggregate.ErrStartTimeUnknown)
+
+	start := time.Date(2024, time.September, 13, 18, 0, 0, 0, time.UTC)
+	rules := nathejktypes.AgeRules{SpejderMinAge: 11, SpejderMaxAge: 15}
+	s.HandleMessage(streamtest.NewMessageP(streaminterface.SubjectFromStr("nathejk:year.created"), streamtest.MessageData{
+		Sequence: 1,
+		Body:     nathejk.NathejkYearCreated{Slug: "2024", StartTime: &start, AgeRules: &rules},
+	}))
+
+	year = s.LoadYear("2024")
+	assert.Equal(rules, year.AgeRules)
+	age, err := year.Age(time.Date(2012, time.September, 14, 0, 0, 0, 0, time.UTC))
+	assert.NoError(err)
+	assert.Equal(11, age)
+	age, _ = year.Age(time.Date(2012, time.September, 13, 0, 0, 0, 0, time.UTC))
+	assert.Equal(12, age)
+	assert.Equal(nathejktypes.DefaultAgeRules, s.LoadYear("2025").AgeRules)
+}
+
+func TestStoreYearStartTime(t *testing.T) {
+	assert := assert.New(t)
+
+	s := aggregate.NewStore(0)
+	configured := time.Date(2025, time.September, 12, 18, 0, 0, 0, time.UTC)
+	s.SetStartTime("2025", configured)
+	assert.Equal(&configured, s.LoadYear("2025").StartTime)
+	assert.Nil(s.LoadYear("2024").StartTime)
+
+	// The start time of the created event wins over the configured one.
+	start := time.Date(2025, time.September, 19, 18, 0, 0, 0, time.UTC)
+	s.HandleMessage(streamtest.NewMessageP(streaminterface.SubjectFromStr("nathejk:year.created"), streamtest.MessageData{
+		Body: nathejk.NathejkYearCreated{Slug: "2025", StartTime: &start},
+	}))
+	assert.Equal(&start, s.LoadYear("2025").StartTime)
+
+	// The configured start time survives a replay.
+	s.Reset()
+	assert.Equal(&configured, s.LoadYear("2025").StartTime)
+}
@@ -0,0 +1,42 @@
+package aggregate
+
+import (
+	"errors"
+	"time"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/types"
+)
+
+// ErrStartTimeUnknown is returned when an age is needed before the start of
+// the event is known, neither from its year.created event nor configured.
+var ErrStartTimeUnknown = errors.New("start of the event is not known")
+
+// Year is the state of a year as told by its events.
+type Year struct {
+	Year string
+	// StartTime is the start of the event, nil if it is not known yet.
+	StartTime *time.Time
+	AgeRules  types.AgeRules
+}
+
+// NewYear returns the state of a year that has no events yet.
+func NewYear(year string) *Year {
+	return &Year{Year: year, AgeRules: types.DefaultAgeRules}
+}
+
+func (y *Year) apply(body nathejk.NathejkYearCreated) {
+	y.StartTime = body.StartTime
+	if body.AgeRules != nil {
+		y.AgeRules = *body.AgeRules
+	}
+}
+
+// Age returns the age at the start of the event of someone born on birthday,
+// or ErrStartTimeUnknown if the start time is not known.
+func (y *Year) Age(birthday time.Time) (int, error) {
+	if y.StartTime == nil {
+		return 0, ErrStartTimeUnknown
+	}
+	return types.Age(birthday, *y.StartTime), nil
+}
@@ -1,22 +1,47 @@
 package commands
 
 import (
+	"context"
+
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
 	"nathejk.dk/internal/data"
+	"nathejk.dk/nathejk/aggregate"
 	"nathejk.dk/pkg/streaminterface"
 )
 
 type Commands struct {
 	Team interface {
-		Signup(types.TeamType, *messages.NathejkTeamSignedUp) error
-		UpdatePatrulje(types.TeamID, Patrulje, Contact, []Spejder) error
-		UpdateKlan(types.TeamID, Klan, []Senior) error
+		// The commands return the sequence of the last event written, zero
+		// if it is not known.
+		Signup(context.Context, types.TeamType, *messages.NathejkTeamSignedUp) (uint64, error)
+		UpdatePatrulje(context.Context, types.TeamID, uint64, Patrulje, Contact, []Spejder) (uint64, error)
+		UpdateKlan(context.Context, types.TeamID, uint64, Klan, []Senior) (uint64, error)
+		UpdateContact(context.Context, types.TeamID, uint64, ContactPatch) (uint64, error)
+
+		AddSpejder(context.Context, types.TeamID, uint64, Spejder) (uint64, error)
+		UpdateSpejder(context.Context, types.TeamID, uint64, types.MemberID, SpejderPatch) (uint64, error)
+		AddSenior(context.Context, types.TeamID, uint64, Senior) (uint64, error)
+		UpdateSenior(context.Context, types.TeamID, uint64, types.MemberID, SeniorPatch) (uint64, error)
+		DeleteMember(context.Context, types.TeamID, types.TeamType, uint64, types.MemberID) (uint64, error)
+		ConfirmEmail(context.Context, types.TeamID, types.EmailAddress) (uint64, error)
+		ConfirmPhone(context.Context, types.TeamID, types.PhoneNumber) (uint64, error)
+
+		// ResolveDuplicate, AssignNumber and ChangeStatus are commands of
+		// HQ, changing the teams at their current versions.
+		ResolveDuplicate(context.Context, types.MemberID, types.MemberID, Resolution) (uint64, error)
+		AssignNumber(context.Context, types.TeamID, types.TeamType, int) (uint64, error)
+		ChangeStatus(context.Context, types.TeamID, types.TeamType, types.SignupStatus, string) (uint64, error)
 	}
+	// Numberer gives the teams paid by any producer their number, and must
+	// consume the stream for that.
+	Numberer *Numberer
 }
 
-func New(stream streaminterface.Publisher, models data.Models) Commands {
+func New(stream streaminterface.Publisher, year string, models data.Models, teams *aggregate.Store) Commands {
+	team := NewTeam(stream, models.Teams, teams, year)
 	return Commands{
-		Team: NewTeam(stream, models.Teams),
+		Team:     team,
+		Numberer: NewNumberer(team),
 	}
 }
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// ConfirmEmail confirms email as the e-mail address of a team, once its
+// contact has followed the link of the confirmation mail. An address is
+// confirmed only once, so a link used twice returns
+// aggregate.ErrEmailConfirmed. It returns the sequence of the event
+// written, zero if it is not known.
+func (c *team) ConfirmEmail(ctx context.Context, teamID types.TeamID, email types.EmailAddress) (uint64, error) {
+	ch, err := c.beginLatest(teamID)
+	if err != nil {
+		return 0, err
+	}
+	state := ch.state
+	if state.Email == email {
+		ch.unlock()
+		return 0, aggregate.ErrEmailConfirmed
+	}
+	msg := c.message(ctx, streaminterface.SubjectFromStr(subject.EmailConfirmed(c.year, state.Type, state.ID).String()))
+	msg.SetBody(&nathejk.NathejkEmailConfirmed{
+		TeamID: nathejktypes.TeamID(state.ID),
+		Email:  nathejktypes.Email(email),
+	})
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	err = ch.publish(msg)
+	return ch.end(), err
+}
+
+// ConfirmPhone confirms phone as the phone number of a team, once its
+// contact has entered the pincode sent to it. The e-mail address must be
+// confirmed first, as the pincode is sent when it is. Confirming a number
+// again writes nothing. It returns the sequence of the event written, zero
+// if it is not known or nothing was written.
+func (c *team) ConfirmPhone(ctx context.Context, teamID types.TeamID, phone types.PhoneNumber) (uint64, error) {
+	ch, err := c.beginLatest(teamID)
+	if err != nil {
+		return 0, err
+	}
+	state := ch.state
+	if state.Email == "" {
+		ch.unlock()
+		return 0, aggregate.ErrEmailUnconfirmed
+	}
+	if state.Phone == phone {
+		ch.unlock()
+		return 0, nil
+	}
+	msg := c.message(ctx, streaminterface.SubjectFromStr(subject.PhoneConfirmed(c.year, state.Type, state.ID).String()))
+	msg.SetBody(&nathejk.NathejkPhoneNumberConfirmed{
+		TeamID: nathejktypes.TeamID(state.ID),
+		Phone:  nathejktypes.PhoneNumber(phone),
+	})
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	err = ch.publish(msg)
+	return ch.end(), err
+}
@@ -0,0 +1,73 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func TestConfirmEmail(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypeKlan, "team-2"),
+		event(subject.EmailConfirmed("2024", types.TeamTypeKlan, "team-2"), nathejk.NathejkEmailConfirmed{TeamID: "team-2", Email: "bo@example.com"}),
+	), "2024")
+	ctx := context.Background()
+
+	_, err := team.ConfirmEmail(ctx, "team-3", "anna@example.com")
+	assert.ErrorIs(err, aggregate.ErrTeamNotFound)
+	// The link has been used.
+	_, err = team.ConfirmEmail(ctx, "team-2", "bo@example.com")
+	assert.ErrorIs(err, aggregate.ErrEmailConfirmed)
+
+	_, err = team.ConfirmEmail(ctx, "team-1", "anna@example.com")
+	assert.NoError(err)
+	// The contact has changed the address and confirms the new one.
+	_, err = team.ConfirmEmail(ctx, "team-2", "bo@example.org")
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-1.email.confirmed",
+		Body:    nathejk.NathejkEmailConfirmed{TeamID: "team-1", Email: "anna@example.com"},
+	}, streamtest.Expect{
+		Subject: "NATHEJK:2024.klan.team-2.email.confirmed",
+		Body:    nathejk.NathejkEmailConfirmed{TeamID: "team-2", Email: "bo@example.org"},
+	})
+}
+
+func TestConfirmPhone(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypeKlan, "team-2"),
+		event(subject.EmailConfirmed("2024", types.TeamTypeKlan, "team-2"), nathejk.NathejkEmailConfirmed{TeamID: "team-2", Email: "bo@example.com"}),
+		signedUp(types.TeamTypeKlan, "team-3"),
+		event(subject.EmailConfirmed("2024", types.TeamTypeKlan, "team-3"), nathejk.NathejkEmailConfirmed{TeamID: "team-3", Email: "cy@example.com"}),
+		event(subject.PhoneConfirmed("2024", types.TeamTypeKlan, "team-3"), nathejk.NathejkPhoneNumberConfirmed{TeamID: "team-3", Phone: "87654321"}),
+	), "2024")
+	ctx := context.Background()
+
+	_, err := team.ConfirmPhone(ctx, "team-1", "12345678")
+	assert.ErrorIs(err, aggregate.ErrEmailUnconfirmed)
+	_, err = team.ConfirmPhone(ctx, "team-2", "12345678")
+	assert.NoError(err)
+	// The pincode is entered again.
+	_, err = team.ConfirmPhone(ctx, "team-3", "87654321")
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.klan.team-2.phone.confirmed",
+		Body:    nathejk.NathejkPhoneNumberConfirmed{TeamID: "team-2", Phone: "12345678"},
+	})
+}
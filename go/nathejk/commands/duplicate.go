@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/internal/validator"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+)
+
+// Resolution tells how a duplicate member is resolved.
+type Resolution string
+
+const (
+	// ResolveDelete deletes the duplicate.
+	ResolveDelete Resolution = "delete"
+	// ResolveMerge fills the empty fields of the member kept from the
+	// duplicate, then deletes the duplicate.
+	ResolveMerge Resolution = "merge"
+)
+
+// fill sets *dst to v if *dst is the zero value.
+func fill[T comparable](dst *T, v T) {
+	var zero T
+	if *dst == zero {
+		*dst = v
+	}
+}
+
+// ResolveDuplicate resolves that memberID is a duplicate of keepID, by
+// deleting it or merging it into keepID. The members may be on different
+// teams, which are changed at their current versions. Both teams are locked
+// for the whole resolution, so the duplicate merged is the one deleted. It
+// returns the sequence of the last event written, zero if it is not known.
+func (c *team) ResolveDuplicate(ctx context.Context, memberID, keepID types.MemberID, resolution Resolution) (uint64, error) {
+	err := validate(func(v validator.Validator) {
+		v.Check(memberID != "", "memberId", "must be provided")
+		v.Check(keepID != "", "keepMemberId", "must be provided")
+		v.Check(memberID != keepID, "keepMemberId", "must be another member")
+		v.Check(validator.PermittedValue(resolution, ResolveDelete, ResolveMerge), "resolution", "must be delete or merge")
+	})
+	if err != nil {
+		return 0, err
+	}
+	teamID, ok := c.l.MemberTeam(memberID)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", aggregate.ErrMemberNotFound, memberID)
+	}
+	keepTeamID, ok := c.l.MemberTeam(keepID)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", aggregate.ErrMemberNotFound, keepID)
+	}
+
+	ch, keep, err := c.beginBoth(teamID, keepTeamID)
+	if err != nil {
+		return 0, err
+	}
+	// The members are checked again under the locks, as they may have
+	// moved since they were looked up.
+	duplicate, err := ch.state.Member(memberID)
+	if err == nil && resolution == ResolveMerge {
+		err = keep.mergeMember(ctx, keepID, duplicate)
+	}
+	if err == nil {
+		err = ch.deleteMember(ctx, memberID)
+	}
+	if keep != ch {
+		keep.end()
+	}
+	return ch.end(), err
+}
+
+// beginBoth begins changing two teams, which may be the same team. They are
+// locked in the order of their IDs, so two commands locking the same teams
+// cannot deadlock.
+func (c *team) beginBoth(teamID, otherID types.TeamID) (ch, other *change, err error) {
+	if teamID == otherID {
+		ch, err = c.beginLatest(teamID)
+		return ch, ch, err
+	}
+	first, second := teamID, otherID
+	if second < first {
+		first, second = second, first
+	}
+	a, err := c.beginLatest(first)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := c.beginLatest(second)
+	if err != nil {
+		a.end()
+		return nil, nil, err
+	}
+	if first != teamID {
+		a, b = b, a
+	}
+	return a, b, nil
+}
+
+// mergeMember fills the empty fields of a member of the team from
+// duplicate.
+func (ch *change) mergeMember(ctx context.Context, memberID types.MemberID, duplicate nathejk.NathejkRosterMember) error {
+	member, err := ch.state.Member(memberID)
+	if err != nil {
+		return err
+	}
+	fill(&member.Name, duplicate.Name)
+	fill(&member.Address, duplicate.Address)
+	fill(&member.PostalCode, duplicate.PostalCode)
+	fill(&member.City, duplicate.City)
+	fill(&member.Email, duplicate.Email)
+	fill(&member.Phone, duplicate.Phone)
+	fill(&member.PhoneContact, duplicate.PhoneContact)
+	fill(&member.BirthDate, duplicate.BirthDate)
+	fill(&member.Returning, duplicate.Returning)
+	fill(&member.TShirtSize, duplicate.TShirtSize)
+	fill(&member.Diet, duplicate.Diet)
+	return ch.publishMember(ctx, member)
+}
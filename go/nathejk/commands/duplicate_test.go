@@ -0,0 +1,83 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func TestResolveDuplicate(t *testing.T) {
+	events := given(
+		signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypePatrulje, "team-2"), emailConfirmed(types.TeamTypePatrulje, "team-2"), phoneConfirmed(types.TeamTypePatrulje, "team-2"),
+		roster(types.TeamTypePatrulje, "team-1", nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo", Phone: "12345678", TShirtSize: "s"}),
+		roster(types.TeamTypePatrulje, "team-2", nathejk.NathejkRosterMember{MemberID: "member-2", Name: "Bo Hansen", Email: "bo@example.com", BirthDate: "2012-01-01"}),
+	)
+
+	t.Run("delete", func(t *testing.T) {
+		p := streamtest.NewRecorder()
+		team := commands.NewTeam(p, &teams{}, events, "2024")
+
+		_, err := team.ResolveDuplicate(context.Background(), "member-1", "member-2", commands.ResolveDelete)
+		assert.NoError(t, err)
+		p.Then(t, streamtest.Expect{
+			Subject: "NATHEJK:2024.spejder.member-1.deleted",
+			Body:    messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"},
+		})
+	})
+	t.Run("merge", func(t *testing.T) {
+		p := streamtest.NewRecorder()
+		team := commands.NewTeam(p, &teams{}, events, "2024")
+
+		_, err := team.ResolveDuplicate(context.Background(), "member-1", "member-2", commands.ResolveMerge)
+		assert.NoError(t, err)
+		p.Then(t, streamtest.Expect{
+			Subject: "NATHEJK:2024.spejder.member-2.updated",
+			Body:    messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-2", Name: "Bo Hansen", Email: "bo@example.com", Phone: "12345678", BirthDate: "2012-01-01", TShirtSize: "s"},
+		}, streamtest.Expect{
+			Subject: "NATHEJK:2024.spejder.member-1.deleted",
+			Body:    messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"},
+		})
+	})
+	t.Run("merge on the same team", func(t *testing.T) {
+		p := streamtest.NewRecorder()
+		team := commands.NewTeam(p, &teams{}, given(
+			signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+			roster(types.TeamTypePatrulje, "team-1",
+				nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo", Phone: "12345678"},
+				nathejk.NathejkRosterMember{MemberID: "member-2", Name: "Bo Hansen"},
+			),
+		), "2024")
+
+		_, err := team.ResolveDuplicate(context.Background(), "member-1", "member-2", commands.ResolveMerge)
+		assert.NoError(t, err)
+		p.Then(t, streamtest.Expect{
+			Subject: "NATHEJK:2024.spejder.member-2.updated",
+			Body:    messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1", Name: "Bo Hansen", Phone: "12345678"},
+		}, streamtest.Expect{
+			Subject: "NATHEJK:2024.spejder.member-1.deleted",
+			Body:    messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"},
+		})
+	})
+	t.Run("invalid", func(t *testing.T) {
+		p := streamtest.NewRecorder()
+		team := commands.NewTeam(p, &teams{}, events, "2024")
+
+		_, err := team.ResolveDuplicate(context.Background(), "member-1", "member-1", "keep")
+		var verr *commands.ValidationError
+		if assert.ErrorAs(t, err, &verr) {
+			assert.Equal(t, map[string]string{"keepMemberId": "must be another member", "resolution": "must be delete or merge"}, verr.Errors)
+		}
+		_, err = team.ResolveDuplicate(context.Background(), "member-3", "member-1", commands.ResolveDelete)
+		assert.ErrorIs(t, err, aggregate.ErrMemberNotFound)
+		p.Then(t)
+	})
+}
@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/internal/validator"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// patch sets *dst to *v unless v is nil.
+func patch[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// AddSpejder adds a new spejder with the ID m.MemberID to a patrulje.
+// version must be the current version of the team, or ErrVersionMismatch is
+// returned. It returns the sequence of the event written, zero if it is not
+// known.
+func (c *team) AddSpejder(ctx context.Context, teamID types.TeamID, version uint64, m Spejder) (uint64, error) {
+	return c.addMember(ctx, teamID, types.TeamTypePatrulje, version, m.member())
+}
+
+// AddSenior adds a new senior with the ID m.MemberID to a klan. version must
+// be the current version of the team, or ErrVersionMismatch is returned. It
+// returns the sequence of the event written, zero if it is not known.
+func (c *team) AddSenior(ctx context.Context, teamID types.TeamID, version uint64, m Senior) (uint64, error) {
+	return c.addMember(ctx, teamID, types.TeamTypeKlan, version, m.member())
+}
+
+func (c *team) addMember(ctx context.Context, teamID types.TeamID, teamType types.TeamType, version uint64, member nathejk.NathejkRosterMember) (uint64, error) {
+	if member.MemberID == "" {
+		return 0, &ValidationError{Errors: map[string]string{"memberId": "must be provided"}}
+	}
+	ages := c.ages(ctx)
+	err := ages.validate(func(v validator.Validator) {
+		checkMember(v, member)
+		ages.member(v, teamType, member.BirthDate)
+	})
+	if err != nil {
+		return 0, err
+	}
+	ch, err := c.begin(teamID, teamType, version)
+	if err != nil {
+		return 0, err
+	}
+	if other, ok := c.l.MemberTeam(member.MemberID); ok {
+		err = fmt.Errorf("%w: %s is on team %s", aggregate.ErrMemberExists, member.MemberID, other)
+	} else {
+		err = ch.publishMember(ctx, member)
+	}
+	return ch.end(), err
+}
+
+// UpdateSpejder changes the fields of a spejder given in p. version must be
+// the current version of the team, or ErrVersionMismatch is returned. It
+// returns the sequence of the event written, zero if it is not known.
+func (c *team) UpdateSpejder(ctx context.Context, teamID types.TeamID, version uint64, memberID types.MemberID, p SpejderPatch) (uint64, error) {
+	return c.updateMember(ctx, teamID, types.TeamTypePatrulje, version, memberID, func(m *nathejk.NathejkRosterMember) {
+		patch(&m.Name, p.Name)
+		patch(&m.Address, p.Address)
+		patch(&m.PostalCode, p.PostalCode)
+		patch(&m.Email, p.Email)
+		patch(&m.Phone, p.Phone)
+		patch(&m.PhoneContact, p.PhoneContact)
+		patch(&m.BirthDate, p.Birthday)
+		patch(&m.TShirtSize, p.TShirtSize)
+	})
+}
+
+// UpdateSenior changes the fields of a senior given in p. version must be
+// the current version of the team, or ErrVersionMismatch is returned. It
+// returns the sequence of the event written, zero if it is not known.
+func (c *team) UpdateSenior(ctx context.Context, teamID types.TeamID, version uint64, memberID types.MemberID, p SeniorPatch) (uint64, error) {
+	return c.updateMember(ctx, teamID, types.TeamTypeKlan, version, memberID, func(m *nathejk.NathejkRosterMember) {
+		patch(&m.Name, p.Name)
+		patch(&m.Address, p.Address)
+		patch(&m.PostalCode, p.PostalCode)
+		patch(&m.Email, p.Email)
+		patch(&m.Phone, p.Phone)
+		patch(&m.BirthDate, p.Birthday)
+		patch(&m.Diet, p.Diet)
+		patch(&m.TShirtSize, p.TShirtSize)
+	})
+}
+
+func (c *team) updateMember(ctx context.Context, teamID types.TeamID, teamType types.TeamType, version uint64, memberID types.MemberID, apply func(*nathejk.NathejkRosterMember)) (uint64, error) {
+	ch, err := c.begin(teamID, teamType, version)
+	if err != nil {
+		return 0, err
+	}
+	member, err := ch.state.Member(memberID)
+	if err == nil {
+		birthday := member.BirthDate
+		apply(&member)
+		ages := c.ages(ctx)
+		err = ages.validate(func(v validator.Validator) {
+			checkMember(v, member)
+			// Only a changed birthday is checked against the age rules.
+			if member.BirthDate != birthday {
+				ages.member(v, teamType, member.BirthDate)
+			}
+		})
+	}
+	if err == nil {
+		err = ch.publishMember(ctx, member)
+	}
+	return ch.end(), err
+}
+
+// DeleteMember removes a member from a team of teamType. version must be
+// the current version of the team, or ErrVersionMismatch is returned. It
+// returns the sequence of the event written, zero if it is not known.
+func (c *team) DeleteMember(ctx context.Context, teamID types.TeamID, teamType types.TeamType, version uint64, memberID types.MemberID) (uint64, error) {
+	ch, err := c.begin(teamID, teamType, version)
+	if err != nil {
+		return 0, err
+	}
+	err = ch.deleteMember(ctx, memberID)
+	return ch.end(), err
+}
+
+// deleteMember removes a member of the team.
+func (ch *change) deleteMember(ctx context.Context, memberID types.MemberID) error {
+	state := ch.state
+	if err := state.HasMember(memberID); err != nil {
+		return err
+	}
+	msg := ch.c.message(ctx, streaminterface.SubjectFromStr(subject.Member(ch.c.year, memberEntity(state.Type), memberID, subject.VerbDeleted).String()))
+	msg.SetBody(&messages.NathejkMemberDeleted{MemberID: memberID, TeamID: state.ID})
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	return ch.publish(msg)
+}
+
+// UpdateContact changes the fields of the contact of a patrulje given in p.
+// The contact is published on a roster event without member changes, which
+// carries the birthday of the contact. version must be the current version
+// of the team, or ErrVersionMismatch is returned. It returns the sequence of
+// the event written, zero if it is not known.
+func (c *team) UpdateContact(ctx context.Context, teamID types.TeamID, version uint64, p ContactPatch) (uint64, error) {
+	ch, err := c.begin(teamID, types.TeamTypePatrulje, version)
+	if err != nil {
+		return 0, err
+	}
+	roster := nathejk.NathejkTeamRosterUpdated{
+		Team:             ch.state.Details,
+		ContactBirthDate: ch.state.ContactBirthDate,
+		Members:          []nathejk.NathejkRosterMember{},
+	}
+	details := &roster.Team
+	patch(&details.ContactName, p.Name)
+	patch(&details.ContactAddress, p.Address)
+	patch(&details.ContactPostalCode, p.PostalCode)
+	patch(&details.ContactEmail, p.Email)
+	patch(&details.ContactPhone, p.Phone)
+	patch(&details.ContactRole, p.Role)
+	patch(&roster.ContactBirthDate, p.Birthday)
+
+	contact := Contact{
+		Name:       details.ContactName,
+		Address:    details.ContactAddress,
+		PostalCode: details.ContactPostalCode,
+		Email:      details.ContactEmail,
+		Phone:      details.ContactPhone,
+		Role:       details.ContactRole,
+		Birthday:   roster.ContactBirthDate,
+	}
+	ages := c.ages(ctx)
+	err = ages.validate(func(v validator.Validator) {
+		contact.Validate(v)
+		if contact.Birthday != ch.state.ContactBirthDate {
+			ages.contact(v, contact.Birthday)
+		}
+	})
+	if err == nil {
+		err = ch.publishRoster(ctx, roster)
+	}
+	return ch.end(), err
+}
+
+// memberEntity returns the entity of the members of a team of teamType.
+func memberEntity(teamType types.TeamType) subject.Entity {
+	if teamType == types.TeamTypeKlan {
+		return subject.Senior
+	}
+	return subject.Spejder
+}
+
+// publishMember publishes the details of a member of the team, as the event
+// of a spejder or a senior depending on the type of the team.
+func (ch *change) publishMember(ctx context.Context, m nathejk.NathejkRosterMember) error {
+	state := ch.state
+	msg := ch.c.message(ctx, streaminterface.SubjectFromStr(subject.Member(ch.c.year, memberEntity(state.Type), m.MemberID, subject.VerbUpdated).String()))
+	if state.Type == types.TeamTypeKlan {
+		msg.SetBody(&messages.NathejkSeniorUpdated{
+			MemberID:   m.MemberID,
+			TeamID:     state.ID,
+			Name:       m.Name,
+			Address:    m.Address,
+			PostalCode: m.PostalCode,
+			City:       m.City,
+			Email:      m.Email,
+			Phone:      m.Phone,
+			BirthDate:  m.BirthDate,
+			Returning:  m.Returning,
+			TShirtSize: m.TShirtSize,
+			Diet:       m.Diet,
+		})
+	} else {
+		msg.SetBody(&messages.NathejkScoutUpdated{
+			MemberID:     m.MemberID,
+			TeamID:       state.ID,
+			Name:         m.Name,
+			Address:      m.Address,
+			PostalCode:   m.PostalCode,
+			City:         m.City,
+			Email:        m.Email,
+			Phone:        m.Phone,
+			PhoneContact: m.PhoneContact,
+			BirthDate:    m.BirthDate,
+			Returning:    m.Returning,
+			TShirtSize:   m.TShirtSize,
+		})
+	}
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	return ch.publish(msg)
+}
@@ -0,0 +1,167 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func roster(teamType types.TeamType, teamID types.TeamID, members ...nathejk.NathejkRosterMember) streaminterface.Message {
+	return event(subject.RosterUpdated("2024", teamType, teamID), nathejk.NathejkTeamRosterUpdated{Members: members})
+}
+
+func TestAddSpejder(t *testing.T) {
+	tests := map[string]struct {
+		teamID types.TeamID
+		member commands.Spejder
+		err    error
+		errs   map[string]string
+	}{
+		"new member": {
+			teamID: "team-1",
+			member: commands.Spejder{MemberID: "member-2", Name: "Carl", TShirtSize: "m"},
+		},
+		"member on the team": {
+			teamID: "team-1",
+			member: commands.Spejder{MemberID: "member-1", Name: "Bo"},
+			err:    aggregate.ErrMemberExists,
+		},
+		"klan": {
+			teamID: "team-2",
+			member: commands.Spejder{MemberID: "member-2", Name: "Carl"},
+			err:    aggregate.ErrTeamNotFound,
+		},
+		"invalid fields": {
+			teamID: "team-1",
+			member: commands.Spejder{MemberID: "member-2", Email: "carl", Phone: "123", TShirtSize: "xxxl"},
+			errs:   map[string]string{"name": "must be provided", "email": "must be a valid email address", "phone": "must be a phone number of 8 digits", "tshirtsize": "must be a known size"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			team := commands.NewTeam(p, &teams{}, given(
+				signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+				signedUp(types.TeamTypeKlan, "team-2"), emailConfirmed(types.TeamTypeKlan, "team-2"), phoneConfirmed(types.TeamTypeKlan, "team-2"),
+				roster(types.TeamTypePatrulje, "team-1", nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo"}),
+			), "2024")
+
+			_, err := team.AddSpejder(context.Background(), tt.teamID, 0, tt.member)
+			switch {
+			case tt.errs != nil:
+				var verr *commands.ValidationError
+				if assert.ErrorAs(t, err, &verr) {
+					assert.Equal(t, tt.errs, verr.Errors)
+				}
+				p.Then(t)
+			case tt.err != nil:
+				assert.ErrorIs(t, err, tt.err)
+				p.Then(t)
+			default:
+				assert.NoError(t, err)
+				p.Then(t, streamtest.Expect{
+					Subject: "NATHEJK:2024.spejder.member-2.updated",
+					Body:    messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1", Name: "Carl", TShirtSize: "m"},
+				})
+			}
+		})
+	}
+}
+
+func TestUpdateSpejder(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+		roster(types.TeamTypePatrulje, "team-1", nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo", Phone: "12345678", TShirtSize: "s"}),
+	), "2024")
+
+	_, err := team.UpdateSpejder(context.Background(), "team-1", 0, "member-2", commands.SpejderPatch{TShirtSize: ptr("m")})
+	assert.ErrorIs(err, aggregate.ErrMemberNotFound)
+	_, err = team.UpdateSpejder(context.Background(), "team-1", 0, "member-1", commands.SpejderPatch{Name: ptr(" ")})
+	assert.ErrorAs(err, new(*commands.ValidationError))
+
+	_, err = team.UpdateSpejder(context.Background(), "team-1", 0, "member-1", commands.SpejderPatch{TShirtSize: ptr("m")})
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.spejder.member-1.updated",
+		Body:    messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Bo", Phone: "12345678", TShirtSize: "m"},
+	})
+}
+
+func TestUpdateSenior(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1"),
+		roster(types.TeamTypeKlan, "team-1", nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo"}),
+	), "2024")
+
+	_, err := team.UpdateSenior(context.Background(), "team-1", 0, "member-1", commands.SeniorPatch{Diet: ptr("vegan")})
+	assert.NoError(t, err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.senior.member-1.updated",
+		Body:    messages.NathejkSeniorUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Bo", Diet: "vegan"},
+	})
+}
+
+func TestDeleteMember(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1"),
+		roster(types.TeamTypeKlan, "team-1", nathejk.NathejkRosterMember{MemberID: "member-1", Name: "Bo"}),
+	), "2024")
+
+	_, err := team.DeleteMember(context.Background(), "team-1", types.TeamTypePatrulje, 0, "member-1")
+	assert.ErrorIs(err, aggregate.ErrTeamNotFound)
+	_, err = team.DeleteMember(context.Background(), "team-1", types.TeamTypeKlan, 0, "member-2")
+	assert.ErrorIs(err, aggregate.ErrMemberNotFound)
+
+	_, err = team.DeleteMember(context.Background(), "team-1", types.TeamTypeKlan, 0, "member-1")
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.senior.member-1.deleted",
+		Body:    messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"},
+	})
+}
+
+func TestUpdateContact(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		event(subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: "team-1", Name: "Anna", Email: "anna@example.com"}),
+		event(subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbUpdated), messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ræverne", ContactName: "Anna", ContactEmail: "anna@example.com"}),
+		emailConfirmed(types.TeamTypePatrulje, "team-1"),
+		phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+	), "2024")
+
+	_, err := team.UpdateContact(context.Background(), "team-1", 0, commands.ContactPatch{Email: ptr(types.EmailAddress("anna"))})
+	var verr *commands.ValidationError
+	if assert.ErrorAs(err, &verr) {
+		assert.Equal(map[string]string{"email": "must be a valid email address"}, verr.Errors)
+	}
+
+	_, err = team.UpdateContact(context.Background(), "team-1", 0, commands.ContactPatch{Phone: ptr(types.PhoneNumber("12 34 56 78"))})
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-1.roster.updated",
+		Body: nathejk.NathejkTeamRosterUpdated{
+			Team: messages.NathejkTeamUpdated{TeamID: "team-1", Type: types.TeamTypePatrulje, Name: "Ræverne", ContactName: "Anna", ContactEmail: "anna@example.com", ContactPhone: "12 34 56 78"},
+		},
+	})
+}
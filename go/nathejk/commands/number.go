@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// AssignNumber gives a team of teamType the number chosen by HQ, or the
+// next free number if number is zero and the team has none. The team is
+// changed at its current version. It returns the sequence of the event
+// written, zero if it is not known or nothing was written.
+func (c *team) AssignNumber(ctx context.Context, teamID types.TeamID, teamType types.TeamType, number int) (uint64, error) {
+	ch, err := c.beginHQ(teamID, teamType)
+	if err != nil {
+		return 0, err
+	}
+	if number != 0 || ch.state.Number == 0 {
+		err = ch.assignNumber(ctx, number)
+	}
+	return ch.end(), err
+}
+
+// assignNumber gives the team its number, the next of its type unless
+// number is chosen by HQ. A number given to one team is never given to
+// another, also when it is given a new number.
+//
+// Numbers are handed out under a lock, and the numbers published but not
+// yet handled by the loader are kept in reserved, so two teams paying at
+// the same time do not get the same number.
+func (ch *change) assignNumber(ctx context.Context, number int) error {
+	c, state := ch.c, ch.state
+	c.numbersMu.Lock()
+	defer c.numbersMu.Unlock()
+
+	key := numberKey{c.year, state.Type}
+	reserved := c.reserved[key]
+	manual := number != 0
+	if manual {
+		if !aggregate.NumberRanges[state.Type].Contains(number) {
+			return fmt.Errorf("%w: %d", aggregate.ErrNumberOutOfRange, number)
+		}
+		other, ok := c.l.NumberTeam(c.year, state.Type, number)
+		if !ok {
+			other, ok = reserved[number]
+		}
+		if ok && other != state.ID {
+			return fmt.Errorf("%w: %d is given to %s", aggregate.ErrNumberTaken, number, other)
+		}
+	} else {
+		number = c.l.NextNumber(c.year, state.Type)
+		for n := range reserved {
+			if n >= number {
+				number = n + 1
+			}
+		}
+		if !aggregate.NumberRanges[state.Type].Contains(number) {
+			return fmt.Errorf("%w: no numbers left", aggregate.ErrNumberOutOfRange)
+		}
+	}
+
+	msg := c.message(ctx, streaminterface.SubjectFromStr(subject.NumberAssigned(c.year, state.Type, state.ID).String()))
+	msg.SetBody(&nathejk.NathejkTeamNumberAssigned{TeamID: state.ID, TeamNumber: number, Manual: manual})
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	if err := ch.publish(msg); err != nil {
+		return err
+	}
+	if reserved == nil {
+		reserved = make(map[int]types.TeamID)
+		c.reserved[key] = reserved
+	}
+	reserved[number] = state.ID
+	return nil
+}
+
+// numberKey identifies the numbers of a team type in a year.
+type numberKey struct {
+	year     string
+	teamType types.TeamType
+}
+
+// numberPaid gives the team its number if it has paid and has none.
+func (c *team) numberPaid(teamID types.TeamID) error {
+	ch, err := c.beginLatest(teamID)
+	if err != nil {
+		return err
+	}
+	if ch.state.Status == types.SignupStatusPaid && ch.state.Number == 0 {
+		err = ch.assignNumber(context.Background(), 0)
+	}
+	ch.end()
+	return err
+}
+
+// Numberer is a consumer giving the teams of the year that reach PAID their
+// number, also when the status is changed by another producer, e.g. the
+// payment service. The teams paid before it started are numbered once it has
+// caught up with the stream. Like the outbox worker, only one instance of
+// the API should run it.
+type Numberer struct {
+	c *team
+
+	mu       sync.Mutex
+	paid     map[types.TeamID]bool
+	caughtUp bool
+	wg       sync.WaitGroup
+}
+
+func NewNumberer(c *team) *Numberer {
+	return &Numberer{c: c, paid: map[types.TeamID]bool{}}
+}
+
+func (n *Numberer) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+	}
+}
+
+// Reset forgets the paid teams before the stream is replayed.
+func (n *Numberer) Reset() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.paid = map[types.TeamID]bool{}
+	n.caughtUp = false
+	return nil
+}
+
+// CaughtUp numbers the teams that paid before the numberer started.
+func (n *Numberer) CaughtUp() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.caughtUp = true
+	for teamID := range n.paid {
+		n.dispatch(teamID)
+	}
+}
+
+func (n *Numberer) HandleMessage(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || subj.Year != n.c.year || (subj.Entity != subject.Patrulje && subj.Entity != subject.Klan) {
+		return nil
+	}
+	teamID := types.TeamID(subj.ID)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case subj.Verb == subject.VerbStatus && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbChanged:
+		var body struct {
+			Status types.SignupStatus `json:"signupStatus"`
+		}
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		if body.Status != types.SignupStatusPaid {
+			delete(n.paid, teamID)
+			return nil
+		}
+		n.paid[teamID] = true
+		if n.caughtUp {
+			n.dispatch(teamID)
+		}
+	case subj.Verb == subject.VerbNumber:
+		delete(n.paid, teamID)
+	}
+	return nil
+}
+
+// Wait waits for the teams being numbered.
+func (n *Numberer) Wait() {
+	n.wg.Wait()
+}
+
+// dispatch numbers the team in the background, as the change waits for
+// the loader, which may consume the stream after the numberer. The caller
+// must hold n.mu.
+func (n *Numberer) dispatch(teamID types.TeamID) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.c.numberPaid(teamID); err != nil {
+			log.Printf("[commands] numbering team %s: %v", teamID, err)
+		}
+	}()
+}
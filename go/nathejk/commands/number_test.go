@@ -0,0 +1,108 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func TestAssignNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypePatrulje, "team-2"),
+		signedUp(types.TeamTypePatrulje, "team-3"),
+		signedUp(types.TeamTypeKlan, "team-4"),
+		event(subject.NumberAssigned("2024", types.TeamTypePatrulje, "team-1"), nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 1}),
+		// HQ gave team-1 another number, 1 is still not free.
+		event(subject.NumberAssigned("2024", types.TeamTypePatrulje, "team-1"), nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 7, Manual: true}),
+	), "2024")
+	ctx := context.Background()
+
+	_, err := team.AssignNumber(ctx, "team-2", types.TeamTypePatrulje, 0)
+	assert.NoError(err)
+	// The number given to team-2 is not handled by the loader yet.
+	_, err = team.AssignNumber(ctx, "team-3", types.TeamTypePatrulje, 0)
+	assert.NoError(err)
+	_, err = team.AssignNumber(ctx, "team-4", types.TeamTypeKlan, 0)
+	assert.NoError(err)
+	// team-1 already has a number.
+	_, err = team.AssignNumber(ctx, "team-1", types.TeamTypePatrulje, 0)
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-2.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-2", TeamNumber: 8},
+	}, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-3.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-3", TeamNumber: 9},
+	}, streamtest.Expect{
+		Subject: "NATHEJK:2024.klan.team-4.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-4", TeamNumber: 501},
+	})
+	p.Reset()
+
+	_, err = team.AssignNumber(ctx, "team-2", types.TeamTypePatrulje, 1)
+	assert.ErrorIs(err, aggregate.ErrNumberTaken)
+	_, err = team.AssignNumber(ctx, "team-2", types.TeamTypePatrulje, 9)
+	assert.ErrorIs(err, aggregate.ErrNumberTaken)
+	_, err = team.AssignNumber(ctx, "team-2", types.TeamTypePatrulje, 501)
+	assert.ErrorIs(err, aggregate.ErrNumberOutOfRange)
+	_, err = team.AssignNumber(ctx, "team-4", types.TeamTypePatrulje, 2)
+	assert.ErrorIs(err, aggregate.ErrTeamNotFound)
+
+	_, err = team.AssignNumber(ctx, "team-2", types.TeamTypePatrulje, 2)
+	assert.NoError(err)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-2.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-2", TeamNumber: 2, Manual: true},
+	})
+}
+
+func TestNumberer(t *testing.T) {
+	// team-1 was paid by the payment service before the numberer started,
+	// team-3 already has its number.
+	paid := statusChanged(types.TeamTypePatrulje, "team-1", types.SignupStatusPaid)
+	numbered := event(subject.NumberAssigned("2024", types.TeamTypePatrulje, "team-3"), nathejk.NathejkTeamNumberAssigned{TeamID: "team-3", TeamNumber: 1})
+	events := []streaminterface.Message{
+		signedUp(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypeKlan, "team-2"),
+		signedUp(types.TeamTypePatrulje, "team-3"),
+		paid,
+		statusChanged(types.TeamTypePatrulje, "team-3", types.SignupStatusPaid),
+		numbered,
+	}
+	store := given(events...)
+	p := streamtest.NewRecorder()
+	n := commands.NewNumberer(commands.NewTeam(p, &teams{}, store, "2024"))
+	for _, e := range events {
+		assert.NoError(t, n.HandleMessage(e))
+	}
+	n.CaughtUp()
+	n.Wait()
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-1.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 2},
+	})
+	p.Reset()
+
+	// Once caught up, a team is numbered as it pays.
+	klanPaid := statusChanged(types.TeamTypeKlan, "team-2", types.SignupStatusPaid)
+	store.HandleMessage(klanPaid)
+	assert.NoError(t, n.HandleMessage(klanPaid))
+	n.Wait()
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.klan.team-2.number.assigned",
+		Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-2", TeamNumber: 501},
+	})
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/internal/validator"
+	nathejktypes "nathejk.dk/nathejk/types"
+)
+
+// ChangeStatus changes the signup status of a team of teamType on behalf of
+// HQ, who must give a reason. Only the transitions of the signup status
+// state machine are allowed, and a team reaching PAID is given its number.
+// The team is changed at its current version. It returns the sequence of
+// the last event written, zero if it is not known.
+func (c *team) ChangeStatus(ctx context.Context, teamID types.TeamID, teamType types.TeamType, status types.SignupStatus, reason string) (uint64, error) {
+	err := validate(func(v validator.Validator) {
+		v.Check(nathejktypes.SignupStatus(status).Valid(), "status", "must be a signup status")
+		v.Check(strings.TrimSpace(reason) != "", "reason", "must be provided")
+	})
+	if err != nil {
+		return 0, err
+	}
+	ch, err := c.beginHQ(teamID, teamType)
+	if err != nil {
+		return 0, err
+	}
+	err = ch.setStatus(ctx, status, strings.TrimSpace(reason))
+	return ch.end(), err
+}
@@ -0,0 +1,70 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func TestChangeStatus(t *testing.T) {
+	tests := map[string]struct {
+		status types.SignupStatus
+		reason string
+		err    error
+		errs   map[string]string
+		want   []streamtest.Expect
+	}{
+		"paid": {
+			status: types.SignupStatusPaid, reason: "paid by bank transfer",
+			want: []streamtest.Expect{{
+				Subject: "NATHEJK:2024.patrulje.team-1.status.changed",
+				Body:    nathejk.NathejkTeamStatusChanged{TeamID: "team-1", Status: "PAID", Reason: "paid by bank transfer"},
+			}, {
+				Subject: "NATHEJK:2024.patrulje.team-1.number.assigned",
+				Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 1},
+			}},
+		},
+		"skipping paid": {
+			status: types.SignupStatusStarted, reason: "showed up",
+			err: aggregate.ErrInvalidTransition,
+		},
+		"without reason": {
+			status: types.SignupStatusPaid, reason: " ",
+			errs: map[string]string{"reason": "must be provided"},
+		},
+		"unknown status": {
+			status: "JOIN", reason: "merged",
+			errs: map[string]string{"status": "must be a signup status"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			team := commands.NewTeam(p, &teams{}, given(
+				signedUp(types.TeamTypePatrulje, "team-1"),
+				statusChanged(types.TeamTypePatrulje, "team-1", types.SignupStatusPay),
+			), "2024")
+
+			_, err := team.ChangeStatus(context.Background(), "team-1", types.TeamTypePatrulje, tt.status, tt.reason)
+			switch {
+			case tt.errs != nil:
+				var verr *commands.ValidationError
+				if assert.ErrorAs(t, err, &verr) {
+					assert.Equal(t, tt.errs, verr.Errors)
+				}
+			case tt.err != nil:
+				assert.ErrorIs(t, err, tt.err)
+			default:
+				assert.NoError(t, err)
+			}
+			p.Then(t, tt.want...)
+		})
+	}
+}
@@ -1,211 +1,453 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand/v2"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
-	"nathejk.dk/internal/data"
+	"nathejk.dk/internal/validator"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/correlation"
+	"nathejk.dk/pkg/nats"
 	"nathejk.dk/pkg/streaminterface"
 )
 
 type teamQuerier interface {
-	//ConfirmBySecret(string) (*data.Confirm, error)
-	GetKlan(types.TeamID) (*data.Klan, error)
 	RequestedSeniorCount() int
 }
+
+// teamLoader loads the state of a team from its events, and tells when it
+// has handled a published event, see aggregate.Store.
+type teamLoader interface {
+	LoadTeam(types.TeamID) (*aggregate.Team, error)
+	LoadYear(string) *aggregate.Year
+	MemberTeam(types.MemberID) (types.TeamID, bool)
+	NumberTeam(year string, teamType types.TeamType, number int) (types.TeamID, bool)
+	NextNumber(year string, teamType types.TeamType) int
+	Expect(eventID string) (<-chan uint64, func())
+}
+
+// identifiable is implemented by messages with an event ID.
+type identifiable interface {
+	EventID() string
+}
+
+// expecter is implemented by messages of streams that can reject a publish
+// when another message has been published on the subject in the meantime,
+// e.g. JetStream. The stream then returns an error the handlers map to 412.
+type expecter interface {
+	SetExpectedLastSubjectSequence(uint64)
+}
+
+// settleTimeout bounds how long a change waits for the loader to handle its
+// last event.
+const settleTimeout = 5 * time.Second
+
 type team struct {
-	p streaminterface.Publisher
-	q teamQuerier
+	p    streaminterface.Publisher
+	q    teamQuerier
+	l    teamLoader
+	year string
+
+	// locks holds a *sync.Mutex per team, serializing the changes of a team.
+	locks sync.Map
+
+	// numbersMu serializes handing out team numbers, and reserved holds the
+	// numbers handed out by this instance, see assignNumber.
+	numbersMu sync.Mutex
+	reserved  map[numberKey]map[int]types.TeamID
 }
 
-func NewTeam(p streaminterface.Publisher, q teamQuerier) *team {
+// NewTeam returns the team commands. Events are published on subjects of
+// year.
+func NewTeam(p streaminterface.Publisher, q teamQuerier, l teamLoader, year string) *team {
 	return &team{
-		p: p,
-		q: q,
+		p:    p,
+		q:    q,
+		l:    l,
+		year: year,
+
+		reserved: make(map[numberKey]map[int]types.TeamID),
 	}
 }
 
-func (c *team) Signup(teamType types.TeamType, body *messages.NathejkTeamSignedUp) error {
+// message returns a new message for subj carrying the correlation IDs of ctx.
+func (c *team) message(ctx context.Context, subj streaminterface.Subject) streaminterface.MutableMessage {
+	msg := c.p.MessageFunc()(subj)
+	correlation.Apply(ctx, msg)
+	return msg
+}
+
+// Signup signs up a new team. A team ID given by the client must not be
+// taken, or ErrTeamExists is returned. It returns the sequence of the
+// signedup event, zero if it is not known.
+func (c *team) Signup(ctx context.Context, teamType types.TeamType, body *messages.NathejkTeamSignedUp) (uint64, error) {
 	if body.TeamID == "" {
 		body.TeamID = types.TeamID(uuid.New().String())
 	}
 	if body.Pincode == "" {
 		body.Pincode = fmt.Sprintf("%d", rand.IntN(9000)+1000)
 	}
+	ch := &change{c: c, unlock: c.lock(body.TeamID)}
+	state, err := c.l.LoadTeam(body.TeamID)
+	if err != nil {
+		ch.unlock()
+		return 0, err
+	}
+	if state.Exists() {
+		ch.unlock()
+		return 0, fmt.Errorf("%w: %s", aggregate.ErrTeamExists, body.TeamID)
+	}
+	ch.state = state
 
-	msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.%s.%s.signedup", "2024", teamType, body.TeamID)))
+	msg := c.message(ctx, streaminterface.SubjectFromStr(subject.Team(c.year, teamType, body.TeamID, subject.VerbSignedup).String()))
 	msg.SetBody(body)
 	meta := messages.Metadata{Producer: "tilmelding-api"}
 	msg.SetMeta(&meta)
 
-	if err := c.p.Publish(msg); err != nil {
-		return err
+	err = ch.publish(msg)
+	return ch.end(), err
+}
+
+// change is a command changing a team. It holds the lock of the team from
+// begin to end, so the version check and the published events are not
+// interleaved with another change of the team.
+type change struct {
+	c      *team
+	state  *aggregate.Team
+	unlock func()
+
+	// handled receives the sequence of the last published event once the
+	// loader has handled it, nil if it cannot be waited for.
+	handled <-chan uint64
+	cancel  func()
+	// seq is the sequence of the last published event if the publisher
+	// told it, otherwise zero.
+	seq uint64
+}
+
+// lock locks the team and returns the function unlocking it.
+func (c *team) lock(teamID types.TeamID) func() {
+	mu, _ := c.locks.LoadOrStore(teamID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// begin locks the team and loads its state, which must be a team of
+// teamType at version. The signup continues only once the contact has
+// confirmed both the e-mail address and the phone number, so the roster
+// and members cannot be changed before that.
+func (c *team) begin(teamID types.TeamID, teamType types.TeamType, version uint64) (*change, error) {
+	ch, err := c.beginHQ(teamID, teamType)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if err := ch.state.IsConfirmed(); err != nil {
+		ch.unlock()
+		return nil, err
+	}
+	if err := ch.state.IsVersion(version); err != nil {
+		ch.unlock()
+		return nil, err
+	}
+	return ch, nil
 }
 
-func (c *team) UpdatePatrulje(teamID types.TeamID, team Patrulje, contact Contact, members []Spejder) error {
-	msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.patrulje.%s.updated", "2024", teamID)))
-	msg.SetBody(&messages.NathejkTeamUpdated{
-		TeamID:            teamID,
-		Type:              types.TeamTypePatrulje,
-		Name:              team.Name,
-		GroupName:         team.Group,
-		Korps:             team.Korps,
-		AdvspejdNumber:    team.AdventureLigaID,
-		ContactName:       contact.Name,
-		ContactAddress:    contact.Address,
-		ContactPostalCode: contact.PostalCode,
-		ContactEmail:      contact.Email,
-		ContactPhone:      contact.Phone,
-		ContactRole:       contact.Role,
-	})
-	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-	if err := c.p.Publish(msg); err != nil {
-		return err
+// beginHQ locks the team and loads its state at whatever version it is,
+// which must be a team of teamType.
+func (c *team) beginHQ(teamID types.TeamID, teamType types.TeamType) (*change, error) {
+	ch, err := c.beginLatest(teamID)
+	if err != nil {
+		return nil, err
 	}
+	if ch.state.Type != teamType {
+		ch.unlock()
+		return nil, fmt.Errorf("%w: %s is a %s", aggregate.ErrTeamNotFound, teamID, ch.state.Type)
+	}
+	return ch, nil
+}
 
-	for _, m := range members {
-		if m.Deleted {
-			msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.spejder.%s.deleted", "2024", m.MemberID)))
-			msg.SetBody(&messages.NathejkMemberDeleted{
-				MemberID: m.MemberID,
-				TeamID:   teamID,
-			})
-			msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-			if err := c.p.Publish(msg); err != nil {
-				return err
-			}
-			continue
-		}
+// beginLatest locks the team and loads its state at whatever version it
+// is, for the commands of HQ that do not act on a version seen by a client.
+func (c *team) beginLatest(teamID types.TeamID) (*change, error) {
+	ch := &change{c: c, unlock: c.lock(teamID)}
 
-		// TODO test if MemberID exits or not
-		if m.MemberID == "" {
-			m.MemberID = types.MemberID(uuid.New().String())
-		}
-		msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.spejder.%s.updated", "2024", m.MemberID)))
-		msg.SetBody(&messages.NathejkScoutUpdated{
-			MemberID:     m.MemberID,
-			TeamID:       teamID,
-			Name:         m.Name,
-			Address:      m.Address,
-			PostalCode:   m.PostalCode,
-			Email:        m.Email,
-			Phone:        m.Phone,
-			PhoneContact: m.PhoneContact,
-			BirthDate:    m.Birthday,
-			TShirtSize:   m.TShirtSize,
-		})
-		msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-		if err := c.p.Publish(msg); err != nil {
+	state, err := c.l.LoadTeam(teamID)
+	if err == nil {
+		err = state.CanChange()
+	}
+	if err != nil {
+		ch.unlock()
+		return nil, err
+	}
+	ch.state = state
+	return ch, nil
+}
+
+// publish publishes msg and applies it to the loaded state of the team, so
+// the following invariant checks of the command see it. A stream that can
+// check the last sequence of the subject rejects msg if another instance
+// has published on it since the state was loaded. A message buffered while
+// the stream reconnects is published once connected, so the command goes
+// on.
+func (ch *change) publish(msg streaminterface.Message) error {
+	if e, ok := msg.(expecter); ok {
+		e.SetExpectedLastSubjectSequence(ch.state.SubjectSequence(msg.Subject()))
+	}
+	handled, cancel := ch.expect(msg)
+	seq, err := streaminterface.PublishSequence(ch.c.p, msg)
+	if err != nil {
+		cancel()
+		if !errors.Is(err, nats.ErrBuffered) {
 			return err
 		}
+		// It is not handled until the stream has reconnected.
+		handled, cancel = nil, func() {}
 	}
-
+	ch.seq = seq
+	if ch.cancel != nil {
+		ch.cancel()
+	}
+	ch.handled, ch.cancel = handled, cancel
+	if err := ch.state.Apply(msg); err != nil {
+		return err
+	}
+	ch.state.Published(msg.Subject(), seq)
 	return nil
 }
 
-func (c *team) UpdateKlan(teamID types.TeamID, team Klan, members []Senior) error {
-	msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.klan.%s.updated", "2024", teamID)))
-	msg.SetBody(&messages.NathejkKlanUpdated{
-		TeamID:    teamID,
-		Name:      team.Name,
-		GroupName: team.Group,
-		Korps:     team.Korps,
+// expect returns a channel receiving the sequence of msg once the loader
+// has handled it, nil if msg has no event ID.
+func (ch *change) expect(msg streaminterface.Message) (<-chan uint64, func()) {
+	id, ok := msg.(identifiable)
+	if !ok {
+		return nil, func() {}
+	}
+	return ch.c.l.Expect(id.EventID())
+}
+
+// end waits until the loader has handled the last published event, so the
+// next change of the team loads a state including it, and unlocks the team.
+// It returns the sequence of the event, zero if it is not known. The events
+// are published, so it does not fail if the wait times out.
+func (ch *change) end() uint64 {
+	defer ch.unlock()
+
+	if ch.handled == nil {
+		return ch.seq
+	}
+	defer ch.cancel()
+	select {
+	case seq := <-ch.handled:
+		return seq
+	case <-time.After(settleTimeout):
+		log.Printf("[commands] team %s: events not handled within %s", ch.state.ID, settleTimeout)
+		return ch.seq
+	}
+}
+
+// setStatus changes the signup status of the team for reason, if the
+// transition is valid.
+func (ch *change) setStatus(ctx context.Context, status types.SignupStatus, reason string) error {
+	state := ch.state
+	if err := state.CanTransition(status); err != nil {
+		return err
+	}
+	msg := ch.c.message(ctx, streaminterface.SubjectFromStr(subject.StatusChanged(ch.c.year, state.Type, state.ID).String()))
+	msg.SetBody(&nathejk.NathejkTeamStatusChanged{
+		TeamID: nathejktypes.TeamID(state.ID),
+		Status: nathejktypes.SignupStatus(status),
+		Reason: reason,
 	})
 	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-	if err := c.p.Publish(msg); err != nil {
+	if err := ch.publish(msg); err != nil {
 		return err
 	}
-	klan, _ := c.q.GetKlan(teamID)
-	if klan.Status == types.SignupStatusOnHold {
-		// The team is on waiting list, do not do anything
-		return nil
+	// A team is given its number once it has paid. A team paid by another
+	// producer is given its number by the Numberer.
+	if status == types.SignupStatusPaid && state.Number == 0 {
+		return ch.assignNumber(ctx, 0)
 	}
-	if c.q.RequestedSeniorCount() > 115 {
-		msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.klan.%s.status.changed", "2024", teamID)))
-		msg.SetBody(&messages.NathejkKlanStatusChanged{TeamID: teamID, Status: types.SignupStatusOnHold})
-		msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-		if err := c.p.Publish(msg); err != nil {
-			return err
-		}
+	return nil
+}
+
+// publishRoster publishes the roster of the team as a single event, so it is
+// written completely or not at all.
+func (ch *change) publishRoster(ctx context.Context, roster nathejk.NathejkTeamRosterUpdated) error {
+	state := ch.state
+	msg := ch.c.message(ctx, streaminterface.SubjectFromStr(subject.RosterUpdated(ch.c.year, state.Type, state.ID).String()))
+	msg.SetBody(&roster)
+	msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
+	return ch.publish(msg)
+}
+
+// UpdatePatrulje updates a patrulje and its members. version must be the
+// current version of the team, or ErrVersionMismatch is returned. It returns
+// the sequence of the last event written, zero if it is not known.
+func (c *team) UpdatePatrulje(ctx context.Context, teamID types.TeamID, version uint64, team Patrulje, contact Contact, members []Spejder) (uint64, error) {
+	ch, err := c.begin(teamID, types.TeamTypePatrulje, version)
+	if err != nil {
+		return 0, err
 	}
-	if klan.Status == "" {
-		msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.klan.%s.status.changed", "2024", teamID)))
-		msg.SetBody(&messages.NathejkKlanStatusChanged{TeamID: teamID, Status: types.SignupStatusPay})
-		msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-		if err := c.p.Publish(msg); err != nil {
-			return err
+	// Only the birthdays that change are checked against the age rules,
+	// so a team that was let in, e.g. with the approval of HQ, can still
+	// be updated.
+	state := ch.state
+	ages := c.ages(ctx)
+	err = ages.validate(func(v validator.Validator) {
+		team.Validate(validator.Prefix(v, "team."))
+		contact.Validate(validator.Prefix(v, "contact."))
+		if contact.Birthday != state.ContactBirthDate {
+			ages.contact(validator.Prefix(v, "contact."), contact.Birthday)
 		}
-	}
-	if len(members) == 0 {
-		for i := 0; i < team.MemberCount; i++ {
-			members = append(members, Senior{})
+		for i, m := range members {
+			if !m.Deleted {
+				m.Validate(memberValidator(v, i))
+				if birthdayChanged(state, m.MemberID, m.Birthday) {
+					ages.member(memberValidator(v, i), types.TeamTypePatrulje, m.Birthday)
+				}
+			}
 		}
+	})
+	if err == nil {
+		err = c.updatePatrulje(ctx, ch, team, contact, members)
 	}
+	return ch.end(), err
+}
 
+func (c *team) updatePatrulje(ctx context.Context, ch *change, team Patrulje, contact Contact, members []Spejder) error {
+	state := ch.state
+	roster := nathejk.NathejkTeamRosterUpdated{
+		Team: messages.NathejkTeamUpdated{
+			TeamID:            state.ID,
+			Type:              types.TeamTypePatrulje,
+			Name:              team.Name,
+			GroupName:         team.Group,
+			Korps:             team.Korps,
+			AdvspejdNumber:    team.AdventureLigaID,
+			ContactName:       contact.Name,
+			ContactAddress:    contact.Address,
+			ContactPostalCode: contact.PostalCode,
+			ContactEmail:      contact.Email,
+			ContactPhone:      contact.Phone,
+			ContactRole:       contact.Role,
+		},
+		ContactBirthDate: contact.Birthday,
+		Members:          []nathejk.NathejkRosterMember{},
+	}
 	for _, m := range members {
-		if m.Deleted {
-			msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.senior.%s.deleted", "2024", m.MemberID)))
-			msg.SetBody(&messages.NathejkMemberDeleted{
-				MemberID: m.MemberID,
-				TeamID:   teamID,
-			})
-			msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-			if err := c.p.Publish(msg); err != nil {
+		if m.MemberID == "" && m.Deleted {
+			continue
+		}
+		if m.MemberID != "" {
+			if err := state.HasMember(m.MemberID); err != nil {
 				return err
 			}
+		}
+		if m.Deleted {
+			roster.Deleted = append(roster.Deleted, m.MemberID)
 			continue
 		}
-
-		// TODO test if MemberID exits or not
 		if m.MemberID == "" {
+			// A new member
 			m.MemberID = types.MemberID(uuid.New().String())
 		}
-		msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.senior.%s.updated", "2024", m.MemberID)))
-		msg.SetBody(&messages.NathejkSeniorUpdated{
-			MemberID:   m.MemberID,
-			TeamID:     teamID,
-			Name:       m.Name,
-			Address:    m.Address,
-			PostalCode: m.PostalCode,
-			Email:      m.Email,
-			Phone:      m.Phone,
-			BirthDate:  m.Birthday,
-			TShirtSize: m.TShirtSize,
-			Diet:       m.Diet,
-		})
-		msg.SetMeta(&messages.Metadata{Producer: "tilmelding-api"})
-		if err := c.p.Publish(msg); err != nil {
-			return err
-		}
+		roster.Members = append(roster.Members, m.member())
 	}
-
-	return nil
+	return ch.publishRoster(ctx, roster)
 }
 
-/*
-func (c *team) ConfirmEmail(secret string) error {
-
-	confirm
-	if body.TeamID == "" {
-		body.TeamID = types.TeamID(uuid.New().String())
+// UpdateKlan updates a klan and its members, and asks a new klan to pay or
+// puts it on the waiting list. version must be the current version of the
+// team, or ErrVersionMismatch is returned. It returns the sequence of the
+// last event written, zero if it is not known.
+func (c *team) UpdateKlan(ctx context.Context, teamID types.TeamID, version uint64, team Klan, members []Senior) (uint64, error) {
+	ch, err := c.begin(teamID, types.TeamTypeKlan, version)
+	if err != nil {
+		return 0, err
 	}
-	if body.Pincode == "" {
-		body.Pincode = "1222"
+	// Only the birthdays that change are checked, see UpdatePatrulje.
+	state := ch.state
+	ages := c.ages(ctx)
+	err = ages.validate(func(v validator.Validator) {
+		team.Validate(validator.Prefix(v, "team."))
+		for i, m := range members {
+			if !m.Deleted {
+				m.Validate(memberValidator(v, i))
+				if birthdayChanged(state, m.MemberID, m.Birthday) {
+					ages.member(memberValidator(v, i), types.TeamTypeKlan, m.Birthday)
+				}
+			}
+		}
+	})
+	if err == nil {
+		err = c.updateKlan(ctx, ch, team, members)
 	}
+	return ch.end(), err
+}
 
-	msg := c.p.MessageFunc()(streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.patrulje.%s.signedup", "2024", body.TeamID)))
-	msg.SetBody(body)
-	meta := messages.Metadata{Producer: "tilmelding-api"}
-	msg.SetMeta(&meta)
-
-	if err := c.p.Publish(msg); err != nil {
+func (c *team) updateKlan(ctx context.Context, ch *change, team Klan, members []Senior) error {
+	state := ch.state
+	roster := nathejk.NathejkTeamRosterUpdated{
+		Team: messages.NathejkTeamUpdated{
+			TeamID:    state.ID,
+			Type:      types.TeamTypeKlan,
+			Name:      team.Name,
+			GroupName: team.Group,
+			Korps:     team.Korps,
+		},
+		Members: []nathejk.NathejkRosterMember{},
+	}
+	for _, m := range members {
+		if m.MemberID != "" {
+			if err := state.HasMember(m.MemberID); err != nil {
+				return err
+			}
+		}
+	}
+	// The members of a team on the waiting list are not changed.
+	if state.Status != types.SignupStatusOnHold {
+		if len(members) == 0 {
+			for i := 0; i < team.MemberCount; i++ {
+				members = append(members, Senior{})
+			}
+		}
+		for _, m := range members {
+			if m.MemberID == "" && m.Deleted {
+				continue
+			}
+			if m.Deleted {
+				roster.Deleted = append(roster.Deleted, m.MemberID)
+				continue
+			}
+			if m.MemberID == "" {
+				// A new member
+				m.MemberID = types.MemberID(uuid.New().String())
+			}
+			roster.Members = append(roster.Members, m.member())
+		}
+	}
+	if err := ch.publishRoster(ctx, roster); err != nil {
 		return err
 	}
-	return nil
+	// A klan that has just signed up goes on the waiting list when the
+	// event is full, otherwise it is asked to pay. Later updates do not
+	// change the status.
+	if state.Status != types.SignupStatusNone && state.Status != types.SignupStatusNew {
+		return nil
+	}
+	if c.q.RequestedSeniorCount() > 115 {
+		return ch.setStatus(ctx, types.SignupStatusOnHold, "the event is full")
+	}
+	return ch.setStatus(ctx, types.SignupStatusPay, "signed up")
 }
-*/
@@ -0,0 +1,389 @@
+package commands_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+type teams struct {
+	requestedCount int
+}
+
+func (q *teams) RequestedSeniorCount() int { return q.requestedCount }
+
+func event(subj subject.Subject, body any) streaminterface.Message {
+	return streamtest.NewMessageP(streaminterface.SubjectFromStr(subj.String()), streamtest.MessageData{Body: body})
+}
+
+// given returns a store holding events.
+func given(events ...streaminterface.Message) *aggregate.Store {
+	s := aggregate.NewStore(0)
+	for _, e := range events {
+		s.HandleMessage(e)
+	}
+	return s
+}
+
+func signedUp(teamType types.TeamType, teamID types.TeamID) streaminterface.Message {
+	return event(subject.Team("2024", teamType, teamID, subject.VerbSignedup), messages.NathejkTeamSignedUp{TeamID: teamID})
+}
+
+// emailConfirmed and phoneConfirmed confirm the contact of a team, which
+// may then change its roster and members.
+func emailConfirmed(teamType types.TeamType, teamID types.TeamID) streaminterface.Message {
+	return event(subject.EmailConfirmed("2024", teamType, teamID), nathejk.NathejkEmailConfirmed{TeamID: nathejktypes.TeamID(teamID), Email: "anna@example.com"})
+}
+
+func phoneConfirmed(teamType types.TeamType, teamID types.TeamID) streaminterface.Message {
+	return event(subject.PhoneConfirmed("2024", teamType, teamID), nathejk.NathejkPhoneNumberConfirmed{TeamID: nathejktypes.TeamID(teamID), Phone: "12345678"})
+}
+
+func statusChanged(teamType types.TeamType, teamID types.TeamID, status types.SignupStatus) streaminterface.Message {
+	return event(subject.StatusChanged("2024", teamType, teamID), messages.NathejkTeamStatusChanged{TeamID: teamID, Status: status})
+}
+
+// ravene and anna are a valid patrulje and contact.
+var (
+	ravene = commands.Patrulje{Name: "Ræverne"}
+	anna   = commands.Contact{Name: "Anna"}
+)
+
+func TestSignup(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(), "2024")
+
+	body := &messages.NathejkTeamSignedUp{Name: "Anna", Email: "anna@example.com", Phone: "12345678"}
+	seq, err := team.Signup(context.Background(), types.TeamTypePatrulje, body)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), seq)
+
+	assert.NotEmpty(t, body.TeamID)
+	assert.Len(t, body.Pincode, 4)
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje." + string(body.TeamID) + ".signedup",
+		Body:    messages.NathejkTeamSignedUp{TeamID: body.TeamID, Name: "Anna", Pincode: body.Pincode},
+	})
+}
+
+func TestSignupTeamExists(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1")), "2024")
+
+	_, err := team.Signup(context.Background(), types.TeamTypeKlan, &messages.NathejkTeamSignedUp{TeamID: "team-1", Name: "Anna"})
+	assert.ErrorIs(t, err, aggregate.ErrTeamExists)
+	assert.Empty(t, p.Messages())
+}
+
+func TestUpdatePatrulje(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+		event(subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1"}),
+		event(subject.Member("2024", subject.Spejder, "member-2", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1"}),
+	), "2024")
+
+	seq, err := team.UpdatePatrulje(context.Background(), "team-1", 0,
+		commands.Patrulje{Name: "Ræverne", AdventureLigaID: "42"},
+		commands.Contact{Name: "Anna"},
+		[]commands.Spejder{
+			{MemberID: "member-1", Name: "Bo"},
+			{Name: "Carl"},
+			{MemberID: "member-2", Deleted: true},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), seq, "sequence of the roster event")
+
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.patrulje.team-1.roster.updated",
+		Body: nathejk.NathejkTeamRosterUpdated{
+			Team: messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ræverne", AdvspejdNumber: "42", ContactName: "Anna"},
+			Members: []nathejk.NathejkRosterMember{
+				{MemberID: "member-1", Name: "Bo"},
+				{Name: "Carl"},
+			},
+			Deleted: []types.MemberID{"member-2"},
+		},
+	})
+	var roster nathejk.NathejkTeamRosterUpdated
+	assert.NoError(t, p.Messages()[0].Body(&roster))
+	assert.NotEmpty(t, roster.Members[1].MemberID, "new members are given an ID")
+}
+
+func TestUpdateValidation(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1")), "2024")
+
+	_, err := team.UpdatePatrulje(context.Background(), "team-1", 0,
+		commands.Patrulje{},
+		commands.Contact{Name: "Anna", Email: "anna", PostalCode: "DK-2100"},
+		[]commands.Spejder{
+			{Name: "Bo", TShirtSize: "m"},
+			{Deleted: true},
+			{Name: "Carl", Phone: "1234", Birthday: "01-01-2010", TShirtSize: "xxxl"},
+		},
+	)
+	var verr *commands.ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, map[string]string{
+			"team.name":             "must be provided",
+			"contact.email":         "must be a valid email address",
+			"contact.postal":        "must be a postal code of 4 or 5 digits",
+			"members[2].phone":      "must be a phone number of 8 digits",
+			"members[2].birthday":   "must be a date like 2006-01-02",
+			"members[2].tshirtsize": "must be a known size",
+		}, verr.Errors)
+	}
+	p.Then(t)
+}
+
+func TestUpdatePatruljeInvariants(t *testing.T) {
+	tests := map[string]struct {
+		given   []streaminterface.Message
+		members []commands.Spejder
+		err     error
+	}{
+		"unknown team": {
+			err: aggregate.ErrTeamNotFound,
+		},
+		"team is out": {
+			given: []streaminterface.Message{
+				signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+				statusChanged(types.TeamTypePatrulje, "team-1", types.SignupStatusOut),
+			},
+			err: aggregate.ErrTeamOut,
+		},
+		"delete unknown member": {
+			given:   []streaminterface.Message{signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1")},
+			members: []commands.Spejder{{MemberID: "member-1", Deleted: true}},
+			err:     aggregate.ErrMemberNotFound,
+		},
+		"update member of another team": {
+			given: []streaminterface.Message{
+				signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+				event(subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-2"}),
+			},
+			members: []commands.Spejder{{MemberID: "member-1", Name: "Bo"}},
+			err:     aggregate.ErrMemberNotFound,
+		},
+		"delete deleted member": {
+			given: []streaminterface.Message{
+				signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+				event(subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated), messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1"}),
+				event(subject.Member("2024", subject.Spejder, "member-1", subject.VerbDeleted), messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"}),
+			},
+			members: []commands.Spejder{{MemberID: "member-1", Deleted: true}},
+			err:     aggregate.ErrMemberNotFound,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			team := commands.NewTeam(p, &teams{}, given(tt.given...), "2024")
+
+			_, err := team.UpdatePatrulje(context.Background(), "team-1", 0, ravene, anna, tt.members)
+			assert.ErrorIs(t, err, tt.err)
+			p.Then(t)
+		})
+	}
+}
+
+func TestUpdateUnconfirmed(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(
+		signedUp(types.TeamTypePatrulje, "team-1"),
+		signedUp(types.TeamTypePatrulje, "team-2"), emailConfirmed(types.TeamTypePatrulje, "team-2"),
+	), "2024")
+	ctx := context.Background()
+
+	_, err := team.UpdatePatrulje(ctx, "team-1", 0, ravene, anna, nil)
+	assert.ErrorIs(t, err, aggregate.ErrEmailUnconfirmed)
+	_, err = team.UpdatePatrulje(ctx, "team-2", 0, ravene, anna, nil)
+	assert.ErrorIs(t, err, aggregate.ErrPhoneUnconfirmed)
+	_, err = team.AddSpejder(ctx, "team-2", 0, commands.Spejder{MemberID: "member-1", Name: "Bo"})
+	assert.ErrorIs(t, err, aggregate.ErrPhoneUnconfirmed)
+	p.Then(t)
+}
+
+func TestUpdateVersion(t *testing.T) {
+	signedUp := streamtest.NewMessageP(
+		streaminterface.SubjectFromStr(subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup).String()),
+		streamtest.MessageData{Body: messages.NathejkTeamSignedUp{TeamID: "team-1"}, Sequence: 7},
+	)
+
+	p := streamtest.NewRecorder()
+	// The contact confirms before the signup, so the version stays 7.
+	team := commands.NewTeam(p, &teams{}, given(
+		emailConfirmed(types.TeamTypePatrulje, "team-1"),
+		phoneConfirmed(types.TeamTypePatrulje, "team-1"),
+		signedUp,
+	), "2024")
+
+	_, err := team.UpdatePatrulje(context.Background(), "team-1", 6, ravene, anna, nil)
+	assert.ErrorIs(t, err, aggregate.ErrVersionMismatch)
+	p.Then(t)
+
+	_, err = team.UpdatePatrulje(context.Background(), "team-1", 7, ravene, anna, nil)
+	assert.NoError(t, err)
+	p.Then(t, streamtest.Expect{Subject: "NATHEJK:2024.patrulje.team-1.roster.updated"})
+}
+
+// expecting is a recorder whose messages record the last sequence of the
+// subject they expect, like those of JetStream.
+type expecting struct {
+	*streamtest.Recorder
+	expected map[string]uint64
+}
+
+type expectingMessage struct {
+	*streamtest.Message
+	e *expecting
+}
+
+func (m expectingMessage) SetExpectedLastSubjectSequence(seq uint64) {
+	m.e.expected[m.Subject().Subject()] = seq
+}
+
+func (e *expecting) MessageFunc() streaminterface.MessageFunc {
+	return func(subj streaminterface.Subject) streaminterface.MutableMessage {
+		return expectingMessage{streamtest.NewMessage(subj), e}
+	}
+}
+
+func TestUpdateExpectsLastSubjectSequence(t *testing.T) {
+	p := &expecting{Recorder: streamtest.NewRecorder(), expected: map[string]uint64{}}
+	team := commands.NewTeam(p, &teams{}, given(
+		emailConfirmed(types.TeamTypeKlan, "team-1"),
+		phoneConfirmed(types.TeamTypeKlan, "team-1"),
+		streamtest.NewMessageP(
+			streaminterface.SubjectFromStr(subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbSignedup).String()),
+			streamtest.MessageData{Body: messages.NathejkTeamSignedUp{TeamID: "team-1"}, Sequence: 1},
+		),
+		streamtest.NewMessageP(
+			streaminterface.SubjectFromStr(subject.RosterUpdated("2024", types.TeamTypeKlan, "team-1").String()),
+			streamtest.MessageData{Body: nathejk.NathejkTeamRosterUpdated{}, Sequence: 3},
+		),
+	), "2024")
+
+	_, err := team.UpdateKlan(context.Background(), "team-1", 3, commands.Klan{Name: "Ulvene", MemberCount: 1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{
+		"NATHEJK:2024.klan.team-1.roster.updated": 3,
+		"NATHEJK:2024.klan.team-1.status.changed": 0,
+	}, p.expected)
+}
+
+func TestUpdateKlan(t *testing.T) {
+	tests := map[string]struct {
+		given   []streaminterface.Message
+		queries teams
+		then    []streamtest.Expect
+	}{
+		"new team is asked to pay": {
+			given: []streaminterface.Message{signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1")},
+			then: []streamtest.Expect{
+				{Subject: "NATHEJK:2024.klan.team-1.roster.updated", Body: nathejk.NathejkTeamRosterUpdated{Members: make([]nathejk.NathejkRosterMember, 2)}},
+				{Subject: "NATHEJK:2024.klan.team-1.status.changed", Body: messages.NathejkKlanStatusChanged{Status: types.SignupStatusPay}},
+			},
+		},
+		"team on hold is left alone": {
+			given: []streaminterface.Message{
+				signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1"),
+				statusChanged(types.TeamTypeKlan, "team-1", types.SignupStatusOnHold),
+			},
+			then: []streamtest.Expect{
+				{Subject: "NATHEJK:2024.klan.team-1.roster.updated", Body: nathejk.NathejkTeamRosterUpdated{Team: messages.NathejkTeamUpdated{Name: "Ulvene"}}},
+			},
+		},
+		"full event puts new team on hold only": {
+			given:   []streaminterface.Message{signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1")},
+			queries: teams{requestedCount: 116},
+			then: []streamtest.Expect{
+				{Subject: "NATHEJK:2024.klan.team-1.roster.updated", Body: nathejk.NathejkTeamRosterUpdated{Members: make([]nathejk.NathejkRosterMember, 2)}},
+				{Subject: "NATHEJK:2024.klan.team-1.status.changed", Body: messages.NathejkKlanStatusChanged{Status: types.SignupStatusOnHold}},
+			},
+		},
+		"full event does not put paid team on hold": {
+			given: []streaminterface.Message{
+				signedUp(types.TeamTypeKlan, "team-1"), emailConfirmed(types.TeamTypeKlan, "team-1"), phoneConfirmed(types.TeamTypeKlan, "team-1"),
+				statusChanged(types.TeamTypeKlan, "team-1", types.SignupStatusPay),
+				statusChanged(types.TeamTypeKlan, "team-1", types.SignupStatusPaid),
+			},
+			queries: teams{requestedCount: 116},
+			then: []streamtest.Expect{
+				{Subject: "NATHEJK:2024.klan.team-1.roster.updated", Body: nathejk.NathejkTeamRosterUpdated{Members: make([]nathejk.NathejkRosterMember, 2)}},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			team := commands.NewTeam(p, &tt.queries, given(tt.given...), "2024")
+
+			_, err := team.UpdateKlan(context.Background(), "team-1", 0, commands.Klan{Name: "Ulvene", MemberCount: 2}, nil)
+			assert.NoError(t, err)
+			p.Then(t, tt.then...)
+		})
+	}
+}
+
+// loopback is a stream delivering the published messages to a store, like
+// the projections do, with sequences starting after 100.
+type loopback struct {
+	store *aggregate.Store
+	seq   uint64
+}
+
+// loopbackMessage is a message with an event ID.
+type loopbackMessage struct {
+	*streamtest.Message
+	id  string
+	seq uint64
+}
+
+func (m *loopbackMessage) EventID() string  { return m.id }
+func (m *loopbackMessage) Sequence() uint64 { return m.seq }
+
+func (l *loopback) Publish(msg streaminterface.Message) error {
+	m := msg.(*loopbackMessage)
+	l.seq++
+	m.seq = 100 + l.seq
+	go l.store.HandleMessage(m)
+	return nil
+}
+
+func (l *loopback) MessageFunc() streaminterface.MessageFunc {
+	return func(subj streaminterface.Subject) streaminterface.MutableMessage {
+		return &loopbackMessage{Message: streamtest.NewMessage(subj), id: fmt.Sprintf("event-%d", l.seq+1)}
+	}
+}
+
+func TestUpdateReturnsHandledSequence(t *testing.T) {
+	assert := assert.New(t)
+	store := given(signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"))
+	team := commands.NewTeam(&loopback{store: store}, &teams{}, store, "2024")
+
+	seq, err := team.UpdatePatrulje(context.Background(), "team-1", 0, ravene, anna, []commands.Spejder{{Name: "Bo"}})
+	assert.NoError(err)
+	assert.Equal(uint64(101), seq)
+
+	// The next change sees the events of the previous one.
+	_, err = team.UpdatePatrulje(context.Background(), "team-1", 0, ravene, anna, nil)
+	assert.ErrorIs(err, aggregate.ErrVersionMismatch)
+	seq, err = team.UpdatePatrulje(context.Background(), "team-1", 101, ravene, anna, nil)
+	assert.NoError(err)
+	assert.Equal(uint64(102), seq)
+}
@@ -1,6 +1,9 @@
 package commands
 
-import "github.com/nathejk/shared-go/types"
+import (
+	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+)
 
 type Patrulje struct {
 	TeamID          types.TeamID `json:"teamId"`
@@ -26,6 +29,7 @@ type Contact struct {
 	Email      types.EmailAddress `json:"email"`
 	Phone      types.PhoneNumber  `json:"phone"`
 	Role       string             `json:"role"`
+	Birthday   types.Date         `json:"birthday"`
 }
 
 type Spejder struct {
@@ -41,6 +45,20 @@ type Spejder struct {
 	TShirtSize   string             `json:"tshirtsize"`
 }
 
+func (s Spejder) member() nathejk.NathejkRosterMember {
+	return nathejk.NathejkRosterMember{
+		MemberID:     s.MemberID,
+		Name:         s.Name,
+		Address:      s.Address,
+		PostalCode:   s.PostalCode,
+		Email:        s.Email,
+		Phone:        s.Phone,
+		PhoneContact: s.PhoneContact,
+		BirthDate:    s.Birthday,
+		TShirtSize:   s.TShirtSize,
+	}
+}
+
 type Senior struct {
 	MemberID   types.MemberID     `json:"memberId"`
 	Deleted    bool               `json:"deleted"`
@@ -53,3 +71,52 @@ type Senior struct {
 	Diet       string             `json:"diet"`
 	TShirtSize string             `json:"tshirtsize"`
 }
+
+func (s Senior) member() nathejk.NathejkRosterMember {
+	return nathejk.NathejkRosterMember{
+		MemberID:   s.MemberID,
+		Name:       s.Name,
+		Address:    s.Address,
+		PostalCode: s.PostalCode,
+		Email:      s.Email,
+		Phone:      s.Phone,
+		BirthDate:  s.Birthday,
+		TShirtSize: s.TShirtSize,
+		Diet:       s.Diet,
+	}
+}
+
+// SpejderPatch changes the fields of a spejder that are not nil.
+type SpejderPatch struct {
+	Name         *string             `json:"name"`
+	Address      *string             `json:"address"`
+	PostalCode   *string             `json:"postalCode"`
+	Email        *types.EmailAddress `json:"email"`
+	Phone        *types.PhoneNumber  `json:"phone"`
+	PhoneContact *types.PhoneNumber  `json:"phoneCantact"`
+	Birthday     *types.Date         `json:"birthday"`
+	TShirtSize   *string             `json:"tshirtsize"`
+}
+
+// SeniorPatch changes the fields of a senior that are not nil.
+type SeniorPatch struct {
+	Name       *string             `json:"name"`
+	Address    *string             `json:"address"`
+	PostalCode *string             `json:"postalCode"`
+	Email      *types.EmailAddress `json:"email"`
+	Phone      *types.PhoneNumber  `json:"phone"`
+	Birthday   *types.Date         `json:"birthday"`
+	Diet       *string             `json:"diet"`
+	TShirtSize *string             `json:"tshirtsize"`
+}
+
+// ContactPatch changes the fields of a contact that are not nil.
+type ContactPatch struct {
+	Name       *string             `json:"name"`
+	Address    *string             `json:"address"`
+	PostalCode *string             `json:"postal"`
+	Email      *types.EmailAddress `json:"email"`
+	Phone      *types.PhoneNumber  `json:"phone"`
+	Role       *string             `json:"role"`
+	Birthday   *types.Date         `json:"birthday"`
+}
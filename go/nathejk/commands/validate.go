@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/internal/validator"
+	"nathejk.dk/nathejk/aggregate"
+	nathejk "nathejk.dk/nathejk/messages"
+)
+
+// TShirtSizes lists the known T-shirt size slugs, "" being no T-shirt.
+var TShirtSizes = []string{"", "xs", "s", "m", "l", "xl", "xxl"}
+
+// ValidationError is returned by a command when its input is invalid. Errors
+// holds a message per invalid field, keyed by the JSON name of the field.
+type ValidationError struct {
+	Errors map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = key + ": " + e.Errors[key]
+	}
+	return "invalid input: " + strings.Join(msgs, ", ")
+}
+
+// validate runs check on a new validator and returns a ValidationError
+// unless it finds the input valid.
+func validate(check func(v validator.Validator)) error {
+	v := validator.New()
+	check(v)
+	if !v.Valid() {
+		return &ValidationError{Errors: v.Errors}
+	}
+	return nil
+}
+
+// checkEmail checks that email is empty or valid.
+func checkEmail(v validator.Validator, email types.EmailAddress, key string) {
+	v.Check(email == "" || email.Valid(), key, "must be a valid email address")
+}
+
+// checkPhone checks that phone is empty or valid.
+func checkPhone(v validator.Validator, phone types.PhoneNumber, key string) {
+	v.Check(phone == "" || phone.IsValid(), key, "must be a phone number of 8 digits")
+}
+
+// checkPostalCode checks that postalCode is empty or valid.
+func checkPostalCode(v validator.Validator, postalCode string, key string) {
+	v.Check(postalCode == "" || validator.PostalCodeRX.MatchString(postalCode), key, "must be a postal code of 4 or 5 digits")
+}
+
+// checkBirthday checks that birthday is empty or a date in the past.
+func checkBirthday(v validator.Validator, birthday types.Date, key string) {
+	if birthday == "" {
+		return
+	}
+	t, err := birthday.ToTime()
+	if err != nil {
+		v.AddError(key, "must be a date like 2006-01-02")
+		return
+	}
+	v.Check(t.Before(time.Now()), key, "must be in the past")
+}
+
+// checkMember checks the details of a spejder or senior.
+func checkMember(v validator.Validator, m nathejk.NathejkRosterMember) {
+	v.Check(strings.TrimSpace(m.Name) != "", "name", "must be provided")
+	checkPostalCode(v, m.PostalCode, "postalCode")
+	checkEmail(v, m.Email, "email")
+	checkPhone(v, m.Phone, "phone")
+	checkPhone(v, m.PhoneContact, "phoneCantact")
+	checkBirthday(v, m.BirthDate, "birthday")
+	v.Check(validator.PermittedValue(m.TShirtSize, TShirtSizes...), "tshirtsize", "must be a known size")
+}
+
+func (t Patrulje) Validate(v validator.Validator) {
+	v.Check(strings.TrimSpace(t.Name) != "", "name", "must be provided")
+}
+
+func (t Klan) Validate(v validator.Validator) {
+	v.Check(strings.TrimSpace(t.Name) != "", "name", "must be provided")
+	v.Check(t.MemberCount >= 0, "memberCount", "must not be negative")
+}
+
+func (c Contact) Validate(v validator.Validator) {
+	v.Check(strings.TrimSpace(c.Name) != "", "name", "must be provided")
+	checkPostalCode(v, c.PostalCode, "postal")
+	checkEmail(v, c.Email, "email")
+	checkPhone(v, c.Phone, "phone")
+	checkBirthday(v, c.Birthday, "birthday")
+}
+
+func (s Spejder) Validate(v validator.Validator) {
+	checkMember(v, s.member())
+}
+
+func (s Senior) Validate(v validator.Validator) {
+	checkMember(v, s.member())
+}
+
+// memberValidator returns the validator of the member at index i of the
+// members of an update, keying its errors like "members[2].birthday".
+func memberValidator(v validator.Validator, i int) validator.Validator {
+	return validator.Prefix(v, fmt.Sprintf("members[%d].", i))
+}
+
+type hqApprovalKey struct{}
+
+// WithHQApproval returns a context in which the commands accept members and
+// contacts outside the age rules, if the year allows exceptions.
+func WithHQApproval(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hqApprovalKey{}, true)
+}
+
+// ageChecker checks birthdays against the age rules of a year.
+type ageChecker struct {
+	year *aggregate.Year
+	// approved is set when HQ has approved exceptions to the rules.
+	approved bool
+	// err is set when a birthday could not be checked.
+	err error
+}
+
+// ages returns the age checker of the year of the commands.
+func (c *team) ages(ctx context.Context) *ageChecker {
+	year := c.l.LoadYear(c.year)
+	approved, _ := ctx.Value(hqApprovalKey{}).(bool)
+	return &ageChecker{year: year, approved: approved && year.AgeRules.Exceptions}
+}
+
+// validate validates like validate, but fails with the error of a birthday
+// that could not be checked, e.g. ErrStartTimeUnknown, rather than letting
+// it pass.
+func (a *ageChecker) validate(check func(v validator.Validator)) error {
+	err := validate(check)
+	if a.err != nil {
+		return a.err
+	}
+	return err
+}
+
+// check checks that someone born on birthday is from min to max years old
+// at the start of the event. A zero limit, an empty birthday and one that is
+// not a date are not checked.
+func (a *ageChecker) check(v validator.Validator, birthday types.Date, min, max int, key string) {
+	if a.approved || birthday == "" {
+		return
+	}
+	t, err := birthday.ToTime()
+	if err != nil {
+		return
+	}
+	age, err := a.year.Age(t)
+	if err != nil {
+		a.err = err
+		return
+	}
+	if (min == 0 || age >= min) && (max == 0 || age <= max) {
+		return
+	}
+	var msg string
+	switch {
+	case min != 0 && max != 0:
+		msg = fmt.Sprintf("must be from %d to %d years old at the start of the event", min, max)
+	case min != 0:
+		msg = fmt.Sprintf("must be at least %d years old at the start of the event", min)
+	default:
+		msg = fmt.Sprintf("must be at most %d years old at the start of the event", max)
+	}
+	if a.year.AgeRules.Exceptions {
+		msg += ", unless approved by HQ"
+	}
+	v.AddError(key, msg)
+}
+
+// member checks the birthday of a member of a team of teamType.
+func (a *ageChecker) member(v validator.Validator, teamType types.TeamType, birthday types.Date) {
+	rules := a.year.AgeRules
+	if teamType == types.TeamTypeKlan {
+		a.check(v, birthday, rules.SeniorMinAge, 0, "birthday")
+	} else {
+		a.check(v, birthday, rules.SpejderMinAge, rules.SpejderMaxAge, "birthday")
+	}
+}
+
+// birthdayChanged reports whether birthday is not the one told for the
+// member of the team, e.g. as the member is new.
+func birthdayChanged(state *aggregate.Team, memberID types.MemberID, birthday types.Date) bool {
+	m, ok := state.Members[memberID]
+	return !ok || m.BirthDate != birthday
+}
+
+// contact checks the birthday of the contact of a team.
+func (a *ageChecker) contact(v validator.Validator, birthday types.Date) {
+	a.check(v, birthday, a.year.AgeRules.ContactMinAge, 0, "birthday")
+}
@@ -0,0 +1,141 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/aggregate"
+	"nathejk.dk/nathejk/commands"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func yearCreated(rules nathejktypes.AgeRules) streaminterface.Message {
+	start := time.Date(2024, time.September, 13, 18, 0, 0, 0, time.UTC)
+	return streamtest.NewMessageP(streaminterface.SubjectFromStr("nathejk:year.created"), streamtest.MessageData{
+		Body: nathejk.NathejkYearCreated{Slug: "2024", StartTime: &start, AgeRules: &rules},
+	})
+}
+
+func TestAgeRules(t *testing.T) {
+	rules := nathejktypes.AgeRules{SpejderMinAge: 12, SpejderMaxAge: 16, SeniorMinAge: 16, ContactMinAge: 18}
+	strict := rules
+	rules.Exceptions = true
+
+	tests := map[string]struct {
+		rules    nathejktypes.AgeRules
+		teamType types.TeamType
+		approved bool
+		contact  types.Date
+		birthday types.Date
+		errs     map[string]string
+	}{
+		"spejder turning 12 at the start": {
+			rules: rules, teamType: types.TeamTypePatrulje, birthday: "2012-09-13",
+		},
+		"spejder turning 12 after the start": {
+			rules: rules, teamType: types.TeamTypePatrulje, birthday: "2012-09-14",
+			errs: map[string]string{"members[0].birthday": "must be from 12 to 16 years old at the start of the event, unless approved by HQ"},
+		},
+		"spejder turning 17 at the start": {
+			rules: strict, teamType: types.TeamTypePatrulje, birthday: "2007-09-13",
+			errs: map[string]string{"members[0].birthday": "must be from 12 to 16 years old at the start of the event"},
+		},
+		"young contact": {
+			rules: rules, teamType: types.TeamTypePatrulje, contact: "2007-01-01",
+			errs: map[string]string{"contact.birthday": "must be at least 18 years old at the start of the event, unless approved by HQ"},
+		},
+		"young senior": {
+			rules: strict, teamType: types.TeamTypeKlan, birthday: "2009-01-01",
+			errs: map[string]string{"members[0].birthday": "must be at least 16 years old at the start of the event"},
+		},
+		"approved by HQ": {
+			rules: rules, teamType: types.TeamTypePatrulje, approved: true, birthday: "2014-01-01", contact: "2010-01-01",
+		},
+		"approval without exceptions": {
+			rules: strict, teamType: types.TeamTypeKlan, approved: true, birthday: "2009-01-01",
+			errs: map[string]string{"members[0].birthday": "must be at least 16 years old at the start of the event"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			team := commands.NewTeam(p, &teams{}, given(yearCreated(tt.rules), signedUp(tt.teamType, "team-1"), emailConfirmed(tt.teamType, "team-1"), phoneConfirmed(tt.teamType, "team-1")), "2024")
+
+			ctx := context.Background()
+			if tt.approved {
+				ctx = commands.WithHQApproval(ctx)
+			}
+			var err error
+			if tt.teamType == types.TeamTypeKlan {
+				_, err = team.UpdateKlan(ctx, "team-1", 0, commands.Klan{Name: "Ulvene"}, []commands.Senior{{Name: "Bo", Birthday: tt.birthday}})
+			} else {
+				contact := commands.Contact{Name: "Anna", Birthday: tt.contact}
+				_, err = team.UpdatePatrulje(ctx, "team-1", 0, ravene, contact, []commands.Spejder{{Name: "Bo", Birthday: tt.birthday}})
+			}
+			if tt.errs == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *commands.ValidationError
+			if assert.ErrorAs(t, err, &verr) {
+				assert.Equal(t, tt.errs, verr.Errors)
+			}
+		})
+	}
+}
+
+func TestAgeRulesStartTimeUnknown(t *testing.T) {
+	p := streamtest.NewRecorder()
+	team := commands.NewTeam(p, &teams{}, given(signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1")), "2024")
+
+	_, err := team.UpdatePatrulje(context.Background(), "team-1", 0, ravene, anna, []commands.Spejder{{Name: "Bo", Birthday: "2012-01-01"}})
+	assert.ErrorIs(t, err, aggregate.ErrStartTimeUnknown)
+	p.Then(t)
+
+	_, err = team.UpdatePatrulje(context.Background(), "team-1", 0, ravene, anna, []commands.Spejder{{Name: "Bo"}})
+	assert.NoError(t, err, "no birthday needs the start time")
+}
+
+func TestAgeRulesOnlyChangedBirthdays(t *testing.T) {
+	rules := nathejktypes.AgeRules{SpejderMinAge: 12, SpejderMaxAge: 16, ContactMinAge: 18}
+	// Bo and the contact were let in outside the rules, e.g. by HQ.
+	roster := event(subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1"), nathejk.NathejkTeamRosterUpdated{
+		Team:             messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ræverne", ContactName: "Anna"},
+		ContactBirthDate: "2010-01-01",
+		Members:          []nathejk.NathejkRosterMember{{MemberID: "member-1", Name: "Bo", BirthDate: "2005-01-01"}},
+	})
+	ctx := context.Background()
+	team := commands.NewTeam(streamtest.NewRecorder(), &teams{}, given(yearCreated(rules), signedUp(types.TeamTypePatrulje, "team-1"), emailConfirmed(types.TeamTypePatrulje, "team-1"), phoneConfirmed(types.TeamTypePatrulje, "team-1"), roster), "2024")
+
+	_, err := team.UpdatePatrulje(ctx, "team-1", 0, ravene, commands.Contact{Name: "Anna", Birthday: "2010-01-01"}, []commands.Spejder{
+		{MemberID: "member-1", Name: "Bo", Birthday: "2005-01-01"},
+	})
+	assert.NoError(t, err, "unchanged birthdays are not checked")
+
+	name := "Bo Hansen"
+	_, err = team.UpdateSpejder(ctx, "team-1", 0, "member-1", commands.SpejderPatch{Name: &name})
+	assert.NoError(t, err, "unchanged birthday is not checked")
+
+	birthday := types.Date("2006-01-01")
+	_, err = team.UpdateSpejder(ctx, "team-1", 0, "member-1", commands.SpejderPatch{Birthday: &birthday})
+	var verr *commands.ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, map[string]string{"birthday": "must be from 12 to 16 years old at the start of the event"}, verr.Errors)
+	}
+
+	_, err = team.UpdatePatrulje(ctx, "team-1", 0, ravene, commands.Contact{Name: "Anna", Birthday: "2011-01-01"}, []commands.Spejder{
+		{MemberID: "member-1", Name: "Bo", Birthday: "2005-01-01"},
+	})
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Equal(t, map[string]string{"contact.birthday": "must be at least 18 years old at the start of the event"}, verr.Errors)
+	}
+}
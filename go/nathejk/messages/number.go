@@ -0,0 +1,14 @@
+package messages
+
+import "github.com/nathejk/shared-go/types"
+
+// nathejk:patrulje.number.assigned
+// nathejk:klan.number.assigned
+//
+// NathejkTeamNumberAssigned gives a team its number of the year. Manual is
+// set when HQ chose the number.
+type NathejkTeamNumberAssigned struct {
+	TeamID     types.TeamID `json:"teamId"`
+	TeamNumber int          `json:"teamNumber"`
+	Manual     bool         `json:"manual,omitempty"`
+}
@@ -0,0 +1,24 @@
+package messages
+
+import "nathejk.dk/nathejk/types"
+
+// nathejk:sms.requested
+type NathejkSmsRequested struct {
+	MessageID string            `json:"messageId"`
+	PingType  types.PingType    `json:"pingType"`
+	TeamID    types.TeamID      `json:"teamId,omitempty"`
+	Phone     types.PhoneNumber `json:"phone"`
+	Text      string            `json:"text"`
+}
+
+// nathejk:mail.requested
+type NathejkMailRequested struct {
+	MessageID string         `json:"messageId"`
+	PingType  types.PingType `json:"pingType"`
+	TeamID    types.TeamID   `json:"teamId,omitempty"`
+	Recipient types.Email    `json:"recipient"`
+	Subject   string         `json:"subject"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+	Secret    string         `json:"secret,omitempty"`
+}
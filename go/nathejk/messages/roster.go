@@ -0,0 +1,36 @@
+package messages
+
+import (
+	shared "github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+)
+
+// nathejk:patrulje.roster.updated
+// nathejk:klan.roster.updated
+//
+// NathejkTeamRosterUpdated changes a team, its contact and its members
+// together, so a roster is never half written. Members not yet on the team
+// are added, the others edited, and the Deleted members removed.
+type NathejkTeamRosterUpdated struct {
+	Team             shared.NathejkTeamUpdated `json:"team"`
+	ContactBirthDate types.Date                `json:"contactBirthDate,omitempty"`
+	Members          []NathejkRosterMember     `json:"members"`
+	Deleted          []types.MemberID          `json:"deleted,omitempty"`
+}
+
+// NathejkRosterMember is a spejder or senior on a roster. PhoneContact is
+// only used by spejdere, Diet only by seniors.
+type NathejkRosterMember struct {
+	MemberID     types.MemberID     `json:"memberId"`
+	Name         string             `json:"name"`
+	Address      string             `json:"address"`
+	PostalCode   string             `json:"postalCode"`
+	City         string             `json:"city"`
+	Email        types.EmailAddress `json:"mail"`
+	Phone        types.PhoneNumber  `json:"phone"`
+	PhoneContact types.PhoneNumber  `json:"phoneContact,omitempty"`
+	BirthDate    types.Date         `json:"birthDate"`
+	Returning    bool               `json:"returning"`
+	TShirtSize   string             `json:"tshirtsize"`
+	Diet         string             `json:"diet,omitempty"`
+}
@@ -12,19 +12,26 @@ type NathejkTeamSignedUp struct {
 	Pincode string            `json:"pincode"`
 }
 
-// nathejk:phonenumber.confirmed
+// nathejk:phone.confirmed
 type NathejkPhoneNumberConfirmed struct {
 	TeamID types.TeamID      `json:"teamId,omitempty"`
 	Phone  types.PhoneNumber `json:"phone"`
 }
 
+// nathejk:email.confirmed
+type NathejkEmailConfirmed struct {
+	TeamID types.TeamID `json:"teamId"`
+	Email  types.Email  `json:"email"`
+}
+
 // nathejk:sms.sent
 type NathejkSmsSent struct {
-	PingType types.PingType    `json:"pingType"`
-	TeamID   types.TeamID      `json:"teamId,omitempty"`
-	Phone    types.PhoneNumber `json:"phone"`
-	Text     string            `json:"text"`
-	Error    string            `json:"error,omitempty"`
+	MessageID string            `json:"messageId,omitempty"`
+	PingType  types.PingType    `json:"pingType"`
+	TeamID    types.TeamID      `json:"teamId,omitempty"`
+	Phone     types.PhoneNumber `json:"phone"`
+	Text      string            `json:"text"`
+	Error     string            `json:"error,omitempty"`
 }
 
 // nathejk:team.updated
@@ -51,9 +58,15 @@ type NathejkKlanUpdated struct {
 	Korps     string       `json:"korps"`
 }
 
+// nathejk:patrulje.status.changed
+// nathejk:klan.status.changed
+//
+// Reason tells why the status was changed, it is required when HQ changes
+// it.
 type NathejkTeamStatusChanged struct {
 	TeamID types.TeamID       `json:"teamId"`
 	Status types.SignupStatus `json:"signupStatus"`
+	Reason string             `json:"reason,omitempty"`
 }
 type NathejkPatruljeStatusChanged NathejkTeamStatusChanged
 type NathejkKlanStatusChanged NathejkTeamStatusChanged
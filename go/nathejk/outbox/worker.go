@@ -0,0 +1,225 @@
+// Package outbox sends the SMS and mail requested on the NATHEJK stream.
+//
+// Handlers do not send SMS and mail themselves. They publish a requested
+// event, and the Worker sends the message and publishes a sent event telling
+// whether it succeeded. A request without a sent event is sent again when
+// the worker restarts, so a message is never lost, but may be sent twice if
+// the API stops between sending it and publishing the sent event. Only one
+// instance of the API should run the worker.
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	sharedtypes "github.com/nathejk/shared-go/types"
+	"nathejk.dk/internal/jsonlog"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// SmsSender sends an SMS, e.g. a sms.Sender.
+type SmsSender interface {
+	Send(phone, text string) error
+}
+
+// MailSender sends a mail from a template, e.g. a mailer.Mailer.
+type MailSender interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// request is a requested message not yet sent.
+type request struct {
+	id   string
+	year string
+	kind string
+	msg  streaminterface.Message
+}
+
+// Worker is a consumer sending the requested messages once it has caught up
+// with the stream, and every request after that as it arrives. A message
+// that fails is tried Attempts times, waiting Backoff before the first retry
+// and doubling the wait for each retry after that.
+type Worker struct {
+	Attempts int
+	Backoff  time.Duration
+
+	p      streaminterface.Publisher
+	sms    SmsSender
+	mail   MailSender
+	logger *jsonlog.Logger
+
+	mu       sync.Mutex
+	pending  map[string]request
+	inflight map[string]bool
+	caughtUp bool
+	wg       sync.WaitGroup
+}
+
+func NewWorker(p streaminterface.Publisher, sms SmsSender, mail MailSender, logger *jsonlog.Logger) *Worker {
+	return &Worker{
+		Attempts: 5,
+		Backoff:  2 * time.Second,
+		p:        p,
+		sms:      sms,
+		mail:     mail,
+		logger:   logger,
+		pending:  map[string]request{},
+		inflight: map[string]bool{},
+	}
+}
+
+func (w *Worker) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+	}
+}
+
+// Reset forgets the pending requests before the stream is replayed. The
+// messages being sent are kept, so they are not sent again when the replay
+// has caught up.
+func (w *Worker) Reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = map[string]request{}
+	w.caughtUp = false
+	return nil
+}
+
+// CaughtUp sends the requests that were not sent before the worker started.
+func (w *Worker) CaughtUp() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.caughtUp = true
+	for _, r := range w.pending {
+		w.dispatch(r)
+	}
+}
+
+func (w *Worker) HandleMessage(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || subj.Entity != subject.Outbox || len(subj.SubVerbs) != 1 {
+		return nil
+	}
+	if subj.Verb != subject.VerbSms && subj.Verb != subject.VerbMail {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch subj.SubVerbs[0] {
+	case subject.VerbRequested:
+		r := request{id: subj.ID, year: subj.Year, kind: subj.Verb, msg: msg}
+		w.pending[r.id] = r
+		if w.caughtUp {
+			w.dispatch(r)
+		}
+	case subject.VerbSent:
+		delete(w.pending, subj.ID)
+	}
+	return nil
+}
+
+// Wait waits for the messages being sent.
+func (w *Worker) Wait() {
+	w.wg.Wait()
+}
+
+// dispatch sends r in the background unless it is being sent already. The
+// caller must hold w.mu.
+func (w *Worker) dispatch(r request) {
+	if w.inflight[r.id] {
+		return
+	}
+	w.inflight[r.id] = true
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if err := w.send(r); err != nil {
+			w.logger.PrintError(err, map[string]string{"messageId": r.id, "action": "publish sent event"})
+		}
+		w.mu.Lock()
+		delete(w.inflight, r.id)
+		w.mu.Unlock()
+	}()
+}
+
+// send sends r, retrying with backoff, and publishes the sent event.
+func (w *Worker) send(r request) error {
+	var sent streaminterface.MutableMessage
+	var err error
+	switch r.kind {
+	case subject.VerbSms:
+		var body nathejk.NathejkSmsRequested
+		if err := r.msg.Body(&body); err != nil {
+			return err
+		}
+		err = w.retry(func() error { return w.sms.Send(body.Phone.Normalize(), body.Text) })
+		sent = w.p.MessageFunc()(streaminterface.SubjectFromStr(subject.OutboxSent(r.year, r.id, r.kind).String()))
+		sent.SetBody(&nathejk.NathejkSmsSent{
+			MessageID: r.id,
+			PingType:  body.PingType,
+			TeamID:    body.TeamID,
+			Phone:     body.Phone,
+			Text:      body.Text,
+			Error:     errorString(err),
+		})
+	case subject.VerbMail:
+		var body nathejk.NathejkMailRequested
+		if err := r.msg.Body(&body); err != nil {
+			return err
+		}
+		err = w.retry(func() error { return w.mail.Send(string(body.Recipient), body.Template, body.Data) })
+		sent = w.p.MessageFunc()(streaminterface.SubjectFromStr(subject.OutboxSent(r.year, r.id, r.kind).String()))
+		sent.SetBody(&messages.NathejkMailSent{
+			PingType:  sharedtypes.PingType(body.PingType),
+			TeamID:    sharedtypes.TeamID(body.TeamID),
+			MessageID: r.id,
+			Recipient: sharedtypes.EmailAddress(body.Recipient),
+			Subject:   body.Subject,
+			Timestamp: time.Now(),
+			Secret:    body.Secret,
+			Error:     errorString(err),
+		})
+	}
+	if err != nil {
+		w.logger.PrintError(err, map[string]string{"messageId": r.id, "kind": r.kind, "action": "give up sending"})
+	}
+	var meta messages.Metadata
+	r.msg.Meta(&meta)
+	sent.SetMeta(&messages.Metadata{Producer: meta.Producer})
+	if err := w.p.Publish(sent); err != nil && !errors.Is(err, nats.ErrBuffered) {
+		return err
+	}
+	return nil
+}
+
+// retry calls send until it succeeds or has been tried w.Attempts times,
+// and returns the last error.
+func (w *Worker) retry(send func() error) (err error) {
+	backoff := w.Backoff
+	for i := 1; i <= w.Attempts; i++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		if i < w.Attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,143 @@
+package outbox_test
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/internal/jsonlog"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/outbox"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+// smsSender records the texts sent, failing the first fails sends.
+type smsSender struct {
+	mu    sync.Mutex
+	fails int
+	calls int
+	sent  []string
+}
+
+func (s *smsSender) Send(phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls <= s.fails {
+		return errors.New("provider down")
+	}
+	s.sent = append(s.sent, phone+": "+text)
+	return nil
+}
+
+// mailSender records the recipient and template of the mails sent.
+type mailSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *mailSender) Send(recipient, templateFile string, _ any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, recipient+": "+templateFile)
+	return nil
+}
+
+var logger = jsonlog.New(io.Discard, jsonlog.LevelOff)
+
+func event(subj subject.Subject, body any) streaminterface.Message {
+	msg := streamtest.MessageFunc(streaminterface.SubjectFromStr(subj.String()))
+	msg.SetBody(body)
+	msg.SetMeta(&messages.Metadata{Producer: "deltag-api"})
+	return msg
+}
+
+func smsRequested(id, text string) streaminterface.Message {
+	return event(subject.OutboxRequested("2024", id, subject.VerbSms), &nathejk.NathejkSmsRequested{MessageID: id, Phone: "12345678", Text: text})
+}
+
+func TestWorkerSendsPendingWhenCaughtUp(t *testing.T) {
+	assert := assert.New(t)
+
+	p := streamtest.NewRecorder()
+	sms := &smsSender{}
+	mail := &mailSender{}
+	w := outbox.NewWorker(p, sms, mail, logger)
+
+	assert.NoError(w.HandleMessage(smsRequested("msg-1", "Din pinkode er 1234")))
+	assert.NoError(w.HandleMessage(smsRequested("msg-2", "Din pinkode er 5678")))
+	assert.NoError(w.HandleMessage(event(subject.OutboxSent("2024", "msg-2", subject.VerbSms), &nathejk.NathejkSmsSent{MessageID: "msg-2"})))
+	assert.NoError(w.HandleMessage(event(subject.OutboxRequested("2024", "msg-3", subject.VerbMail), &nathejk.NathejkMailRequested{MessageID: "msg-3", Recipient: "anna@example.com", Template: "verify_email.tmpl", Secret: "secret-1"})))
+	w.Wait()
+	assert.Empty(sms.sent, "nothing is sent before the worker has caught up")
+
+	w.CaughtUp()
+	w.Wait()
+	assert.Equal([]string{"12345678: Din pinkode er 1234"}, sms.sent)
+	assert.Equal([]string{"anna@example.com: verify_email.tmpl"}, mail.sent)
+
+	// Requests after catching up are sent as they arrive.
+	p.Reset()
+	assert.NoError(w.HandleMessage(smsRequested("msg-4", "Betal her")))
+	w.Wait()
+	p.Then(t, streamtest.Expect{
+		Subject: "NATHEJK:2024.outbox.msg-4.sms.sent",
+		Body:    nathejk.NathejkSmsSent{MessageID: "msg-4", Phone: "12345678", Text: "Betal her"},
+	})
+}
+
+func TestWorkerRetries(t *testing.T) {
+	tests := map[string]struct {
+		fails int
+		calls int
+		err   string
+	}{
+		"succeeds on retry": {fails: 2, calls: 3},
+		"gives up":          {fails: 5, calls: 3, err: "provider down"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := streamtest.NewRecorder()
+			sms := &smsSender{fails: tt.fails}
+			w := outbox.NewWorker(p, sms, &mailSender{}, logger)
+			w.Attempts, w.Backoff = 3, 0
+			w.CaughtUp()
+
+			assert.NoError(t, w.HandleMessage(smsRequested("msg-1", "Din pinkode er 1234")))
+			w.Wait()
+			assert.Equal(t, tt.calls, sms.calls)
+
+			msgs := p.Messages()
+			if assert.Len(t, msgs, 1) {
+				var body nathejk.NathejkSmsSent
+				assert.NoError(t, msgs[0].Body(&body))
+				assert.Equal(t, tt.err, body.Error)
+			}
+		})
+	}
+}
+
+func TestWorkerMailSent(t *testing.T) {
+	p := streamtest.NewRecorder()
+	w := outbox.NewWorker(p, &smsSender{}, &mailSender{}, logger)
+	w.CaughtUp()
+
+	assert.NoError(t, w.HandleMessage(event(subject.OutboxRequested("2024", "msg-1", subject.VerbMail), &nathejk.NathejkMailRequested{MessageID: "msg-1", PingType: "signup", TeamID: "team-1", Recipient: "anna@example.com", Subject: "Bekræft e-mailadresse", Template: "verify_email.tmpl", Secret: "secret-1"})))
+	w.Wait()
+	p.Then(t, streamtest.Expect{Subject: "NATHEJK:2024.outbox.msg-1.mail.sent"})
+
+	var body messages.NathejkMailSent
+	assert.NoError(t, p.Messages()[0].Body(&body))
+	assert.Equal(t, "msg-1", body.MessageID)
+	assert.Equal(t, "secret-1", body.Secret)
+	assert.Equal(t, "Bekræft e-mailadresse", body.Subject)
+	assert.Empty(t, body.Error)
+}
@@ -0,0 +1,217 @@
+// Package subject builds and parses the subjects used for team and member
+// events on the NATHEJK stream.
+//
+// A subject has the form
+//
+//	NATHEJK:<year>.<entity>.<id>.<verb>[.<subverb>...]
+//
+// e.g. "NATHEJK:2024.patrulje.team-1.signedup" or
+// "NATHEJK:2024.klan.team-2.mail.signup.sent".
+package subject
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nathejk/shared-go/types"
+)
+
+// Domain is the stream domain (channel) all team and member events are
+// published on.
+const Domain = "NATHEJK"
+
+// Any is the wildcard that matches any single part of a subject.
+const Any = "*"
+
+var ErrInvalidSubject = errors.New("subject: invalid subject")
+
+// Entity is the type of the aggregate a subject is about.
+type Entity string
+
+const (
+	Patrulje Entity = "patrulje"
+	Klan     Entity = "klan"
+	Spejder  Entity = "spejder"
+	Senior   Entity = "senior"
+	// MailTemplate is the entity of the mail templates, whose ID is the
+	// slug of the template.
+	MailTemplate Entity = "mailtemplate"
+	// Outbox is the entity of the SMS and mail waiting to be sent, whose ID
+	// is the ID of the message.
+	Outbox Entity = "outbox"
+)
+
+// Verbs used on team and member subjects.
+const (
+	VerbSignedup  = "signedup"
+	VerbUpdated   = "updated"
+	VerbDeleted   = "deleted"
+	VerbStatus    = "status"
+	VerbRoster    = "roster"
+	VerbMail      = "mail"
+	VerbSms       = "sms"
+	VerbChanged   = "changed"
+	VerbSent      = "sent"
+	VerbNumber    = "number"
+	VerbAssigned  = "assigned"
+	VerbEmail     = "email"
+	VerbPhone     = "phone"
+	VerbConfirmed = "confirmed"
+	VerbRequested = "requested"
+)
+
+// Subject is a parsed NATHEJK subject.
+type Subject struct {
+	Year     string
+	Entity   Entity
+	ID       string
+	Verb     string
+	SubVerbs []string
+}
+
+// New returns a subject for the given parts. Any part may be the wildcard
+// Any, in which case the subject can be used as a pattern.
+func New(year string, entity Entity, id string, verb string, subverbs ...string) Subject {
+	return Subject{Year: year, Entity: entity, ID: id, Verb: verb, SubVerbs: subverbs}
+}
+
+// Team returns a subject for an event on a team.
+func Team(year string, teamType types.TeamType, teamID types.TeamID, verb string, subverbs ...string) Subject {
+	return New(year, Entity(teamType), string(teamID), verb, subverbs...)
+}
+
+// Member returns a subject for an event on a member of a team.
+func Member(year string, entity Entity, memberID types.MemberID, verb string, subverbs ...string) Subject {
+	return New(year, entity, string(memberID), verb, subverbs...)
+}
+
+// StatusChanged returns the subject used when the signup status of a team
+// changes.
+func StatusChanged(year string, teamType types.TeamType, teamID types.TeamID) Subject {
+	return Team(year, teamType, teamID, VerbStatus, VerbChanged)
+}
+
+// RosterUpdated returns the subject used when the roster of a team, that is
+// the team, its contact and its members, is updated.
+func RosterUpdated(year string, teamType types.TeamType, teamID types.TeamID) Subject {
+	return Team(year, teamType, teamID, VerbRoster, VerbUpdated)
+}
+
+// NumberAssigned returns the subject used when a team is given its team
+// number.
+func NumberAssigned(year string, teamType types.TeamType, teamID types.TeamID) Subject {
+	return Team(year, teamType, teamID, VerbNumber, VerbAssigned)
+}
+
+// EmailConfirmed returns the subject used when the contact of a team has
+// confirmed the e-mail address given at signup.
+func EmailConfirmed(year string, teamType types.TeamType, teamID types.TeamID) Subject {
+	return Team(year, teamType, teamID, VerbEmail, VerbConfirmed)
+}
+
+// PhoneConfirmed returns the subject used when the contact of a team has
+// confirmed the phone number given at signup with the pincode sent to it.
+func PhoneConfirmed(year string, teamType types.TeamType, teamID types.TeamID) Subject {
+	return Team(year, teamType, teamID, VerbPhone, VerbConfirmed)
+}
+
+// MailTemplateChanged returns the subject used when the mail template slug
+// is updated or deleted, as told by verb.
+func MailTemplateChanged(year string, slug string, verb string) Subject {
+	return New(year, MailTemplate, slug, verb)
+}
+
+// OutboxRequested returns the subject used when the outbox is asked to send
+// the message id, kind being VerbSms or VerbMail.
+func OutboxRequested(year string, id string, kind string) Subject {
+	return New(year, Outbox, id, kind, VerbRequested)
+}
+
+// OutboxSent returns the subject used when the outbox has sent the message
+// id, or has given up sending it.
+func OutboxSent(year string, id string, kind string) Subject {
+	return New(year, Outbox, id, kind, VerbSent)
+}
+
+// MailSent returns the subject used when a mail of the given ping type has
+// been sent to a team.
+func MailSent(year string, teamType types.TeamType, teamID types.TeamID, pingType types.PingType) Subject {
+	return Team(year, teamType, teamID, VerbMail, string(pingType), VerbSent)
+}
+
+// Signedup matches the signedup event of any team in any year.
+var Signedup = New(Any, Any, Any, VerbSignedup)
+
+// Parse parses the string representation of a subject. Both the stream form
+// ("NATHEJK:2024.klan.id.updated") and the dotted form used by JetStream
+// ("NATHEJK.2024.klan.id.updated") are accepted.
+func Parse(s string) (Subject, error) {
+	i := strings.IndexAny(s, ":.")
+	if i < 0 || !strings.EqualFold(s[:i], Domain) {
+		return Subject{}, ErrInvalidSubject
+	}
+	parts := strings.Split(s[i+1:], ".")
+	if len(parts) < 4 {
+		return Subject{}, ErrInvalidSubject
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Subject{}, ErrInvalidSubject
+		}
+	}
+	subj := Subject{
+		Year:   parts[0],
+		Entity: Entity(parts[1]),
+		ID:     parts[2],
+		Verb:   parts[3],
+	}
+	if len(parts) > 4 {
+		subj.SubVerbs = parts[4:]
+	}
+	return subj, nil
+}
+
+// Type returns the type part of the subject, that is everything after the
+// domain.
+func (s Subject) Type() string {
+	parts := append([]string{s.Year, string(s.Entity), s.ID, s.Verb}, s.SubVerbs...)
+	return strings.Join(parts, ".")
+}
+
+// String returns the subject in the form accepted by SubjectFromStr in the
+// streaminterface packages.
+func (s Subject) String() string {
+	return Domain + ":" + s.Type()
+}
+
+// Pattern returns the subject in the dotted form accepted by Subject.Match.
+func (s Subject) Pattern() string {
+	return Domain + "." + s.Type()
+}
+
+// Valid reports whether the subject has all the required parts and none of
+// them contain a separator.
+func (s Subject) Valid() bool {
+	parts := append([]string{s.Year, string(s.Entity), s.ID, s.Verb}, s.SubVerbs...)
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, ".: \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// TeamType returns the team type of a team subject.
+func (s Subject) TeamType() types.TeamType {
+	return types.TeamType(s.Entity)
+}
+
+// TeamID returns the ID of a team subject.
+func (s Subject) TeamID() types.TeamID {
+	return types.TeamID(s.ID)
+}
+
+// MemberID returns the ID of a member subject.
+func (s Subject) MemberID() types.MemberID {
+	return types.MemberID(s.ID)
+}
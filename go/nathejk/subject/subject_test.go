@@ -0,0 +1,141 @@
+package subject_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/nathejk/subject"
+	pkgstreaminterface "nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/superfluids/streaminterface"
+)
+
+func TestSubjectString(t *testing.T) {
+	assert := assert.New(t)
+
+	s := subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbSignedup)
+	assert.Equal("NATHEJK:2024.patrulje.team-1.signedup", s.String())
+	assert.Equal("NATHEJK.2024.patrulje.team-1.signedup", s.Pattern())
+
+	s = subject.MailSent("2024", types.TeamTypeKlan, "team-2", types.PingTypeSignup)
+	assert.Equal("NATHEJK:2024.klan.team-2.mail.signup.sent", s.String())
+
+	s = subject.Member("2024", subject.Senior, "member-1", subject.VerbDeleted)
+	assert.Equal("NATHEJK:2024.senior.member-1.deleted", s.String())
+
+	s = subject.NumberAssigned("2024", types.TeamTypeKlan, "team-2")
+	assert.Equal("NATHEJK:2024.klan.team-2.number.assigned", s.String())
+
+	s = subject.EmailConfirmed("2024", types.TeamTypePatrulje, "team-1")
+	assert.Equal("NATHEJK:2024.patrulje.team-1.email.confirmed", s.String())
+
+	s = subject.PhoneConfirmed("2024", types.TeamTypePatrulje, "team-1")
+	assert.Equal("NATHEJK:2024.patrulje.team-1.phone.confirmed", s.String())
+
+	s = subject.MailTemplateChanged("2024", "verify_email", subject.VerbUpdated)
+	assert.Equal("NATHEJK:2024.mailtemplate.verify_email.updated", s.String())
+
+	s = subject.OutboxRequested("2024", "msg-1", subject.VerbSms)
+	assert.Equal("NATHEJK:2024.outbox.msg-1.sms.requested", s.String())
+
+	s = subject.OutboxSent("2024", "msg-1", subject.VerbMail)
+	assert.Equal("NATHEJK:2024.outbox.msg-1.mail.sent", s.String())
+}
+
+func TestSubjectParse(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		str  string
+		exp  subject.Subject
+		err  bool
+	}{
+		{
+			name: "stream form",
+			str:  "NATHEJK:2024.patrulje.team-1.updated",
+			exp:  subject.New("2024", subject.Patrulje, "team-1", subject.VerbUpdated),
+		},
+		{
+			name: "dotted form",
+			str:  "NATHEJK.2024.klan.team-1.status.changed",
+			exp:  subject.New("2024", subject.Klan, "team-1", subject.VerbStatus, subject.VerbChanged),
+		},
+		{
+			name: "lower case domain",
+			str:  "nathejk.2024.spejder.member-1.deleted",
+			exp:  subject.New("2024", subject.Spejder, "member-1", subject.VerbDeleted),
+		},
+		{
+			name: "wrong domain",
+			str:  "nathejk2:2024.klan.team-1.updated",
+			err:  true,
+		},
+		{
+			name: "missing verb",
+			str:  "NATHEJK:2024.klan.team-1",
+			err:  true,
+		},
+		{
+			name: "empty part",
+			str:  "NATHEJK:2024..team-1.updated",
+			err:  true,
+		},
+		{
+			name: "domain only",
+			str:  "NATHEJK",
+			err:  true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := subject.Parse(test.str)
+			if test.err {
+				assert.ErrorIs(t, err, subject.ErrInvalidSubject)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.exp, got)
+		})
+	}
+}
+
+func TestSubjectRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	s := subject.StatusChanged("2024", types.TeamTypeKlan, "team-1")
+
+	// superfluids subjects are matched with the pattern form
+	sf := streaminterface.SubjectFromStr(s.String())
+	assert.True(sf.Match(s.Pattern()))
+	assert.True(sf.Match(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbStatus, subject.VerbChanged).Pattern()))
+	assert.False(sf.Match(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbStatus, subject.VerbChanged).Pattern()))
+	assert.False(sf.Match(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbStatus).Pattern()))
+
+	got, err := subject.Parse(sf.Subject())
+	assert.NoError(err)
+	assert.Equal(s, got)
+
+	// pkg subjects keep the domain as the channel
+	ps := pkgstreaminterface.SubjectFromStr(s.String())
+	assert.Equal(subject.Domain, ps.Domain())
+	assert.Equal(s.Type(), ps.Type())
+
+	got, err = subject.Parse(ps.Subject())
+	assert.NoError(err)
+	assert.Equal(s, got)
+	assert.Equal(types.TeamID("team-1"), got.TeamID())
+	assert.Equal(types.TeamTypeKlan, got.TeamType())
+
+	// a roster update is not an update of the team
+	r := subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1")
+	assert.Equal("NATHEJK:2024.patrulje.team-1.roster.updated", r.String())
+	assert.False(streaminterface.SubjectFromStr(r.String()).Match(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbUpdated).Pattern()))
+}
+
+func TestSubjectValid(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbUpdated).Valid())
+	assert.True(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbUpdated).Valid())
+	assert.False(subject.Team("2024", types.TeamTypeKlan, "", subject.VerbUpdated).Valid())
+	assert.False(subject.Team("2024", types.TeamTypeKlan, "team.1", subject.VerbUpdated).Valid())
+}
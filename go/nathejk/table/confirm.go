@@ -3,13 +3,19 @@ package table
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
 	"nathejk.dk/pkg/tablerow"
-	"nathejk.dk/superfluids/streaminterface"
 )
 
+// confirm holds the secret of the last confirmation mail sent to each team.
+// A new mail replaces the secret, so only the link of the last mail works,
+// and confirmedAt is set once the link has been used.
 type confirm struct {
 	w tablerow.Consumer
 }
@@ -28,21 +34,37 @@ CREATE TABLE IF NOT EXISTS confirm (
     teamId VARCHAR(99) NOT NULL,
     emailPending VARCHAR(99) NOT NULL,
     secret VARCHAR(99),
+    sentAt VARCHAR(99),
+    confirmedAt VARCHAR(99),
     PRIMARY KEY (teamId)
 );
 `
 }
 
+// Reset empties the table before the projection is rebuilt.
+func (t *confirm) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE confirm")
+}
+
 func (t *confirm) Consumes() []streaminterface.Subject {
 	return []streaminterface.Subject{
-		streaminterface.SubjectFromStr(fmt.Sprintf("NATHEJK:%s.*.*.mail.%s.sent", "2024", types.PingTypeSignup)),
+		streaminterface.SubjectFromStr(subject.Domain),
 	}
 }
 
 func (t *confirm) HandleMessage(msg streaminterface.Message) error {
-	switch msg.Subject().Subject() {
-	//case "NATHEJK.year.created":
-	default:
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil {
+		return nil
+	}
+	if subj.Entity == subject.Outbox {
+		return t.outboxMessage(msg, subj)
+	}
+	if subj.Entity != subject.Patrulje && subj.Entity != subject.Klan {
+		return nil
+	}
+	switch {
+	case subj.Verb == subject.VerbMail && len(subj.SubVerbs) == 2 && subj.SubVerbs[0] == string(types.PingTypeSignup) && subj.SubVerbs[1] == subject.VerbSent:
 		var body messages.NathejkMailSent
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -51,25 +73,46 @@ func (t *confirm) HandleMessage(msg streaminterface.Message) error {
 		if err := msg.Meta(&meta); err != nil {
 			return err
 		}
-		sql := "INSERT INTO confirm SET teamId=%q, emailPending=%q, secret=%q ON DUPLICATE KEY UPDATE emailPending=VALUES(emailPending), secret=VALUES(secret)"
-		args := []any{
-			body.TeamID,
-			body.Recipient,
-			meta.Phase,
+		if err := t.mailSent(msg, body, meta.Phase); err != nil {
+			return err
 		}
-		if err := t.w.Consume(fmt.Sprintf(sql, args...)); err != nil {
+	case subj.Verb == subject.VerbEmail && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbConfirmed:
+		var body nathejk.NathejkEmailConfirmed
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		sql := "UPDATE confirm SET confirmedAt=%q WHERE teamId=%q AND emailPending=%q"
+		if err := t.w.Consume(fmt.Sprintf(sql, msg.Time().UTC().Format(time.RFC3339), subj.ID, body.Email)); err != nil {
 			return err
 		}
-		//default:
-		//	return fmt.Errorf("unhandled subject %q", msg.Subject().Subject())
 	}
 	return nil
 }
 
-/*
-func escapeNull(s *time.Time) string {
-	if s == nil {
-		return "NULL"
+// outboxMessage handles the confirmation mails sent by the outbox, which
+// carry the secret in the body. Mails that could not be sent are ignored, so
+// the link of the last mail sent keeps working.
+func (t *confirm) outboxMessage(msg streaminterface.Message, subj subject.Subject) error {
+	if subj.Verb != subject.VerbMail || len(subj.SubVerbs) != 1 || subj.SubVerbs[0] != subject.VerbSent {
+		return nil
+	}
+	var body messages.NathejkMailSent
+	if err := msg.Body(&body); err != nil {
+		return err
 	}
-	return fmt.Sprintf("%q", s)
-}*/
+	if body.PingType != types.PingTypeSignup || body.Error != "" {
+		return nil
+	}
+	return t.mailSent(msg, body, body.Secret)
+}
+
+func (t *confirm) mailSent(msg streaminterface.Message, body messages.NathejkMailSent, secret string) error {
+	sql := "INSERT INTO confirm SET teamId=%q, emailPending=%q, secret=%q, sentAt=%q, confirmedAt=NULL ON DUPLICATE KEY UPDATE emailPending=VALUES(emailPending), secret=VALUES(secret), sentAt=VALUES(sentAt), confirmedAt=NULL"
+	args := []any{
+		body.TeamID,
+		body.Recipient,
+		secret,
+		msg.Time().UTC().Format(time.RFC3339),
+	}
+	return t.w.Consume(fmt.Sprintf(sql, args...))
+}
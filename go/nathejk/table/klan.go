@@ -6,6 +6,8 @@ import (
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
 	"nathejk.dk/pkg/tablerow"
 	"nathejk.dk/superfluids/streaminterface"
 
@@ -30,12 +32,21 @@ func NewKlan(w tablerow.Consumer) *klan {
 	if err := w.Consume(table.CreateTableSql()); err != nil {
 		log.Fatalf("Error creating table %q", err)
 	}
+	if err := migrate(w, klanMigrations...); err != nil {
+		log.Fatalf("Error migrating table %q", err)
+	}
 	return table
 }
 
 //go:embed klan.sql
 var klanSchema string
 
+// klanMigrations add the columns of klan.sql missing in tables created
+// before them.
+var klanMigrations = []string{
+	`ALTER TABLE klan ADD COLUMN IF NOT EXISTS teamNumber VARCHAR(99) NOT NULL DEFAULT ""`,
+}
+
 func (t *klan) CreateTableSql() string {
 	return klanSchema
 }
@@ -44,15 +55,21 @@ func (c *klan) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
 		//streaminterface.SubjectFromStr("monolith:nathejk_team"),
 		//streaminterface.SubjectFromStr("nathejk"),
-		streaminterface.SubjectFromStr("NATHEJK:2024.klan.*.updated"),
-		streaminterface.SubjectFromStr("NATHEJK:2024.klan.*.signedup"),
-		streaminterface.SubjectFromStr("NATHEJK.*.klan.*.status.changed"),
+		streaminterface.SubjectFromStr(subject.New("2024", subject.Klan, subject.Any, subject.VerbUpdated).String()),
+		streaminterface.SubjectFromStr(subject.New("2024", subject.Klan, subject.Any, subject.VerbSignedup).String()),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbStatus, subject.VerbChanged).String()),
+		streaminterface.SubjectFromStr(subject.RosterUpdated(subject.Any, types.TeamTypeKlan, subject.Any).String()),
+		streaminterface.SubjectFromStr(subject.NumberAssigned(subject.Any, types.TeamTypeKlan, subject.Any).String()),
 	}
 }
 
 func (c *klan) HandleMessage(msg streaminterface.Message) error {
 	switch true {
-	case msg.Subject().Match("NATHEJK.*.klan.*.signedup"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbSignedup).Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
 		var body messages.NathejkTeamSignedUp
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -60,7 +77,7 @@ func (c *klan) HandleMessage(msg streaminterface.Message) error {
 		if body.TeamID == "" {
 			return nil
 		}
-		sql := fmt.Sprintf("INSERT IGNORE INTO klan SET teamId=%q, year=%q", body.TeamID, msg.Subject().Parts()[1])
+		sql := fmt.Sprintf("INSERT IGNORE INTO klan SET teamId=%q, year=%q", body.TeamID, subj.Year)
 		if err := c.w.Consume(sql); err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		}
@@ -75,7 +92,7 @@ func (c *klan) HandleMessage(msg streaminterface.Message) error {
 			log.Fatalf("Error consuming sql %q", err)
 		}
 
-	case msg.Subject().Match("NATHEJK.*.klan.*.status.changed"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbStatus, subject.VerbChanged).Pattern()):
 		var body messages.NathejkKlanStatusChanged
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -85,22 +102,36 @@ func (c *klan) HandleMessage(msg streaminterface.Message) error {
 			log.Fatalf("Error consuming sql %q", err)
 		}
 
-	case msg.Subject().Match("NATHEJK.*.klan.*.updated"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Klan, subject.Any, subject.VerbUpdated).Pattern()):
 		var body messages.NathejkKlanUpdated
 		if err := msg.Body(&body); err != nil {
 			return err
 		}
-		msg.Subject().Parts()
-		query := "UPDATE klan SET name=%q, groupName=%q, korps=%q WHERE teamId=%q"
-		args := []any{body.Name, body.GroupName, body.Korps, body.TeamID}
 		//query := "INSERT INTO patrulje SET teamId=%q, year=\"%d\", contactName=%q, contactPhone=%q, contactEmail=%q ON DUPLICATE KEY UPDATE contactName=VALUES(contactName), conta    ctPhone=VALUES(contactPhone), contactEmail=VALUES(contactEmail)"
 		//args := []any{body.TeamID, msg.Time().Year(), body.Name, body.Phone, body.Email}
 		//, body.Name, body.GroupName, body.Korps, body.ContactName, body.ContactPhone, body.ContactEmail, body.ContactRole, body.TeamID))
 
-		err := c.w.Consume(fmt.Sprintf(query, args...))
+		err := c.w.Consume(klanUpdate(body.TeamID, body.Name, body.GroupName, body.Korps))
 		if err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		}
+	case msg.Subject().Match(subject.NumberAssigned(subject.Any, types.TeamTypeKlan, subject.Any).Pattern()):
+		var body nathejk.NathejkTeamNumberAssigned
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		err := c.w.Consume(fmt.Sprintf("UPDATE klan SET teamNumber=\"%d\" WHERE teamId=%q", body.TeamNumber, body.TeamID))
+		if err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
+	case msg.Subject().Match(subject.RosterUpdated(subject.Any, types.TeamTypeKlan, subject.Any).Pattern()):
+		var body nathejk.NathejkTeamRosterUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		if err := c.w.Consume(klanUpdate(body.Team.TeamID, body.Team.Name, body.Team.GroupName, body.Team.Korps)); err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
 	default:
 		log.Printf("Unhandled message %q", msg.Subject().Subject())
 		/*
@@ -152,3 +183,9 @@ func (c *klan) HandleMessage(msg streaminterface.Message) error {
 	}
 	return nil
 }
+
+// klanUpdate returns the statement writing the name, group and korps of a
+// klan.
+func klanUpdate(teamID types.TeamID, name, groupName, korps string) string {
+	return fmt.Sprintf("UPDATE klan SET name=%q, groupName=%q, korps=%q WHERE teamId=%q", name, groupName, korps, teamID)
+}
@@ -0,0 +1,78 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestKlan(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewKlan).
+		Given(
+			signedUp(types.TeamTypeKlan, "team-1", "Bo"),
+			tablerowtest.Event{
+				Subject: subject.Team("2024", types.TeamTypeKlan, "team-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkKlanUpdated{TeamID: "team-1", Name: "Ulvene", GroupName: "1. Gruppe", Korps: "dds"},
+			},
+			tablerowtest.Event{
+				Subject: subject.StatusChanged("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    messages.NathejkKlanStatusChanged{TeamID: "team-1", Status: types.SignupStatusPay},
+			},
+			tablerowtest.Event{
+				Subject: subject.NumberAssigned("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 501},
+			},
+		).
+		ThenRows("klan",
+			tablerowtest.Row{"teamId": "team-1", "year": "2024", "teamNumber": "501", "name": "Ulvene", "groupName": "1. Gruppe", "korps": "dds", "signupStatus": string(types.SignupStatusPay)},
+		)
+}
+
+func TestKlanRoster(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewKlan).
+		Given(
+			signedUp(types.TeamTypeKlan, "team-1", "Bo"),
+			tablerowtest.Event{
+				Subject: subject.RosterUpdated("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    nathejk.NathejkTeamRosterUpdated{Team: messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ulvene", GroupName: "1. Gruppe", Korps: "dds"}},
+			},
+		).
+		ThenRows("klan",
+			tablerowtest.Row{"teamId": "team-1", "name": "Ulvene", "groupName": "1. Gruppe", "korps": "dds"},
+		)
+}
+
+func TestKlanIgnoresSignupWithoutTeam(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewKlan).
+		Given(signedUp(types.TeamTypeKlan, "", "Bo")).
+		ThenRows("klan")
+}
+
+func TestKlanMigrate(t *testing.T) {
+	db := tablerowtest.New()
+	// The table as created before klans had numbers.
+	err := db.Consume(`CREATE TABLE IF NOT EXISTS klan (
+		teamId VARCHAR(99) NOT NULL,
+		year VARCHAR(99) NOT NULL DEFAULT "",
+		name VARCHAR(99) NOT NULL DEFAULT "",
+		PRIMARY KEY (teamId)
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Consume(`INSERT INTO klan SET teamId="team-1", year="2024", name="Ulvene"`); err != nil {
+		t.Fatal(err)
+	}
+
+	table.NewKlan(db)
+	table.NewKlan(db)
+	assert.Equal(t, []tablerowtest.Row{{"teamId": "team-1", "year": "2024", "name": "Ulvene", "teamNumber": ""}}, db.Rows("klan"))
+	assert.NoError(t, db.Consume(`UPDATE klan SET teamNumber="501" WHERE teamId="team-1"`))
+}
@@ -0,0 +1,64 @@
+package table
+
+import (
+	"fmt"
+	"log"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/tablerow"
+
+	_ "embed"
+)
+
+// mailTemplate holds the mail templates defined on the stream, which the
+// mailer prefers to its embedded templates.
+type mailTemplate struct {
+	w tablerow.Consumer
+}
+
+func NewMailTemplate(w tablerow.Consumer) *mailTemplate {
+	table := &mailTemplate{w: w}
+	if err := w.Consume(table.CreateTableSql()); err != nil {
+		log.Fatalf("Error creating table %q", err)
+	}
+	return table
+}
+
+//go:embed mailtemplate.sql
+var mailTemplateSchema string
+
+func (t *mailTemplate) CreateTableSql() string {
+	return mailTemplateSchema
+}
+
+// Reset empties the table before the projection is rebuilt.
+func (t *mailTemplate) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE mailtemplate")
+}
+
+func (t *mailTemplate) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+	}
+}
+
+func (t *mailTemplate) HandleMessage(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || subj.Entity != subject.MailTemplate {
+		return nil
+	}
+	switch subj.Verb {
+	case subject.VerbUpdated:
+		var body nathejk.NathejkMailTemplateUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		sql := "INSERT INTO mailtemplate SET slug=%q, subject=%q, template=%q, updatedAt=%q ON DUPLICATE KEY UPDATE subject=VALUES(subject), template=VALUES(template), updatedAt=VALUES(updatedAt)"
+		return t.w.Consume(fmt.Sprintf(sql, subj.ID, body.Subject, body.Template, msg.Time()))
+	case subject.VerbDeleted:
+		return t.w.Consume(fmt.Sprintf("DELETE FROM mailtemplate WHERE slug=%q", subj.ID))
+	}
+	return nil
+}
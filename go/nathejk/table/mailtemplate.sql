@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS mailtemplate (
+    slug VARCHAR(99) NOT NULL,
+    subject VARCHAR(999) NOT NULL DEFAULT "",
+    template TEXT NOT NULL,
+    updatedAt VARCHAR(99) NOT NULL,
+    PRIMARY KEY (slug)
+);
@@ -0,0 +1,35 @@
+package table_test
+
+import (
+	"testing"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestMailTemplate(t *testing.T) {
+	updated := func(slug, subj, body string) tablerowtest.Event {
+		return tablerowtest.Event{
+			Subject: subject.MailTemplateChanged("2024", slug, subject.VerbUpdated).String(),
+			Time:    signedUpAt,
+			Body:    nathejk.NathejkMailTemplateUpdated{Slug: slug, Subject: subj, Template: body},
+		}
+	}
+	tablerowtest.NewPkgProjection(t, table.NewMailTemplate).
+		Given(
+			updated("verify_email", "Bekræft", `{{define "plainBody"}}Hej "{{.Name}}"`+"\n"+`{{end}}`),
+			updated("paid", "Betalt", `{{define "plainBody"}}Tak{{end}}`),
+			updated("welcome", "Velkommen", `{{define "plainBody"}}Hej{{end}}`),
+			updated("paid", "Betaling modtaget", `{{define "plainBody"}}Tak for betalingen{{end}}`),
+			tablerowtest.Event{
+				Subject: subject.MailTemplateChanged("2024", "welcome", subject.VerbDeleted).String(),
+				Body:    nathejk.NathejkMailTemplateDeleted{Slug: "welcome"},
+			},
+		).
+		ThenRows("mailtemplate",
+			tablerowtest.Row{"slug": "paid", "subject": "Betaling modtaget", "template": `{{define "plainBody"}}Tak for betalingen{{end}}`},
+			tablerowtest.Row{"slug": "verify_email", "subject": "Bekræft", "template": `{{define "plainBody"}}Hej "{{.Name}}"` + "\n" + `{{end}}`, "updatedAt": signedUpAt.String()},
+		)
+}
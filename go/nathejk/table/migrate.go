@@ -0,0 +1,15 @@
+package table
+
+import "nathejk.dk/pkg/tablerow"
+
+// migrate brings a table created by an older version up to date, as its
+// CREATE TABLE IF NOT EXISTS leaves an existing table as it is. Each
+// migration must be safe to run again, e.g. ADD COLUMN IF NOT EXISTS.
+func migrate(w tablerow.Consumer, migrations ...string) error {
+	for _, m := range migrations {
+		if err := w.Consume(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package table
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/tablerow"
+
+	_ "embed"
+)
+
+// Statuses of the messages in the outbox.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// outbox holds the SMS and mail requested, so HQ can see which failed and
+// resend them. The request is kept as published, and is published again
+// when the message is resent.
+type outbox struct {
+	w tablerow.Consumer
+}
+
+func NewOutbox(w tablerow.Consumer) *outbox {
+	table := &outbox{w: w}
+	if err := w.Consume(table.CreateTableSql()); err != nil {
+		log.Fatalf("Error creating table %q", err)
+	}
+	return table
+}
+
+//go:embed outbox.sql
+var outboxSchema string
+
+func (t *outbox) CreateTableSql() string {
+	return outboxSchema
+}
+
+// Reset empties the table before the projection is rebuilt.
+func (t *outbox) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE outbox")
+}
+
+func (t *outbox) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+	}
+}
+
+func (t *outbox) HandleMessage(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || subj.Entity != subject.Outbox || len(subj.SubVerbs) != 1 {
+		return nil
+	}
+	switch {
+	case subj.Verb == subject.VerbSms && subj.SubVerbs[0] == subject.VerbRequested:
+		var body nathejk.NathejkSmsRequested
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		return t.requested(msg, subj, string(body.PingType), string(body.TeamID), string(body.Phone), body.Text, &body)
+	case subj.Verb == subject.VerbMail && subj.SubVerbs[0] == subject.VerbRequested:
+		var body nathejk.NathejkMailRequested
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		return t.requested(msg, subj, string(body.PingType), string(body.TeamID), string(body.Recipient), body.Template, &body)
+	case subj.Verb == subject.VerbSms && subj.SubVerbs[0] == subject.VerbSent:
+		var body nathejk.NathejkSmsSent
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		return t.sent(msg, subj, body.Error)
+	case subj.Verb == subject.VerbMail && subj.SubVerbs[0] == subject.VerbSent:
+		var body messages.NathejkMailSent
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		return t.sent(msg, subj, body.Error)
+	}
+	return nil
+}
+
+// requested adds the message, or marks it pending again when it is resent.
+func (t *outbox) requested(msg streaminterface.Message, subj subject.Subject, pingType, teamID, recipient, content string, body any) error {
+	request, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	sql := "INSERT INTO outbox SET messageId=%q, kind=%q, pingType=%q, teamId=%q, recipient=%q, content=%q, request=%q, status=%q, error=NULL, requestedAt=%q, sentAt=NULL ON DUPLICATE KEY UPDATE request=VALUES(request), status=VALUES(status), error=NULL, requestedAt=VALUES(requestedAt), sentAt=NULL"
+	args := []any{
+		subj.ID,
+		subj.Verb,
+		pingType,
+		teamID,
+		recipient,
+		content,
+		string(request),
+		OutboxPending,
+		msg.Time().UTC().Format(time.RFC3339),
+	}
+	return t.w.Consume(fmt.Sprintf(sql, args...))
+}
+
+func (t *outbox) sent(msg streaminterface.Message, subj subject.Subject, sendErr string) error {
+	if sendErr == "" {
+		sql := "UPDATE outbox SET status=%q, error=NULL, sentAt=%q WHERE messageId=%q"
+		return t.w.Consume(fmt.Sprintf(sql, OutboxSent, msg.Time().UTC().Format(time.RFC3339), subj.ID))
+	}
+	sql := "UPDATE outbox SET status=%q, error=%q, sentAt=NULL WHERE messageId=%q"
+	return t.w.Consume(fmt.Sprintf(sql, OutboxFailed, sendErr, subj.ID))
+}
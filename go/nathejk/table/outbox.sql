@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    messageId VARCHAR(99) NOT NULL,
+    kind VARCHAR(9) NOT NULL,
+    pingType VARCHAR(99) NOT NULL DEFAULT "",
+    teamId VARCHAR(99) NOT NULL DEFAULT "",
+    recipient VARCHAR(99) NOT NULL,
+    content TEXT NOT NULL,
+    request TEXT NOT NULL,
+    status VARCHAR(9) NOT NULL,
+    error VARCHAR(999),
+    requestedAt VARCHAR(99) NOT NULL,
+    sentAt VARCHAR(99),
+    PRIMARY KEY (messageId)
+);
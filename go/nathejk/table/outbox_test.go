@@ -0,0 +1,68 @@
+package table_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/stretchr/testify/assert"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestOutbox(t *testing.T) {
+	sentAt := signedUpAt.Add(time.Minute)
+	p := tablerowtest.NewPkgProjection(t, table.NewOutbox)
+	p.Given(
+		tablerowtest.Event{
+			Subject: subject.OutboxRequested("2024", "msg-1", subject.VerbSms).String(),
+			Time:    signedUpAt,
+			Body:    nathejk.NathejkSmsRequested{MessageID: "msg-1", PingType: "validate", TeamID: "team-1", Phone: "12345678", Text: "Din pinkode er 1234"},
+		},
+		tablerowtest.Event{
+			Subject: subject.OutboxRequested("2024", "msg-2", subject.VerbMail).String(),
+			Time:    signedUpAt,
+			Body:    nathejk.NathejkMailRequested{MessageID: "msg-2", PingType: "signup", TeamID: "team-1", Recipient: "anna@example.com", Template: "verify_email.tmpl"},
+		},
+		tablerowtest.Event{
+			Subject: subject.OutboxRequested("2024", "msg-3", subject.VerbSms).String(),
+			Time:    signedUpAt,
+			Body:    nathejk.NathejkSmsRequested{MessageID: "msg-3", Phone: "87654321", Text: "Betal her"},
+		},
+		tablerowtest.Event{
+			Subject: subject.OutboxSent("2024", "msg-1", subject.VerbSms).String(),
+			Time:    sentAt,
+			Body:    nathejk.NathejkSmsSent{MessageID: "msg-1", Error: "provider down"},
+		},
+		tablerowtest.Event{
+			Subject: subject.OutboxSent("2024", "msg-2", subject.VerbMail).String(),
+			Time:    sentAt,
+			Body:    messages.NathejkMailSent{MessageID: "msg-2"},
+		},
+	)
+	p.ThenRows("outbox",
+		tablerowtest.Row{"messageId": "msg-1", "kind": "sms", "pingType": "validate", "teamId": "team-1", "recipient": "12345678", "content": "Din pinkode er 1234", "status": "failed", "error": "provider down"},
+		tablerowtest.Row{"messageId": "msg-2", "kind": "mail", "recipient": "anna@example.com", "content": "verify_email.tmpl", "status": "sent", "sentAt": "2024-08-01T12:01:00Z"},
+		tablerowtest.Row{"messageId": "msg-3", "kind": "sms", "status": "pending"},
+	)
+	rows := p.DB().Rows("outbox")
+	assert.NotContains(t, rows[0], "sentAt")
+	assert.Contains(t, rows[0]["request"], `"text":"Din pinkode er 1234"`)
+	assert.NotContains(t, rows[2], "error")
+
+	// Resending a failed message makes it pending again.
+	p.Given(tablerowtest.Event{
+		Subject: subject.OutboxRequested("2024", "msg-1", subject.VerbSms).String(),
+		Time:    sentAt.Add(time.Hour),
+		Body:    nathejk.NathejkSmsRequested{MessageID: "msg-1", PingType: "validate", TeamID: "team-1", Phone: "12345678", Text: "Din pinkode er 1234"},
+	})
+	p.ThenRows("outbox",
+		tablerowtest.Row{"messageId": "msg-1", "status": "pending", "requestedAt": "2024-08-01T13:01:00Z"},
+		tablerowtest.Row{"messageId": "msg-2", "status": "sent"},
+		tablerowtest.Row{"messageId": "msg-3", "status": "pending"},
+	)
+	assert.NotContains(t, p.DB().Rows("outbox")[0], "error")
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
 	"nathejk.dk/pkg/tablerow"
 	"nathejk.dk/superfluids/streaminterface"
 
@@ -34,12 +36,21 @@ func NewPatrulje(w tablerow.Consumer) *patrulje {
 	if err := w.Consume(table.CreateTableSql()); err != nil {
 		log.Fatalf("Error creating table %q", err)
 	}
+	if err := migrate(w, patruljeMigrations...); err != nil {
+		log.Fatalf("Error migrating table %q", err)
+	}
 	return table
 }
 
 //go:embed patrulje.sql
 var patruljeSchema string
 
+// patruljeMigrations add the columns of patrulje.sql missing in tables
+// created before them.
+var patruljeMigrations = []string{
+	`ALTER TABLE patrulje ADD COLUMN IF NOT EXISTS contactBirthday VARCHAR(10) NOT NULL DEFAULT ""`,
+}
+
 func (t *patrulje) CreateTableSql() string {
 	return patruljeSchema
 }
@@ -48,15 +59,18 @@ func (c *patrulje) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
 		//streaminterface.SubjectFromStr("monolith:nathejk_team"),
 		//streaminterface.SubjectFromStr("nathejk"),
-		streaminterface.SubjectFromStr("NATHEJK:2024.patrulje.*.updated"),
-		streaminterface.SubjectFromStr("NATHEJK:2024.patrulje.*.signedup"),
+		streaminterface.SubjectFromStr(subject.New("2024", subject.Patrulje, subject.Any, subject.VerbUpdated).String()),
+		streaminterface.SubjectFromStr(subject.New("2024", subject.Patrulje, subject.Any, subject.VerbSignedup).String()),
+		streaminterface.SubjectFromStr(subject.RosterUpdated(subject.Any, types.TeamTypePatrulje, subject.Any).String()),
+		streaminterface.SubjectFromStr(subject.NumberAssigned(subject.Any, types.TeamTypePatrulje, subject.Any).String()),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbStatus, subject.VerbChanged).String()),
 	}
 }
 
 func (c *patrulje) HandleMessage(msg streaminterface.Message) error {
 	//log.Printf("patrulje.go RECEIVED %q", msg.Subject().Subject())
 	switch true {
-	case msg.Subject().Match("NATHEJK.*.patrulje.*.signedup"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbSignedup).Pattern()):
 		var body messages.NathejkTeamSignedUp
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -79,31 +93,49 @@ func (c *patrulje) HandleMessage(msg streaminterface.Message) error {
 			log.Fatalf("Error consuming sql %q", err)
 		}
 
-	case msg.Subject().Match("nathejk:patrulje.status.changed"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbStatus, subject.VerbChanged).Pattern()):
 		var body messages.NathejkPatruljeStatusChanged
 		if err := msg.Body(&body); err != nil {
 			return err
 		}
-		err := c.w.Consume(fmt.Sprintf("UPDATE klan SET signupStatus=%q WHERE teamId=%q", body.Status, body.TeamID))
+		err := c.w.Consume(fmt.Sprintf("UPDATE patrulje SET signupStatus=%q WHERE teamId=%q", body.Status, body.TeamID))
 		if err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		}
-	case msg.Subject().Match("NATHEJK.*.patrulje.*.updated"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Patrulje, subject.Any, subject.VerbUpdated).Pattern()):
 		var body messages.NathejkTeamUpdated
 		if err := msg.Body(&body); err != nil {
 			return err
 		}
-		msg.Subject().Parts()
-		query := "UPDATE patrulje SET name=%q, groupName=%q, korps=%q, liga=%q, contactName=%q, contactPhone=%q, contactEmail=%q, contactRole=%q WHERE teamId=%q"
-		args := []any{body.Name, body.GroupName, body.Korps, body.AdvspejdNumber, body.ContactName, body.ContactPhone, body.ContactEmail, body.ContactRole, body.TeamID}
 		//query := "INSERT INTO patrulje SET teamId=%q, year=\"%d\", contactName=%q, contactPhone=%q, contactEmail=%q ON DUPLICATE KEY UPDATE contactName=VALUES(contactName), conta    ctPhone=VALUES(contactPhone), contactEmail=VALUES(contactEmail)"
 		//args := []any{body.TeamID, msg.Time().Year(), body.Name, body.Phone, body.Email}
 		//, body.Name, body.GroupName, body.Korps, body.ContactName, body.ContactPhone, body.ContactEmail, body.ContactRole, body.TeamID))
 
-		err := c.w.Consume(fmt.Sprintf(query, args...))
+		err := c.w.Consume(patruljeUpdate(body))
+		if err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
+	case msg.Subject().Match(subject.NumberAssigned(subject.Any, types.TeamTypePatrulje, subject.Any).Pattern()):
+		var body nathejk.NathejkTeamNumberAssigned
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		err := c.w.Consume(fmt.Sprintf("UPDATE patrulje SET teamNumber=\"%d\" WHERE teamId=%q", body.TeamNumber, body.TeamID))
 		if err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		}
+	case msg.Subject().Match(subject.RosterUpdated(subject.Any, types.TeamTypePatrulje, subject.Any).Pattern()):
+		var body nathejk.NathejkTeamRosterUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		queries := []string{
+			patruljeUpdate(body.Team),
+			fmt.Sprintf("UPDATE patrulje SET contactBirthday=%q WHERE teamId=%q", body.ContactBirthDate, body.Team.TeamID),
+		}
+		if err := tablerow.ConsumeAll(c.w, queries...); err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
 	default:
 		log.Printf("Unhandled message %q", msg.Subject().Subject())
 		/*
@@ -155,3 +187,10 @@ func (c *patrulje) HandleMessage(msg streaminterface.Message) error {
 	}
 	return nil
 }
+
+// patruljeUpdate returns the statement writing the team and contact of body.
+func patruljeUpdate(body messages.NathejkTeamUpdated) string {
+	query := "UPDATE patrulje SET name=%q, groupName=%q, korps=%q, liga=%q, contactName=%q, contactPhone=%q, contactEmail=%q, contactRole=%q WHERE teamId=%q"
+	args := []any{body.Name, body.GroupName, body.Korps, body.AdvspejdNumber, body.ContactName, body.ContactPhone, body.ContactEmail, body.ContactRole, body.TeamID}
+	return fmt.Sprintf(query, args...)
+}
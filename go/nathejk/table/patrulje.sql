@@ -11,6 +11,7 @@ CREATE TABLE IF NOT EXISTS patrulje (
     contactPhone VARCHAR(99) NOT NULL DEFAULT "",
     contactEmail VARCHAR(99) NOT NULL DEFAULT "",
     contactRole VARCHAR(99) NOT NULL DEFAULT "",
+    contactBirthday VARCHAR(10) NOT NULL DEFAULT "",
     signupStatus VARCHAR(9) NOT NULL DEFAULT "",
     PRIMARY KEY (teamId)
 );
@@ -0,0 +1,106 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestPatrulje(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewPatrulje).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			tablerowtest.Event{
+				Subject: subject.Team("2024", types.TeamTypePatrulje, "team-1", subject.VerbUpdated).String(),
+				Body: messages.NathejkTeamUpdated{
+					TeamID:         "team-1",
+					Name:           "Ræverne",
+					GroupName:      "1. Gruppe",
+					Korps:          "kfum",
+					AdvspejdNumber: "42",
+					ContactName:    "Anna Andersen",
+					ContactPhone:   "87654321",
+					ContactEmail:   "anna@example.com",
+					ContactRole:    "leder",
+				},
+			},
+		).
+		ThenRows("patrulje",
+			tablerowtest.Row{"teamId": "team-1", "year": "2024", "name": "Ræverne", "groupName": "1. Gruppe", "korps": "kfum", "liga": "42", "contactName": "Anna Andersen", "contactPhone": "87654321", "contactEmail": "anna@example.com", "contactRole": "leder"},
+		)
+}
+
+func TestPatruljeRoster(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewPatrulje).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			tablerowtest.Event{
+				Subject: subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1").String(),
+				Body: nathejk.NathejkTeamRosterUpdated{
+					Team:             messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ræverne", ContactName: "Anna Andersen", ContactRole: "leder"},
+					ContactBirthDate: "1990-05-01",
+				},
+			},
+		).
+		ThenRows("patrulje",
+			tablerowtest.Row{"teamId": "team-1", "name": "Ræverne", "contactName": "Anna Andersen", "contactRole": "leder", "contactBirthday": "1990-05-01"},
+		)
+}
+
+func TestPatruljeStatusChanged(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewPatrulje).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			tablerowtest.Event{
+				Subject: subject.StatusChanged("2024", types.TeamTypePatrulje, "team-1").String(),
+				Body:    messages.NathejkPatruljeStatusChanged{TeamID: "team-1", Status: types.SignupStatusPaid},
+			},
+			tablerowtest.Event{
+				Subject: subject.NumberAssigned("2024", types.TeamTypePatrulje, "team-1").String(),
+				Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 7},
+			},
+		).
+		ThenRows("patrulje",
+			tablerowtest.Row{"teamId": "team-1", "teamNumber": "7", "signupStatus": string(types.SignupStatusPaid)},
+		)
+}
+
+func TestPatruljeStatus(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewPatruljeStatus).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+		).
+		ThenRows("patruljestatus",
+			tablerowtest.Row{"teamId": "team-1", "year": "2024", "startedUts": "1"},
+		)
+}
+
+func TestPatruljeMigrate(t *testing.T) {
+	db := tablerowtest.New()
+	// The table as created before the contact had a birthday.
+	err := db.Consume(`CREATE TABLE IF NOT EXISTS patrulje (
+		teamId VARCHAR(99) NOT NULL,
+		year VARCHAR(99) NOT NULL DEFAULT "",
+		name VARCHAR(99) NOT NULL DEFAULT "",
+		PRIMARY KEY (teamId)
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Consume(`INSERT INTO patrulje SET teamId="team-1", year="2024", name="Ræverne"`); err != nil {
+		t.Fatal(err)
+	}
+
+	table.NewPatrulje(db)
+	table.NewPatrulje(db)
+	assert.Equal(t, []tablerowtest.Row{{"teamId": "team-1", "year": "2024", "name": "Ræverne", "contactBirthday": ""}}, db.Rows("patrulje"))
+	assert.NoError(t, db.Consume(`UPDATE patrulje SET contactBirthday="1990-01-01" WHERE teamId="team-1"`))
+}
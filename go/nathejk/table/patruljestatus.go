@@ -6,6 +6,7 @@ import (
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	"nathejk.dk/nathejk/subject"
 	"nathejk.dk/pkg/tablerow"
 	"nathejk.dk/superfluids/streaminterface"
 
@@ -46,7 +47,7 @@ func (t *patruljeStatus) CreateTableSql() string {
 
 func (c *patruljeStatus) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
-		streaminterface.SubjectFromStr("NATHEJK:*.*.*.signedup"),
+		streaminterface.SubjectFromStr(subject.Signedup.String()),
 		//streaminterface.SubjectFromStr("monolith:nathejk_team"),
 	}
 }
@@ -60,7 +61,11 @@ func (c *patruljeStatus) HandleMessage(msg streaminterface.Message) error {
 		}
 	*/
 	switch true {
-	case msg.Subject().Match("NATHEJK.*.*.*.signedup"):
+	case msg.Subject().Match(subject.Signedup.Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
 		var body messages.NathejkTeamSignedUp
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -84,7 +89,7 @@ func (c *patruljeStatus) HandleMessage(msg streaminterface.Message) error {
 		//			year := time.Unix(uts, 0).Year()
 		//startedUts, _ := strconv.Atoi(body.Entity.StartUts)
 		query := "INSERT INTO patruljestatus SET teamId=%q, year=%q, startedUts=%d ON DUPLICATE KEY UPDATE startedUts=VALUES(startedUts)"
-		args := []any{body.TeamID, msg.Subject().Parts()[1], 1}
+		args := []any{body.TeamID, subj.Year, 1}
 		if err := c.w.Consume(fmt.Sprintf(query, args...)); err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		}
@@ -50,6 +50,11 @@ func (t *personnel) CreateTableSql() string {
 	return personnelSchema
 }
 
+// Reset empties the table before the projection is rebuilt.
+func (t *personnel) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE personnel")
+}
+
 func (c *personnel) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
 		streaminterface.SubjectFromStr("nathejk"),
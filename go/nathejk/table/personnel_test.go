@@ -0,0 +1,47 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+	"nathejk.dk/pkg/tablerow"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestPersonnel(t *testing.T) {
+	changes := streamtest.NewRecorder()
+	p := tablerowtest.NewPkgProjection(t, func(w tablerow.Consumer) streaminterface.MessageHandler {
+		return table.NewPersonnel(w, changes)
+	})
+	p.Given(
+		tablerowtest.Event{
+			Subject: "nathejk:personnel.updated",
+			Body:    messages.NathejkPersonnelUpdated{UserID: "user-1", Phone: "12345678", Pincode: "1234"},
+		},
+		tablerowtest.Event{
+			Subject: "nathejk:personnel.updated",
+			Body:    messages.NathejkPersonnelUpdated{UserID: "user-1", Name: "Anna", Phone: "12345678", HqAccess: true, Department: "hq"},
+		},
+		tablerowtest.Event{
+			Subject: "nathejk:personnel.updated",
+			Body:    messages.NathejkPersonnelUpdated{UserID: "user-2", Name: "Bo", Phone: "87654321"},
+		},
+		tablerowtest.Event{
+			Subject: "nathejk:personnel.deleted",
+			Body:    messages.NathejkPersonnelDeleted{UserID: "user-2"},
+		},
+	).ThenRows("personnel",
+		tablerowtest.Row{"userId": "user-1", "name": "Anna", "phone": string(types.PhoneNumber("12345678").Normalize()), "pincode": "1234", "hqAccess": "1", "department": "hq"},
+	)
+	changes.Then(t,
+		streamtest.Expect{Subject: "personnel.table:updated"},
+		streamtest.Expect{Subject: "personnel.table:updated"},
+		streamtest.Expect{Subject: "personnel.table:updated"},
+		streamtest.Expect{Subject: "personnel.table:deleted", Body: table.PersonnelTableEvent{UserID: "user-2"}},
+	)
+}
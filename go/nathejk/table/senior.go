@@ -7,6 +7,8 @@ import (
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
 	"nathejk.dk/pkg/tablerow"
 	"nathejk.dk/superfluids/streaminterface"
 
@@ -48,46 +50,64 @@ func (t *senior) CreateTableSql() string {
 
 func (c *senior) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
-		streaminterface.SubjectFromStr("NATHEJK.*.senior.*.updated"),
-		streaminterface.SubjectFromStr("NATHEJK.*.senior.*.deleted"),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Senior, subject.Any, subject.VerbUpdated).String()),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Senior, subject.Any, subject.VerbDeleted).String()),
+		streaminterface.SubjectFromStr(subject.RosterUpdated(subject.Any, types.TeamTypeKlan, subject.Any).String()),
 		//streaminterface.SubjectFromStr("monolith:nathejk_member"),
 	}
 }
 
 func (c *senior) HandleMessage(msg streaminterface.Message) error {
 	switch true {
-	case msg.Subject().Match("nathejk.*.senior.*.updated"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Senior, subject.Any, subject.VerbUpdated).Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
 		var body messages.NathejkSeniorUpdated
 		if err := msg.Body(&body); err != nil {
 			return err
 		}
-		query := `INSERT INTO senior
-			(memberId, year, teamId, name, address, postalCode, city, email, phone, birthday, tshirtSize, diet,  createdAt, updatedAt)
-			VALUES (%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q)
-			ON DUPLICATE KEY UPDATE
-			teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city), email=VALUES(email), phone=VALUES(phone), birthday=VALUES(birthday), tshirtSize=VALUES(tshirtSize), diet=VALUES(diet), updatedAt=VALUES(updatedAt)`
-		args := []any{
-			body.MemberID,
-			msg.Subject().Parts()[1],
-			body.TeamID,
-			body.Name,
-			body.Address,
-			body.PostalCode,
-			body.City,
-			body.Email,
-			body.Phone,
-			body.BirthDate,
-			body.TShirtSize,
-			body.Diet,
-			msg.Time(),
-			msg.Time(),
-		}
-		err := c.w.Consume(fmt.Sprintf(query, args...))
+		err = c.w.Consume(seniorUpsert(subj.Year, body, msg.Time()))
 		//"INSERT INTO spejder (memberId, year, teamId, name, address, postalCode, city, email, phone, phoneParent, birthday, `returning`, createdAt, updatedAt) VALUES (%q,\"%d\",%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q) ON DUPLICATE KEY UPDATE teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city),email=VALUES(email),phone=VALUES(phone), phoneParent=VALUES(phoneParent), birthday=VALUES(birthday), `returning`=VALUES(`returning`),  updatedAt=VALUES(updatedAt)", body.MemberID, msg.Time().Year(), body.TeamID, body.Name, body.Address, body.PostalCode, body.City, body.Email, body.Phone, body.PhoneParent, body.Birthday, returning, msg.Time(), msg.Time()))
 		if err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		} //*/
-	case msg.Subject().Match("nathejk.*.senior.*.deleted"):
+	case msg.Subject().Match(subject.RosterUpdated(subject.Any, types.TeamTypeKlan, subject.Any).Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
+		var body nathejk.NathejkTeamRosterUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		// The roster is written in one transaction, so the team is never
+		// seen with half of its members updated.
+		queries := []string{}
+		for _, m := range body.Members {
+			queries = append(queries, seniorUpsert(subj.Year, messages.NathejkSeniorUpdated{
+				MemberID:   m.MemberID,
+				TeamID:     subj.TeamID(),
+				Name:       m.Name,
+				Address:    m.Address,
+				PostalCode: m.PostalCode,
+				City:       m.City,
+				Email:      m.Email,
+				Phone:      m.Phone,
+				BirthDate:  m.BirthDate,
+				Returning:  m.Returning,
+				TShirtSize: m.TShirtSize,
+				Diet:       m.Diet,
+			}, msg.Time()))
+		}
+		for _, memberID := range body.Deleted {
+			queries = append(queries, fmt.Sprintf("DELETE FROM senior WHERE memberId=%q", memberID))
+		}
+		if err := tablerow.ConsumeAll(c.w, queries...); err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
+	case msg.Subject().Match(subject.New(subject.Any, subject.Senior, subject.Any, subject.VerbDeleted).Pattern()):
 		var body messages.NathejkMemberDeleted
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -144,3 +164,29 @@ func (c *senior) HandleMessage(msg streaminterface.Message) error {
 	}
 	return nil
 }
+
+// seniorUpsert returns the statement writing the senior of body.
+func seniorUpsert(year string, body messages.NathejkSeniorUpdated, at time.Time) string {
+	query := `INSERT INTO senior
+		(memberId, year, teamId, name, address, postalCode, city, email, phone, birthday, tshirtSize, diet,  createdAt, updatedAt)
+		VALUES (%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q)
+		ON DUPLICATE KEY UPDATE
+		teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city), email=VALUES(email), phone=VALUES(phone), birthday=VALUES(birthday), tshirtSize=VALUES(tshirtSize), diet=VALUES(diet), updatedAt=VALUES(updatedAt)`
+	args := []any{
+		body.MemberID,
+		year,
+		body.TeamID,
+		body.Name,
+		body.Address,
+		body.PostalCode,
+		body.City,
+		body.Email,
+		body.Phone,
+		body.BirthDate,
+		body.TShirtSize,
+		body.Diet,
+		at,
+		at,
+	}
+	return fmt.Sprintf(query, args...)
+}
@@ -0,0 +1,55 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestSenior(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewSenior).
+		Given(
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Senior, "member-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkSeniorUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Bo", Email: "bo@example.com", Diet: "vegan"},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Senior, "member-2", subject.VerbUpdated).String(),
+				Body:    messages.NathejkSeniorUpdated{MemberID: "member-2", TeamID: "team-1", Name: "Carl"},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Senior, "member-1", subject.VerbDeleted).String(),
+				Body:    messages.NathejkMemberDeleted{MemberID: "member-1", TeamID: "team-1"},
+			},
+		).
+		ThenRows("senior",
+			tablerowtest.Row{"memberId": "member-2", "year": "2024", "teamId": "team-1", "name": "Carl", "diet": ""},
+		)
+}
+
+func TestSeniorRoster(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewSenior).
+		Given(
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Senior, "member-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkSeniorUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Bo"},
+			},
+			tablerowtest.Event{
+				Subject: subject.RosterUpdated("2024", types.TeamTypeKlan, "team-1").String(),
+				Body: nathejk.NathejkTeamRosterUpdated{
+					Team:    messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ulvene"},
+					Members: []nathejk.NathejkRosterMember{{MemberID: "member-2", Name: "Carl", Diet: "vegan"}},
+					Deleted: []types.MemberID{"member-1"},
+				},
+			},
+		).
+		ThenRows("senior",
+			tablerowtest.Row{"memberId": "member-2", "year": "2024", "teamId": "team-1", "name": "Carl", "diet": "vegan"},
+		)
+}
@@ -5,8 +5,10 @@ import (
 	"log"
 
 	"github.com/nathejk/shared-go/messages"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
 	"nathejk.dk/pkg/tablerow"
-	"nathejk.dk/superfluids/streaminterface"
 )
 
 type signup struct {
@@ -38,16 +40,24 @@ CREATE TABLE IF NOT EXISTS signup (
 `
 }
 
+// Reset empties the table before the projection is rebuilt.
+func (t *signup) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE signup")
+}
+
 func (t *signup) Consumes() []streaminterface.Subject {
 	return []streaminterface.Subject{
-		streaminterface.SubjectFromStr("NATHEJK:*.*.*.signedup"),
+		streaminterface.SubjectFromStr(subject.Domain),
 	}
 }
 
 func (t *signup) HandleMessage(msg streaminterface.Message) error {
-	switch true {
-	case msg.Subject().Match("NATHEJK.*.*.*.signedup"):
-		//case "NATHEJK.year.created":
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || (subj.Entity != subject.Patrulje && subj.Entity != subject.Klan) {
+		return nil
+	}
+	switch {
+	case subj.Verb == subject.VerbSignedup:
 		var body messages.NathejkTeamSignedUp
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -55,7 +65,7 @@ func (t *signup) HandleMessage(msg streaminterface.Message) error {
 		sql := "INSERT INTO signup SET teamId=%q, teamType=%q, name=%q, emailPending=%q, phonePending=%q, pincode=%q, createdAt=%q ON DUPLICATE KEY UPDATE name=VALUES(name), emailPending=VALUES(emailPending), phonePending=VALUES(phonePending), pincode=VALUES(pincode)"
 		args := []any{
 			body.TeamID,
-			msg.Subject().Parts()[2],
+			subj.TeamType(),
 			body.Name,
 			body.Email,
 			body.Phone,
@@ -65,6 +75,26 @@ func (t *signup) HandleMessage(msg streaminterface.Message) error {
 		if err := t.w.Consume(fmt.Sprintf(sql, args...)); err != nil {
 			return err
 		}
+	case subj.Verb == subject.VerbEmail && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbConfirmed:
+		// The pending address is confirmed, unless the team has signed up
+		// with another address since.
+		var body nathejk.NathejkEmailConfirmed
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		sql := "UPDATE signup SET email=%q WHERE teamId=%q AND emailPending=%q"
+		if err := t.w.Consume(fmt.Sprintf(sql, body.Email, subj.ID, body.Email)); err != nil {
+			return err
+		}
+	case subj.Verb == subject.VerbPhone && len(subj.SubVerbs) == 1 && subj.SubVerbs[0] == subject.VerbConfirmed:
+		var body nathejk.NathejkPhoneNumberConfirmed
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		sql := "UPDATE signup SET phone=%q WHERE teamId=%q AND phonePending=%q"
+		if err := t.w.Consume(fmt.Sprintf(sql, body.Phone, subj.ID, body.Phone)); err != nil {
+			return err
+		}
 		//default:
 		//	return fmt.Errorf("unhandled subject %q", msg.Subject().Subject())
 	}
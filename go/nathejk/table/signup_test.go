@@ -0,0 +1,130 @@
+package table_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+	"github.com/stretchr/testify/assert"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	nathejktypes "nathejk.dk/nathejk/types"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+var signedUpAt = time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+func signedUp(teamType types.TeamType, teamID types.TeamID, name string) tablerowtest.Event {
+	return tablerowtest.Event{
+		Subject: subject.Team("2024", teamType, teamID, subject.VerbSignedup).String(),
+		Time:    signedUpAt,
+		Body: messages.NathejkTeamSignedUp{
+			TeamID:  teamID,
+			Name:    name,
+			Email:   types.EmailAddress(string(teamID) + "@example.com"),
+			Phone:   "12345678",
+			Pincode: "1234",
+		},
+	}
+}
+
+func TestSignup(t *testing.T) {
+	tablerowtest.NewPkgProjection(t, table.NewSignup).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			signedUp(types.TeamTypeKlan, "team-2", "Bo"),
+			signedUp(types.TeamTypePatrulje, "team-1", "Anne"),
+		).
+		ThenRows("signup",
+			tablerowtest.Row{"teamId": "team-1", "teamType": "patrulje", "name": "Anne", "emailPending": "team-1@example.com", "phonePending": "12345678", "pincode": "1234", "createdAt": signedUpAt.String()},
+			tablerowtest.Row{"teamId": "team-2", "teamType": "klan", "name": "Bo", "emailPending": "team-2@example.com"},
+		)
+}
+
+func emailConfirmed(teamType types.TeamType, teamID types.TeamID, email string) tablerowtest.Event {
+	return tablerowtest.Event{
+		Subject: subject.EmailConfirmed("2024", teamType, teamID).String(),
+		Time:    signedUpAt.Add(time.Hour),
+		Body:    nathejk.NathejkEmailConfirmed{TeamID: nathejktypes.TeamID(teamID), Email: nathejktypes.Email(email)},
+	}
+}
+
+func TestSignupEmailConfirmed(t *testing.T) {
+	p := tablerowtest.NewPkgProjection(t, table.NewSignup).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			signedUp(types.TeamTypeKlan, "team-2", "Bo"),
+			emailConfirmed(types.TeamTypePatrulje, "team-1", "team-1@example.com"),
+			// The address confirmed is no longer the one pending.
+			emailConfirmed(types.TeamTypeKlan, "team-2", "bo@example.com"),
+		)
+	p.ThenRows("signup",
+		tablerowtest.Row{"teamId": "team-1", "emailPending": "team-1@example.com", "email": "team-1@example.com"},
+		tablerowtest.Row{"teamId": "team-2", "emailPending": "team-2@example.com"},
+	)
+	assert.NotContains(t, p.DB().Rows("signup")[1], "email")
+}
+
+func TestSignupPhoneConfirmed(t *testing.T) {
+	p := tablerowtest.NewPkgProjection(t, table.NewSignup).
+		Given(
+			signedUp(types.TeamTypePatrulje, "team-1", "Anna"),
+			signedUp(types.TeamTypeKlan, "team-2", "Bo"),
+			tablerowtest.Event{
+				Subject: subject.PhoneConfirmed("2024", types.TeamTypePatrulje, "team-1").String(),
+				Body:    nathejk.NathejkPhoneNumberConfirmed{TeamID: "team-1", Phone: "12345678"},
+			},
+			// The number confirmed is no longer the one pending.
+			tablerowtest.Event{
+				Subject: subject.PhoneConfirmed("2024", types.TeamTypeKlan, "team-2").String(),
+				Body:    nathejk.NathejkPhoneNumberConfirmed{TeamID: "team-2", Phone: "87654321"},
+			},
+		)
+	p.ThenRows("signup",
+		tablerowtest.Row{"teamId": "team-1", "phonePending": "12345678", "phone": "12345678"},
+		tablerowtest.Row{"teamId": "team-2", "phonePending": "12345678"},
+	)
+	assert.NotContains(t, p.DB().Rows("signup")[1], "phone")
+}
+
+func mailSent(teamID types.TeamID, recipient types.EmailAddress, secret string, at time.Time) tablerowtest.Event {
+	return tablerowtest.Event{
+		Subject: subject.MailSent("2024", types.TeamTypePatrulje, teamID, types.PingTypeSignup).String(),
+		Time:    at,
+		Body:    messages.NathejkMailSent{TeamID: teamID, Recipient: recipient},
+		Meta:    messages.Metadata{Producer: "deltag-api", Phase: secret},
+	}
+}
+
+func outboxMailSent(teamID types.TeamID, recipient types.EmailAddress, secret, sendErr string, at time.Time) tablerowtest.Event {
+	return tablerowtest.Event{
+		Subject: subject.OutboxSent("2024", "msg-"+secret, subject.VerbMail).String(),
+		Time:    at,
+		Body:    messages.NathejkMailSent{MessageID: "msg-" + secret, PingType: types.PingTypeSignup, TeamID: teamID, Recipient: recipient, Secret: secret, Error: sendErr},
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	resentAt := signedUpAt.Add(48 * time.Hour)
+	p := tablerowtest.NewPkgProjection(t, table.NewConfirm).
+		Given(
+			mailSent("team-1", "anna@example.com", "secret-1", signedUpAt),
+			emailConfirmed(types.TeamTypePatrulje, "team-1", "anna@example.com"),
+			mailSent("team-2", "bo@example.com", "secret-2", signedUpAt),
+			// A new mail replaces the secret of the first.
+			mailSent("team-2", "bo@example.com", "secret-3", resentAt),
+			// The outbox sends the secret in the body, and a mail it could
+			// not send leaves the last link working.
+			outboxMailSent("team-3", "cai@example.com", "secret-4", "", signedUpAt),
+			outboxMailSent("team-3", "cai@example.com", "secret-5", "smtp down", resentAt),
+		)
+	p.ThenRows("confirm",
+		tablerowtest.Row{"teamId": "team-1", "emailPending": "anna@example.com", "secret": "secret-1", "sentAt": "2024-08-01T12:00:00Z", "confirmedAt": "2024-08-01T13:00:00Z"},
+		tablerowtest.Row{"teamId": "team-2", "emailPending": "bo@example.com", "secret": "secret-3", "sentAt": "2024-08-03T12:00:00Z"},
+		tablerowtest.Row{"teamId": "team-3", "emailPending": "cai@example.com", "secret": "secret-4", "sentAt": "2024-08-01T12:00:00Z"},
+	)
+	assert.NotContains(t, p.DB().Rows("confirm")[1], "confirmedAt")
+}
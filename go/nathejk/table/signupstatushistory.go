@@ -0,0 +1,64 @@
+package table
+
+import (
+	"fmt"
+	"log"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/tablerow"
+
+	_ "embed"
+)
+
+// signupStatusHistory keeps every signup status change of the patruljer and
+// klaner, with the reason given.
+type signupStatusHistory struct {
+	w tablerow.Consumer
+}
+
+func NewSignupStatusHistory(w tablerow.Consumer) *signupStatusHistory {
+	table := &signupStatusHistory{w: w}
+	if err := w.Consume(table.CreateTableSql()); err != nil {
+		log.Fatalf("Error creating table %q", err)
+	}
+	return table
+}
+
+//go:embed signupstatushistory.sql
+var signupStatusHistorySchema string
+
+func (t *signupStatusHistory) CreateTableSql() string {
+	return signupStatusHistorySchema
+}
+
+// Reset empties the table before the projection is rebuilt.
+func (t *signupStatusHistory) Reset() error {
+	return t.w.Consume("TRUNCATE TABLE signupstatushistory")
+}
+
+func (c *signupStatusHistory) Consumes() []streaminterface.Subject {
+	return []streaminterface.Subject{
+		streaminterface.SubjectFromStr(subject.Domain),
+	}
+}
+
+func (c *signupStatusHistory) HandleMessage(msg streaminterface.Message) error {
+	subj, err := subject.Parse(msg.Subject().Subject())
+	if err != nil || (subj.Entity != subject.Patrulje && subj.Entity != subject.Klan) {
+		return nil
+	}
+	if subj.Verb != subject.VerbStatus || len(subj.SubVerbs) != 1 || subj.SubVerbs[0] != subject.VerbChanged {
+		return nil
+	}
+	var body nathejk.NathejkTeamStatusChanged
+	if err := msg.Body(&body); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("INSERT IGNORE INTO signupstatushistory SET teamId=%q, sequence=%d, year=%q, teamType=%q, signupStatus=%q, reason=%q, changedAt=%q", subj.TeamID(), msg.Sequence(), subj.Year, subj.TeamType(), body.Status, body.Reason, msg.Time())
+	if err := c.w.Consume(sql); err != nil {
+		log.Fatalf("Error consuming sql %q", err)
+	}
+	return nil
+}
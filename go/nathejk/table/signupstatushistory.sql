@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS signupstatushistory (
+    teamId VARCHAR(99) NOT NULL,
+    sequence BIGINT NOT NULL,
+    year VARCHAR(99) NOT NULL,
+    teamType VARCHAR(9) NOT NULL,
+    signupStatus VARCHAR(9) NOT NULL,
+    reason VARCHAR(999) NOT NULL DEFAULT "",
+    changedAt VARCHAR(99) NOT NULL,
+    PRIMARY KEY (teamId, sequence)
+);
@@ -0,0 +1,34 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/types"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestSignupStatusHistory(t *testing.T) {
+	tablerowtest.NewPkgProjection(t, table.NewSignupStatusHistory).
+		Given(
+			tablerowtest.Event{
+				Subject: subject.StatusChanged("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    nathejk.NathejkTeamStatusChanged{TeamID: "team-1", Status: "PAY", Reason: "signed up"},
+			},
+			tablerowtest.Event{
+				Subject: subject.StatusChanged("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    nathejk.NathejkTeamStatusChanged{TeamID: "team-1", Status: "PAID", Reason: "paid by bank transfer"},
+			},
+			tablerowtest.Event{
+				Subject: subject.NumberAssigned("2024", types.TeamTypeKlan, "team-1").String(),
+				Body:    nathejk.NathejkTeamNumberAssigned{TeamID: "team-1", TeamNumber: 501},
+			},
+		).
+		ThenRows("signupstatushistory",
+			tablerowtest.Row{"teamId": "team-1", "sequence": "1", "year": "2024", "teamType": "klan", "signupStatus": "PAY", "reason": "signed up"},
+			tablerowtest.Row{"teamId": "team-1", "sequence": "2", "year": "2024", "teamType": "klan", "signupStatus": "PAID", "reason": "paid by bank transfer"},
+		)
+}
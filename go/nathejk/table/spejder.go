@@ -7,6 +7,8 @@ import (
 
 	"github.com/nathejk/shared-go/messages"
 	"github.com/nathejk/shared-go/types"
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
 	"nathejk.dk/pkg/tablerow"
 	"nathejk.dk/superfluids/streaminterface"
 
@@ -49,51 +51,64 @@ func (t *spejder) CreateTableSql() string {
 
 func (c *spejder) Consumes() (subjs []streaminterface.Subject) {
 	return []streaminterface.Subject{
-		streaminterface.SubjectFromStr("NATHEJK.*.spejder.*.updated"),
-		streaminterface.SubjectFromStr("NATHEJK.*.spejder.*.deleted"),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Spejder, subject.Any, subject.VerbUpdated).String()),
+		streaminterface.SubjectFromStr(subject.New(subject.Any, subject.Spejder, subject.Any, subject.VerbDeleted).String()),
+		streaminterface.SubjectFromStr(subject.RosterUpdated(subject.Any, types.TeamTypePatrulje, subject.Any).String()),
 		//streaminterface.SubjectFromStr("monolith:nathejk_member"),
 	}
 }
 
 func (c *spejder) HandleMessage(msg streaminterface.Message) error {
 	switch true {
-	case msg.Subject().Match("nathejk.*.spejder.*.updated"):
+	case msg.Subject().Match(subject.New(subject.Any, subject.Spejder, subject.Any, subject.VerbUpdated).Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
 		var body messages.NathejkScoutUpdated
 		if err := msg.Body(&body); err != nil {
 			return err
 		}
-		returning := "0"
-		if body.Returning {
-			returning = "1"
-		}
-		query := `INSERT INTO spejder
-			(memberId, year, teamId, name, address, postalCode, city, email, phone, phoneParent, birthday, tshirtSize, ` + "`returning`," + ` createdAt, updatedAt)
-			VALUES (%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%s,%q,%q)
-			ON DUPLICATE KEY UPDATE
-			teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city), email=VALUES(email), phone=VALUES(phone), phoneParent=VALUES(phoneParent), birthday=VALUES(birthday), tshirtSize=VALUES(tshirtSize), ` + "`returning`=VALUES(`returning`)," + ` updatedAt=VALUES(updatedAt)`
-		args := []any{
-			body.MemberID,
-			msg.Subject().Parts()[1],
-			body.TeamID,
-			body.Name,
-			body.Address,
-			body.PostalCode,
-			body.City,
-			body.Email,
-			body.Phone,
-			body.PhoneContact,
-			body.BirthDate,
-			body.TShirtSize,
-			returning,
-			msg.Time(),
-			msg.Time(),
-		}
-		err := c.w.Consume(fmt.Sprintf(query, args...))
+		err = c.w.Consume(spejderUpsert(subj.Year, body, msg.Time()))
 		//"INSERT INTO spejder (memberId, year, teamId, name, address, postalCode, city, email, phone, phoneParent, birthday, `returning`, createdAt, updatedAt) VALUES (%q,\"%d\",%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q) ON DUPLICATE KEY UPDATE teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city),email=VALUES(email),phone=VALUES(phone), phoneParent=VALUES(phoneParent), birthday=VALUES(birthday), `returning`=VALUES(`returning`),  updatedAt=VALUES(updatedAt)", body.MemberID, msg.Time().Year(), body.TeamID, body.Name, body.Address, body.PostalCode, body.City, body.Email, body.Phone, body.PhoneParent, body.Birthday, returning, msg.Time(), msg.Time()))
 		if err != nil {
 			log.Fatalf("Error consuming sql %q", err)
 		} //*/
-	case msg.Subject().Match("nathejk.*.spejder.*.deleted"):
+	case msg.Subject().Match(subject.RosterUpdated(subject.Any, types.TeamTypePatrulje, subject.Any).Pattern()):
+		subj, err := subject.Parse(msg.Subject().Subject())
+		if err != nil {
+			return err
+		}
+		var body nathejk.NathejkTeamRosterUpdated
+		if err := msg.Body(&body); err != nil {
+			return err
+		}
+		// The roster is written in one transaction, so the team is never
+		// seen with half of its members updated.
+		queries := []string{}
+		for _, m := range body.Members {
+			queries = append(queries, spejderUpsert(subj.Year, messages.NathejkScoutUpdated{
+				MemberID:     m.MemberID,
+				TeamID:       subj.TeamID(),
+				Name:         m.Name,
+				Address:      m.Address,
+				PostalCode:   m.PostalCode,
+				City:         m.City,
+				Email:        m.Email,
+				Phone:        m.Phone,
+				PhoneContact: m.PhoneContact,
+				BirthDate:    m.BirthDate,
+				Returning:    m.Returning,
+				TShirtSize:   m.TShirtSize,
+			}, msg.Time()))
+		}
+		for _, memberID := range body.Deleted {
+			queries = append(queries, fmt.Sprintf("DELETE FROM spejder WHERE memberId=%q", memberID))
+		}
+		if err := tablerow.ConsumeAll(c.w, queries...); err != nil {
+			log.Fatalf("Error consuming sql %q", err)
+		}
+	case msg.Subject().Match(subject.New(subject.Any, subject.Spejder, subject.Any, subject.VerbDeleted).Pattern()):
 		var body messages.NathejkScoutDeleted
 		if err := msg.Body(&body); err != nil {
 			return err
@@ -150,3 +165,34 @@ func (c *spejder) HandleMessage(msg streaminterface.Message) error {
 	}
 	return nil
 }
+
+// spejderUpsert returns the statement writing the spejder of body.
+func spejderUpsert(year string, body messages.NathejkScoutUpdated, at time.Time) string {
+	returning := "0"
+	if body.Returning {
+		returning = "1"
+	}
+	query := `INSERT INTO spejder
+		(memberId, year, teamId, name, address, postalCode, city, email, phone, phoneParent, birthday, tshirtSize, ` + "`returning`," + ` createdAt, updatedAt)
+		VALUES (%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%s,%q,%q)
+		ON DUPLICATE KEY UPDATE
+		teamId=VALUES(teamId), name=VALUES(name), address=VALUES(address), postalCode=VALUES(postalCode),city=VALUES(city), email=VALUES(email), phone=VALUES(phone), phoneParent=VALUES(phoneParent), birthday=VALUES(birthday), tshirtSize=VALUES(tshirtSize), ` + "`returning`=VALUES(`returning`)," + ` updatedAt=VALUES(updatedAt)`
+	args := []any{
+		body.MemberID,
+		year,
+		body.TeamID,
+		body.Name,
+		body.Address,
+		body.PostalCode,
+		body.City,
+		body.Email,
+		body.Phone,
+		body.PhoneContact,
+		body.BirthDate,
+		body.TShirtSize,
+		returning,
+		at,
+		at,
+	}
+	return fmt.Sprintf(query, args...)
+}
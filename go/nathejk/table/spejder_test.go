@@ -0,0 +1,67 @@
+package table_test
+
+import (
+	"testing"
+
+	"github.com/nathejk/shared-go/messages"
+	"github.com/nathejk/shared-go/types"
+
+	nathejk "nathejk.dk/nathejk/messages"
+	"nathejk.dk/nathejk/subject"
+	"nathejk.dk/nathejk/table"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+func TestSpejder(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewSpejder).
+		Given(
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Anna", BirthDate: "2010-05-01", Returning: true},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-2", subject.VerbUpdated).String(),
+				Body:    messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1", Name: "Bo"},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Anne", BirthDate: "2010-05-01"},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-2", subject.VerbDeleted).String(),
+				Body:    messages.NathejkScoutDeleted{MemberID: "member-2"},
+			},
+		).
+		ThenRows("spejder",
+			tablerowtest.Row{"memberId": "member-1", "year": "2024", "teamId": "team-1", "name": "Anne", "birthday": "2010-05-01", "returning": "0"},
+		)
+}
+
+func TestSpejderRoster(t *testing.T) {
+	tablerowtest.NewProjection(t, table.NewSpejder).
+		Given(
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-1", subject.VerbUpdated).String(),
+				Body:    messages.NathejkScoutUpdated{MemberID: "member-1", TeamID: "team-1", Name: "Anna"},
+			},
+			tablerowtest.Event{
+				Subject: subject.Member("2024", subject.Spejder, "member-2", subject.VerbUpdated).String(),
+				Body:    messages.NathejkScoutUpdated{MemberID: "member-2", TeamID: "team-1", Name: "Bo"},
+			},
+			tablerowtest.Event{
+				Subject: subject.RosterUpdated("2024", types.TeamTypePatrulje, "team-1").String(),
+				Body: nathejk.NathejkTeamRosterUpdated{
+					Team: messages.NathejkTeamUpdated{TeamID: "team-1", Name: "Ræverne"},
+					Members: []nathejk.NathejkRosterMember{
+						{MemberID: "member-1", Name: "Anne", TShirtSize: "m"},
+						{MemberID: "member-3", Name: "Carl", PhoneContact: "12345678"},
+					},
+					Deleted: []types.MemberID{"member-2"},
+				},
+			},
+		).
+		ThenRows("spejder",
+			tablerowtest.Row{"memberId": "member-1", "teamId": "team-1", "name": "Anne", "tshirtSize": "m"},
+			tablerowtest.Row{"memberId": "member-3", "teamId": "team-1", "name": "Carl", "phoneParent": "12345678"},
+		)
+}
@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+// AgeRules are the age limits of a year, in whole years at the start of the
+// event. A zero limit is not checked.
+type AgeRules struct {
+	SpejderMinAge int `json:"spejderMinAge"`
+	SpejderMaxAge int `json:"spejderMaxAge"`
+	SeniorMinAge  int `json:"seniorMinAge"`
+	ContactMinAge int `json:"contactMinAge"`
+	// Exceptions tells whether HQ may approve members outside the limits.
+	Exceptions bool `json:"exceptions"`
+}
+
+// DefaultAgeRules are the age rules of a year that does not set its own.
+var DefaultAgeRules = AgeRules{
+	SpejderMinAge: 12,
+	SpejderMaxAge: 16,
+	SeniorMinAge:  16,
+	ContactMinAge: 18,
+	Exceptions:    true,
+}
+
+// Age returns the age in whole years at the time at of someone born on
+// birthday.
+func Age(birthday, at time.Time) int {
+	age := at.Year() - birthday.Year()
+	if at.Month() < birthday.Month() || (at.Month() == birthday.Month() && at.Day() < birthday.Day()) {
+		age--
+	}
+	return age
+}
@@ -3,6 +3,7 @@ package types
 type SignupStatus string
 
 const (
+	SignupStatusNone    SignupStatus = ""
 	SignupStatusNew     SignupStatus = "NEW"
 	SignupStatusOnHold  SignupStatus = "HOLD"
 	SignupStatusPay     SignupStatus = "PAY"
@@ -11,6 +12,40 @@ const (
 	SignupStatusOut     SignupStatus = "OUT"
 )
 
+// signupTransitions lists the statuses a team may change to from each
+// status, following NEW→HOLD→PAY→PAID→STARTED→OUT. A team without a status
+// has just signed up and counts as NEW. HOLD is the waiting list, used only
+// when the event is full, so NEW may skip it.
+var signupTransitions = map[SignupStatus][]SignupStatus{
+	SignupStatusNone:    {SignupStatusNew, SignupStatusOnHold, SignupStatusPay},
+	SignupStatusNew:     {SignupStatusOnHold, SignupStatusPay},
+	SignupStatusOnHold:  {SignupStatusPay},
+	SignupStatusPay:     {SignupStatusPaid},
+	SignupStatusPaid:    {SignupStatusStarted},
+	SignupStatusStarted: {SignupStatusOut},
+}
+
+// Next returns the statuses a team in status s may change to.
+func (s SignupStatus) Next() []SignupStatus {
+	return signupTransitions[s]
+}
+
+// CanTransition reports whether a team in status s may change to status to.
+func (s SignupStatus) CanTransition(to SignupStatus) bool {
+	for _, next := range s.Next() {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether s is one of the signup statuses.
+func (s SignupStatus) Valid() bool {
+	_, ok := signupTransitions[s]
+	return s != SignupStatusNone && (ok || s == SignupStatusOut)
+}
+
 type TeamType string
 type TeamTypeList []TeamType
 
@@ -0,0 +1,92 @@
+// Package correlation carries correlation and causation IDs through a
+// context.Context, so messages published while handling a request can be
+// traced back to the request that caused them.
+package correlation
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const (
+	correlationIDKey = contextKey("correlationID")
+	causationIDKey   = contextKey("causationID")
+)
+
+// NewID returns a new ID with the given prefix, e.g. "request-<uuid>".
+func NewID(prefix string) string {
+	return prefix + "-" + uuid.New().String()
+}
+
+// maxIDLength is the longest ID accepted from a client.
+const maxIDLength = 128
+
+// ValidID reports whether id, e.g. taken from a request header, is safe to
+// log, echo back and store in event metadata: 1 to 128 ASCII letters,
+// digits, '-', '_', '.' or ':'.
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the correlation and causation
+// IDs. If causationID is empty the correlation ID is used.
+func NewContext(ctx context.Context, correlationID, causationID string) context.Context {
+	if causationID == "" {
+		causationID = correlationID
+	}
+	ctx = context.WithValue(ctx, correlationIDKey, correlationID)
+	return context.WithValue(ctx, causationIDKey, causationID)
+}
+
+// CorrelationID returns the correlation ID stored in ctx, or "" if none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// CausationID returns the causation ID stored in ctx, or "" if none.
+func CausationID(ctx context.Context) string {
+	id, _ := ctx.Value(causationIDKey).(string)
+	return id
+}
+
+// Detach returns a background context carrying the IDs of ctx but none of
+// its deadline or cancellation. Use it for work that outlives a request.
+func Detach(ctx context.Context) context.Context {
+	if CorrelationID(ctx) == "" {
+		return context.Background()
+	}
+	return NewContext(context.Background(), CorrelationID(ctx), CausationID(ctx))
+}
+
+// Settable is implemented by messages that can carry correlation and
+// causation IDs.
+type Settable interface {
+	SetCorrelationID(string)
+	SetCausationID(string)
+}
+
+// Apply sets the IDs of ctx on msg. Messages not implementing Settable and
+// contexts without IDs are left untouched.
+func Apply(ctx context.Context, msg any) {
+	m, ok := msg.(Settable)
+	if !ok || CorrelationID(ctx) == "" {
+		return
+	}
+	m.SetCorrelationID(CorrelationID(ctx))
+	m.SetCausationID(CausationID(ctx))
+}
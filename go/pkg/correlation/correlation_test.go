@@ -0,0 +1,67 @@
+package correlation_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/correlation"
+	"nathejk.dk/pkg/nats"
+)
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	assert.Equal("", correlation.CorrelationID(ctx))
+	assert.Equal("", correlation.CausationID(ctx))
+
+	ctx = correlation.NewContext(ctx, "corr-1", "")
+	assert.Equal("corr-1", correlation.CorrelationID(ctx))
+	assert.Equal("corr-1", correlation.CausationID(ctx), "causation should default to correlation")
+
+	ctx = correlation.NewContext(ctx, "corr-1", "request-1")
+	assert.Equal("request-1", correlation.CausationID(ctx))
+}
+
+func TestValidID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(correlation.ValidID("request-3f2b8c1e-4d5a-4b6c-9d7e-1f2a3b4c5d6e"))
+	assert.True(correlation.ValidID("svc.a:1_2"))
+	assert.False(correlation.ValidID(""))
+	assert.False(correlation.ValidID("a b"))
+	assert.False(correlation.ValidID("id\nX-Injected: 1"))
+	assert.False(correlation.ValidID("<script>"))
+	assert.False(correlation.ValidID(strings.Repeat("a", 129)))
+}
+
+func TestDetach(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(correlation.NewContext(context.Background(), "corr-1", "request-1"), time.Minute)
+	cancel()
+
+	detached := correlation.Detach(ctx)
+	assert.NoError(detached.Err())
+	assert.Equal("corr-1", correlation.CorrelationID(detached))
+	assert.Equal("request-1", correlation.CausationID(detached))
+}
+
+func TestApply(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := nats.NewMessage()
+	correlation.Apply(context.Background(), msg)
+	assert.Equal(msg.EventID(), msg.CorrelationID(), "context without IDs should not change message")
+
+	correlation.Apply(correlation.NewContext(context.Background(), "corr-1", "request-1"), msg)
+	assert.Equal("corr-1", msg.CorrelationID())
+	assert.Equal("request-1", msg.CausationID())
+
+	// messages without correlation support are ignored
+	correlation.Apply(correlation.NewContext(context.Background(), "corr-1", ""), struct{}{})
+}
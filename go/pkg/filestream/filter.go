@@ -0,0 +1,57 @@
+package filestream
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"nathejk.dk/superfluids/streaminterface"
+)
+
+// Filter selects records by subject pattern, team and time. The zero Filter
+// matches all records.
+type Filter struct {
+	// Subject is a pattern as accepted by Subject.Match, e.g.
+	// "NATHEJK.*.klan.*.updated".
+	Subject string
+
+	// TeamID matches records with the ID as a part of their type or as the
+	// "teamId" field of their body.
+	TeamID string
+
+	// Since and Until bound the datetime of the records, both inclusive.
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether r is selected by the filter.
+func (f Filter) Match(r Record) bool {
+	if f.Subject != "" && !streaminterface.SubjectFromStr(r.Channel+":"+r.Type).Match(f.Subject) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Datetime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Datetime.After(f.Until) {
+		return false
+	}
+	if f.TeamID != "" && !f.matchTeam(r) {
+		return false
+	}
+	return true
+}
+
+func (f Filter) matchTeam(r Record) bool {
+	for _, part := range strings.Split(r.Type, ".") {
+		if part == f.TeamID {
+			return true
+		}
+	}
+	var body struct {
+		TeamID string `json:"teamId"`
+	}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		return false
+	}
+	return body.TeamID == f.TeamID
+}
@@ -0,0 +1,69 @@
+package filestream
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// maxLineSize is the largest record we accept in a file.
+const maxLineSize = 16 * 1024 * 1024
+
+// Record is a single line of a stream file: the envelope used on NATS
+// Streaming, plus the channel and the sequence the message had on it.
+type Record struct {
+	Channel  string `json:"channel"`
+	Sequence uint64 `json:"sequence"`
+	nats.Envelope
+}
+
+// NewRecord returns the record of msg published on channel at sequence.
+func NewRecord(channel string, sequence uint64, msg streaminterface.Message) (Record, error) {
+	e, err := nats.NewEnvelope(msg)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Channel: channel, Sequence: sequence, Envelope: e}, nil
+}
+
+// Message returns the message of the record.
+func (r Record) Message() (streaminterface.Message, error) {
+	return nats.NewMessageFromEnvelope(r.Channel, r.Sequence, r.Envelope)
+}
+
+// WriteRecord writes r as a single JSON line to w.
+func WriteRecord(w io.Writer, r Record) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "encode record")
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// ReadRecords calls fn for each record read from rd. Blank lines are
+// skipped. Reading stops at the first error returned by fn.
+func ReadRecords(rd io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
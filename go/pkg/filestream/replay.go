@@ -0,0 +1,52 @@
+package filestream
+
+import (
+	"encoding/json"
+	"io"
+
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// Replay publishes the records read from rd matching f to p, keeping their
+// subject, time, body and meta. Event, correlation and causation IDs are kept
+// when the messages of p support setting them. It returns the number of
+// published messages.
+func Replay(rd io.Reader, p streaminterface.Publisher, f Filter) (int, error) {
+	n := 0
+	err := ReadRecords(rd, func(r Record) error {
+		if !f.Match(r) {
+			return nil
+		}
+		msg := p.MessageFunc()(streaminterface.SubjectFromStr(r.Channel + ":" + r.Type))
+		if err := msg.SetBody(json.RawMessage(r.Body)); err != nil {
+			return err
+		}
+		meta := r.Meta
+		if len(meta) == 0 {
+			meta = json.RawMessage("null")
+		}
+		if err := msg.SetMeta(meta); err != nil {
+			return err
+		}
+		if err := msg.SetTime(r.Datetime); err != nil {
+			return err
+		}
+		if m, ok := msg.(identifiable); ok {
+			m.SetEventID(r.EventID)
+			m.SetCorrelationID(r.CorrelationID)
+			m.SetCausationID(r.CausationID)
+		}
+		if err := p.Publish(msg); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+type identifiable interface {
+	SetEventID(string)
+	SetCorrelationID(string)
+	SetCausationID(string)
+}
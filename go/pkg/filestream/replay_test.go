@@ -0,0 +1,112 @@
+package filestream_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/filestream"
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/streamtest"
+)
+
+func record(seq uint64, typ, body string, ts time.Time) filestream.Record {
+	return filestream.Record{
+		Channel:  "NATHEJK",
+		Sequence: seq,
+		Envelope: nats.Envelope{
+			EventID:       "event-" + typ,
+			CorrelationID: "corr-1",
+			CausationID:   "request-1",
+			Datetime:      ts,
+			Type:          typ,
+			Body:          json.RawMessage(body),
+			Meta:          json.RawMessage(`{"producer":"test"}`),
+		},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+	ts := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	klan := record(1, "2024.klan.team-1.updated", `{"teamId":"team-1"}`, ts)
+	senior := record(2, "2024.senior.member-1.updated", `{"memberId":"member-1","teamId":"team-1"}`, ts.Add(time.Hour))
+	other := record(3, "2024.klan.team-2.signedup", `{"teamId":"team-2"}`, ts.Add(2*time.Hour))
+
+	assert.True(filestream.Filter{}.Match(klan))
+
+	f := filestream.Filter{Subject: "NATHEJK.*.klan.*.*"}
+	assert.True(f.Match(klan))
+	assert.False(f.Match(senior))
+
+	f = filestream.Filter{TeamID: "team-1"}
+	assert.True(f.Match(klan))
+	assert.True(f.Match(senior), "team ID in body")
+	assert.False(f.Match(other))
+
+	f = filestream.Filter{Since: ts.Add(time.Hour), Until: ts.Add(2 * time.Hour)}
+	assert.False(f.Match(klan))
+	assert.True(f.Match(senior))
+	assert.True(f.Match(other))
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	ts := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	assert.NoError(filestream.WriteRecord(&buf, record(1, "2024.klan.team-1.updated", `{"teamId":"team-1"}`, ts)))
+	assert.NoError(filestream.WriteRecord(&buf, record(2, "2024.klan.team-2.updated", `{"teamId":"team-2"}`, ts)))
+
+	p := make(streamtest.SingleDomainPublisher, 10)
+	n, err := filestream.Replay(&buf, &p, filestream.Filter{TeamID: "team-2"})
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	msg, ok := p.Pop()
+	assert.True(ok)
+	assert.Equal("NATHEJK:2024.klan.team-2.updated", msg.Subject().Subject())
+	assert.Equal(ts, msg.Time())
+	var body struct {
+		TeamID string `json:"teamId"`
+	}
+	assert.NoError(msg.Body(&body))
+	assert.Equal("team-2", body.TeamID)
+}
+
+func TestReplayKeepsIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(filestream.WriteRecord(&buf, record(1, "2024.klan.team-1.updated", `{}`, time.Now())))
+
+	var published streaminterface.Message
+	p := publisher(func(msg streaminterface.Message) error {
+		published = msg
+		return nil
+	})
+	_, err := filestream.Replay(&buf, p, filestream.Filter{})
+	assert.NoError(err)
+
+	e, err := nats.NewEnvelope(published)
+	assert.NoError(err)
+	assert.Equal("event-2024.klan.team-1.updated", e.EventID)
+	assert.Equal("corr-1", e.CorrelationID)
+	assert.Equal("request-1", e.CausationID)
+}
+
+type publisher func(streaminterface.Message) error
+
+func (p publisher) Publish(msg streaminterface.Message) error { return p(msg) }
+func (p publisher) MessageFunc() streaminterface.MessageFunc {
+	return func(subj streaminterface.Subject) streaminterface.MutableMessage {
+		m := nats.NewMessage()
+		m.SetSubject(subj)
+		return m
+	}
+}
@@ -0,0 +1,263 @@
+// Package filestream implements a stream that appends messages to a local
+// JSONL file.
+//
+// Each line is a Record holding the same envelope as used on NATS Streaming,
+// plus the channel and per channel sequence of the message. Subscriptions
+// always start from the first message of a channel and receive the caughtup
+// sentinel once they have read the messages present when subscribing, which
+// makes a file a drop-in replacement for NATS Streaming when running
+// offline or replaying fixtures.
+package filestream
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+)
+
+var (
+	ErrBadSubject      = errors.New("filestream: invalid subject")
+	ErrBadSubscription = errors.New("filestream: invalid subscription")
+	ErrBadSequence     = errors.New("filestream: sequence not increasing")
+	ErrClosed          = errors.New("filestream: stream closed")
+)
+
+// FileStream is a stream persisted in a JSONL file.
+type FileStream struct {
+	// mu guards all fields below, cond is signalled on new messages and
+	// close.
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	file     *os.File
+	channels map[string][]streaminterface.Message
+	subs     map[*subscription]struct{}
+	discard  map[string]map[uint64]bool
+	closed   bool
+}
+
+// Open opens the stream in the named file, creating it if it does not exist.
+// The messages already in the file are loaded into memory. Sequences may have
+// gaps, e.g. after filtering, but must strictly increase per channel.
+func Open(name string) (*FileStream, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStream{
+		file:     file,
+		channels: make(map[string][]streaminterface.Message),
+		subs:     make(map[*subscription]struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	err = ReadRecords(file, func(r Record) error {
+		if r.Sequence <= s.lastSequence(r.Channel) {
+			return fmt.Errorf("%w: %s sequence %d after %d", ErrBadSequence, r.Channel, r.Sequence, s.lastSequence(r.Channel))
+		}
+		msg, err := r.Message()
+		if err != nil {
+			return err
+		}
+		s.channels[r.Channel] = append(s.channels[r.Channel], msg)
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Publish appends msg to the file and delivers it to the subscribers of its
+// channel. The message is given the sequence following the last message of
+// the channel.
+func (s *FileStream) Publish(msg streaminterface.Message) error {
+	_, err := s.PublishSequence(msg)
+	return err
+}
+
+// PublishSequence publishes msg like Publish, and returns the sequence it
+// was given.
+func (s *FileStream) PublishSequence(msg streaminterface.Message) (uint64, error) {
+	channel := msg.Subject().Domain()
+	if channel == "" {
+		return 0, ErrBadSubject
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	seq := s.lastSequence(channel) + 1
+	r, err := NewRecord(channel, seq, msg)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := r.Message()
+	if err != nil {
+		return 0, err
+	}
+	if err := WriteRecord(s.file, r); err != nil {
+		return 0, err
+	}
+	s.channels[channel] = append(s.channels[channel], stored)
+	s.cond.Broadcast()
+	return seq, nil
+}
+
+func (s *FileStream) MessageFunc() streaminterface.MessageFunc {
+	return func(subj streaminterface.Subject) streaminterface.MutableMessage {
+		m := nats.NewMessage()
+		m.SetSubject(subj)
+		return m
+	}
+}
+
+// LastSequence returns the sequence of the last message on channel, 0 if the
+// channel is empty.
+func (s *FileStream) LastSequence(channel string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(s.lastSequence(channel)), nil
+}
+
+// lastSequence returns the sequence of the last message on channel. The
+// caller must hold mu, or be the only user of s.
+func (s *FileStream) lastSequence(channel string) uint64 {
+	msgs := s.channels[channel]
+	if len(msgs) == 0 {
+		return 0
+	}
+	return msgs[len(msgs)-1].Sequence()
+}
+
+// SetInvalidMessagesIds sets the skip list of the stream, keyed by channel
+// and sequence. Skipped messages are not delivered to subscriptions made
+// after the call.
+func (s *FileStream) SetInvalidMessagesIds(m map[string]map[uint64]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.discard = m
+}
+
+// Subscribe delivers all messages on the channel of subject, from the first
+// one, to cb. The caughtup sentinel is delivered after the messages present
+// when subscribing.
+func (s *FileStream) Subscribe(subject string, cb streaminterface.MessageHandler) (streaminterface.Subscription, error) {
+	subj := streaminterface.SubjectFromStr(subject)
+	if subj.String() != subject || subj.Domain() == "" {
+		return nil, ErrBadSubject
+	}
+	if cb == nil {
+		return nil, ErrBadSubscription
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	sub := &subscription{
+		stream:     s,
+		channel:    subj.Domain(),
+		cb:         cb,
+		caughtupAt: len(s.channels[subj.Domain()]),
+		discard:    s.discard[subj.Domain()],
+	}
+	s.subs[sub] = struct{}{}
+	go sub.deliver()
+
+	return sub, nil
+}
+
+// Close closes all subscriptions and the file.
+func (s *FileStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for sub := range s.subs {
+		sub.closed = true
+	}
+	s.subs = nil
+	s.cond.Broadcast()
+	return s.file.Close()
+}
+
+// subscription delivers the messages of a channel, in order, from its own
+// goroutine.
+type subscription struct {
+	stream  *FileStream
+	channel string
+	cb      streaminterface.MessageHandler
+	discard map[uint64]bool
+
+	// guarded by stream.mu
+	pos        int
+	caughtupAt int
+	closed     bool
+}
+
+func (sub *subscription) deliver() {
+	s := sub.stream
+	if sub.caughtupAt == 0 {
+		sub.cb.HandleMessage(caughtup.NewCaughtupMessage(sub.channel))
+	}
+	for {
+		s.mu.Lock()
+		for !sub.closed && sub.pos >= len(s.channels[sub.channel]) {
+			s.cond.Wait()
+		}
+		if sub.closed {
+			s.mu.Unlock()
+			return
+		}
+		msg := s.channels[sub.channel][sub.pos]
+		sub.pos++
+		announce := sub.pos == sub.caughtupAt
+		skip := sub.discard[msg.Sequence()]
+		s.mu.Unlock()
+
+		if !skip {
+			sub.cb.HandleMessage(msg)
+		}
+		if announce {
+			sub.cb.HandleMessage(caughtup.NewCaughtupMessage(sub.channel))
+		}
+	}
+}
+
+// Close stops delivery of messages to the subscription.
+func (sub *subscription) Close() error {
+	s := sub.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub.closed {
+		return ErrBadSubscription
+	}
+	sub.closed = true
+	delete(s.subs, sub)
+	s.cond.Broadcast()
+	return nil
+}
+
+var (
+	_ streaminterface.Stream            = (*FileStream)(nil)
+	_ streaminterface.SequencePublisher = (*FileStream)(nil)
+	_ streaminterface.Subscription      = (*subscription)(nil)
+)
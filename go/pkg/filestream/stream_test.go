@@ -0,0 +1,197 @@
+package filestream_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/filestream"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+)
+
+type body struct {
+	Name string `json:"name"`
+}
+
+func publish(t *testing.T, s streaminterface.Stream, subject, name string) {
+	msg := s.MessageFunc()(streaminterface.SubjectFromStr(subject))
+	msg.SetBody(&body{Name: name})
+	msg.SetMeta(map[string]string{})
+	if err := s.Publish(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// collect subscribes to channel and returns a channel receiving the type and
+// sequence of each delivered message.
+func collect(t *testing.T, s streaminterface.Stream, channel string) (chan streaminterface.Message, streaminterface.Subscription) {
+	ch := make(chan streaminterface.Message, 100)
+	sub, err := s.Subscribe(channel, streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+		ch <- msg
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch, sub
+}
+
+func next(t *testing.T, ch chan streaminterface.Message) streaminterface.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestFileStream(t *testing.T) {
+	assert := assert.New(t)
+	name := filepath.Join(t.TempDir(), "events.jsonl")
+
+	s, err := filestream.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, s, "NATHEJK:2024.klan.team-1.updated", "first")
+	publish(t, s, "NATHEJK:2024.klan.team-1.updated", "second")
+	publish(t, s, "nathejk:personnel.updated", "other channel")
+	assert.NoError(s.Close())
+
+	// reopen and read back from sequence 0
+	s, err = filestream.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	seq, err := s.LastSequence("NATHEJK")
+	assert.NoError(err)
+	assert.Equal(int64(2), seq)
+
+	ch, sub := collect(t, s, "NATHEJK")
+
+	msg := next(t, ch)
+	assert.Equal("NATHEJK:2024.klan.team-1.updated", msg.Subject().Subject())
+	assert.Equal(uint64(1), msg.Sequence())
+	var b body
+	assert.NoError(msg.Body(&b))
+	assert.Equal("first", b.Name)
+
+	msg = next(t, ch)
+	assert.Equal(uint64(2), msg.Sequence())
+	assert.True(caughtup.IsCaughtup(next(t, ch)), "expected caughtup after existing messages")
+
+	// live messages follow the sentinel
+	publish(t, s, "NATHEJK:2024.klan.team-1.deleted", "third")
+	msg = next(t, ch)
+	assert.Equal("2024.klan.team-1.deleted", msg.Subject().Type())
+	assert.Equal(uint64(3), msg.Sequence())
+
+	assert.NoError(sub.Close())
+	assert.Error(sub.Close())
+}
+
+func TestFileStreamEmptyChannel(t *testing.T) {
+	s, err := filestream.Open(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ch, _ := collect(t, s, "NATHEJK")
+	assert.True(t, caughtup.IsCaughtup(next(t, ch)), "empty channel should be caught up at once")
+
+	_, err = s.Subscribe("NATHEJK:", nil)
+	assert.Error(t, err)
+}
+
+func TestFileStreamSkipList(t *testing.T) {
+	assert := assert.New(t)
+	s, err := filestream.Open(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	publish(t, s, "NATHEJK:2024.klan.team-1.updated", "first")
+	publish(t, s, "NATHEJK:2024.klan.team-1.updated", "poison")
+	s.SetInvalidMessagesIds(map[string]map[uint64]bool{"NATHEJK": {2: true}})
+
+	ch, _ := collect(t, s, "NATHEJK")
+	assert.Equal(uint64(1), next(t, ch).Sequence())
+	assert.True(caughtup.IsCaughtup(next(t, ch)), "skipped last message should still announce caughtup")
+}
+
+func writeRecords(t *testing.T, name string, records ...filestream.Record) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, r := range records {
+		if err := filestream.WriteRecord(f, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileStreamSequenceGaps(t *testing.T) {
+	assert := assert.New(t)
+	ts := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	name := filepath.Join(t.TempDir(), "events.jsonl")
+	writeRecords(t, name,
+		record(3, "2024.klan.team-1.updated", `{"name":"first"}`, ts),
+		record(7, "2024.klan.team-1.updated", `{"name":"second"}`, ts),
+	)
+
+	s, err := filestream.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	seq, err := s.LastSequence("NATHEJK")
+	assert.NoError(err)
+	assert.Equal(int64(7), seq)
+
+	msg := s.MessageFunc()(streaminterface.SubjectFromStr("NATHEJK:2024.klan.team-1.deleted"))
+	msg.SetBody(&body{Name: "third"})
+	msg.SetMeta(map[string]string{})
+	published, err := s.PublishSequence(msg)
+	assert.NoError(err)
+	assert.Equal(uint64(8), published)
+	seq, err = s.LastSequence("NATHEJK")
+	assert.NoError(err)
+	assert.Equal(int64(8), seq)
+
+	ch, _ := collect(t, s, "NATHEJK")
+	assert.Equal(uint64(3), next(t, ch).Sequence())
+	assert.Equal(uint64(7), next(t, ch).Sequence())
+	assert.Equal(uint64(8), next(t, ch).Sequence())
+	assert.True(caughtup.IsCaughtup(next(t, ch)))
+}
+
+func TestFileStreamRejectsUnorderedSequences(t *testing.T) {
+	ts := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	for name, seqs := range map[string][]uint64{
+		"duplicate":  {1, 2, 2},
+		"decreasing": {1, 3, 2},
+		"zero":       {0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "events.jsonl")
+			var records []filestream.Record
+			for _, seq := range seqs {
+				records = append(records, record(seq, "2024.klan.team-1.updated", `{"name":"x"}`, ts))
+			}
+			writeRecords(t, file, records...)
+
+			_, err := filestream.Open(file)
+			assert.True(t, errors.Is(err, filestream.ErrBadSequence), "got %v", err)
+		})
+	}
+}
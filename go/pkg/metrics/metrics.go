@@ -0,0 +1,356 @@
+// Package metrics is a minimal collector of counters, gauges and histograms
+// exposed in the Prometheus text format.
+//
+// Like expvar, metrics are registered on a package-level registry when they
+// are created, and served by Handler. Registering a name twice fails with
+// ErrDuplicateName.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the default histogram buckets, in seconds, tailored to
+// HTTP request latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of named metrics.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// ErrDuplicateName is returned when a metric name is registered twice.
+var ErrDuplicateName = errors.New("metrics: duplicate metric name")
+
+func (r *Registry) register(name string, c collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		return fmt.Errorf("%w %q", ErrDuplicateName, name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// Must returns v, and panics if err is not nil. Use it for metrics created
+// in package variables, where a duplicate name is a programming error.
+func Must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// WriteTo writes all metrics of the registry in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP serves the metrics of the registry.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// Handler returns the HTTP handler serving the default registry.
+func Handler() http.Handler {
+	return Default
+}
+
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+func (d desc) writeSample(w io.Writer, suffix string, labelValues []string, extra string, value float64) {
+	var pairs []string
+	for i, label := range d.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	labels := ""
+	if len(pairs) > 0 {
+		labels = "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s%s%s %s\n", d.name, suffix, labels, formatFloat(value))
+}
+
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	labelValues []string
+	v           uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() { atomic.AddUint64(&c.v, 1) }
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) { atomic.AddUint64(&c.v, n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return atomic.LoadUint64(&c.v) }
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	desc
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// NewCounterVec creates and registers a counter vector on the default
+// registry.
+func NewCounterVec(name, help string, labels ...string) (*CounterVec, error) {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates and registers a counter vector.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) (*CounterVec, error) {
+	v := &CounterVec{
+		desc:     desc{name: name, help: help, typ: "counter", labels: labels},
+		counters: make(map[string]*Counter),
+	}
+	if err := r.register(name, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// With returns the counter for the given label values, creating it if needed.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	key := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{labelValues: labelValues}
+		v.counters[key] = c
+	}
+	return c
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.writeHeader(w)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.counters) {
+		c := v.counters[key]
+		v.writeSample(w, "", c.labelValues, "", float64(c.Value()))
+	}
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	labelValues []string
+	buckets     []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	desc
+	buckets    []float64
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec creates and registers a histogram vector on the default
+// registry. If buckets is nil DefaultBuckets are used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) (*HistogramVec, error) {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates and registers a histogram vector. If buckets is nil
+// DefaultBuckets are used.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) (*HistogramVec, error) {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	v := &HistogramVec{
+		desc:       desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+	}
+	if err := r.register(name, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// With returns the histogram for the given label values, creating it if
+// needed.
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	key := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.histograms[key]
+	if !ok {
+		h = &Histogram{
+			labelValues: labelValues,
+			buckets:     v.buckets,
+			counts:      make([]uint64, len(v.buckets)),
+		}
+		v.histograms[key] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.writeHeader(w)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.histograms) {
+		h := v.histograms[key]
+		h.mu.Lock()
+		for i, bound := range h.buckets {
+			v.writeSample(w, "_bucket", h.labelValues, `le="`+formatFloat(bound)+`"`, float64(h.counts[i]))
+		}
+		v.writeSample(w, "_bucket", h.labelValues, `le="+Inf"`, float64(h.count))
+		v.writeSample(w, "_sum", h.labelValues, "", h.sum)
+		v.writeSample(w, "_count", h.labelValues, "", float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+// EmitFunc reports a single value with its label values.
+type EmitFunc func(value float64, labelValues ...string)
+
+// funcCollector reports values read at scrape time.
+type funcCollector struct {
+	desc
+	f func(EmitFunc)
+}
+
+// NewGaugeFunc registers a gauge on the default registry whose values are
+// read by calling f at scrape time.
+func NewGaugeFunc(name, help string, labels []string, f func(EmitFunc)) error {
+	return Default.NewGaugeFunc(name, help, labels, f)
+}
+
+// NewGaugeFunc registers a gauge whose values are read by calling f at scrape
+// time.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, f func(EmitFunc)) error {
+	return r.register(name, &funcCollector{desc{name: name, help: help, typ: "gauge", labels: labels}, f})
+}
+
+// NewCounterFunc registers a counter on the default registry whose values are
+// read by calling f at scrape time. Use it to expose counters kept elsewhere.
+func NewCounterFunc(name, help string, labels []string, f func(EmitFunc)) error {
+	return Default.NewCounterFunc(name, help, labels, f)
+}
+
+// NewCounterFunc registers a counter whose values are read by calling f at
+// scrape time.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, f func(EmitFunc)) error {
+	return r.register(name, &funcCollector{desc{name: name, help: help, typ: "counter", labels: labels}, f})
+}
+
+func (c *funcCollector) write(w io.Writer) {
+	c.writeHeader(w)
+	c.f(func(value float64, labelValues ...string) {
+		c.key(labelValues) // validates the number of label values
+		c.writeSample(w, "", labelValues, "", value)
+	})
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
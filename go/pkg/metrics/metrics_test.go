@@ -0,0 +1,91 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/metrics"
+)
+
+func TestCounterVec(t *testing.T) {
+	assert := assert.New(t)
+
+	r := metrics.NewRegistry()
+	c, err := r.NewCounterVec("sms_sent_total", "SMS send results.", "result")
+	assert.NoError(err)
+	c.With("ok").Inc()
+	c.With("ok").Add(2)
+	c.With(`fail"ed`).Inc()
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	assert.Equal(`# HELP sms_sent_total SMS send results.
+# TYPE sms_sent_total counter
+sms_sent_total{result="fail\"ed"} 1
+sms_sent_total{result="ok"} 3
+`, buf.String())
+	assert.Equal(uint64(3), c.With("ok").Value())
+}
+
+func TestHistogramVec(t *testing.T) {
+	assert := assert.New(t)
+
+	r := metrics.NewRegistry()
+	h, err := r.NewHistogramVec("request_seconds", "Latency.", []float64{1, 0.1}, "route")
+	assert.NoError(err)
+	h.With("/a").Observe(0.05)
+	h.With("/a").Observe(0.5)
+	h.With("/a").Observe(5)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	assert.Equal(`# HELP request_seconds Latency.
+# TYPE request_seconds histogram
+request_seconds_bucket{route="/a",le="0.1"} 1
+request_seconds_bucket{route="/a",le="1"} 2
+request_seconds_bucket{route="/a",le="+Inf"} 3
+request_seconds_sum{route="/a"} 5.55
+request_seconds_count{route="/a"} 3
+`, buf.String())
+}
+
+func TestFuncCollectors(t *testing.T) {
+	assert := assert.New(t)
+
+	r := metrics.NewRegistry()
+	_ = r.NewGaugeFunc("consumer_lag", "Lag.", []string{"consumer"}, func(emit metrics.EmitFunc) {
+		emit(4, "personnel")
+	})
+	_ = r.NewCounterFunc("uptime_total", "No labels.", nil, func(emit metrics.EmitFunc) {
+		emit(1)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(rec.Header().Get("Content-Type"), "text/plain")
+	assert.Equal(`# HELP consumer_lag Lag.
+# TYPE consumer_lag gauge
+consumer_lag{consumer="personnel"} 4
+# HELP uptime_total No labels.
+# TYPE uptime_total counter
+uptime_total 1
+`, rec.Body.String())
+}
+
+func TestDuplicateName(t *testing.T) {
+	assert := assert.New(t)
+
+	r := metrics.NewRegistry()
+	_, err := r.NewCounterVec("dup", "")
+	assert.NoError(err)
+	_, err = r.NewCounterVec("dup", "")
+	assert.ErrorIs(err, metrics.ErrDuplicateName)
+	assert.ErrorIs(r.NewGaugeFunc("dup", "", nil, func(metrics.EmitFunc) {}), metrics.ErrDuplicateName)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	assert.Equal("# HELP dup \n# TYPE dup counter\n", buf.String())
+}
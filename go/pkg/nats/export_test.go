@@ -0,0 +1,13 @@
+package nats
+
+import (
+	"net/url"
+
+	"github.com/nats-io/stan.go"
+)
+
+// NewTestNATSStream returns a stream connecting with dial rather than to a
+// NATS Streaming server.
+func NewTestNATSStream(clientID string, dial func(clientID string, lost stan.ConnectionLostHandler) (stan.Conn, error), options ...NatsStreamOption) (*NATSStream, error) {
+	return newNATSStream(url.URL{Scheme: "stan", Host: "localhost", Path: "/test-cluster"}, clientID, dial, options...)
+}
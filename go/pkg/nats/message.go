@@ -14,8 +14,8 @@ import (
 
 var jjson = jsoniter.ConfigCompatibleWithStandardLibrary
 
-// struct represents a message of a nats stream
-type envelope struct {
+// Envelope is the wire format of a message on a nats stream.
+type Envelope struct {
 	EventID       string          `json:"eventId"`
 	CorrelationID string          `json:"correlationId"`
 	CausationID   string          `json:"causationId"`
@@ -26,7 +26,7 @@ type envelope struct {
 	Meta          json.RawMessage `json:"meta"`
 }
 
-func (e *envelope) IsValid() bool {
+func (e *Envelope) IsValid() bool {
 	return len(e.Type) > 0 && len(e.Body) > 0
 }
 
@@ -165,10 +165,14 @@ func (m *message) SetMeta(v interface{}) (err error) {
 }
 
 func (m *message) DecodeData(data []byte) error {
-	var e envelope
+	var e Envelope
 	if err := jjson.Unmarshal(data, &e); err != nil {
 		return err
 	}
+	return m.setEnvelope(e)
+}
+
+func (m *message) setEnvelope(e Envelope) error {
 	if !e.IsValid() {
 		return errors.New("Error decoding message envelope")
 	}
@@ -183,3 +187,46 @@ func (m *message) DecodeData(data []byte) error {
 
 	return nil
 }
+
+// NewEnvelope returns the envelope of msg. The message must implement
+// Identifiable and hold its body and meta as json.RawMessage; a nil meta is
+// allowed.
+func NewEnvelope(msg streaminterface.Message) (Envelope, error) {
+	ID, ok := msg.(Identifiable)
+	if !ok {
+		return Envelope{}, errors.New("Message does not implement 'Identifiable' interface")
+	}
+	body, ok := msg.RawBody().(json.RawMessage)
+	if !ok {
+		return Envelope{}, errors.Errorf("Message body is %T, not json.RawMessage", msg.RawBody())
+	}
+	var meta json.RawMessage
+	if raw := msg.RawMeta(); raw != nil {
+		if meta, ok = raw.(json.RawMessage); !ok {
+			return Envelope{}, errors.Errorf("Message meta is %T, not json.RawMessage", raw)
+		}
+	}
+	return Envelope{
+		EventID:       ID.EventID(),
+		CorrelationID: ID.CorrelationID(),
+		CausationID:   ID.CausationID(),
+		Version:       0,
+		Datetime:      msg.Time(),
+		Type:          msg.Subject().Type(),
+		Body:          body,
+		Meta:          meta,
+	}, nil
+}
+
+// NewMessageFromEnvelope returns the message of envelope e, read from the
+// given channel at sequence.
+func NewMessageFromEnvelope(channel string, sequence uint64, e Envelope) (*message, error) {
+	m := &message{
+		channel:  channel,
+		sequence: sequence,
+	}
+	if err := m.setEnvelope(e); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
 )
 
 type mytype struct {
@@ -162,3 +163,29 @@ func TestMessageEncoding(t *testing.T) {
 
 	assert.JSONEq(exp, string(got))
 }*/
+
+type identifiableMessage interface {
+	streaminterface.Message
+	nats.Identifiable
+}
+
+// bytesBody is a message holding its body as plain bytes.
+type bytesBody struct {
+	identifiableMessage
+}
+
+func (m bytesBody) RawBody() interface{} { return []byte(`{"Data":"Hello"}`) }
+
+func TestNewEnvelope(t *testing.T) {
+	m := nats.NewMessage()
+	m.SetSubject(streaminterface.SubjectFromStr("NATHEJK:2024.klan.team-1.updated"))
+	m.SetBody(&mytype{Data: "Hello"})
+
+	e, err := nats.NewEnvelope(m)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024.klan.team-1.updated", e.Type)
+	assert.JSONEq(t, `{"Data":"Hello"}`, string(e.Body))
+
+	_, err = nats.NewEnvelope(bytesBody{m})
+	assert.Error(t, err, "non raw body must not be dropped")
+}
@@ -2,12 +2,15 @@ package nats
 
 import (
 	"encoding/json"
-	"io"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 )
 
+// Monitor reads the monitoring endpoint of a NATS Streaming server. All
+// methods return an error, rather than panic, when the endpoint is
+// unreachable or answers unexpectedly.
 type Monitor struct {
 	Url string
 }
@@ -16,180 +19,81 @@ type Channel struct {
 	LastSequence int64
 }
 
-func (m *Monitor) StanUrl() string {
-	// Fetch port number to nats streaming server from "varz" endpoint.
-	res, err := http.Get(m.Url + "/varz")
-	if err != nil {
-		panic(err.Error())
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
-	}
-	var varz struct {
-		Port json.Number `json:"port"`
-	}
-	err = json.Unmarshal(resBody, &varz)
-	if err != nil {
-		panic(err.Error())
-	}
+var monitorClient = &http.Client{Timeout: 5 * time.Second}
 
-	stanUrl, _ := url.Parse(m.Url)
-	stanUrl.Scheme = "stan"
-	stanUrl.Host = stanUrl.Hostname() + ":" + string(varz.Port)
-	return stanUrl.String()
-}
-
-func (m *Monitor) ClusterId() string {
-	res, err := http.Get(m.Url + "/streaming/channelsz?subs=1")
+// get decodes the JSON document at path of the monitor endpoint into dst.
+func (m *Monitor) get(path string, dst any) error {
+	res, err := monitorClient.Get(m.Url + path)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("monitor %s: %s", path, res.Status)
 	}
-	var channelszsubs struct {
-		ClusterId string `json:"cluster_id"`
-	}
-	err = json.Unmarshal(resBody, &channelszsubs)
-	if err != nil {
-		panic(err.Error())
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("monitor %s: %w", path, err)
 	}
-	return channelszsubs.ClusterId
+	return nil
 }
 
-func (m *Monitor) Channels() map[string]Channel {
-	res, err := http.Get(m.Url + "/streaming/channelsz?subs=1")
-	if err != nil {
-		panic(err.Error())
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	var channelsz struct {
-		Channels []struct {
-			Name         string      `json:"name"`
-			LastSequence json.Number `json:"last_seq"`
-		} `json:"channels"`
-	}
-	err = json.Unmarshal(resBody, &channelsz)
-	if err != nil {
-		log.Println(string(resBody), m.Url+"/streaming/channelsz?subs=1")
-		panic(err)
-	}
-
-	channels := make(map[string]Channel)
-	for _, channelInfo := range channelsz.Channels {
-		lastSequence, err := channelInfo.LastSequence.Int64()
-		if err != nil {
-			panic(err)
-		}
-		channels[channelInfo.Name] = Channel{LastSequence: lastSequence}
-	}
-
-	return channels
-}
-
-func (m *Monitor) LastSequence(channel string) int64 {
-	channels := m.Channels()
-	if channel, exists := channels[channel]; exists {
-		return channel.LastSequence
-	}
-	return 0
-}
-
-type natsMonitor struct {
-	Url string
-}
-
-type monitorChannel struct {
-	LastSequence int64
-}
-
-func (m *natsMonitor) StanUrl() string {
+func (m *Monitor) StanUrl() (string, error) {
 	// Fetch port number to nats streaming server from "varz" endpoint.
-	res, err := http.Get(m.Url + "/varz")
-	if err != nil {
-		panic(err.Error())
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
-	}
 	var varz struct {
 		Port json.Number `json:"port"`
 	}
-	err = json.Unmarshal(resBody, &varz)
-	if err != nil {
-		panic(err.Error())
+	if err := m.get("/varz", &varz); err != nil {
+		return "", err
 	}
 
-	stanUrl, _ := url.Parse(m.Url)
+	stanUrl, err := url.Parse(m.Url)
+	if err != nil {
+		return "", err
+	}
 	stanUrl.Scheme = "stan"
 	stanUrl.Host = stanUrl.Hostname() + ":" + string(varz.Port)
-	return stanUrl.String()
+	return stanUrl.String(), nil
 }
 
-func (m *natsMonitor) ClusterId() string {
-	res, err := http.Get(m.Url + "/streaming/channelsz?subs=1")
-	if err != nil {
-		panic(err.Error())
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
-	}
+func (m *Monitor) ClusterId() (string, error) {
 	var channelszsubs struct {
 		ClusterId string `json:"cluster_id"`
 	}
-	err = json.Unmarshal(resBody, &channelszsubs)
-	if err != nil {
-		panic(err.Error())
+	if err := m.get("/streaming/channelsz?subs=1", &channelszsubs); err != nil {
+		return "", err
 	}
-	return channelszsubs.ClusterId
+	return channelszsubs.ClusterId, nil
 }
 
-func (m *natsMonitor) Channels() map[string]monitorChannel {
-	res, err := http.Get(m.Url + "/streaming/channelsz?subs=1")
-	if err != nil {
-		panic(err.Error())
-	}
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		panic(err.Error())
-	}
-
+func (m *Monitor) Channels() (map[string]Channel, error) {
 	var channelsz struct {
 		Channels []struct {
 			Name         string      `json:"name"`
 			LastSequence json.Number `json:"last_seq"`
 		} `json:"channels"`
 	}
-	err = json.Unmarshal(resBody, &channelsz)
-	if err != nil {
-		log.Println(string(resBody), m.Url+"/streaming/channelsz?subs=1")
-		panic(err)
+	if err := m.get("/streaming/channelsz?subs=1", &channelsz); err != nil {
+		return nil, err
 	}
 
-	channels := make(map[string]monitorChannel)
+	channels := make(map[string]Channel)
 	for _, channelInfo := range channelsz.Channels {
 		lastSequence, err := channelInfo.LastSequence.Int64()
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("monitor channel %q: %w", channelInfo.Name, err)
 		}
-		channels[channelInfo.Name] = monitorChannel{LastSequence: lastSequence}
+		channels[channelInfo.Name] = Channel{LastSequence: lastSequence}
 	}
 
-	return channels
+	return channels, nil
 }
 
-func (m *natsMonitor) LastSequence(subject string) int64 {
-	channels := m.Channels()
-	if ch, exists := channels[subject]; exists {
-		return ch.LastSequence
+// LastSequence returns the last sequence of channel, 0 if it does not
+// exist.
+func (m *Monitor) LastSequence(channel string) (int64, error) {
+	channels, err := m.Channels()
+	if err != nil {
+		return 0, err
 	}
-	return 0
+	return channels[channel].LastSequence, nil
 }
@@ -0,0 +1,67 @@
+package nats_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/nats"
+)
+
+func TestMonitor(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/varz":
+			w.Write([]byte(`{"port": 4222}`))
+		case "/streaming/channelsz":
+			w.Write([]byte(`{"cluster_id": "test-cluster", "channels": [{"name": "NATHEJK", "last_seq": 42}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	m := nats.Monitor{Url: srv.URL}
+	stanUrl, err := m.StanUrl()
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(stanUrl, "stan://127.0.0.1:4222"), stanUrl)
+
+	clusterID, err := m.ClusterId()
+	assert.NoError(err)
+	assert.Equal("test-cluster", clusterID)
+
+	seq, err := m.LastSequence("NATHEJK")
+	assert.NoError(err)
+	assert.Equal(int64(42), seq)
+
+	seq, err = m.LastSequence("missing")
+	assert.NoError(err)
+	assert.Equal(int64(0), seq)
+}
+
+func TestMonitorErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/varz" {
+			w.Write([]byte(`not json`))
+			return
+		}
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	m := nats.Monitor{Url: srv.URL}
+	_, err := m.StanUrl()
+	assert.Error(t, err)
+	_, err = m.ClusterId()
+	assert.Error(t, err)
+	_, err = m.LastSequence("NATHEJK")
+	assert.Error(t, err)
+
+	srv.Close()
+	_, err = m.Channels()
+	assert.Error(t, err)
+}
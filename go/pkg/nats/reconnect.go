@@ -0,0 +1,282 @@
+package nats
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	gonats "github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrClosed            = errors.New("stan: stream closed")
+	ErrPublishBufferFull = errors.New("stan: publish buffer full while reconnecting")
+
+	// ErrBuffered is returned by Publish for a message that is kept in the
+	// publish buffer while reconnecting. It is published once connected,
+	// unless the stream is closed before.
+	ErrBuffered = errors.New("stan: message buffered while reconnecting")
+)
+
+// ConnState is the connection state of a NATSStream.
+type ConnState int
+
+const (
+	StateConnected ConnState = iota
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+type bufferedMsg struct {
+	channel string
+	data    []byte
+}
+
+// isConnErr reports whether err means the message was not handed to the
+// server because the connection is gone, so it is safe to publish again.
+func isConnErr(err error) bool {
+	return errors.Is(err, stan.ErrConnectionClosed) ||
+		errors.Is(err, gonats.ErrConnectionClosed) ||
+		errors.Is(err, gonats.ErrConnectionReconnecting)
+}
+
+// isClientIDTaken reports whether the server rejected a connection because
+// the client ID is still registered, which happens when reconnecting before
+// the server has noticed that the old connection is gone.
+func isClientIDTaken(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "clientID already registered")
+}
+
+// dialer opens a connection to the server as clientID. lost is called when
+// the connection is lost.
+type dialer func(clientID string, lost stan.ConnectionLostHandler) (stan.Conn, error)
+
+// dial connects to the NATS Streaming server of the stream URL.
+func (s *NATSStream) dial(clientID string, lost stan.ConnectionLostHandler) (stan.Conn, error) {
+	natsUrl := s.url
+	natsUrl.Scheme, natsUrl.Path = "nats", ""
+	return stan.Connect(s.url.Path[1:], clientID, stan.NatsURL(natsUrl.String()),
+		stan.Pings(5, 3),
+		stan.SetConnectionLostHandler(lost),
+	)
+}
+
+// connect opens a new connection to the server. A lost connection is handed
+// to reconnect. If the client ID is still registered by a lost connection,
+// it connects with a new unique client ID.
+func (s *NATSStream) connect() (stan.Conn, error) {
+	lost := func(conn stan.Conn, reason error) {
+		if s.opts.ConnectionLostHandler != nil {
+			s.opts.ConnectionLostHandler(conn, reason)
+		}
+		go s.reconnect(conn, reason)
+	}
+	conn, err := s.dialer(s.connClientID, lost)
+	if isClientIDTaken(err) {
+		taken := s.connClientID
+		s.connClientID = s.clientID + "-" + uuid.New().String()
+		log.Printf("[stan] Client ID %q still registered, connecting as %q", taken, s.connClientID)
+		conn, err = s.dialer(s.connClientID, lost)
+	}
+	return conn, err
+}
+
+// publish publishes m. While reconnecting, and while buffered messages are
+// being published after a reconnect, m is appended to the buffer and
+// ErrBuffered is returned, so messages are published in order.
+func (s *NATSStream) publish(m bufferedMsg) error {
+	s.mu.RLock()
+	state, conn := s.state, s.conn
+	s.mu.RUnlock()
+
+	if state == StateClosed {
+		return ErrClosed
+	}
+	s.pubMu.Lock()
+	if state == StateConnected && len(s.buffer) == 0 {
+		s.pubMu.Unlock()
+		err := conn.Publish(m.channel, m.data)
+		if err == nil {
+			return nil
+		}
+		if !isConnErr(err) {
+			return errors.Wrap(err, "publish message")
+		}
+		s.pubMu.Lock()
+	}
+	defer s.pubMu.Unlock()
+
+	if len(s.buffer) >= s.opts.PublishBufferSize {
+		return ErrPublishBufferFull
+	}
+	s.buffer = append(s.buffer, m)
+	return ErrBuffered
+}
+
+// flush publishes the buffered messages on conn in order, including those
+// buffered while flushing. The buffer is copied under pubMu and published
+// without holding any lock. A failed publish is handled as a lost
+// connection, keeping the rest of the buffer for the next reconnect.
+func (s *NATSStream) flush(conn stan.Conn) {
+	for {
+		s.pubMu.Lock()
+		pending := append([]bufferedMsg(nil), s.buffer...)
+		s.pubMu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for i, m := range pending {
+			if err := conn.Publish(m.channel, m.data); err != nil {
+				s.dropBuffered(i)
+				go s.reconnect(conn, errors.Wrap(err, "publish buffered messages"))
+				return
+			}
+		}
+		s.dropBuffered(len(pending))
+	}
+}
+
+// dropBuffered removes the first n messages of the buffer, which have been
+// published.
+func (s *NATSStream) dropBuffered(n int) {
+	s.pubMu.Lock()
+	defer s.pubMu.Unlock()
+
+	s.buffer = s.buffer[n:]
+	if len(s.buffer) == 0 {
+		s.buffer = nil
+	}
+}
+
+// reconnect replaces the lost connection old. It retries with exponential
+// backoff until connected or the stream is closed, then resubscribes each
+// subscription after its last delivered message and publishes the buffered
+// messages.
+func (s *NATSStream) reconnect(old stan.Conn, reason error) {
+	s.mu.Lock()
+	if s.state != StateConnected || s.conn != old {
+		s.mu.Unlock()
+		return
+	}
+	s.state, s.lastErr = StateReconnecting, reason
+	s.mu.Unlock()
+	old.Close()
+	log.Printf("[stan] Connection lost, reason: %v. Reconnecting", reason)
+
+	wait := s.opts.ReconnectWait
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-s.closing:
+			return
+		case <-time.After(wait):
+		}
+		conn, err := s.resume()
+		if err == nil {
+			atomic.AddUint64(&s.reconnectCnt, 1)
+			log.Printf("[stan] Reconnected to '%s' after %d attempts", s.url.String(), attempt)
+			s.flush(conn)
+			return
+		}
+		log.Printf("[stan] Reconnect attempt %d failed: %v", attempt, err)
+		s.mu.Lock()
+		s.lastErr = err
+		s.mu.Unlock()
+
+		if wait *= 2; wait > s.opts.MaxReconnectWait {
+			wait = s.opts.MaxReconnectWait
+		}
+	}
+}
+
+// resume connects and resubscribes, marking the stream connected on
+// success. Publishing keeps buffering until the buffer has been flushed.
+func (s *NATSStream) resume() (stan.Conn, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == StateClosed {
+		conn.Close()
+		return nil, ErrClosed
+	}
+	for sub := range s.subs {
+		if err := sub.subscribe(conn); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "resubscribe %q", sub.subject)
+		}
+	}
+	s.conn, s.state, s.lastErr = conn, StateConnected, nil
+	return conn, nil
+}
+
+// subscription is a subscription on a NATSStream that survives reconnects.
+type subscription struct {
+	stream  *NATSStream
+	subject string
+	handler stan.MsgHandler
+
+	// lastSeq is the sequence of the last delivered message.
+	lastSeq uint64
+
+	mu  sync.Mutex
+	sub stan.Subscription
+}
+
+// subscribe subscribes on conn after the last delivered message.
+func (sub *subscription) subscribe(conn stan.Conn) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	s, err := conn.QueueSubscribe(sub.subject, "", sub.handler, stan.StartAtSequence(atomic.LoadUint64(&sub.lastSeq)+1))
+	if err != nil {
+		return err
+	}
+	sub.sub = s
+	return nil
+}
+
+func (sub *subscription) close() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.sub == nil {
+		return nil
+	}
+	err := sub.sub.Close()
+	sub.sub = nil
+	return err
+}
+
+// Close stops delivery of messages to the subscription.
+func (sub *subscription) Close() error {
+	s := sub.stream
+	s.mu.Lock()
+	if _, ok := s.subs[sub]; !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.subs, sub)
+	s.mu.Unlock()
+
+	return sub.close()
+}
@@ -0,0 +1,334 @@
+package nats_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gonats "github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/nats"
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+)
+
+// fakeServer is a NATS Streaming server for the fake connections.
+type fakeServer struct {
+	mu sync.Mutex
+	// down makes dialing fail.
+	down bool
+	// sticky keeps client IDs registered when their connection is closed,
+	// like a server that has not yet noticed a lost connection.
+	sticky    bool
+	clients   map[string]bool
+	conns     []*fakeConn
+	published [][]byte
+	// block, if set, is received from before each publish.
+	block chan struct{}
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{clients: make(map[string]bool)}
+}
+
+func (srv *fakeServer) dial(clientID string, lost stan.ConnectionLostHandler) (stan.Conn, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.down {
+		return nil, errors.New("connection refused")
+	}
+	if srv.clients[clientID] {
+		return nil, errors.New("stan: clientID already registered")
+	}
+	srv.clients[clientID] = true
+	c := &fakeConn{srv: srv, clientID: clientID, lost: lost}
+	srv.conns = append(srv.conns, c)
+	return c, nil
+}
+
+func (srv *fakeServer) setDown(down bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.down = down
+}
+
+func (srv *fakeServer) conn(i int) *fakeConn {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if i >= len(srv.conns) {
+		return nil
+	}
+	return srv.conns[i]
+}
+
+// names returns the body names of the published messages, in order.
+func (srv *fakeServer) names(t *testing.T) []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	names := []string{}
+	for _, data := range srv.published {
+		var e nats.Envelope
+		var b body
+		if err := json.Unmarshal(data, &e); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(e.Body, &b); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+type fakeConn struct {
+	stan.Conn
+
+	srv      *fakeServer
+	clientID string
+	lost     stan.ConnectionLostHandler
+	closed   bool
+	subs     []*fakeSub
+}
+
+func (c *fakeConn) Publish(subject string, data []byte) error {
+	c.srv.mu.Lock()
+	block := c.srv.block
+	c.srv.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	if c.closed {
+		return stan.ErrConnectionClosed
+	}
+	c.srv.published = append(c.srv.published, data)
+	return nil
+}
+
+func (c *fakeConn) QueueSubscribe(subject, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	o := stan.DefaultSubscriptionOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+
+	sub := &fakeSub{subject: subject, start: o.StartSequence, cb: cb}
+	c.subs = append(c.subs, sub)
+	return sub, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+
+	c.closed = true
+	if !c.srv.sticky {
+		delete(c.srv.clients, c.clientID)
+	}
+	return nil
+}
+
+func (c *fakeConn) NatsConn() *gonats.Conn { return nil }
+
+// drop makes the stream lose the connection.
+func (c *fakeConn) drop() {
+	c.lost(c, errors.New("connection lost"))
+}
+
+func (c *fakeConn) sub(i int) *fakeSub {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	if i >= len(c.subs) {
+		return nil
+	}
+	return c.subs[i]
+}
+
+type fakeSub struct {
+	stan.Subscription
+
+	subject string
+	start   uint64
+	cb      stan.MsgHandler
+}
+
+func (s *fakeSub) Close() error { return nil }
+
+// deliver delivers a message named name at seq to the subscription.
+func (s *fakeSub) deliver(t *testing.T, seq uint64, name string) {
+	msg := nats.NewMessage()
+	msg.SetSubject(streaminterface.SubjectFromStr(s.subject + ":2024.klan.team-1.updated"))
+	msg.SetBody(&body{Name: name})
+	e, err := nats.NewEnvelope(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(e)
+	s.cb(&stan.Msg{MsgProto: pb.MsgProto{Sequence: seq, Subject: s.subject, Data: data}})
+}
+
+type body struct {
+	Name string `json:"name"`
+}
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for " + msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestStream(t *testing.T, srv *fakeServer, options ...nats.NatsStreamOption) *nats.NATSStream {
+	monitor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"channels": [{"name": "NATHEJK", "last_seq": 3}]}`))
+	}))
+	t.Cleanup(monitor.Close)
+
+	options = append([]nats.NatsStreamOption{
+		nats.StreamOptionMontiorDSN(monitor.URL),
+		nats.StreamOptionReconnectWait(time.Millisecond, 5*time.Millisecond),
+	}, options...)
+	s, err := nats.NewTestNATSStream("client", srv.dial, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func publishName(s *nats.NATSStream, name string) error {
+	msg := s.MessageFunc()(streaminterface.SubjectFromStr("NATHEJK:2024.klan.team-1.updated"))
+	msg.SetBody(&body{Name: name})
+	return s.Publish(msg)
+}
+
+func TestReconnectResubscribesAfterLastDelivered(t *testing.T) {
+	assert := assert.New(t)
+	srv := newFakeServer()
+	s := newTestStream(t, srv)
+
+	var mu sync.Mutex
+	received := []string{}
+	_, err := s.Subscribe("NATHEJK", streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+		if caughtup.IsCaughtup(msg) {
+			return nil
+		}
+		var b body
+		msg.Body(&b)
+		mu.Lock()
+		received = append(received, b.Name)
+		mu.Unlock()
+		return nil
+	}))
+	assert.NoError(err)
+
+	conn := srv.conn(0)
+	assert.Equal(uint64(1), conn.sub(0).start)
+	conn.sub(0).deliver(t, 1, "one")
+	conn.sub(0).deliver(t, 2, "two")
+
+	conn.drop()
+	eventually(t, func() bool { return srv.conn(1) != nil && srv.conn(1).sub(0) != nil }, "resubscribe")
+	assert.Equal(uint64(3), srv.conn(1).sub(0).start, "resubscribe after the last delivered message")
+	assert.Equal(nats.StateConnected, s.State())
+	assert.Equal(uint64(1), s.Stats().Reconnects)
+
+	srv.conn(1).sub(0).deliver(t, 3, "three")
+	mu.Lock()
+	assert.Equal([]string{"one", "two", "three"}, received)
+	mu.Unlock()
+}
+
+func TestPublishBuffersWhileReconnecting(t *testing.T) {
+	assert := assert.New(t)
+	srv := newFakeServer()
+	s := newTestStream(t, srv, nats.StreamOptionPublishBufferSize(2))
+
+	assert.NoError(publishName(s, "before"))
+
+	srv.setDown(true)
+	srv.conn(0).drop()
+	eventually(t, func() bool { return s.State() == nats.StateReconnecting }, "reconnecting")
+
+	assert.ErrorIs(publishName(s, "one"), nats.ErrBuffered)
+	assert.ErrorIs(publishName(s, "two"), nats.ErrBuffered)
+	assert.ErrorIs(publishName(s, "three"), nats.ErrPublishBufferFull)
+	assert.Equal(2, s.Stats().Buffered)
+
+	srv.setDown(false)
+	eventually(t, func() bool { return s.Stats().Buffered == 0 }, "flush")
+	assert.Equal(nats.StateConnected, s.State())
+	assert.NoError(publishName(s, "after"))
+	assert.Equal([]string{"before", "one", "two", "after"}, srv.names(t))
+}
+
+func TestFlushKeepsOrderWithoutBlockingPublish(t *testing.T) {
+	assert := assert.New(t)
+	srv := newFakeServer()
+	s := newTestStream(t, srv)
+
+	srv.setDown(true)
+	srv.conn(0).drop()
+	eventually(t, func() bool { return s.State() == nats.StateReconnecting }, "reconnecting")
+	assert.ErrorIs(publishName(s, "one"), nats.ErrBuffered)
+	assert.ErrorIs(publishName(s, "two"), nats.ErrBuffered)
+
+	// Hold the flush in the first publish after reconnecting.
+	block := make(chan struct{})
+	srv.mu.Lock()
+	srv.block = block
+	srv.down = false
+	srv.mu.Unlock()
+	eventually(t, func() bool { return s.State() == nats.StateConnected }, "connected")
+
+	// Publishing during the flush is buffered behind it rather than waiting
+	// for it.
+	done := make(chan error)
+	go func() { done <- publishName(s, "three") }()
+	select {
+	case err := <-done:
+		assert.ErrorIs(err, nats.ErrBuffered)
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by flush")
+	}
+
+	srv.mu.Lock()
+	srv.block = nil
+	srv.mu.Unlock()
+	close(block)
+	eventually(t, func() bool { return s.Stats().Buffered == 0 }, "flush")
+	assert.Equal([]string{"one", "two", "three"}, srv.names(t))
+}
+
+func TestReconnectWithClientIDStillRegistered(t *testing.T) {
+	assert := assert.New(t)
+	srv := newFakeServer()
+	srv.sticky = true
+	s := newTestStream(t, srv)
+
+	srv.conn(0).drop()
+	eventually(t, func() bool { return s.State() == nats.StateConnected && srv.conn(1) != nil }, "reconnect")
+	assert.Equal("client", srv.conn(0).clientID)
+	assert.True(strings.HasPrefix(srv.conn(1).clientID, "client-"), srv.conn(1).clientID)
+	assert.Equal("client", s.ClientID())
+	assert.NoError(publishName(s, "after"))
+}
@@ -3,7 +3,6 @@ package nats
 import (
 	"bufio"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/url"
@@ -12,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/stan.go"
@@ -34,6 +34,16 @@ type NatsStreamOptions struct {
 
 	// ImmediateCatchup sends the catchup event before any other event—effectivly skipping it.
 	ImmediateCatchup bool
+
+	// ReconnectWait is the delay before the first reconnect attempt after
+	// the connection is lost. It doubles on each failed attempt, up to
+	// MaxReconnectWait.
+	ReconnectWait    time.Duration
+	MaxReconnectWait time.Duration
+
+	// PublishBufferSize is the number of messages kept for publishing while
+	// reconnecting. Publish fails with ErrPublishBufferFull beyond that.
+	PublishBufferSize int
 }
 
 /*
@@ -46,8 +56,8 @@ func StreamOptionWithValidator(v messagevalidator.MessageValidator) NatsStreamOp
 }
 */
 
-// StreamOptionConnectionLostHandler sets your specified connection lost handler, instead of the default one that panics on
-// connection lost.
+// StreamOptionConnectionLostHandler sets a handler called when the
+// connection is lost, before the stream starts reconnecting.
 func StreamOptionConnectionLostHandler(f func(stan.Conn, error)) NatsStreamOption {
 	return func(o *NatsStreamOptions) {
 		o.ConnectionLostHandler = f
@@ -75,23 +85,54 @@ func StreamOptionImmediateCatchup() NatsStreamOption {
 	}
 }
 
+// StreamOptionReconnectWait sets the initial and maximum delay between
+// reconnect attempts.
+func StreamOptionReconnectWait(wait, max time.Duration) NatsStreamOption {
+	return func(o *NatsStreamOptions) {
+		o.ReconnectWait = wait
+		o.MaxReconnectWait = max
+	}
+}
+
+// StreamOptionPublishBufferSize sets the number of messages buffered while
+// reconnecting.
+func StreamOptionPublishBufferSize(n int) NatsStreamOption {
+	return func(o *NatsStreamOptions) {
+		o.PublishBufferSize = n
+	}
+}
+
 type NATSStream struct {
+	// mu guards conn, state, lastErr, subs and the maps below.
 	mu *sync.RWMutex
 
-	conn     stan.Conn
-	monitor  natsMonitor
-	url      url.URL
-	clientID string
+	conn         stan.Conn
+	monitor      Monitor
+	url          url.URL
+	clientID     string
+	connClientID string
+	state        ConnState
+	lastErr      error
+	closing      chan struct{}
 
 	lastSequences map[string]int64
 	discardMsgMap map[string]map[uint64]bool
-	subMap        map[string]stan.Subscription
+	subs          map[*subscription]struct{}
 	//internal      streaminterface.Stream
 	opts NatsStreamOptions
 
+	// dialer opens the connections of the stream.
+	dialer dialer
+
+	// pubMu guards buffer. A non-empty buffer is published in order before
+	// new messages.
+	pubMu  sync.Mutex
+	buffer []bufferedMsg
+
 	decodeMsgErrCnt uint64
 	discardMsgCnt   uint64
 	msgCnt          uint64
+	reconnectCnt    uint64
 }
 
 func NewNATSStream(stanDsn, clientId string, options ...NatsStreamOption) *NATSStream {
@@ -99,19 +140,25 @@ func NewNATSStream(stanDsn, clientId string, options ...NatsStreamOption) *NATSS
 	if err != nil || len(stanUrl.Path) < 1 {
 		log.Fatal("Missing or malformed URL. Expected 'stan://[user[:pass]@]host[:port][/cluster]'")
 	}
-	natsUrl := *stanUrl
-	natsUrl.Scheme, natsUrl.Path = "nats", ""
+	s, err := newNATSStream(*stanUrl, clientId, nil, options...)
+	if err != nil {
+		log.Fatalf("Can't connect: %v.\nMake sure a NATS Streaming Server is running at: %s", err, stanUrl.String())
+	}
 
-	var opts NatsStreamOptions
+	log.Printf("Connected to '%s' as client: [%s]\n", stanUrl.String(), clientId)
+	return s
+}
 
-	// default connection lost handler
-	opts.ConnectionLostHandler = func(_ stan.Conn, reason error) {
-		log.Output(2, fmt.Sprintf("Connection lost, reason: %v", reason))
-		os.Exit(111)
-	}
+// newNATSStream returns a stream connected with dial, or to the server at
+// stanUrl if dial is nil.
+func newNATSStream(stanUrl url.URL, clientId string, dial dialer, options ...NatsStreamOption) (*NATSStream, error) {
+	var opts NatsStreamOptions
 
 	// default monitor dsn
 	opts.MonitorDSN = "http://" + stanUrl.Hostname() + ":8222"
+	opts.ReconnectWait = time.Second
+	opts.MaxReconnectWait = 30 * time.Second
+	opts.PublishBufferSize = 1000
 
 	// apply user config
 	for _, opt := range options {
@@ -126,24 +173,27 @@ func NewNATSStream(stanDsn, clientId string, options ...NatsStreamOption) *NATSS
 
 	s := &NATSStream{
 		opts:          opts,
-		url:           *stanUrl,
+		url:           stanUrl,
 		mu:            &sync.RWMutex{},
 		lastSequences: make(map[string]int64),
-		subMap:        make(map[string]stan.Subscription),
-		monitor:       natsMonitor{Url: opts.MonitorDSN},
+		subs:          make(map[*subscription]struct{}),
+		monitor:       Monitor{Url: opts.MonitorDSN},
 		clientID:      clientId,
+		connClientID:  clientId,
+		closing:       make(chan struct{}),
+		dialer:        dial,
+	}
+	if s.dialer == nil {
+		s.dialer = s.dial
 	}
 
 	// Setup nats connection
-	s.conn, err = stan.Connect(stanUrl.Path[1:], clientId, stan.NatsURL(natsUrl.String()),
-		stan.SetConnectionLostHandler(opts.ConnectionLostHandler),
-	)
+	conn, err := s.connect()
 	if err != nil {
-		log.Fatalf("Can't connect: %v.\nMake sure a NATS Streaming Server is running at: %s", err, stanUrl.String())
+		return nil, err
 	}
-
-	log.Printf("Connected to '%s' as client: [%s]\n", stanUrl.String(), clientId)
-	return s
+	s.conn = conn
+	return s, nil
 }
 
 func NewNATSStreamUnique(stanDsn, clientId string, options ...NatsStreamOption) *NATSStream {
@@ -157,26 +207,99 @@ func (s *NATSStream) ClientID() string {
 }
 
 func (s *NATSStream) Channels() (channels []string) {
-	for ch := range s.monitor.Channels() {
+	chs, err := s.monitor.Channels()
+	if err != nil {
+		log.Printf("[stan] channels: %s", err)
+	}
+	for ch := range chs {
 		channels = append(channels, ch)
 	}
 	return channels
 }
 
+// Ping returns an error unless the stream is connected.
+func (s *NATSStream) Ping() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch s.state {
+	case StateReconnecting:
+		return errors.Errorf("reconnecting: %v", s.lastErr)
+	case StateClosed:
+		return errors.New("closed")
+	}
+	nc := s.conn.NatsConn()
+	if nc == nil {
+		return errors.New("not connected")
+	}
+	if !nc.IsConnected() {
+		return errors.Errorf("connection %s", nc.Status())
+	}
+	return nil
+}
+
+// State returns the connection state of the stream.
+func (s *NATSStream) State() ConnState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+// NATSStreamStats counts the messages received on all subscriptions of a
+// NATSStream, the reconnects and the messages waiting to be published.
+type NATSStreamStats struct {
+	Msgs         uint64
+	DecodeErrors uint64
+	Discarded    uint64
+	Reconnects   uint64
+	Buffered     int
+}
+
+func (s *NATSStream) Stats() NATSStreamStats {
+	s.pubMu.Lock()
+	buffered := len(s.buffer)
+	s.pubMu.Unlock()
+
+	return NATSStreamStats{
+		Msgs:         atomic.LoadUint64(&s.msgCnt),
+		DecodeErrors: atomic.LoadUint64(&s.decodeMsgErrCnt),
+		Discarded:    atomic.LoadUint64(&s.discardMsgCnt),
+		Reconnects:   atomic.LoadUint64(&s.reconnectCnt),
+		Buffered:     buffered,
+	}
+}
+
+// LastSequence returns the current last sequence of channel as reported by
+// the monitor endpoint.
+func (s *NATSStream) LastSequence(channel string) (int64, error) {
+	return s.monitor.LastSequence(channel)
+}
+
+// SetInvalidMessagesIds sets the skip list of the stream, keyed by channel
+// and sequence. Skipped messages are counted as discarded and not handed to
+// subscribers. The cached last sequences are dropped, so subscriptions made
+// after the call, e.g. when rebuilding projections, announce caughtup at the
+// current end of their channel.
 func (s *NATSStream) SetInvalidMessagesIds(m map[string]map[uint64]bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.discardMsgMap = m
+	s.lastSequences = make(map[string]int64)
 }
 
-func (s *NATSStream) lastSequence(subject string) int64 {
+func (s *NATSStream) lastSequence(subject string) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	seqId, exist := s.lastSequences[subject]
 	if !exist {
-		seqId = s.monitor.LastSequence(subject)
+		var err error
+		seqId, err = s.monitor.LastSequence(subject)
+		if err != nil {
+			return 0, err
+		}
 		s.lastSequences[subject] = seqId
 
 		if s.discardMsgMap == nil {
@@ -186,11 +309,18 @@ func (s *NATSStream) lastSequence(subject string) int64 {
 			s.discardMsgMap[subject] = make(map[uint64]bool)
 		}
 	}
-	return seqId
+	return seqId, nil
 }
 
+// Subscribe delivers all messages on subject to cb, from the first one. The
+// caughtup sentinel is delivered once the last message present when
+// subscribing has been handled. If the connection is lost, the subscription
+// continues after the last delivered message once reconnected.
 func (c *NATSStream) Subscribe(subject string, cb streaminterface.MessageHandler) (streaminterface.Subscription, error) {
-	lastSequence := c.lastSequence(subject)
+	lastSequence, err := c.lastSequence(subject)
+	if err != nil {
+		return nil, errors.Wrapf(err, "last sequence of %q", subject)
+	}
 	var caughtupcount int32
 	if lastSequence == 0 || c.opts.ImmediateCatchup {
 		atomic.StoreInt32(&caughtupcount, 1)
@@ -199,8 +329,10 @@ func (c *NATSStream) Subscribe(subject string, cb streaminterface.MessageHandler
 		log.Printf("[stan] '%s' caughtup. messages: 0", subject)
 	}
 
-	s, err := c.conn.QueueSubscribe(subject, "", func(stanMsg *stan.Msg) {
+	sub := &subscription{stream: c, subject: subject}
+	sub.handler = func(stanMsg *stan.Msg) {
 		atomic.AddUint64(&c.msgCnt, 1)
+		atomic.StoreUint64(&sub.lastSeq, stanMsg.Sequence)
 
 		c.mu.RLock()
 		_, discard := c.discardMsgMap[subject][stanMsg.Sequence]
@@ -236,12 +368,23 @@ func (c *NATSStream) Subscribe(subject string, cb streaminterface.MessageHandler
 				atomic.LoadUint64(&c.discardMsgCnt),
 				atomic.LoadUint64(&c.decodeMsgErrCnt))
 		}
-	}, stan.StartAtSequence(0))
-	if err != nil {
-		return nil, err
 	}
 
-	return s, nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateClosed {
+		return nil, ErrClosed
+	}
+	// While reconnecting the subscription is made once connected.
+	if c.state == StateConnected {
+		if err := sub.subscribe(c.conn); err != nil {
+			return nil, err
+		}
+	}
+	c.subs[sub] = struct{}{}
+
+	return sub, nil
 }
 
 type Identifiable interface {
@@ -250,31 +393,19 @@ type Identifiable interface {
 	CausationID() string
 }
 
+// Publish publishes msg on the channel of its subject. While reconnecting
+// the message is buffered, published once connected, and ErrBuffered is
+// returned.
 func (s *NATSStream) Publish(msg streaminterface.Message) error {
-	ID, ok := msg.(Identifiable)
-	if !ok {
-		return errors.New("Message does not implement 'Identifiable' interface")
-	}
-
-	buf, err := json.Marshal(envelope{
-		EventID:       ID.EventID(),
-		CorrelationID: ID.CorrelationID(),
-		CausationID:   ID.CausationID(),
-		Version:       0,
-		Datetime:      msg.Time(),
-		Type:          msg.Subject().Type(),
-		Body:          msg.RawBody().(json.RawMessage),
-		Meta:          msg.RawMeta().(json.RawMessage),
-	})
+	e, err := NewEnvelope(msg)
 	if err != nil {
-		return errors.Wrap(err, "encode message")
+		return err
 	}
-
-	err = s.conn.Publish(msg.Subject().Domain(), buf)
+	buf, err := json.Marshal(e)
 	if err != nil {
-		return errors.Wrap(err, "publish message")
+		return errors.Wrap(err, "encode message")
 	}
-	return nil
+	return s.publish(bufferedMsg{channel: msg.Subject().Domain(), data: buf})
 }
 
 func (s *NATSStream) MessageFunc() streaminterface.MessageFunc {
@@ -290,42 +421,83 @@ func (c *NATSStream) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	for _, sub := range c.subMap {
-		sub.Close()
+	if c.state == StateClosed {
+		return nil
 	}
+	c.state = StateClosed
+	close(c.closing)
+	for sub := range c.subs {
+		sub.close()
+	}
+	c.subs = nil
 	c.conn.Close()
 	log.Println("[stan] Close Ok")
 	return nil
 }
 
-func LoadInvalidEventsFromReader(rd io.Reader) map[string]map[uint64]bool {
+// LoadInvalidEventsFromReader reads a skip list of events, one per line. A
+// line is either "channel:?:sequence", or a JSON object with "channel" and
+// "sequence" fields, such as the output of "nathejkctl stream dump". Blank
+// lines and lines starting with "#" are ignored.
+//
+// In the "channel:?:sequence" form the middle field is not used; it may hold
+// anything without a colon, e.g. the event type, to make the list readable:
+//
+//	# klan updated with a broken member list
+//	NATHEJK:2024.klan.updated:1234
+//	NATHEJK:?:1240
+//
+// An error names the first line that could not be read.
+func LoadInvalidEventsFromReader(rd io.Reader) (map[string]map[uint64]bool, error) {
 	invalidEvents := make(map[string]map[uint64]bool)
 	scanner := bufio.NewScanner(rd)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ":")
-		channel := parts[0]
-		sequence, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil {
-			panic(err)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var channel string
+		var sequence uint64
+		if strings.HasPrefix(line, "{") {
+			var r struct {
+				Channel  string `json:"channel"`
+				Sequence uint64 `json:"sequence"`
+			}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				return nil, errors.Wrapf(err, "skip list line %d", n)
+			}
+			channel, sequence = r.Channel, r.Sequence
+		} else {
+			parts := strings.Split(line, ":")
+			if len(parts) != 3 {
+				return nil, errors.Errorf("skip list line %d: invalid line %q, expected 'channel:?:sequence'", n, line)
+			}
+			seq, err := strconv.ParseUint(parts[2], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "skip list line %d", n)
+			}
+			channel, sequence = parts[0], seq
 		}
 		if invalidEvents[channel] == nil {
 			invalidEvents[channel] = make(map[uint64]bool)
 		}
-		invalidEvents[channel][uint64(sequence)] = true
+		invalidEvents[channel][sequence] = true
 	}
 
 	if err := scanner.Err(); err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return invalidEvents
+	return invalidEvents, nil
 }
 
-func LoadInvalidEventsFromFile(filename string) map[string]map[uint64]bool {
+// LoadInvalidEventsFromFile reads the skip list in the named file, see
+// LoadInvalidEventsFromReader.
+func LoadInvalidEventsFromFile(filename string) (map[string]map[uint64]bool, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer file.Close()
 	return LoadInvalidEventsFromReader(file)
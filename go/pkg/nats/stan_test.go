@@ -2,6 +2,7 @@ package nats_test
 
 import (
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -153,3 +154,33 @@ func TestStreamIntegrationLoadAll(t *testing.T) {
 		memstat.PrintMemoryStats()
 	}
 }
+
+func TestLoadInvalidEventsFromReader(t *testing.T) {
+	skip, err := nats.LoadInvalidEventsFromReader(strings.NewReader(`# comment
+NATHEJK:?:12
+
+{"channel":"NATHEJK","sequence":13,"eventId":"event-1","type":"2024.klan.team-1.updated","body":{}}
+nathejk:x:4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skip["NATHEJK"][12] || !skip["NATHEJK"][13] || !skip["nathejk"][4] {
+		t.Fatalf("unexpected skip list %v", skip)
+	}
+	if len(skip["NATHEJK"]) != 2 {
+		t.Fatalf("exp 2 events on NATHEJK, got %v", skip["NATHEJK"])
+	}
+}
+
+func TestLoadInvalidEventsFromReaderErrors(t *testing.T) {
+	for _, in := range []string{
+		"NATHEJK:12",
+		"NATHEJK:?:twelve",
+		"{not json",
+	} {
+		if _, err := nats.LoadInvalidEventsFromReader(strings.NewReader("# comment\n" + in + "\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: exp error on line 2, got %v", in, err)
+		}
+	}
+}
@@ -27,6 +27,23 @@ func (c *client) Consume(query string) error {
 	return nil
 }
 
+// ConsumeTx executes the queries in one transaction, which is rolled back
+// if any of them fails.
+func (c *client) ConsumeTx(queries ...string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			c.stderr.Write([]byte(query + "\n"))
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (c *client) Close() error {
 	return c.db.Close()
 }
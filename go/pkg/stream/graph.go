@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// Graph is the consumer→subject graph of a Switch, carrying the live stats
+// of each node.
+type Graph struct {
+	Subjects  []SubjectNode  `json:"subjects"`
+	Consumers []ConsumerNode `json:"consumers"`
+	Edges     []Edge         `json:"edges"`
+}
+
+// SubjectNode is a subject (domain) consumed or produced by the consumers of
+// a switch.
+type SubjectNode struct {
+	Subject string `json:"subject"`
+	Root    bool   `json:"root"`
+	InMsgs  uint64 `json:"inMsgs"`
+	OutMsgs uint64 `json:"outMsgs"`
+}
+
+// ConsumerNode is a consumer of a switch.
+type ConsumerNode struct {
+	Name         string            `json:"name"`
+	InMsgs       uint64            `json:"inMsgs"`
+	OutMsgs      uint64            `json:"outMsgs"`
+	CaughtUp     bool              `json:"caughtUp"`
+	LastSequence map[string]uint64 `json:"lastSequence"`
+}
+
+// Edge connects a subject and a consumer. Consumes edges go from a subject to
+// a consumer, produces edges from a consumer to a subject. Types lists the
+// message types of the subject, an empty list means all types.
+type Edge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Kind  string   `json:"kind"`
+	Types []string `json:"types,omitempty"`
+}
+
+const (
+	EdgeConsumes = "consumes"
+	EdgeProduces = "produces"
+)
+
+// Topology returns the topology for the consumers of this switch.
+func (m *Switch) Topology() Topology {
+	return m.topo
+}
+
+// Graph returns the consumer→subject graph of the switch with the current
+// stats of each node.
+func (m *Switch) Graph() Graph {
+	var g Graph
+
+	subjectStats := map[string]SubjectStats{}
+	for _, s := range m.SubjectStats() {
+		subjectStats[s.Subject] = s
+	}
+	subjects := map[string]bool{}
+
+	consumerStats := m.ConsumerStats()
+	for i, h := range m.handlers {
+		cs := consumerStats[i]
+		g.Consumers = append(g.Consumers, ConsumerNode{
+			Name:         cs.Name,
+			InMsgs:       cs.InMsgs,
+			OutMsgs:      cs.OutMsgs,
+			CaughtUp:     cs.CaughtUp,
+			LastSequence: cs.LastSequence,
+		})
+		for subj, types := range subjectTypeSplit(h.Consumes()) {
+			subjects[subj] = true
+			g.Edges = append(g.Edges, Edge{From: subj, To: cs.Name, Kind: EdgeConsumes, Types: nonEmpty(types)})
+		}
+		if p, ok := h.(streaminterface.Producer); ok {
+			for subj, types := range subjectTypeSplit(p.Produces()) {
+				subjects[subj] = true
+				g.Edges = append(g.Edges, Edge{From: cs.Name, To: subj, Kind: EdgeProduces, Types: nonEmpty(types)})
+			}
+		}
+	}
+	for subj := range subjects {
+		s := subjectStats[subj]
+		g.Subjects = append(g.Subjects, SubjectNode{
+			Subject: subj,
+			Root:    m.topo.RootSubject(subj),
+			InMsgs:  s.InMsgs,
+			OutMsgs: s.OutMsgs,
+		})
+	}
+
+	sort.Slice(g.Subjects, func(i, j int) bool { return g.Subjects[i].Subject < g.Subjects[j].Subject })
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+func nonEmpty(types []string) []string {
+	var out []string
+	for _, t := range types {
+		if t == "" {
+			return nil
+		}
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DOT returns the graph in the Graphviz DOT language. Subjects are drawn as
+// ellipses, consumers as boxes; consumers not caught up are drawn in red.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph switch {\n\trankdir=LR;\n")
+	for _, s := range g.Subjects {
+		label := fmt.Sprintf("%s\\nin: %d out: %d", s.Subject, s.InMsgs, s.OutMsgs)
+		fmt.Fprintf(&b, "\t%s [shape=ellipse, label=%s];\n", dotQuote("subject:"+s.Subject), dotQuote(label))
+	}
+	for _, c := range g.Consumers {
+		seqs := make([]string, 0, len(c.LastSequence))
+		for subj, seq := range c.LastSequence {
+			seqs = append(seqs, fmt.Sprintf("%s@%d", subj, seq))
+		}
+		sort.Strings(seqs)
+		label := fmt.Sprintf("%s\\nin: %d out: %d\\ncaught up: %t", c.Name, c.InMsgs, c.OutMsgs, c.CaughtUp)
+		if len(seqs) > 0 {
+			label += "\\nlast: " + strings.Join(seqs, " ")
+		}
+		color := "black"
+		if !c.CaughtUp {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "\t%s [shape=box, color=%s, label=%s];\n", dotQuote("consumer:"+c.Name), color, dotQuote(label))
+	}
+	for _, e := range g.Edges {
+		from, to := "subject:"+e.From, "consumer:"+e.To
+		if e.Kind == EdgeProduces {
+			from, to = "consumer:"+e.From, "subject:"+e.To
+		}
+		label := strings.Join(e.Types, "\\n")
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(from), dotQuote(to), dotQuote(label))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes s as a DOT string, keeping "\n" line breaks in labels.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,50 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/memorystream"
+	"nathejk.dk/pkg/stream"
+	"nathejk.dk/pkg/streaminterface"
+)
+
+func TestSwitchGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	s := memorystream.New()
+	swtch, err := stream.NewSwitch(stream.NewStreamMux(s), []streaminterface.Consumer{
+		&testHandler{
+			subscribes: []string{"service:updated", "service:removed"},
+			produces:   []string{"servicemodel"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := swtch.Graph()
+	assert.Equal([]stream.SubjectNode{
+		{Subject: "service", Root: true},
+		{Subject: "servicemodel"},
+	}, g.Subjects)
+	assert.Len(g.Consumers, 1)
+	assert.Equal("*stream_test.testHandler", g.Consumers[0].Name)
+	assert.False(g.Consumers[0].CaughtUp)
+	assert.Equal([]stream.Edge{
+		{From: "*stream_test.testHandler", To: "servicemodel", Kind: stream.EdgeProduces},
+		{From: "service", To: "*stream_test.testHandler", Kind: stream.EdgeConsumes, Types: []string{"removed", "updated"}},
+	}, g.Edges)
+
+	buf, err := json.Marshal(g)
+	assert.NoError(err)
+	assert.Contains(string(buf), `"caughtUp":false`)
+
+	dot := g.DOT()
+	assert.True(strings.HasPrefix(dot, "digraph switch {"))
+	assert.Contains(dot, `"subject:service" -> "consumer:*stream_test.testHandler" [label="removed\nupdated"];`)
+	assert.Contains(dot, `"consumer:*stream_test.testHandler" [shape=box, color=red,`)
+}
@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"nathejk.dk/pkg/streaminterface"
+	"nathejk.dk/pkg/streaminterface/caughtup"
+)
+
+// SubjectStats tracks the messages of a single subject (domain) passing
+// through the switch. InMsgs counts messages received by consumers on the
+// subject, OutMsgs the messages handed on to consumers after filtering on
+// type.
+type SubjectStats struct {
+	Subject string
+	InMsgs  uint64
+	OutMsgs uint64
+}
+
+// ConsumerStats tracks the messages handled by a single consumer.
+type ConsumerStats struct {
+	Name     string
+	Subjects []string
+	InMsgs   uint64
+	OutMsgs  uint64
+	CaughtUp bool
+
+	// LastSequence is the sequence of the last message received on each
+	// subject.
+	LastSequence map[string]uint64
+}
+
+type subjectCounter struct {
+	in  uint64
+	out uint64
+}
+
+type consumerCounter struct {
+	name     string
+	subjects []string
+	in       uint64
+	out      uint64
+	caughtup int32
+
+	mu      sync.Mutex
+	lastSeq map[string]uint64
+	applied map[string]uint64
+}
+
+func consumerName(c streaminterface.Consumer) string {
+	if n, ok := c.(fmt.Stringer); ok {
+		return n.String()
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+// counters holds the per subject and per consumer counters of a switch.
+type counters struct {
+	mu        sync.Mutex
+	subjects  map[string]*subjectCounter
+	consumers []*consumerCounter
+
+	// applied is closed when a consumer has handled a message, if anyone
+	// is waiting for it.
+	applied chan struct{}
+}
+
+func (c *counters) subject(subj string) *subjectCounter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subjects == nil {
+		c.subjects = make(map[string]*subjectCounter)
+	}
+	sc, ok := c.subjects[subj]
+	if !ok {
+		sc = &subjectCounter{}
+		c.subjects[subj] = sc
+	}
+	return sc
+}
+
+func (c *counters) consumer(h streaminterface.Consumer, subjects []string) *consumerCounter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sorted := append([]string(nil), subjects...)
+	sort.Strings(sorted)
+	cc := &consumerCounter{name: consumerName(h), subjects: sorted, lastSeq: make(map[string]uint64), applied: make(map[string]uint64)}
+	c.consumers = append(c.consumers, cc)
+	return cc
+}
+
+// countHandler wraps the message handler of a consumer on a subject,
+// counting the messages received before the type filter (in) and the
+// messages passed on by it (out).
+func (m *Switch) countHandler(subj string, cc *consumerCounter) (in, out HandlerMiddleware) {
+	sc := m.counters.subject(subj)
+	in = func(h streaminterface.MessageHandler) streaminterface.MessageHandler {
+		return streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+			if !caughtup.IsCaughtup(msg) {
+				atomic.AddUint64(&m.stats.InMsgs, 1)
+				atomic.AddUint64(&sc.in, 1)
+				atomic.AddUint64(&cc.in, 1)
+				cc.mu.Lock()
+				cc.lastSeq[subj] = msg.Sequence()
+				cc.mu.Unlock()
+			}
+			if err := h.HandleMessage(msg); err != nil {
+				return err
+			}
+			if !caughtup.IsCaughtup(msg) {
+				cc.mu.Lock()
+				cc.applied[subj] = msg.Sequence()
+				cc.mu.Unlock()
+				m.counters.notifyApplied()
+			}
+			return nil
+		})
+	}
+	out = func(h streaminterface.MessageHandler) streaminterface.MessageHandler {
+		return streaminterface.MessageHandlerFunc(func(msg streaminterface.Message) error {
+			atomic.AddUint64(&m.stats.OutMsgs, 1)
+			atomic.AddUint64(&sc.out, 1)
+			atomic.AddUint64(&cc.out, 1)
+			return h.HandleMessage(msg)
+		})
+	}
+	return in, out
+}
+
+// SubjectStats returns the stats of each subject consumed by the switch,
+// sorted by subject.
+func (m *Switch) SubjectStats() []SubjectStats {
+	m.counters.mu.Lock()
+	defer m.counters.mu.Unlock()
+
+	stats := make([]SubjectStats, 0, len(m.counters.subjects))
+	for subj, sc := range m.counters.subjects {
+		stats = append(stats, SubjectStats{
+			Subject: subj,
+			InMsgs:  atomic.LoadUint64(&sc.in),
+			OutMsgs: atomic.LoadUint64(&sc.out),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Subject < stats[j].Subject })
+	return stats
+}
+
+// ConsumerStats returns the stats of each consumer of the switch, in the
+// order the consumers were given to NewSwitch.
+func (m *Switch) ConsumerStats() []ConsumerStats {
+	m.counters.mu.Lock()
+	defer m.counters.mu.Unlock()
+
+	stats := make([]ConsumerStats, 0, len(m.counters.consumers))
+	for _, cc := range m.counters.consumers {
+		cs := ConsumerStats{
+			Name:         cc.name,
+			Subjects:     cc.subjects,
+			InMsgs:       atomic.LoadUint64(&cc.in),
+			OutMsgs:      atomic.LoadUint64(&cc.out),
+			CaughtUp:     atomic.LoadInt32(&cc.caughtup) == 1,
+			LastSequence: make(map[string]uint64),
+		}
+		cc.mu.Lock()
+		for subj, seq := range cc.lastSeq {
+			cs.LastSequence[subj] = seq
+		}
+		cc.mu.Unlock()
+		stats = append(stats, cs)
+	}
+	return stats
+}
+
+func (c *counters) notifyApplied() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.applied != nil {
+		close(c.applied)
+		c.applied = nil
+	}
+}
+
+// Applied returns the sequence of the last message on subj handled by every
+// consumer of subj, and whether the switch has consumers of subj.
+func (m *Switch) Applied(subj string) (seq uint64, ok bool) {
+	m.counters.mu.Lock()
+	defer m.counters.mu.Unlock()
+
+	return m.counters.appliedLocked(subj)
+}
+
+func (c *counters) appliedLocked(subj string) (seq uint64, ok bool) {
+	for _, cc := range c.consumers {
+		for _, s := range cc.subjects {
+			if s != subj {
+				continue
+			}
+			cc.mu.Lock()
+			applied := cc.applied[subj]
+			cc.mu.Unlock()
+			if !ok || applied < seq {
+				seq = applied
+			}
+			ok = true
+		}
+	}
+	return seq, ok
+}
+
+// WaitApplied blocks until every consumer of subj has handled the message
+// at sequence seq, or ctx is done. It returns at once if the switch has no
+// consumers of subj.
+func (m *Switch) WaitApplied(ctx context.Context, subj string, seq uint64) error {
+	for {
+		m.counters.mu.Lock()
+		applied, ok := m.counters.appliedLocked(subj)
+		if !ok || applied >= seq {
+			m.counters.mu.Unlock()
+			return nil
+		}
+		if m.counters.applied == nil {
+			m.counters.applied = make(chan struct{})
+		}
+		changed := m.counters.applied
+		m.counters.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -159,7 +159,8 @@ type Switch struct {
 	subs []streaminterface.Subscription
 
 	// Switch stats
-	stats SwitchStats
+	stats    SwitchStats
+	counters counters
 }
 
 // NewSwitch initializes a new publish-subscriber orchestration tool.
@@ -225,7 +226,8 @@ func (m *Switch) init() error {
 }
 
 // Run creates subscriptions by subscribing all Handlers to their subjects of
-// interest. Run blocks until context is cancelled.
+// interest. Run blocks until context is cancelled, also while waiting on the
+// subscriptions to catch up.
 func (m *Switch) Run(ctx context.Context, noop ...func()) (err error) {
 	// call close on exit
 	defer func() {
@@ -298,7 +300,17 @@ func (m *Switch) Run(ctx context.Context, noop ...func()) (err error) {
 		// there a programming error where you subscribe to a subject that does
 		// not exist AND the publisher doesn't annunce caughtup.
 		log.Println("Switch: wait on catch up")
-		m.caughtup.Wait()
+		caughtup := make(chan struct{})
+		go func() {
+			m.caughtup.Wait()
+			close(caughtup)
+		}()
+		select {
+		case <-caughtup:
+		case <-ctx.Done():
+			log.Println("Switch: cancelled before caught up")
+			return nil
+		}
 		log.Println("Switch: caught up — OK")
 	} else {
 		// call all catchup listeners for the handlers that implement them.
@@ -307,6 +319,9 @@ func (m *Switch) Run(ctx context.Context, noop ...func()) (err error) {
 				cl.CaughtUp()
 			}
 		}
+		for _, cc := range m.counters.consumers {
+			atomic.StoreInt32(&cc.caughtup, 1)
+		}
 	}
 
 	// caught up, set stats before calling caughtup callbacks
@@ -358,20 +373,6 @@ func (m *Switch) Close() (err error) {
 	return err
 }
 
-/*
-// Topology returns the topology for Consumer's in this switch
-func (m *Switch) Topology() *Topology {
-	return m.topo
-}
-
-/*
-// DotGraph returns a dot graph of the topology for the Consumer's in this switch
-func (m *Switch) DotGraph() (string, error) {
-	b, err := dot.Marshal(m.topo.Graph(), "aggregates", "", "\t")
-	return string(b), err
-}
-*/
-
 func (m *Switch) Stats() SwitchStats {
 	// guard for timer variables
 	m.stats.mu.Lock()
@@ -389,6 +390,7 @@ func (m *Switch) Stats() SwitchStats {
 // explodedHandler is a handlers interface types exploded to a struct
 type explodedHandler struct {
 	swtch     *Switch
+	cc        *consumerCounter
 	h         streaminterface.MessageHandler
 	orig      streaminterface.MessageHandler
 	subj      []string
@@ -419,6 +421,7 @@ func explodeHandler(swtch *Switch, sh streaminterface.Consumer) *explodedHandler
 			e.prod = append(e.prod, subject)
 		}
 	}
+	e.cc = swtch.counters.consumer(sh, e.subj)
 
 	return &e
 }
@@ -430,7 +433,7 @@ func (e *explodedHandler) handlermap() map[string]*explodedHandler {
 	cl, _ := e.orig.(streaminterface.CatchupListener)
 	var catchupHandler HandlerMiddleware
 	if e.swtch.opts.waitOnCaughtup {
-		catchupHandler = newCatchupHandler(cl, e.swtch.mux, e.swtch.caughtup, e.subj, e.prod)
+		catchupHandler = newCatchupHandler(cl, e.cc, e.swtch.mux, e.swtch.caughtup, e.subj, e.prod)
 	} else {
 		catchupHandler = noopHandler
 	}
@@ -440,7 +443,8 @@ func (e *explodedHandler) handlermap() map[string]*explodedHandler {
 		// copy of e for each subject, with its own LimitHandler that filters
 		// unwanted types.
 		e := *e
-		e.h = catchupHandler(syncHandler(LimitHandler(e.h, types)))
+		in, out := e.swtch.countHandler(subject, e.cc)
+		e.h = catchupHandler(syncHandler(in(LimitHandler(out(e.h), types))))
 		m[subject] = &e
 	}
 
@@ -466,7 +470,7 @@ func noopHandler(h streaminterface.MessageHandler) streaminterface.MessageHandle
 	return h
 }
 
-func newCatchupHandler(cl streaminterface.CatchupListener, mux *StreamMux, caughtupwg *sync.WaitGroup, subjects, produces []string) func(streaminterface.MessageHandler) streaminterface.MessageHandler {
+func newCatchupHandler(cl streaminterface.CatchupListener, cc *consumerCounter, mux *StreamMux, caughtupwg *sync.WaitGroup, subjects, produces []string) func(streaminterface.MessageHandler) streaminterface.MessageHandler {
 	var done int32
 	var mu sync.Mutex
 
@@ -508,6 +512,7 @@ func newCatchupHandler(cl streaminterface.CatchupListener, mux *StreamMux, caugh
 
 			// we are all caughtup at this point
 			atomic.StoreInt32(&done, 1)
+			atomic.StoreInt32(&cc.caughtup, 1)
 
 			// find the streams we produce on
 			for _, prod := range produces {
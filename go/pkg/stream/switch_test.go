@@ -13,6 +13,7 @@ import (
 	"nathejk.dk/pkg/stream"
 	"nathejk.dk/pkg/streaminterface"
 	"nathejk.dk/pkg/streaminterface/caughtup"
+	"nathejk.dk/pkg/streaminterface/streamtest"
 )
 
 type assetMessageBody struct {
@@ -105,6 +106,119 @@ func TestSwitch(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSwitchStats(t *testing.T) {
+	s := memorystream.New()
+	caughtupCh := make(chan struct{})
+
+	h1 := &testHandler{
+		stream:     s,
+		subscribes: []string{"service:updated"},
+		handler: func(m streaminterface.Message) error {
+			return nil
+		},
+	}
+
+	mux := stream.NewStreamMux(s)
+	newMessage := s.MessageFunc()
+	swtch, err := stream.NewSwitch(mux,
+		[]streaminterface.Consumer{
+			h1,
+		},
+		stream.SwitchSubscribedFunc(func() {
+			s.Publish(newMessage(streaminterface.SubjectFromStr("service:updated")))
+			s.Publish(newMessage(streaminterface.SubjectFromStr("service:removed")))
+			s.Publish(newMessage(streaminterface.SubjectFromStr("service:updated")))
+			s.Publish(caughtup.NewCaughtupMessage("service"))
+		}),
+		stream.SwitchCaughtupFunc(func() {
+			close(caughtupCh)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs := swtch.ConsumerStats(); len(cs) != 1 || cs[0].CaughtUp {
+		t.Fatalf("exp 1 consumer not caught up, got %+v", cs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go swtch.Run(ctx)
+
+	select {
+	case <-caughtupCh:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for caughtup")
+	}
+
+	ss := swtch.SubjectStats()
+	if len(ss) != 1 || ss[0].Subject != "service" || ss[0].InMsgs != 3 || ss[0].OutMsgs != 2 {
+		t.Fatalf("exp service in=3 out=2, got %+v", ss)
+	}
+	cs := swtch.ConsumerStats()
+	if cs[0].Name != "*stream_test.testHandler" || !cs[0].CaughtUp || cs[0].InMsgs != 3 || cs[0].OutMsgs != 2 {
+		t.Fatalf("unexpected consumer stats %+v", cs[0])
+	}
+	if stats := swtch.Stats(); stats.InMsgs != 3 || stats.OutMsgs != 2 {
+		t.Fatalf("exp switch in=3 out=2, got in=%d out=%d", stats.InMsgs, stats.OutMsgs)
+	}
+}
+
+func TestSwitchWaitApplied(t *testing.T) {
+	s := memorystream.New()
+	release := make(chan struct{})
+
+	h1 := &testHandler{
+		stream:     s,
+		subscribes: []string{"service"},
+		handler: func(m streaminterface.Message) error {
+			if m.Sequence() == 2 {
+				<-release
+			}
+			return nil
+		},
+	}
+
+	mux := stream.NewStreamMux(s)
+	swtch, err := stream.NewSwitch(mux, []streaminterface.Consumer{h1},
+		stream.SwitchSubscribedFunc(func() {
+			s.Publish(caughtup.NewCaughtupMessage("service"))
+			go func() {
+				for seq := uint64(1); seq <= 2; seq++ {
+					s.Publish(streamtest.NewMessageP(streaminterface.SubjectFromStr("service:updated"), streamtest.MessageData{Sequence: seq}))
+				}
+			}()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go swtch.Run(ctx)
+
+	if err := swtch.WaitApplied(context.Background(), "service", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+	if err := swtch.WaitApplied(timeout, "service", 2); err != context.DeadlineExceeded {
+		t.Fatalf("exp deadline exceeded waiting for an unhandled message, got %v", err)
+	}
+
+	close(release)
+	if err := swtch.WaitApplied(context.Background(), "service", 2); err != nil {
+		t.Fatal(err)
+	}
+	if seq, ok := swtch.Applied("service"); !ok || seq != 2 {
+		t.Fatalf("exp applied 2, got %d %v", seq, ok)
+	}
+	if err := swtch.WaitApplied(context.Background(), "unknown", 1); err != nil {
+		t.Fatalf("exp no wait without consumers, got %v", err)
+	}
+}
+
 /*
 func TestSwitchNats(t *testing.T) {
 	stanDsn := os.Getenv("TEST_STAN_DSN")
@@ -389,3 +503,37 @@ func benchmarkSwitchComplexN(b *testing.B, N int) {
 func BenchmarkSwitchComplex1000(b *testing.B)   { benchmarkSwitchComplexN(b, 1000) }
 func BenchmarkSwitchComplex10000(b *testing.B)  { benchmarkSwitchComplexN(b, 10000) }
 func BenchmarkSwitchComplex100000(b *testing.B) { benchmarkSwitchComplexN(b, 100000) }
+
+// silentStream never delivers messages, not even the caughtup sentinel.
+type silentStream struct{ streaminterface.Stream }
+
+func (silentStream) Subscribe(string, streaminterface.MessageHandler) (streaminterface.Subscription, error) {
+	return silentSubscription{}, nil
+}
+
+type silentSubscription struct{}
+
+func (silentSubscription) Close() error { return nil }
+
+func TestSwitchCancelBeforeCaughtup(t *testing.T) {
+	mux := stream.NewStreamMux(silentStream{memorystream.New()})
+	swtch, err := stream.NewSwitch(mux, []streaminterface.Consumer{
+		&testHandler{subscribes: []string{"service"}, handler: func(streaminterface.Message) error { return nil }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- swtch.Run(ctx) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
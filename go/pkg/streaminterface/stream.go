@@ -97,6 +97,24 @@ type Publisher interface {
 	MessageFunc() MessageFunc
 }
 
+// SequencePublisher is an optional interface of publishers that know the
+// sequence a message was written at on its channel.
+type SequencePublisher interface {
+	// PublishSequence publishes msg like Publish, and returns the sequence
+	// of the message, or a later sequence of the channel. Zero means the
+	// sequence is not known, e.g. because the message is buffered.
+	PublishSequence(msg Message) (uint64, error)
+}
+
+// PublishSequence publishes msg with p, and returns the sequence it was
+// written at if p is a SequencePublisher, otherwise zero.
+func PublishSequence(p Publisher, msg Message) (uint64, error) {
+	if sp, ok := p.(SequencePublisher); ok {
+		return sp.PublishSequence(msg)
+	}
+	return 0, p.Publish(msg)
+}
+
 // PublisherFunc type is an adapter to allow the use of ordinary functions as
 // Publishers.
 type PublisherFunc func(Message) error
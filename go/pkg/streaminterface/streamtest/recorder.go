@@ -0,0 +1,182 @@
+package streamtest
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	json "github.com/json-iterator/go"
+
+	"nathejk.dk/pkg/streaminterface"
+)
+
+// Recorder is a publisher recording the published messages, for testing
+// commands as "when this is called, expect these events".
+type Recorder struct {
+	mu   sync.Mutex
+	msgs []streaminterface.Message
+	seq  uint64
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Publish(msg streaminterface.Message) error {
+	_, err := r.PublishSequence(msg)
+	return err
+}
+
+// PublishSequence records msg and returns its sequence, counting from 1.
+func (r *Recorder) PublishSequence(msg streaminterface.Message) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	if m, ok := msg.(*Message); ok {
+		m.seq = r.seq
+	}
+	r.msgs = append(r.msgs, msg)
+	return r.seq, nil
+}
+
+func (r *Recorder) MessageFunc() streaminterface.MessageFunc {
+	return MessageFunc
+}
+
+// Messages returns the published messages in order.
+func (r *Recorder) Messages() []streaminterface.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]streaminterface.Message(nil), r.msgs...)
+}
+
+// Reset forgets the published messages.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.msgs = nil
+}
+
+var (
+	_ streaminterface.Publisher         = (*Recorder)(nil)
+	_ streaminterface.SequencePublisher = (*Recorder)(nil)
+)
+
+// Expect is an expected event. Subject may contain "*" matching any one
+// dot separated part, e.g. "NATHEJK:2024.spejder.*.updated". Body, when not
+// nil, must be a subset of the published body: only the fields that are
+// non-zero in Body are compared.
+type Expect struct {
+	Subject string
+	Body    any
+}
+
+// Then fails the test unless exactly the expected events were published,
+// in order.
+func (r *Recorder) Then(t testing.TB, want ...Expect) {
+	t.Helper()
+	got := r.Messages()
+	if len(got) != len(want) {
+		subjects := make([]string, len(got))
+		for i, m := range got {
+			subjects[i] = m.Subject().Subject()
+		}
+		t.Fatalf("published %d events, want %d:\n\t%s", len(got), len(want), strings.Join(subjects, "\n\t"))
+	}
+	for i, e := range want {
+		subj := got[i].Subject().Subject()
+		if !matchSubject(e.Subject, subj) {
+			t.Errorf("event %d: subject %q, want %q", i, subj, e.Subject)
+			continue
+		}
+		if e.Body == nil {
+			continue
+		}
+		var gotBody, wantBody any
+		if err := got[i].Body(&gotBody); err != nil {
+			t.Errorf("event %d: %v", i, err)
+			continue
+		}
+		b, err := json.Marshal(e.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &wantBody); err != nil {
+			t.Fatal(err)
+		}
+		if !containsJSON(gotBody, wantBody) {
+			gb, _ := json.Marshal(gotBody)
+			t.Errorf("event %d %q: body %s, want %s", i, subj, gb, b)
+		}
+	}
+}
+
+func matchSubject(pattern, subj string) bool {
+	p := strings.FieldsFunc(pattern, isSeparator)
+	s := strings.FieldsFunc(subj, isSeparator)
+	if len(p) != len(s) {
+		return false
+	}
+	for i := range p {
+		if p[i] != "*" && !strings.EqualFold(p[i], s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == ':'
+}
+
+// containsJSON reports whether the decoded JSON value got contains want,
+// ignoring zero values in want.
+func containsJSON(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, _ := got.(map[string]any)
+		for k, v := range w {
+			if isZeroJSON(v) {
+				continue
+			}
+			if !containsJSON(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsJSON(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func isZeroJSON(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
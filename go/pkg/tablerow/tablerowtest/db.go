@@ -0,0 +1,542 @@
+// Package tablerowtest runs table projections against an in-memory SQL
+// backend, so they can be tested as "given these events, expect these rows".
+package tablerowtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"nathejk.dk/pkg/tablerow"
+)
+
+// Row is a table row keyed by column name. NULL columns are left out.
+type Row map[string]string
+
+type column struct {
+	name       string
+	notNull    bool
+	hasDefault bool
+	def        *string
+}
+
+type table struct {
+	name    string
+	columns []column
+	primary []string
+	rows    map[string]Row
+}
+
+func (t *table) column(name string) (column, bool) {
+	for _, c := range t.columns {
+		if strings.EqualFold(c.name, name) {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+func (t *table) key(r Row) string {
+	parts := make([]string, len(t.primary))
+	for i, col := range t.primary {
+		parts[i] = r[col]
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// DB is an in-memory SQL backend implementing tablerow.Consumer. It
+// understands the statements written by the table projections:
+//
+//	CREATE TABLE IF NOT EXISTS t (col TYPE [NOT NULL] [DEFAULT v], ..., PRIMARY KEY (col, ...))
+//	ALTER TABLE t ADD [COLUMN] [IF NOT EXISTS] col TYPE [NOT NULL] [DEFAULT v]
+//	INSERT [IGNORE] INTO t SET col=v, ... [ON DUPLICATE KEY UPDATE col=VALUES(col) | col=v, ...]
+//	INSERT [IGNORE] INTO t (col, ...) VALUES (v, ...) [ON DUPLICATE KEY UPDATE ...]
+//	REPLACE INTO t SET col=v, ...
+//	UPDATE t SET col=v, ... [WHERE col=v [AND col=v ...]]
+//	DELETE FROM t [WHERE col=v [AND col=v ...]]
+//	TRUNCATE TABLE t
+//
+// Values are stored as strings. As in MySQL strict mode, inserting a row
+// without a value for a NOT NULL column without a default is an error,
+// unless the insert is IGNORE.
+type DB struct {
+	mu      sync.Mutex
+	tables  map[string]*table
+	queries []string
+}
+
+// New returns an empty DB.
+func New() *DB {
+	return &DB{tables: make(map[string]*table)}
+}
+
+var (
+	_ tablerow.Consumer   = (*DB)(nil)
+	_ tablerow.TxConsumer = (*DB)(nil)
+)
+
+// Consume executes query.
+func (db *DB) Consume(query string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.queries = append(db.queries, query)
+	toks, err := tokenize(query)
+	if err != nil {
+		return fmt.Errorf("%w in %q", err, query)
+	}
+	p := &parser{toks: toks}
+	if err := db.exec(p); err != nil {
+		return fmt.Errorf("%w in %q", err, query)
+	}
+	return nil
+}
+
+// ConsumeTx executes the queries in one transaction: if one fails, the
+// tables are restored to their state before the first.
+func (db *DB) ConsumeTx(queries ...string) error {
+	db.mu.Lock()
+	saved := db.snapshot()
+	db.mu.Unlock()
+
+	for _, query := range queries {
+		if err := db.Consume(query); err != nil {
+			db.mu.Lock()
+			db.tables = saved
+			db.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of the tables. The caller must hold mu.
+func (db *DB) snapshot() map[string]*table {
+	tables := make(map[string]*table, len(db.tables))
+	for name, t := range db.tables {
+		c := *t
+		c.rows = make(map[string]Row, len(t.rows))
+		for k, r := range t.rows {
+			row := Row{}
+			for col, v := range r {
+				row[col] = v
+			}
+			c.rows[k] = row
+		}
+		tables[name] = &c
+	}
+	return tables
+}
+
+// Queries returns the statements executed so far.
+func (db *DB) Queries() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]string(nil), db.queries...)
+}
+
+// Rows returns the rows of the named table ordered by primary key. It
+// returns nil if the table does not exist.
+func (db *DB) Rows(name string) []Row {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(t.rows))
+	for k := range t.rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([]Row, 0, len(keys))
+	for _, k := range keys {
+		r := Row{}
+		for col, v := range t.rows[k] {
+			r[col] = v
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func (db *DB) table(name string) (*table, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("table %q doesn't exist", name)
+	}
+	return t, nil
+}
+
+func (db *DB) exec(p *parser) error {
+	switch {
+	case p.keyword("CREATE"):
+		return db.create(p)
+	case p.keyword("ALTER"):
+		return db.alter(p)
+	case p.keyword("INSERT"):
+		ignore := p.keyword("IGNORE")
+		if err := p.expectKeyword("INTO"); err != nil {
+			return err
+		}
+		return db.insert(p, ignore, false)
+	case p.keyword("REPLACE"):
+		if err := p.expectKeyword("INTO"); err != nil {
+			return err
+		}
+		return db.insert(p, false, true)
+	case p.keyword("UPDATE"):
+		return db.update(p)
+	case p.keyword("DELETE"):
+		if err := p.expectKeyword("FROM"); err != nil {
+			return err
+		}
+		return db.delete(p)
+	case p.keyword("TRUNCATE"):
+		p.keyword("TABLE")
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		t, err := db.table(name)
+		if err != nil {
+			return err
+		}
+		t.rows = make(map[string]Row)
+		return p.end()
+	}
+	return fmt.Errorf("unsupported statement at %q", p.peek().text)
+}
+
+func (db *DB) create(p *parser) error {
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return err
+	}
+	ifNotExists := p.keyword("IF")
+	if ifNotExists {
+		if err := p.expectKeyword("NOT"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return err
+		}
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t := &table{name: name, rows: make(map[string]Row)}
+	if err := p.expectPunct("("); err != nil {
+		return err
+	}
+	for {
+		switch {
+		case p.keyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return err
+			}
+			if t.primary, err = p.identList(); err != nil {
+				return err
+			}
+		default:
+			c, err := p.columnDef()
+			if err != nil {
+				return err
+			}
+			t.columns = append(t.columns, c)
+		}
+		if p.punct(")") {
+			break
+		}
+		if err := p.expectPunct(","); err != nil {
+			return err
+		}
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+	if len(t.primary) == 0 {
+		return fmt.Errorf("table %q has no primary key", name)
+	}
+	if _, exists := db.tables[strings.ToLower(name)]; exists {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %q already exists", name)
+	}
+	db.tables[strings.ToLower(name)] = t
+	return nil
+}
+
+// alter adds a column to a table, giving the existing rows its default.
+func (db *DB) alter(p *parser) error {
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t, err := db.table(name)
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("ADD"); err != nil {
+		return err
+	}
+	p.keyword("COLUMN")
+	ifNotExists := p.keyword("IF")
+	if ifNotExists {
+		if err := p.expectKeyword("NOT"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return err
+		}
+	}
+	c, err := p.columnDef()
+	if err != nil {
+		return err
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+	if _, exists := t.column(c.name); exists {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("duplicate column name %q", c.name)
+	}
+	if c.notNull && !c.hasDefault && len(t.rows) > 0 {
+		return fmt.Errorf("column %q is NOT NULL without a default", c.name)
+	}
+	t.columns = append(t.columns, c)
+	for _, r := range t.rows {
+		if c.def != nil {
+			r[c.name] = *c.def
+		}
+	}
+	return nil
+}
+
+// assignment is col=value or col=VALUES(col).
+type assignment struct {
+	col    string
+	value  *string
+	values string
+}
+
+func (db *DB) insert(p *parser, ignore, replace bool) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t, err := db.table(name)
+	if err != nil {
+		return err
+	}
+
+	var set []assignment
+	if p.keyword("SET") {
+		if set, err = p.assignments(); err != nil {
+			return err
+		}
+	} else {
+		cols, err := p.identList()
+		if err != nil {
+			return err
+		}
+		if err := p.expectKeyword("VALUES"); err != nil {
+			return err
+		}
+		vals, err := p.valueList()
+		if err != nil {
+			return err
+		}
+		if len(cols) != len(vals) {
+			return fmt.Errorf("column count doesn't match value count")
+		}
+		for i := range cols {
+			set = append(set, assignment{col: cols[i], value: vals[i]})
+		}
+	}
+	var onDuplicate []assignment
+	if p.keyword("ON") {
+		for _, kw := range []string{"DUPLICATE", "KEY", "UPDATE"} {
+			if err := p.expectKeyword(kw); err != nil {
+				return err
+			}
+		}
+		if onDuplicate, err = p.assignments(); err != nil {
+			return err
+		}
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+
+	row := Row{}
+	given := map[string]bool{}
+	for _, a := range set {
+		c, ok := t.column(a.col)
+		if !ok {
+			return fmt.Errorf("unknown column %q", a.col)
+		}
+		if a.value == nil && c.notNull {
+			return fmt.Errorf("column %q cannot be null", c.name)
+		}
+		setValue(row, c.name, a.value)
+		given[c.name] = true
+	}
+	for _, c := range t.columns {
+		if given[c.name] {
+			continue
+		}
+		switch {
+		case c.hasDefault:
+			setValue(row, c.name, c.def)
+		case !c.notNull:
+		case ignore:
+			row[c.name] = ""
+		default:
+			return fmt.Errorf("field %q doesn't have a default value", c.name)
+		}
+	}
+
+	key := t.key(row)
+	existing, exists := t.rows[key]
+	switch {
+	case !exists || replace:
+		t.rows[key] = row
+	case onDuplicate != nil:
+		updated := Row{}
+		for col, v := range existing {
+			updated[col] = v
+		}
+		for _, a := range onDuplicate {
+			c, ok := t.column(a.col)
+			if !ok {
+				return fmt.Errorf("unknown column %q", a.col)
+			}
+			if a.values != "" {
+				src, ok := t.column(a.values)
+				if !ok {
+					return fmt.Errorf("unknown column %q", a.values)
+				}
+				v, set := row[src.name]
+				if !set {
+					delete(updated, c.name)
+					continue
+				}
+				updated[c.name] = v
+				continue
+			}
+			setValue(updated, c.name, a.value)
+		}
+		delete(t.rows, key)
+		t.rows[t.key(updated)] = updated
+	case ignore:
+	default:
+		return fmt.Errorf("duplicate entry %q for key PRIMARY", strings.ReplaceAll(key, "\x00", "-"))
+	}
+	return nil
+}
+
+func (db *DB) update(p *parser) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t, err := db.table(name)
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return err
+	}
+	set, err := p.assignments()
+	if err != nil {
+		return err
+	}
+	where, err := p.where()
+	if err != nil {
+		return err
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+	for _, a := range append(set, where...) {
+		if _, ok := t.column(a.col); !ok {
+			return fmt.Errorf("unknown column %q", a.col)
+		}
+	}
+	var matched []string
+	for key, row := range t.rows {
+		if t.matches(row, where) {
+			matched = append(matched, key)
+		}
+	}
+	for _, key := range matched {
+		row := t.rows[key]
+		for _, a := range set {
+			c, _ := t.column(a.col)
+			setValue(row, c.name, a.value)
+		}
+		if newKey := t.key(row); newKey != key {
+			delete(t.rows, key)
+			t.rows[newKey] = row
+		}
+	}
+	return nil
+}
+
+func (db *DB) delete(p *parser) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t, err := db.table(name)
+	if err != nil {
+		return err
+	}
+	where, err := p.where()
+	if err != nil {
+		return err
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+	for _, a := range where {
+		if _, ok := t.column(a.col); !ok {
+			return fmt.Errorf("unknown column %q", a.col)
+		}
+	}
+	for key, row := range t.rows {
+		if t.matches(row, where) {
+			delete(t.rows, key)
+		}
+	}
+	return nil
+}
+
+func (t *table) matches(row Row, where []assignment) bool {
+	for _, a := range where {
+		c, _ := t.column(a.col)
+		v, set := row[c.name]
+		if a.value == nil || !set || v != *a.value {
+			return false
+		}
+	}
+	return true
+}
+
+func setValue(row Row, col string, v *string) {
+	if v == nil {
+		delete(row, col)
+		return
+	}
+	row[col] = *v
+}
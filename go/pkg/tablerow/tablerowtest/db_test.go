@@ -0,0 +1,91 @@
+package tablerowtest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"nathejk.dk/pkg/tablerow"
+	"nathejk.dk/pkg/tablerow/tablerowtest"
+)
+
+const schema = "CREATE TABLE IF NOT EXISTS t (id VARCHAR(99) NOT NULL, year VARCHAR(9) NOT NULL, name VARCHAR(99) NOT NULL DEFAULT \"\", note VARCHAR(99), `count` INT NOT NULL, PRIMARY KEY (year, id));"
+
+func TestDB(t *testing.T) {
+	assert := assert.New(t)
+
+	db := tablerowtest.New()
+	assert.NoError(db.Consume(schema))
+	assert.NoError(db.Consume(schema))
+
+	assert.NoError(db.Consume(`INSERT INTO t SET id="b", year="2024", count=1`))
+	assert.NoError(db.Consume("INSERT INTO t (id, year, name, `count`) VALUES ('a', '2024', 'it\\'s \\\"A\\\"', 2)"))
+	assert.Equal([]tablerowtest.Row{
+		{"id": "a", "year": "2024", "name": `it's "A"`, "count": "2"},
+		{"id": "b", "year": "2024", "name": "", "count": "1"},
+	}, db.Rows("t"))
+
+	assert.Error(db.Consume(`INSERT INTO t SET id="a", year="2024", count=3`), "duplicate key")
+	assert.Error(db.Consume(`INSERT INTO t SET id="c", year="2024"`), "NOT NULL without default")
+	assert.NoError(db.Consume(`INSERT IGNORE INTO t SET id="a", year="2024", count=3`))
+	assert.Equal("2", db.Rows("t")[0]["count"])
+
+	assert.NoError(db.Consume(`INSERT INTO t SET id="a", year="2024", name="x", note="n", count=3 ON DUPLICATE KEY UPDATE note=VALUES(note), count=VALUES(count)`))
+	assert.Equal(tablerowtest.Row{"id": "a", "year": "2024", "name": `it's "A"`, "note": "n", "count": "3"}, db.Rows("t")[0])
+
+	assert.NoError(db.Consume(`UPDATE t SET note=NULL, name="y" WHERE id="a" AND year="2024"`))
+	assert.Equal(tablerowtest.Row{"id": "a", "year": "2024", "name": "y", "count": "3"}, db.Rows("t")[0])
+
+	assert.NoError(db.Consume(`REPLACE INTO t SET id="b", year="2024", count=5`))
+	assert.Equal("5", db.Rows("t")[1]["count"])
+
+	assert.NoError(db.Consume(`DELETE FROM t WHERE id="a"`))
+	assert.Len(db.Rows("t"), 1)
+	assert.NoError(db.Consume(`TRUNCATE TABLE t`))
+	assert.Empty(db.Rows("t"))
+
+	assert.Error(db.Consume(`UPDATE unknown SET a=1`))
+	assert.Error(db.Consume(`UPDATE t SET unknown=1`))
+	assert.Error(db.Consume(`SELECT * FROM t`))
+	assert.Nil(db.Rows("unknown"))
+	assert.Len(db.Queries(), 15)
+}
+
+func TestDBAlter(t *testing.T) {
+	assert := assert.New(t)
+
+	db := tablerowtest.New()
+	assert.NoError(db.Consume(schema))
+	assert.NoError(db.Consume(`INSERT INTO t SET id="a", year="2024", count=1`))
+
+	assert.NoError(db.Consume(`ALTER TABLE t ADD COLUMN IF NOT EXISTS label VARCHAR(9) NOT NULL DEFAULT ""`))
+	assert.NoError(db.Consume(`ALTER TABLE t ADD COLUMN IF NOT EXISTS label VARCHAR(9) NOT NULL DEFAULT ""`))
+	assert.Error(db.Consume(`ALTER TABLE t ADD label VARCHAR(9)`), "duplicate column")
+	assert.Error(db.Consume(`ALTER TABLE t ADD other VARCHAR(9) NOT NULL`), "NOT NULL without default")
+	assert.Equal(tablerowtest.Row{"id": "a", "year": "2024", "name": "", "count": "1", "label": ""}, db.Rows("t")[0])
+
+	assert.NoError(db.Consume(`UPDATE t SET label="x" WHERE id="a"`))
+	assert.Equal("x", db.Rows("t")[0]["label"])
+}
+
+func TestDBConsumeTx(t *testing.T) {
+	assert := assert.New(t)
+
+	db := tablerowtest.New()
+	assert.NoError(db.Consume(schema))
+	assert.NoError(tablerow.ConsumeAll(db,
+		`INSERT INTO t SET id="a", year="2024", count=1`,
+		`INSERT INTO t SET id="b", year="2024", count=2`,
+	))
+	assert.Len(db.Rows("t"), 2)
+
+	// the second insert fails, so the update of the first is rolled back
+	assert.Error(tablerow.ConsumeAll(db,
+		`UPDATE t SET count=3 WHERE id="a"`,
+		`INSERT INTO t SET id="b", year="2024", count=4`,
+	))
+	assert.Equal([]tablerowtest.Row{
+		{"id": "a", "year": "2024", "name": "", "count": "1"},
+		{"id": "b", "year": "2024", "name": "", "count": "2"},
+	}, db.Rows("t"))
+}
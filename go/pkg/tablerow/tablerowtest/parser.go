@@ -0,0 +1,315 @@
+package tablerowtest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits a statement into identifiers, quoted identifiers, string
+// and number literals and punctuation. Strings may be quoted with ' or ", and
+// use MySQL backslash escapes.
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '`':
+			j := strings.IndexByte(s[i+1:], '`')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated identifier")
+			}
+			toks = append(toks, token{tokIdent, s[i+1 : i+1+j]})
+			i += j + 2
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					switch s[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					case '0':
+						b.WriteByte(0)
+					default:
+						b.WriteByte(s[j])
+					}
+					continue
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, token{tokString, b.String()})
+			i = j + 1
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j]})
+			i = j
+		case strings.IndexByte("(),=;*", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tokEOF}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the next token if it is the keyword kw.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return fmt.Errorf("expected %s at %q", kw, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.punct(s) {
+		return fmt.Errorf("expected %q at %q", s, p.peek().text)
+	}
+	return nil
+}
+
+// end expects the end of the statement, optionally after a semicolon.
+func (p *parser) end() error {
+	p.punct(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return fmt.Errorf("unexpected %q", t.text)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", fmt.Errorf("expected identifier at %q", t.text)
+	}
+	return t.text, nil
+}
+
+// identList parses "(a, b, ...)".
+func (p *parser) identList() ([]string, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for {
+		id, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		if p.punct(")") {
+			return ids, nil
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// value parses a literal; NULL gives nil.
+func (p *parser) value() (*string, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokString || t.kind == tokNumber:
+		return &t.text, nil
+	case t.kind == tokIdent && strings.EqualFold(t.text, "NULL"):
+		return nil, nil
+	case t.kind == tokIdent && (strings.EqualFold(t.text, "TRUE") || strings.EqualFold(t.text, "FALSE")):
+		v := "0"
+		if strings.EqualFold(t.text, "TRUE") {
+			v = "1"
+		}
+		return &v, nil
+	}
+	return nil, fmt.Errorf("expected value at %q", t.text)
+}
+
+// valueList parses "(v, v, ...)".
+func (p *parser) valueList() ([]*string, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var vals []*string
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		if p.punct(")") {
+			return vals, nil
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// assignment parses "col=v" or "col=VALUES(col)".
+func (p *parser) assignment() (assignment, error) {
+	col, err := p.ident()
+	if err != nil {
+		return assignment{}, err
+	}
+	if err := p.expectPunct("="); err != nil {
+		return assignment{}, err
+	}
+	if p.keyword("VALUES") {
+		if err := p.expectPunct("("); err != nil {
+			return assignment{}, err
+		}
+		src, err := p.ident()
+		if err != nil {
+			return assignment{}, err
+		}
+		return assignment{col: col, values: src}, p.expectPunct(")")
+	}
+	v, err := p.value()
+	return assignment{col: col, value: v}, err
+}
+
+// assignments parses "a=v, b=v, ...".
+func (p *parser) assignments() ([]assignment, error) {
+	var as []assignment
+	for {
+		a, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+		if !p.punct(",") {
+			return as, nil
+		}
+	}
+}
+
+// where parses an optional "WHERE a=v [AND b=v ...]".
+func (p *parser) where() ([]assignment, error) {
+	if !p.keyword("WHERE") {
+		return nil, nil
+	}
+	var as []assignment
+	for {
+		a, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		if a.values != "" {
+			return nil, fmt.Errorf("VALUES() in WHERE")
+		}
+		as = append(as, a)
+		if !p.keyword("AND") {
+			return as, nil
+		}
+	}
+}
+
+// columnDef parses "name TYPE[(n)] [UNSIGNED] [NOT NULL | NULL] [DEFAULT v]".
+func (p *parser) columnDef() (column, error) {
+	name, err := p.ident()
+	if err != nil {
+		return column{}, err
+	}
+	c := column{name: name}
+	if _, err := p.ident(); err != nil {
+		return column{}, err
+	}
+	if p.punct("(") {
+		for !p.punct(")") {
+			if p.next().kind == tokEOF {
+				return column{}, fmt.Errorf("unterminated type of %q", name)
+			}
+		}
+	}
+	for {
+		switch {
+		case p.keyword("UNSIGNED"):
+		case p.keyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return column{}, err
+			}
+			c.notNull = true
+		case p.keyword("NULL"):
+		case p.keyword("DEFAULT"):
+			v, err := p.value()
+			if err != nil {
+				return column{}, err
+			}
+			c.hasDefault, c.def = true, v
+		default:
+			return c, nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package tablerowtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	pkgstreaminterface "nathejk.dk/pkg/streaminterface"
+	pkgstreamtest "nathejk.dk/pkg/streaminterface/streamtest"
+	"nathejk.dk/pkg/tablerow"
+	"nathejk.dk/superfluids/streaminterface"
+	"nathejk.dk/superfluids/streaminterface/streamtest"
+)
+
+// Event is an event given to a projection. Sequence is assigned in order
+// when left zero.
+type Event struct {
+	Subject  string
+	Time     time.Time
+	Sequence uint64
+	Body     any
+	Meta     any
+}
+
+// Projection is a table projection running on a DB.
+type Projection struct {
+	t      testing.TB
+	db     *DB
+	handle func(Event) error
+	seq    uint64
+}
+
+// NewProjection creates the table projection returned by newTable on an
+// empty DB, e.g.
+//
+//	p := tablerowtest.NewProjection(t, table.NewKlan)
+func NewProjection[H streaminterface.MessageHandler](t testing.TB, newTable func(tablerow.Consumer) H) *Projection {
+	t.Helper()
+	db := New()
+	h := newTable(db)
+	return &Projection{t: t, db: db, handle: func(e Event) error {
+		return h.HandleMessage(streamtest.NewMessageP(streaminterface.SubjectFromStr(e.Subject), streamtest.MessageData{
+			Time:     e.Time,
+			Sequence: e.Sequence,
+			Body:     e.Body,
+			Meta:     e.Meta,
+		}))
+	}}
+}
+
+// NewPkgProjection is NewProjection for projections handling messages of
+// the pkg/streaminterface package.
+func NewPkgProjection[H pkgstreaminterface.MessageHandler](t testing.TB, newTable func(tablerow.Consumer) H) *Projection {
+	t.Helper()
+	db := New()
+	h := newTable(db)
+	return &Projection{t: t, db: db, handle: func(e Event) error {
+		return h.HandleMessage(pkgstreamtest.NewMessageP(pkgstreaminterface.SubjectFromStr(e.Subject), pkgstreamtest.MessageData{
+			Time:     e.Time,
+			Sequence: e.Sequence,
+			Body:     e.Body,
+			Meta:     e.Meta,
+		}))
+	}}
+}
+
+// DB returns the database the projection writes to.
+func (p *Projection) DB() *DB {
+	return p.db
+}
+
+// Given hands events to the projection in order, failing the test if the
+// projection returns an error.
+func (p *Projection) Given(events ...Event) *Projection {
+	p.t.Helper()
+	for _, e := range events {
+		if e.Sequence == 0 {
+			e.Sequence = p.seq + 1
+		}
+		p.seq = e.Sequence
+		if err := p.handle(e); err != nil {
+			p.t.Fatalf("handle %q: %v", e.Subject, err)
+		}
+	}
+	return p
+}
+
+// ThenRows fails the test unless the table holds exactly the wanted rows,
+// ordered by primary key. Only the columns present in a wanted row are
+// compared; a column given as "" must be empty or NULL.
+func (p *Projection) ThenRows(table string, want ...Row) {
+	p.t.Helper()
+	got := p.db.Rows(table)
+	if got == nil {
+		p.t.Fatalf("table %q doesn't exist", table)
+	}
+	if len(got) != len(want) {
+		p.t.Fatalf("table %q has %d rows, want %d:\n%s", table, len(got), len(want), formatRows(got))
+	}
+	for i := range want {
+		for col, v := range want[i] {
+			if got[i][col] != v {
+				p.t.Errorf("table %q row %d: %s = %q, want %q\n%s", table, i, col, got[i][col], v, formatRows(got))
+			}
+		}
+	}
+}
+
+func formatRows(rows []Row) string {
+	var b strings.Builder
+	for i, r := range rows {
+		cols := make([]string, 0, len(r))
+		for col := range r {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		fmt.Fprintf(&b, "\t%d:", i)
+		for _, col := range cols {
+			fmt.Fprintf(&b, " %s=%q", col, r[col])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
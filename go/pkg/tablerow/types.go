@@ -16,6 +16,28 @@ type Consumer interface {
 	Consume(string) error
 }
 
+// TxConsumer is implemented by consumers that can execute several statements
+// in one transaction.
+type TxConsumer interface {
+	// ConsumeTx executes the queries in order, and either all or none of
+	// them take effect.
+	ConsumeTx(queries ...string) error
+}
+
+// ConsumeAll executes the queries with w, in one transaction if w is a
+// TxConsumer.
+func ConsumeAll(w Consumer, queries ...string) error {
+	if tx, ok := w.(TxConsumer); ok {
+		return tx.ConsumeTx(queries...)
+	}
+	for _, query := range queries {
+		if err := w.Consume(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type SQLTableCreator interface {
 	CreateTableSql() string
 }
@@ -19,6 +19,10 @@ type message struct {
 	subject       streaminterface.Subject
 	body          json.RawMessage
 	meta          json.RawMessage
+
+	// expectedLastSubjectSequence, when set, makes Publish fail unless it is
+	// the sequence of the last message on the subject.
+	expectedLastSubjectSequence *uint64
 }
 
 func NewMessage() *message {
@@ -94,6 +98,13 @@ func (m *message) SetMeta(v interface{}) error {
 	return nil
 }
 
+// SetExpectedLastSubjectSequence makes publishing the message fail with
+// ErrWrongLastSequence if another message has been published on its subject
+// after seq. Zero expects no messages on the subject.
+func (m *message) SetExpectedLastSubjectSequence(seq uint64) {
+	m.expectedLastSubjectSequence = &seq
+}
+
 func (m *message) Subject() streaminterface.Subject {
 	return m.subject
 }
@@ -14,6 +14,10 @@ import (
 	"nathejk.dk/superfluids/streaminterface"
 )
 
+// ErrWrongLastSequence is returned by Publish when the message expected
+// another last sequence on its subject.
+var ErrWrongLastSequence = errors.New("wrong last sequence")
+
 var (
 	_ streaminterface.Stream = &stream{}
 	//_ StreamStatistics             = &stream{}
@@ -28,7 +32,7 @@ type stream struct {
 
 // https://github.com/nats-io/nats.go/blob/main/jetstream/README.md
 func New(url string) (*stream, error) {
-	s := stream{}
+	s := stream{ctx: context.Background()}
 
 	//url := os.Getenv("NATS_URL")
 	if url == "" {
@@ -83,13 +87,20 @@ type Identifiable interface {
 }
 
 func (s *stream) Publish(m streaminterface.Message) error {
+	_, err := s.PublishSequence(m)
+	return err
+}
+
+// PublishSequence publishes m like Publish, and returns the stream sequence
+// it was stored at.
+func (s *stream) PublishSequence(m streaminterface.Message) (uint64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	subject := fmt.Sprintf("%s.%s", strings.ToUpper(m.Subject().Domain()), m.Subject().Type())
 	ID, ok := m.(Identifiable)
 	if !ok {
-		return errors.New("Message does not implement 'Identifiable' interface")
+		return 0, errors.New("Message does not implement 'Identifiable' interface")
 	}
 	buf, err := json.Marshal(jetstreamMessage{
 		EventID:       ID.EventID(),
@@ -101,15 +112,23 @@ func (s *stream) Publish(m streaminterface.Message) error {
 		Meta:          m.RawMeta().(json.RawMessage),
 	})
 	if err != nil {
-		return errors.Wrap(err, "encode message")
+		return 0, errors.Wrap(err, "encode message")
 	}
 
-	ack, err := s.js.Publish(ctx, subject, buf)
+	opts := []jetstream.PublishOpt{}
+	if msg, ok := m.(*message); ok && msg.expectedLastSubjectSequence != nil {
+		opts = append(opts, jetstream.WithExpectLastSequencePerSubject(*msg.expectedLastSubjectSequence))
+	}
+	ack, err := s.js.Publish(ctx, subject, buf, opts...)
+	var apiErr *jetstream.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+		return 0, fmt.Errorf("%w: %s", ErrWrongLastSequence, apiErr.Description)
+	}
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("publish message to %q", subject))
+		return 0, errors.Wrap(err, fmt.Sprintf("publish message to %q", subject))
 	}
 	log.Printf("Published message %#v", ack)
-	return nil
+	return ack.Sequence, nil
 }
 
 func (s *stream) LastMessage(subject streaminterface.Subject) (*message, error) {
@@ -177,6 +196,54 @@ func (s *stream) Subscribe(subjects []streaminterface.Subject, h streaminterface
 		})
 	*/
 }
+
+// ReadAll calls h with every message of the named stream, from the first to
+// the last message present when called, then returns.
+func (s *stream) ReadAll(ctx context.Context, name string, h streaminterface.MessageHandler) error {
+	js, err := s.js.Stream(ctx, name)
+	if err != nil {
+		return err
+	}
+	info, err := js.Info(ctx)
+	if err != nil {
+		return err
+	}
+	last := info.State.LastSeq
+	if info.State.Msgs == 0 {
+		return nil
+	}
+	consumer, err := js.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{})
+	if err != nil {
+		return err
+	}
+	for {
+		msgs, err := consumer.Fetch(100, jetstream.FetchMaxWait(5*time.Second))
+		if err != nil {
+			return err
+		}
+		count := 0
+		for msg := range msgs.Messages() {
+			count++
+			m, err := createMessage(msg)
+			if err != nil {
+				return err
+			}
+			if err := h.HandleMessage(m); err != nil {
+				return err
+			}
+			if m.Sequence() >= last {
+				return nil
+			}
+		}
+		if msgs.Error() != nil {
+			return msgs.Error()
+		}
+		if count == 0 {
+			return fmt.Errorf("timeout reading stream %q at sequence below %d", name, last)
+		}
+	}
+}
+
 func createMessage(msg jetstream.Msg) (*message, error) {
 	var data jetstreamMessage
 	if err := json.Unmarshal(msg.Data(), &data); err != nil {
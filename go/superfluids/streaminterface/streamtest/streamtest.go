@@ -50,9 +50,10 @@ func MessageFunc(subject streaminterface.Subject) streaminterface.MutableMessage
 }
 
 type MessageData struct {
-	Time time.Time
-	Body interface{}
-	Meta interface{}
+	Time     time.Time
+	Sequence uint64
+	Body     interface{}
+	Meta     interface{}
 }
 
 func NewMessageP(subject streaminterface.Subject, opts MessageData) *Message {
@@ -66,6 +67,7 @@ func NewMessageP(subject streaminterface.Subject, opts MessageData) *Message {
 	if err := m.SetTime(opts.Time); err != nil {
 		panic(err)
 	}
+	m.seq = opts.Sequence
 	return m
 }
 